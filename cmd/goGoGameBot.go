@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -12,10 +15,13 @@ import (
 	"github.com/chzyer/readline"
 	"github.com/spf13/pflag"
 
+	"awesome-dragon.science/go/goGoGameBot/internal/api"
 	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/discord"
 	"awesome-dragon.science/go/goGoGameBot/internal/game"
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
 	"awesome-dragon.science/go/goGoGameBot/internal/irc"
+	"awesome-dragon.science/go/goGoGameBot/internal/matrix"
 	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
 	"awesome-dragon.science/go/goGoGameBot/internal/version"
 	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
@@ -72,7 +78,17 @@ func main() {
 
 	logger.Infof("goGoGameBot version %s loading....", version.Version)
 
-	gm, err := getGameManager()
+	gm, conf, err := getGameManager()
+	if err != nil {
+		logger.Crit(err)
+	}
+
+	apiServer, err := startAPI(conf.API, gm)
+	if err != nil {
+		logger.Crit(err)
+	}
+
+	metricsServer, err := startMetrics(conf.Metrics, gm)
 	if err != nil {
 		logger.Crit(err)
 	}
@@ -86,6 +102,16 @@ func main() {
 		logger.Warnf("Got an error from bot on exit: %s", err)
 	}
 
+	if apiServer != nil {
+		if err := apiServer.Stop(); err != nil {
+			logger.Warnf("error while stopping API server: %s", err)
+		}
+	}
+
+	if metricsServer != nil {
+		_ = metricsServer.Close()
+	}
+
 	logger.Info("Goodbye")
 
 	if restart {
@@ -102,23 +128,77 @@ func main() {
 	_ = rl.Close()
 }
 
-func getGameManager() (*game.Manager, error) {
+func getGameManager() (*game.Manager, *tomlconf.Config, error) {
 	conf, err := tomlconf.GetConfig(*configFile)
 	if err != nil {
-		return nil, fmt.Errorf("could not read config file. Please ensure it exists and is correctly formatted: %w", err)
+		return nil, nil, fmt.Errorf(
+			"could not read config file. Please ensure it exists and is correctly formatted: %w", err,
+		)
 	}
 
-	conn, err := getConn(conf, logger)
+	conns := make(map[string]interfaces.Bot, len(conf.Connections))
+
+	for name, connConf := range conf.Connections {
+		conn, err := getConn(name, connConf, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Could not create connection %q: %w", name, err)
+		}
+
+		conns[name] = conn
+	}
+
+	gm, err := game.NewManager(conf, conns, logger.Clone().SetPrefix("GM"))
 	if err != nil {
-		return nil, fmt.Errorf("Could not create connection: %w", err)
+		return nil, nil, fmt.Errorf("could not create GameManager: %w", err)
+	}
+
+	return gm, conf, nil
+}
+
+// startAPI starts the HTTP admin API if it is enabled in the given config. It returns nil if the API is disabled
+func startAPI(conf tomlconf.API, gm *game.Manager) (*api.Server, error) {
+	if conf.Listen == "" {
+		return nil, nil
 	}
 
-	gm, err := game.NewManager(conf, conn, logger.Clone().SetPrefix("GM"))
+	server, err := api.New(conf, gm, logger.Clone().SetPrefix("API"))
 	if err != nil {
-		return nil, fmt.Errorf("could not create GameManager: %w", err)
+		return nil, err
+	}
+
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// startMetrics starts serving the game manager's metrics if enabled in the given config. It returns nil if metrics are
+// disabled
+func startMetrics(conf tomlconf.Metrics, gm *game.Manager) (*http.Server, error) {
+	if conf.Listen == "" {
+		return nil, nil
+	}
+
+	l, err := net.Listen("tcp", conf.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("could not start metrics listener: %w", err)
 	}
 
-	return gm, nil
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", gm.Metrics.Handler())
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: time.Second * 10}
+
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warnf("metrics server exited: %s", err)
+		}
+	}()
+
+	logger.Infof("serving metrics on %s", l.Addr())
+
+	return server, nil
 }
 
 func setupSignalHandler(gameManager *game.Manager) {
@@ -171,14 +251,26 @@ func runCLI(gm *game.Manager, rl *readline.Instance) {
 	}
 }
 
-func getConn(conf *tomlconf.Config, logger *log.Logger) (interfaces.Bot, error) {
-	switch strings.ToLower(conf.Connection.Type) {
+func getConn(name string, conf tomlconf.ConfigHolder, logger *log.Logger) (interfaces.Bot, error) {
+	prefix := func(p string) *log.Logger {
+		if name != tomlconf.DefaultConnection {
+			p += "|" + name
+		}
+
+		return logger.Clone().SetPrefix(p)
+	}
+
+	switch strings.ToLower(conf.Type) {
 	case "irc":
-		return irc.New(conf.Connection, logger.Clone().SetPrefix("IRC"))
+		return irc.New(conf, prefix("IRC"))
+	case "discord":
+		return discord.New(conf, prefix("Discord"))
+	case "matrix":
+		return matrix.New(conf, prefix("Matrix"))
 	case "null":
-		return nullconn.New(logger.Clone().SetPrefix("null")), nil
+		return nullconn.New(prefix("null")), nil
 	default:
-		return nil, fmt.Errorf("cannot resolve connType %q to a supported connection type", conf.Connection.Type)
+		return nil, fmt.Errorf("cannot resolve connType %q to a supported connection type", conf.Type)
 	}
 }
 
@@ -9,8 +9,10 @@ require (
 	github.com/chzyer/test v0.0.0-20180213035817-a1ea475d72b1 // indirect
 	github.com/davecgh/go-spew v1.1.1
 	github.com/dustin/go-humanize v1.0.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/goshuirc/irc-go v0.0.0-20200311142257-57fd157327ac
 	github.com/pelletier/go-toml v1.9.4
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/shirou/gopsutil v3.21.11+incompatible
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.3.0 // indirect
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/game"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+// Controller is the set of operations the API exposes. It is implemented by game.Manager
+type Controller interface {
+	StartGame(name string) error
+	StopGame(name string) error
+	RestartGame(name string) error
+	WriteToGame(name, line string) error
+	GameExists(name string) bool
+	Status() game.StatusReport
+	Reload() error
+	Stop(msg string, restart bool)
+	SubscribeOutput(name string) (<-chan game.OutputLine, func())
+}
+
+// keepAliveInterval is how often a comment is sent on idle output streams, to stop proxies closing them
+var keepAliveInterval = time.Second * 30
+
+// Server is an HTTP server exposing a Controller
+type Server struct {
+	ctrl   Controller
+	token  string
+	log    *log.Logger
+	server *http.Server
+	ctx    context.Context
+	cancel context.CancelFunc // Cancels ctx, ending any open streams
+}
+
+// New creates a new Server with the given config. It does not start listening until Start is called
+func New(conf tomlconf.API, ctrl Controller, logger *log.Logger) (*Server, error) {
+	if conf.Token == "" {
+		return nil, errors.New("cannot create an API server without a token")
+	}
+
+	s := &Server{ctrl: ctrl, token: conf.Token, log: logger}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.server = &http.Server{
+		Addr:              conf.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: time.Second * 10,
+		BaseContext:       func(net.Listener) context.Context { return s.ctx },
+	}
+
+	return s, nil
+}
+
+// Handler returns the http.Handler for the API, with authentication applied
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/status", s.onlyMethod(http.MethodGet, s.status))
+	mux.HandleFunc("/api/v1/reload", s.onlyMethod(http.MethodPost, s.reload))
+	mux.HandleFunc("/api/v1/shutdown", s.onlyMethod(http.MethodPost, s.shutdown))
+	mux.HandleFunc("/api/v1/games/", s.games)
+
+	return s.authenticate(mux)
+}
+
+// Start starts listening for requests in a goroutine. It returns an error if the listener could not be created
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("could not start API listener: %w", err)
+	}
+
+	s.log.Infof("API listening on %s", l.Addr())
+
+	go func() {
+		if err := s.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Warnf("API server exited: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the server, waiting a short time for in flight requests to complete
+func (s *Server) Stop() error {
+	s.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		// Browsers cannot set headers on EventSource requests, so allow the token as a query param on streams
+		if token == "" && strings.HasSuffix(r.URL.Path, "/stdout") {
+			token = r.URL.Query().Get("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) onlyMethod(method string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+
+			return
+		}
+
+		f(w, r)
+	}
+}
+
+type response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, response{Error: err.Error()})
+}
+
+// writeResult writes either a success response, or the given error with a status code matching it
+func writeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, response{OK: true})
+	case errors.Is(err, game.ErrGameNotExist):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, game.ErrAlreadyRunning), errors.Is(err, game.ErrGameNotRunning):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctrl.Status())
+}
+
+func (s *Server) reload(w http.ResponseWriter, _ *http.Request) {
+	writeResult(w, s.ctrl.Reload())
+}
+
+type shutdownRequest struct {
+	Message string `json:"message"`
+	Restart bool   `json:"restart"`
+}
+
+func (s *Server) shutdown(w http.ResponseWriter, r *http.Request) {
+	req := shutdownRequest{Message: "Stop requested"}
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeResult(w, nil)
+
+	// Stopping waits for games to exit, so respond before starting
+	go s.ctrl.Stop(req.Message, req.Restart)
+}
+
+// decodeBody decodes the request body into out, if there is one
+func decodeBody(r *http.Request, out interface{}) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+type rawRequest struct {
+	Line string `json:"line"`
+}
+
+// games handles all requests to /api/v1/games/<name>/<action>
+func (s *Server) games(w http.ResponseWriter, r *http.Request) {
+	split := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/games/"), "/")
+	if len(split) != 2 || split[0] == "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	name, action := split[0], split[1]
+
+	if action == "stdout" {
+		s.onlyMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.stream(w, r, name) })(w, r)
+		return
+	}
+
+	var f func() error
+
+	switch action {
+	case "start":
+		f = func() error { return s.ctrl.StartGame(name) }
+	case "stop":
+		f = func() error { return s.ctrl.StopGame(name) }
+	case "restart":
+		f = func() error { return s.ctrl.RestartGame(name) }
+	case "raw":
+		f = func() error {
+			req := rawRequest{}
+			if err := decodeBody(r, &req); err != nil || req.Line == "" {
+				return errBadRaw
+			}
+
+			return s.ctrl.WriteToGame(name, req.Line)
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action %q", action))
+		return
+	}
+
+	s.onlyMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		err := f()
+		if errors.Is(err, errBadRaw) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		writeResult(w, err)
+	})(w, r)
+}
+
+var errBadRaw = errors.New(`raw requires a JSON body with a non-empty "line"`)
+
+// stream sends the named game's output as server sent events until the client goes away
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, name string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	if name != "*" && !s.ctrl.GameExists(name) {
+		writeError(w, http.StatusNotFound, game.ErrGameNotExist)
+		return
+	}
+
+	if name == "*" {
+		name = ""
+	}
+
+	lines, cancel := s.ctrl.SubscribeOutput(name)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-ticker.C:
+			_, _ = fmt.Fprint(w, ": keepalive\n\n")
+
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(line)
+			if err != nil {
+				s.log.Warnf("could not marshal output line: %s", err)
+				continue
+			}
+
+			_, _ = fmt.Fprintf(w, "event: line\ndata: %s\n\n", data)
+		}
+
+		flusher.Flush()
+	}
+}
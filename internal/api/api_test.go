@@ -0,0 +1,318 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/game"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+const testToken = "secret"
+
+type fakeController struct {
+	mu      sync.Mutex
+	calls   []string
+	running map[string]bool
+	stopped chan struct{}
+	output  chan game.OutputLine
+}
+
+func newFakeController() *fakeController {
+	return &fakeController{
+		running: map[string]bool{"running": true, "stopped": false},
+		stopped: make(chan struct{}, 1),
+		output:  make(chan game.OutputLine, 10),
+	}
+}
+
+func (f *fakeController) record(call string) {
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+}
+
+func (f *fakeController) check(name string, wantRunning bool) error {
+	running, exists := f.running[name]
+
+	switch {
+	case !exists:
+		return game.ErrGameNotExist
+	case running && !wantRunning:
+		return game.ErrAlreadyRunning
+	case !running && wantRunning:
+		return game.ErrGameNotRunning
+	}
+
+	return nil
+}
+
+func (f *fakeController) StartGame(name string) error {
+	f.record("start " + name)
+	return f.check(name, false)
+}
+
+func (f *fakeController) StopGame(name string) error {
+	f.record("stop " + name)
+	return f.check(name, true)
+}
+
+func (f *fakeController) RestartGame(name string) error {
+	f.record("restart " + name)
+	return f.check(name, true)
+}
+
+func (f *fakeController) WriteToGame(name, line string) error {
+	f.record("raw " + name + " " + line)
+	return f.check(name, true)
+}
+
+func (f *fakeController) GameExists(name string) bool {
+	_, exists := f.running[name]
+	return exists
+}
+
+func (f *fakeController) Status() game.StatusReport {
+	return game.StatusReport{
+		System:      "stats",
+		Connections: map[string]string{"default": "connected"},
+		Games:       []game.GameStatus{{Name: "running", Running: true, Status: "running"}},
+	}
+}
+
+func (f *fakeController) Reload() error {
+	f.record("reload")
+	return nil
+}
+
+func (f *fakeController) Stop(msg string, restart bool) {
+	if restart {
+		msg += " (restart)"
+	}
+
+	f.record("shutdown " + msg)
+	f.stopped <- struct{}{}
+}
+
+func (f *fakeController) SubscribeOutput(name string) (<-chan game.OutputLine, func()) {
+	f.record("subscribe " + name)
+	return f.output, func() {}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *fakeController) {
+	t.Helper()
+
+	ctrl := newFakeController()
+
+	s, err := New(
+		tomlconf.API{Token: testToken}, ctrl, log.New(log.FTimestamp, os.Stdout, "TEST", log.INFO),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(s.Handler()), ctrl
+}
+
+func doRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(tomlconf.API{Listen: "127.0.0.1:0"}, newFakeController(), nil); err == nil {
+		t.Error("New() did not error without a token")
+	}
+}
+
+func TestServer_Handler(t *testing.T) {
+	server, ctrl := newTestServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		body      string
+		wantCode  int
+		wantCall  string
+		wantError bool
+	}{
+		{name: "no token", method: "GET", path: "/api/v1/status", wantCode: 401, wantError: true},
+		{name: "bad token", method: "GET", path: "/api/v1/status", token: "wrong", wantCode: 401, wantError: true},
+		{name: "status", method: "GET", path: "/api/v1/status", token: testToken, wantCode: 200},
+		{
+			name: "status bad method", method: "POST", path: "/api/v1/status", token: testToken,
+			wantCode: 405, wantError: true,
+		},
+		{name: "reload", method: "POST", path: "/api/v1/reload", token: testToken, wantCode: 200, wantCall: "reload"},
+		{
+			name: "start", method: "POST", path: "/api/v1/games/stopped/start", token: testToken,
+			wantCode: 200, wantCall: "start stopped",
+		},
+		{
+			name: "start running", method: "POST", path: "/api/v1/games/running/start", token: testToken,
+			wantCode: 409, wantCall: "start running", wantError: true,
+		},
+		{
+			name: "stop", method: "POST", path: "/api/v1/games/running/stop", token: testToken,
+			wantCode: 200, wantCall: "stop running",
+		},
+		{
+			name: "stop missing", method: "POST", path: "/api/v1/games/missing/stop", token: testToken,
+			wantCode: 404, wantCall: "stop missing", wantError: true,
+		},
+		{
+			name: "restart", method: "POST", path: "/api/v1/games/running/restart", token: testToken,
+			wantCode: 200, wantCall: "restart running",
+		},
+		{
+			name: "raw", method: "POST", path: "/api/v1/games/running/raw", token: testToken,
+			body: `{"line": "say hi"}`, wantCode: 200, wantCall: "raw running say hi",
+		},
+		{
+			name: "raw no body", method: "POST", path: "/api/v1/games/running/raw", token: testToken,
+			wantCode: 400, wantError: true,
+		},
+		{
+			name: "start with get", method: "GET", path: "/api/v1/games/stopped/start", token: testToken,
+			wantCode: 405, wantError: true,
+		},
+		{
+			name: "unknown action", method: "POST", path: "/api/v1/games/running/explode", token: testToken,
+			wantCode: 404, wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl.mu.Lock()
+			ctrl.calls = nil
+			ctrl.mu.Unlock()
+
+			res := doRequest(t, tt.method, server.URL+tt.path, tt.token, tt.body)
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.wantCode {
+				t.Errorf("status code = %d, want %d", res.StatusCode, tt.wantCode)
+			}
+
+			body := map[string]interface{}{}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("could not decode response: %s", err)
+			}
+
+			if _, hasErr := body["error"]; hasErr != tt.wantError {
+				t.Errorf("response %v has error = %t, want %t", body, hasErr, tt.wantError)
+			}
+
+			ctrl.mu.Lock()
+			defer ctrl.mu.Unlock()
+
+			if tt.wantCall != "" && (len(ctrl.calls) != 1 || ctrl.calls[0] != tt.wantCall) {
+				t.Errorf("controller calls = %q, want [%q]", ctrl.calls, tt.wantCall)
+			}
+		})
+	}
+}
+
+func TestServer_shutdown(t *testing.T) {
+	server, ctrl := newTestServer(t)
+	defer server.Close()
+
+	res := doRequest(t, "POST", server.URL+"/api/v1/shutdown", testToken, `{"message": "bye", "restart": true}`)
+	res.Body.Close()
+
+	if res.StatusCode != 200 {
+		t.Errorf("status code = %d, want 200", res.StatusCode)
+	}
+
+	select {
+	case <-ctrl.stopped:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Stop was not called")
+	}
+
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+
+	if len(ctrl.calls) != 1 || ctrl.calls[0] != "shutdown bye (restart)" {
+		t.Errorf("controller calls = %q", ctrl.calls)
+	}
+}
+
+func TestServer_stream(t *testing.T) {
+	server, ctrl := newTestServer(t)
+	defer server.Close()
+
+	// Query tokens are only allowed on streams
+	res := doRequest(t, "GET", server.URL+"/api/v1/games/running/stdout?token="+testToken, "", "")
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		t.Fatalf("status code = %d, want 200", res.StatusCode)
+	}
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	ctrl.output <- game.OutputLine{Game: "running", Stdout: true, Line: "hello"}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "data: ") {
+			continue
+		}
+
+		line := game.OutputLine{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data: ")), &line); err != nil {
+			t.Fatal(err)
+		}
+
+		if line.Line != "hello" || line.Game != "running" || !line.Stdout {
+			t.Errorf("streamed line = %#v", line)
+		}
+
+		break
+	}
+
+	missing := doRequest(t, "GET", server.URL+"/api/v1/games/missing/stdout", testToken, "")
+	missing.Body.Close()
+
+	if missing.StatusCode != 404 {
+		t.Errorf("stream for a missing game status code = %d, want 404", missing.StatusCode)
+	}
+
+	noQueryToken := doRequest(t, "GET", server.URL+"/api/v1/status?token="+testToken, "", "")
+	noQueryToken.Body.Close()
+
+	if noQueryToken.StatusCode != 401 {
+		t.Errorf("query token on a non-stream endpoint status code = %d, want 401", noQueryToken.StatusCode)
+	}
+}
@@ -0,0 +1,2 @@
+// Package api contains an HTTP API for controlling a game.Manager, for use by dashboards and scripts
+package api
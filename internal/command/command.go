@@ -25,10 +25,18 @@ type SingleCommand struct {
 	callback      Callback
 	help          string
 	name          string
+	node          string // the name used for the command in Permissions, eg gamectl.start
+	game          string // the game the command belongs to, if any
+	perGame       bool   // whether the command acts on games named in its arguments
 }
 
 // Fire executes the callback on the command if the caller has the permissions required
 func (c *SingleCommand) Fire(data *Data) {
+	data.node = c.node
+	data.game = c.game
+	data.perGame = c.perGame
+	data.adminRequired = c.adminRequired
+
 	if data.CheckPerms(c.adminRequired) {
 		c.callback(data)
 	}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"fmt"
 	"strings"
 
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
@@ -15,6 +16,11 @@ type Data struct {
 	Target       string
 	Manager      *Manager
 	util         DataUtil
+
+	node          string
+	game          string
+	perGame       bool
+	adminRequired int
 }
 
 // DataUtil provides methods for Data to use when returning messages or checking admin levels
@@ -23,11 +29,37 @@ type DataUtil interface {
 	interfaces.Messager
 }
 
-const notAllowed = "You are not permitted to use this command"
+const (
+	notAllowed       = "You are not permitted to use this command"
+	notAllowedOnGame = "You are not permitted to use this command on %q"
+)
+
+// permitted checks the Manager's Permissions for the source user, falling back to checking that their admin level is at
+// or above requiredLevel if no role covers the command
+func (d *Data) permitted(requiredLevel int, game string, anyGame bool) bool {
+	if d.FromTerminal {
+		return true
+	}
 
-// CheckPerms verifies that the admin level of the source user is at or above the requiredLevel
+	if d.Manager != nil {
+		account := ""
+		if namer, ok := d.util.(AccountNamer); ok {
+			account = namer.AccountName(d.Source)
+		}
+
+		if allowed, decided := d.Manager.Permissions().Check(d.Source, account, d.node, game, anyGame); decided {
+			return allowed
+		}
+	}
+
+	return d.util.AdminLevel(d.Source) >= requiredLevel
+}
+
+// CheckPerms verifies that the source user is allowed to use the command, either by a role or by having an admin level
+// at or above the requiredLevel. Commands that act on games named in their arguments are allowed here if the user may
+// use them on any game, and must check each game with CheckGamePerms
 func (d *Data) CheckPerms(requiredLevel int) bool {
-	if d.FromTerminal || d.util.AdminLevel(d.Source) >= requiredLevel {
+	if d.permitted(requiredLevel, d.game, d.perGame) {
 		return true
 	}
 
@@ -36,6 +68,17 @@ func (d *Data) CheckPerms(requiredLevel int) bool {
 	return false
 }
 
+// CheckGamePerms verifies that the source user is allowed to use the command on the named game
+func (d *Data) CheckGamePerms(game string) bool {
+	if d.permitted(d.adminRequired, game, false) {
+		return true
+	}
+
+	d.ReturnNotice(fmt.Sprintf(notAllowedOnGame, game))
+
+	return false
+}
+
 // SendNotice sends an IRC notice to the given target with the given message
 func (d *Data) SendNotice(target, msg string) { d.util.SendNotice(target, msg) }
 
@@ -32,6 +32,28 @@ type Manager struct {
 	commandPrefixes []string
 	prefixFunc      prefixFunc
 	Logger          *log.Logger
+
+	invocationMutex sync.Mutex
+	invocations     map[string]uint64
+
+	permMutex   sync.RWMutex
+	permissions *Permissions
+}
+
+// SetPermissions sets the Permissions checked before admin levels when commands are fired. It is safe for concurrent
+// use
+func (m *Manager) SetPermissions(p *Permissions) {
+	m.permMutex.Lock()
+	m.permissions = p
+	m.permMutex.Unlock()
+}
+
+// Permissions returns the Permissions currently in use by the Manager. It may be nil
+func (m *Manager) Permissions() *Permissions {
+	m.permMutex.RLock()
+	defer m.permMutex.RUnlock()
+
+	return m.permissions
 }
 
 // AddPrefix adds a prefix to the command manager. It is not safe for concurrent use
@@ -67,6 +89,7 @@ func (m *Manager) AddCommand(name string, requiresAdmin int, callback Callback,
 		callback:      callback,
 		help:          help,
 		name:          strings.ToLower(name),
+		node:          strings.ToLower(name),
 	})
 }
 
@@ -119,6 +142,33 @@ func (m *Manager) getCommandByName(name string) Command {
 // the Manager, it is automatically added. Otherwise, if it DOES exist but is of the wrong type, AddSubCommand returns
 // an error
 func (m *Manager) AddSubCommand(rootName, name string, requiresAdmin int, callback Callback, help string) error {
+	return m.addSubCommand(rootName, &SingleCommand{
+		name: name, adminRequired: requiresAdmin, callback: callback, help: help,
+	})
+}
+
+// AddGameSubCommand is the same as AddSubCommand, but marks the command as belonging to the given game, which is used
+// as the root name. Permissions for the command are checked against the game
+func (m *Manager) AddGameSubCommand(game, name string, requiresAdmin int, callback Callback, help string) error {
+	return m.addSubCommand(game, &SingleCommand{
+		name: name, adminRequired: requiresAdmin, callback: callback, help: help, game: game,
+	})
+}
+
+// AddGameControlSubCommand is the same as AddSubCommand, but marks the command as acting on games named in its
+// arguments. Before the callback is fired, the caller is only checked for permission to use the command on any game.
+// The callback must call Data.CheckGamePerms for each game it acts on
+func (m *Manager) AddGameControlSubCommand(
+	rootName, name string, requiresAdmin int, callback Callback, help string,
+) error {
+	return m.addSubCommand(rootName, &SingleCommand{
+		name: name, adminRequired: requiresAdmin, callback: callback, help: help, perGame: true,
+	})
+}
+
+func (m *Manager) addSubCommand(rootName string, command *SingleCommand) error {
+	command.node = strings.ToLower(rootName + "." + command.name)
+
 	if m.getCommandByName(rootName) == nil {
 		err := m.internalAddCommand(&SubCommandList{
 			SingleCommand: SingleCommand{adminRequired: noAdmin, callback: nil, help: "", name: strings.ToLower(rootName)},
@@ -138,7 +188,7 @@ func (m *Manager) AddSubCommand(rootName, name string, requiresAdmin int, callba
 		return fmt.Errorf("command %s is not a command that can have subcommands", rootName)
 	}
 
-	return cmd.addSubcommand(&SingleCommand{name: name, adminRequired: requiresAdmin, callback: callback, help: help})
+	return cmd.addSubcommand(command)
 }
 
 // RemoveSubCommand removes the command referenced by name on rootName, if rootName is not a command with sub commands,
@@ -162,7 +212,19 @@ func (m *Manager) RemoveSubCommand(rootName, name string) error {
 	return realCmd.removeSubcmd(name)
 }
 
-func (m *Manager) stripPrefix(line string) (string, bool) {
+// PrefixChecker is implemented by DataUtils that have their own dynamic command prefixes, such as a bot's nick.
+// When the DataUtil passed to ParseLine implements it, it is checked before the Manager's own prefixFunc
+type PrefixChecker interface {
+	IsCommandPrefix(string) (string, bool)
+}
+
+func (m *Manager) stripPrefix(line string, util DataUtil) (string, bool) {
+	if checker, ok := util.(PrefixChecker); ok {
+		if res, ok := checker.IsCommandPrefix(line); ok {
+			return res, ok
+		}
+	}
+
 	if m.prefixFunc != nil {
 		if res, ok := m.prefixFunc(line); ok {
 			return res, ok
@@ -194,7 +256,7 @@ func (m *Manager) ParseLine(line string, fromTerminal bool, source, target strin
 
 	if !fromTerminal {
 		var ok bool
-		if line, ok = m.stripPrefix(line); !ok {
+		if line, ok = m.stripPrefix(line, util); !ok {
 			return
 		}
 	}
@@ -215,6 +277,14 @@ func (m *Manager) ParseLine(line string, fromTerminal bool, source, target strin
 		return
 	}
 
+	m.invocationMutex.Lock()
+	if m.invocations == nil {
+		m.invocations = make(map[string]uint64)
+	}
+
+	m.invocations[cmd.Name()]++
+	m.invocationMutex.Unlock()
+
 	data := &Data{
 		FromTerminal: fromTerminal,
 		Args:         lineSplit[1:],
@@ -227,6 +297,19 @@ func (m *Manager) ParseLine(line string, fromTerminal bool, source, target strin
 	cmd.Fire(data)
 }
 
+// Invocations returns the number of times each command has been invoked
+func (m *Manager) Invocations() map[string]uint64 {
+	m.invocationMutex.Lock()
+	defer m.invocationMutex.Unlock()
+
+	out := make(map[string]uint64, len(m.invocations))
+	for name, count := range m.invocations {
+		out[name] = count
+	}
+
+	return out
+}
+
 // String implements the stringer interface
 func (m *Manager) String() string {
 	var cmds []string
@@ -22,6 +22,7 @@ type mockMessager struct {
 	lastMessages [][2]string
 	lastNotices  [][2]string
 	admins       map[string]int
+	accounts     map[string]string
 }
 
 func getNick(source string) string {
@@ -63,6 +64,10 @@ func (m *mockMessager) AdminLevel(source string) int {
 	return 0
 }
 
+func (m *mockMessager) AccountName(source string) string {
+	return m.accounts[source]
+}
+
 func (m *mockMessager) AddAdmin(mask string, level int) {
 	m.checkMap()
 	m.admins[mask] = level
@@ -150,14 +155,14 @@ func TestManager_AddCommand(t *testing.T) {
 func TestManager_getCommandByName(t *testing.T) {
 	m := NewManager(baseLogger, nil)
 	existingCommand := &SingleCommand{
-		0,
-		nil,
-		"Helpful help is helpful",
-		"helpful",
+		adminRequired: 0,
+		callback:      nil,
+		help:          "Helpful help is helpful",
+		name:          "helpful",
 	}
 	existingSubCommand := &SubCommandList{
-		SingleCommand: SingleCommand{0, nil, "test is not doing, allah is doing", "test"},
-		subCommands:   map[string]Command{"test": &SingleCommand{0, nil, "lol", "test"}},
+		SingleCommand: SingleCommand{adminRequired: 0, help: "test is not doing, allah is doing", name: "test"},
+		subCommands:   map[string]Command{"test": &SingleCommand{adminRequired: 0, help: "lol", name: "test"}},
 	}
 	_ = m.internalAddCommand(existingCommand)
 	_ = m.internalAddCommand(existingSubCommand)
@@ -195,10 +200,10 @@ func TestManager_getCommandByName(t *testing.T) {
 
 func TestManager_AddSubCommand(t *testing.T) { //nolint:funlen // Its got the test data in it
 	sCmdManager := NewManager(baseLogger, nil)
-	_ = sCmdManager.internalAddCommand(&SingleCommand{0, nil, "single_command", "single"})
+	_ = sCmdManager.internalAddCommand(&SingleCommand{help: "single_command", name: "single"})
 	mCmdManager := NewManager(baseLogger, nil)
 	_ = mCmdManager.internalAddCommand(&SubCommandList{
-		SingleCommand: SingleCommand{0, nil, "baseCmd", "baseCmd"},
+		SingleCommand: SingleCommand{help: "baseCmd", name: "baseCmd"},
 		subCommands:   make(map[string]Command)},
 	)
 
@@ -560,3 +565,22 @@ func TestManager_AddAdmin(t *testing.T) {
 	}
 }
 */
+
+func TestManager_Invocations(t *testing.T) {
+	m := NewManager(baseLogger, nil, "~")
+	if err := m.AddCommand("test", 0, func(*Data) {}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	util := &mockMessager{}
+
+	m.ParseLine("~test", false, "someone!a@b", "#chan", util)
+	m.ParseLine("test args", true, "", "", util)
+	m.ParseLine("~unknown", false, "someone!a@b", "#chan", util)
+	m.ParseLine("no prefix", false, "someone!a@b", "#chan", util)
+
+	want := map[string]uint64{"test": 2}
+	if got := m.Invocations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Invocations() = %v, want %v", got, want)
+	}
+}
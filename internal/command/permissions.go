@@ -0,0 +1,177 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// AccountNamer is implemented by DataUtils that can look up the account a source is logged into. When the DataUtil
+// passed to ParseLine implements it, Permissions can match users by account
+type AccountNamer interface {
+	// AccountName returns the account the given source is logged into, or an empty string if there is none
+	AccountName(source string) string
+}
+
+// permission is a single allow or deny entry on a role
+type permission struct {
+	node *regexp.Regexp
+	game *regexp.Regexp // nil if the permission applies to all games
+}
+
+// globRegexp compiles an anchored, case insensitive regexp from the given glob
+func globRegexp(glob string) *regexp.Regexp {
+	return regexp.MustCompile("^(?i:" + util.GlobToRegexp(glob).String() + ")$")
+}
+
+func parsePermission(s string) permission {
+	node, game := s, ""
+	if idx := strings.LastIndex(s, "@"); idx != -1 {
+		node, game = s[:idx], s[idx+1:]
+	}
+
+	out := permission{node: globRegexp(node)}
+	if game != "" {
+		out.game = globRegexp(game)
+	}
+
+	return out
+}
+
+// matchesNode returns whether or not the permission covers the given command node. A permission for a command also
+// covers all of its subcommands
+func (p permission) matchesNode(node string) bool {
+	for {
+		if p.node.MatchString(node) {
+			return true
+		}
+
+		idx := strings.LastIndex(node, ".")
+		if idx == -1 {
+			return false
+		}
+
+		node = node[:idx]
+	}
+}
+
+// matches returns whether or not the permission covers the given node and game. An empty game only matches
+// permissions that apply to all games
+func (p permission) matches(node, game string) bool {
+	if !p.matchesNode(node) {
+		return false
+	}
+
+	if p.game == nil {
+		return true
+	}
+
+	return game != "" && p.game.MatchString(game)
+}
+
+type role struct {
+	allow []permission
+	deny  []permission
+}
+
+type permUser struct {
+	mask    *regexp.Regexp
+	account *regexp.Regexp
+	roles   []*role
+}
+
+func (u *permUser) matches(source, account string) bool {
+	if u.mask != nil && !u.mask.MatchString(source) {
+		return false
+	}
+
+	if u.account != nil && (account == "" || !u.account.MatchString(account)) {
+		return false
+	}
+
+	return true
+}
+
+// Permissions is a role based permission model. Users are matched by mask and/or account to roles, which allow or
+// deny the use of commands, optionally only on specific games. A nil *Permissions has no roles at all
+type Permissions struct {
+	users []*permUser
+}
+
+// NewPermissions creates a Permissions from the given config
+func NewPermissions(conf tomlconf.Permissions) (*Permissions, error) {
+	roles := make(map[string]*role, len(conf.Roles))
+
+	for name, r := range conf.Roles {
+		newRole := new(role)
+		for _, p := range r.Allow {
+			newRole.allow = append(newRole.allow, parsePermission(p))
+		}
+
+		for _, p := range r.Deny {
+			newRole.deny = append(newRole.deny, parsePermission(p))
+		}
+
+		roles[name] = newRole
+	}
+
+	out := new(Permissions)
+
+	for _, u := range conf.Users {
+		user := new(permUser)
+		if u.Mask != "" {
+			user.mask = globRegexp(u.Mask)
+		}
+
+		if u.Account != "" {
+			user.account = globRegexp(u.Account)
+		}
+
+		for _, name := range u.Roles {
+			r, ok := roles[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown role %q", name)
+			}
+
+			user.roles = append(user.roles, r)
+		}
+
+		out.users = append(out.users, user)
+	}
+
+	return out, nil
+}
+
+// Check checks whether the given user may use the command node on the given game. decided is false if none of the
+// user's roles mention the command, in which case allowed is meaningless and admin levels should be used instead.
+// If anyGame is true, game is ignored and the command is allowed if it is allowed for any game
+func (p *Permissions) Check(source, account, node, game string, anyGame bool) (allowed, decided bool) {
+	if p == nil {
+		return false, false
+	}
+
+	for _, u := range p.users {
+		if !u.matches(source, account) {
+			continue
+		}
+
+		for _, r := range u.roles {
+			for _, d := range r.deny {
+				if d.matches(node, game) {
+					return false, true
+				}
+			}
+
+			for _, a := range r.allow {
+				if a.matches(node, game) || (anyGame && a.matchesNode(node)) {
+					allowed = true
+				}
+			}
+		}
+	}
+
+	return allowed, allowed
+}
@@ -0,0 +1,246 @@
+package command
+
+import (
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+)
+
+var testPermConf = tomlconf.Permissions{
+	Roles: map[string]tomlconf.Role{
+		"survival": {Allow: []string{"gamectl.start@survival", "gamectl.stop@survival"}},
+		"tester":   {Allow: []string{"gamectl.raw@test*", "gamectl.logs"}},
+		"everyone": {Allow: []string{"*"}, Deny: []string{"reload", "*@creative"}},
+		"owner":    {Allow: []string{"*"}},
+	},
+	Users: []tomlconf.PermissionUser{
+		{Mask: "*!*@survival.host", Roles: []string{"survival"}},
+		{Mask: "*!*@test.host", Roles: []string{"tester"}},
+		{Account: "everyone", Roles: []string{"everyone"}},
+		{Mask: "*!*@owner.host", Account: "owner", Roles: []string{"owner"}},
+	},
+}
+
+func TestPermissions_Check(t *testing.T) {
+	p, err := NewPermissions(testPermConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		source      string
+		account     string
+		node        string
+		game        string
+		anyGame     bool
+		wantAllowed bool
+		wantDecided bool
+	}{
+		{
+			name:   "no matching user",
+			source: "x!x@nowhere", node: "gamectl.start", game: "survival",
+		},
+		{
+			name:   "game grant",
+			source: "x!x@survival.host", node: "gamectl.start", game: "survival",
+			wantAllowed: true, wantDecided: true,
+		},
+		{
+			name:   "game grant other game",
+			source: "x!x@survival.host", node: "gamectl.start", game: "creative",
+		},
+		{
+			name:   "game grant without game",
+			source: "x!x@survival.host", node: "gamectl.start",
+		},
+		{
+			name:   "game grant any game",
+			source: "x!x@survival.host", node: "gamectl.start", anyGame: true,
+			wantAllowed: true, wantDecided: true,
+		},
+		{
+			name:   "game grant unrelated command",
+			source: "x!x@survival.host", node: "gamectl.raw", game: "survival",
+		},
+		{
+			name:   "game glob",
+			source: "x!x@TEST.host", node: "gamectl.raw", game: "testserver",
+			wantAllowed: true, wantDecided: true,
+		},
+		{
+			name:   "command grant covers all games",
+			source: "x!x@test.host", node: "gamectl.logs", game: "anything",
+			wantAllowed: true, wantDecided: true,
+		},
+		{
+			name:    "account",
+			account: "everyone", node: "gamectl.start", game: "survival",
+			wantAllowed: true, wantDecided: true,
+		},
+		{
+			name:    "deny",
+			account: "everyone", node: "reload",
+			wantAllowed: false, wantDecided: true,
+		},
+		{
+			name:    "game deny",
+			account: "everyone", node: "gamectl.stop", game: "creative",
+			wantAllowed: false, wantDecided: true,
+		},
+		{
+			name:    "game deny any game",
+			account: "everyone", node: "gamectl.stop", anyGame: true,
+			wantAllowed: true, wantDecided: true,
+		},
+		{
+			name:   "deny wins over other roles",
+			source: "x!x@survival.host", account: "everyone", node: "gamectl.start", game: "creative",
+			wantAllowed: false, wantDecided: true,
+		},
+		{
+			name:   "mask and account, only mask",
+			source: "x!x@owner.host", node: "reload",
+		},
+		{
+			name:   "mask and account, both",
+			source: "x!x@owner.host", account: "owner", node: "reload",
+			wantAllowed: true, wantDecided: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, decided := p.Check(tt.source, tt.account, tt.node, tt.game, tt.anyGame)
+			if allowed != tt.wantAllowed || decided != tt.wantDecided {
+				t.Errorf(
+					"Check() = (%t, %t), want (%t, %t)", allowed, decided, tt.wantAllowed, tt.wantDecided,
+				)
+			}
+		})
+	}
+}
+
+func TestPermissions_nil(t *testing.T) {
+	var p *Permissions
+	if allowed, decided := p.Check("x!x@x", "", "reload", "", false); allowed || decided {
+		t.Errorf("nil Permissions Check() = (%t, %t), want (false, false)", allowed, decided)
+	}
+}
+
+func TestNewPermissions_unknownRole(t *testing.T) {
+	_, err := NewPermissions(tomlconf.Permissions{Users: []tomlconf.PermissionUser{{Mask: "*", Roles: []string{"x"}}}})
+	if err == nil {
+		t.Error("NewPermissions() with an unknown role did not error")
+	}
+}
+
+func TestManager_permissions(t *testing.T) {
+	p, err := NewPermissions(testPermConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(baseLogger, nil, "!")
+	m.SetPermissions(p)
+
+	var ran []string
+
+	gameCtl := func(data *Data) {
+		for _, g := range data.Args {
+			if data.CheckGamePerms(g) {
+				ran = append(ran, "start "+g)
+			}
+		}
+	}
+
+	if err := m.AddGameControlSubCommand("gamectl", "start", 2, gameCtl, "starts games"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddGameSubCommand("creative", "say", 0, func(*Data) { ran = append(ran, "say") }, "says"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddCommand("reload", 3, func(*Data) { ran = append(ran, "reload") }, "reloads"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		source      string
+		account     string
+		adminLevel  int
+		line        string
+		wantRan     []string
+		wantNotices int
+	}{
+		{
+			name:   "role on one game",
+			source: "x!x@survival.host", line: "!gamectl start survival creative",
+			wantRan: []string{"start survival"}, wantNotices: 1,
+		},
+		{
+			name:   "role with no grant for command",
+			source: "x!x@survival.host", line: "!reload",
+			wantNotices: 1,
+		},
+		{
+			name:   "admin level fallback",
+			source: "x!x@nowhere", adminLevel: 3, line: "!gamectl start survival creative",
+			wantRan: []string{"start survival", "start creative"},
+		},
+		{
+			name:   "admin level too low",
+			source: "x!x@nowhere", adminLevel: 1, line: "!gamectl start survival",
+			wantNotices: 1,
+		},
+		{
+			name:   "deny overrides admin level",
+			source: "x!x@nowhere", account: "everyone", adminLevel: 3, line: "!reload",
+			wantNotices: 1,
+		},
+		{
+			name:   "game command deny",
+			source: "x!x@nowhere", account: "everyone", line: "!creative say hi",
+			wantNotices: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ran = nil
+			util := &mockMessager{accounts: map[string]string{tt.source: tt.account}}
+
+			if tt.adminLevel > 0 {
+				util.AddAdmin(tt.source, tt.adminLevel)
+			}
+
+			m.ParseLine(tt.line, false, tt.source, "#test", util)
+
+			if !cmpStrSlice(ran, tt.wantRan) {
+				t.Errorf("ran %v, want %v", ran, tt.wantRan)
+			}
+
+			if len(util.lastNotices) != tt.wantNotices {
+				t.Errorf("got notices %v, want %d notices", util.lastNotices, tt.wantNotices)
+			}
+		})
+	}
+}
+
+func cmpStrSlice(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
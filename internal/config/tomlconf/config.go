@@ -1,15 +1,25 @@
 package tomlconf
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/pelletier/go-toml"
 )
 
+// DefaultConnection is the name given to the connection declared with the single [connection] table
+const DefaultConnection = "default"
+
 // Config is the main config struct
 type Config struct {
 	OriginalPath string `toml:"-"`
 	Connection   ConfigHolder
+	Connections  map[string]ConfigHolder `toml:"connections" comment:"Named connections, for bridging to more than one chat service at once"` //nolint:lll // Cant shorten it
+	API          API                     `toml:"api" comment:"The HTTP admin API. Changes require a restart"`
+	Metrics      Metrics                 `toml:"metrics" comment:"The Prometheus metrics endpoint. Changes require a restart"`      //nolint:lll // Cant shorten it
+	Permissions  Permissions             `toml:"permissions" comment:"Role based command permissions, checked before admin levels"` //nolint:lll // Cant shorten it
+	Webhooks     []Webhook               `toml:"webhook" comment:"HTTP endpoints that game events are sent to"`
+	Groups       map[string][]string     `toml:"groups" comment:"Named groups of games. Games only forward messages to the games in their groups"` //nolint:lll // Cant shorten it
 
 	FormatTemplates  map[string]FormatSet          `toml:"format_templates"`
 	RegexpTemplates  map[string][]Regexp           `toml:"regexp_templates"`
@@ -17,6 +27,17 @@ type Config struct {
 	Games            []*Game                       `toml:"game"`
 }
 
+// API holds the config for the HTTP admin API
+type API struct {
+	Listen string `comment:"The address to listen on, eg 127.0.0.1:8080. The API is disabled if this is empty"`
+	Token  string `comment:"The token that must be sent as a Bearer token with every request"`
+}
+
+// Metrics holds the config for the Prometheus metrics endpoint
+type Metrics struct {
+	Listen string `comment:"The address to serve /metrics on, eg 127.0.0.1:9100. Metrics are disabled if this is empty"`
+}
+
 func (c *Config) resolveImports() error {
 	for idx := range c.Games {
 		game := c.Games[idx] // because gocritic. and if I want to make changes I need a reference anyway
@@ -40,6 +61,10 @@ func GetConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("could not unmarshal config: %w", err)
 	}
 
+	if err := out.resolveConnections(); err != nil {
+		return nil, err
+	}
+
 	if err := out.resolveImports(); err != nil {
 		return nil, fmt.Errorf("unable to resolve imports: %w", err)
 	}
@@ -53,6 +78,25 @@ func GetConfig(path string) (*Config, error) {
 	return out, nil
 }
 
+// resolveConnections merges the legacy single connection into the named connection list, under DefaultConnection
+func (c *Config) resolveConnections() error {
+	if c.Connection.Type == "" {
+		return nil
+	}
+
+	if _, exists := c.Connections[DefaultConnection]; exists {
+		return fmt.Errorf("cannot have both a [connection] and a connection named %q", DefaultConnection)
+	}
+
+	if c.Connections == nil {
+		c.Connections = make(map[string]ConfigHolder)
+	}
+
+	c.Connections[DefaultConnection] = c.Connection
+
+	return nil
+}
+
 func configFromTree(tree *toml.Tree) (*Config, error) {
 	out := new(Config)
 	if err := tree.Unmarshal(out); err != nil {
@@ -63,15 +107,48 @@ func configFromTree(tree *toml.Tree) (*Config, error) {
 }
 
 func validateConfig(inConf *Config) error {
-	if inConf.Connection.Type != "null" && inConf.Connection.RealConf == nil {
+	if len(inConf.Connections) == 0 && inConf.Connection.Type != "null" && inConf.Connection.RealConf == nil {
 		return fmt.Errorf("invalid config for connection type %q, missing config", inConf.Connection.Type)
 	}
 
+	for name, conn := range inConf.Connections {
+		if conn.Type == "" || (conn.Type != "null" && conn.RealConf == nil) {
+			return fmt.Errorf("invalid config for connection %q of type %q, missing config", name, conn.Type)
+		}
+	}
+
+	if inConf.API.Listen != "" && inConf.API.Token == "" {
+		return errors.New("the API cannot be enabled without a token")
+	}
+
+	if err := inConf.Permissions.validate(); err != nil {
+		return fmt.Errorf("invalid permissions: %w", err)
+	}
+
+	names := make(map[string]bool, len(inConf.Webhooks))
+
+	for i := range inConf.Webhooks {
+		w := &inConf.Webhooks[i]
+		if err := w.validate(); err != nil {
+			return err
+		}
+
+		if names[w.Name] {
+			return fmt.Errorf("duplicate webhook name %q", w.Name)
+		}
+
+		names[w.Name] = true
+	}
+
 	for _, g := range inConf.Games {
 		if g.Transport.Type == "" || g.Transport.RealConf == nil {
 			return fmt.Errorf("invalid config for game %q. Missing transport", g.Name)
 		}
 	}
 
+	if err := validateRouting(inConf); err != nil {
+		return fmt.Errorf("invalid routing: %w", err)
+	}
+
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -46,6 +47,185 @@ var tests = []confTest{
 		IsValid:       false,
 		expectedError: "invalid config for connection type \"\", missing config",
 	},
+	{
+		name:    "named connections",
+		IsValid: true,
+		tomlStr: `
+		[connections.one]
+		type = "null"
+
+		[connections.two]
+		type = "irc"
+		config.nick = "test"
+		`,
+		expectedConf: &Config{},
+	}, {
+		name:    "bad named conn",
+		IsValid: false,
+		tomlStr: `
+		[connections.one]
+		type = "irc"
+		`,
+		expectedError: "invalid config for connection \"one\" of type \"irc\", missing config",
+	},
+	{
+		name:    "api without token",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[api]
+		listen = "127.0.0.1:8080"
+		`,
+		expectedError: "the API cannot be enabled without a token",
+	},
+	{
+		name:    "permissions",
+		IsValid: true,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[permissions.roles.survival_ops]
+		allow = ["gamectl.start@survival", "gamectl.stop@survival"]
+		deny = ["gamectl.*@creative"]
+
+		[[permissions.users]]
+		mask = "*!*@ops.example.com"
+		account = "someop"
+		roles = ["survival_ops"]
+		`,
+		expectedConf: &Config{
+			Connection: ConfigHolder{Type: "null"},
+			Permissions: Permissions{
+				Roles: map[string]Role{
+					"survival_ops": {
+						Allow: []string{"gamectl.start@survival", "gamectl.stop@survival"},
+						Deny:  []string{"gamectl.*@creative"},
+					},
+				},
+				Users: []PermissionUser{{Mask: "*!*@ops.example.com", Account: "someop", Roles: []string{"survival_ops"}}},
+			},
+		},
+	},
+	{
+		name:    "permissions unknown role",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[[permissions.users]]
+		mask = "*!*@*"
+		roles = ["nope"]
+		`,
+		expectedError: "invalid permissions: permission user 0 references unknown role \"nope\"",
+	},
+	{
+		name:    "permissions user without match",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[permissions.roles.a]
+		allow = ["*"]
+
+		[[permissions.users]]
+		roles = ["a"]
+		`,
+		expectedError: "invalid permissions: permission user 0 has neither a mask nor an account",
+	},
+	{
+		name:    "webhooks",
+		IsValid: true,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[[webhook]]
+		name = "oncall"
+		url = "https://oncall.example.com/hooks/gggb"
+		secret = "hunter2"
+		events = ["crash"]
+
+		[[webhook]]
+		name = "chat"
+		url = "https://discord.com/api/webhooks/1/abc"
+		type = "discord"
+		games = ["survival"]
+		headers = { X-Extra = "extra" }
+		timeout = 30
+		`,
+		expectedConf: &Config{
+			Connection: ConfigHolder{Type: "null"},
+			Webhooks: []Webhook{
+				{
+					Name:       "oncall",
+					URL:        "https://oncall.example.com/hooks/gggb",
+					Type:       WebhookJSON,
+					Secret:     "hunter2",
+					Events:     []string{WebhookCrash},
+					Timeout:    10,
+					MaxRetries: 5,
+				},
+				{
+					Name:       "chat",
+					URL:        "https://discord.com/api/webhooks/1/abc",
+					Type:       WebhookDiscord,
+					Games:      []string{"survival"},
+					Headers:    map[string]string{"X-Extra": "extra"},
+					Timeout:    30,
+					MaxRetries: 5,
+				},
+			},
+		},
+	},
+	{
+		name:    "webhook bad url",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[[webhook]]
+		name = "test"
+		url = "/relative"
+		`,
+		expectedError: "webhook \"test\" has an invalid URL \"/relative\". It must be an absolute http or https URL",
+	},
+	{
+		name:    "webhook unknown event",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[[webhook]]
+		name = "test"
+		url = "http://example.com"
+		events = ["explode"]
+		`,
+		expectedError: "webhook \"test\" has an unknown event \"explode\"",
+	},
+	{
+		name:    "duplicate webhooks",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+		type = "null"
+
+		[[webhook]]
+		name = "test"
+		url = "http://example.com"
+
+		[[webhook]]
+		name = "test"
+		url = "http://example.org"
+		`,
+		expectedError: "duplicate webhook name \"test\"",
+	},
 	{
 		name:    "bad conn",
 		IsValid: false,
@@ -94,11 +274,299 @@ var tests = []confTest{
 					Chat: Chat{
 						BridgeChat:    true,
 						AllowForwards: true,
+						TopicInterval: 60,
+					},
+				},
+			},
+		},
+	},
+
+	{
+		name:    "per channel settings",
+		IsValid: true,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[[game]]
+			name = "test"
+
+			[[game.chat.channels]]
+			name = "#staff"
+
+			[[game.chat.channels]]
+			name = "#public"
+			direction = "out"
+			events = ["chat"]
+			formats.message = "public message"
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+		`,
+		expectedConf: &Config{
+			Connection: ConfigHolder{Type: "null"},
+			Games: []*Game{
+				{
+					Name: "test",
+					Transport: ConfigHolder{
+						Type: "process",
+						RealConf: tomlTreeFromMapMust(map[string]interface{}{
+							"binary": "asd",
+						}),
+					},
+					Chat: Chat{
+						BridgeChat:    true,
+						AllowForwards: true,
+						TopicInterval: 60,
+						Channels: []BridgedChannel{
+							{Name: "#staff"},
+							{
+								Name:      "#public",
+								Direction: DirectionOut,
+								Events:    []string{"chat"},
+								Formats:   &FormatSet{Message: makeStrPtr("public message")},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		name:    "schedule",
+		IsValid: true,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[[game]]
+			name = "test"
+
+			[[game.schedule]]
+			name = "save"
+			every = "10m"
+			format = "save-all"
+
+			[[game.schedule]]
+			name = "warn"
+			cron = "55 4 * * *"
+			format = "restarting in 5 minutes"
+			send_to = "chat"
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+		`,
+		expectedConf: &Config{
+			Connection: ConfigHolder{Type: "null"},
+			Games: []*Game{
+				{
+					Name: "test",
+					Transport: ConfigHolder{
+						Type: "process",
+						RealConf: tomlTreeFromMapMust(map[string]interface{}{
+							"binary": "asd",
+						}),
+					},
+					Chat: Chat{
+						BridgeChat:    true,
+						AllowForwards: true,
+						TopicInterval: 60,
+					},
+					Schedule: []Schedule{
+						{Name: "save", Every: "10m", Format: "save-all", SendTo: ScheduleStdin},
+						{Name: "warn", Cron: "55 4 * * *", Format: "restarting in 5 minutes", SendTo: ScheduleChat},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		name:    "players",
+		IsValid: true,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[[game]]
+			name = "test"
+
+			[game.players]
+			join = "^(?P<player>\\S+) joined the game$"
+			leave = "^(?P<player>\\S+) left the game$"
+			list_command = "list"
+			list = "players online: (.*)$"
+			list_interval = 60
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+		`,
+		expectedConf: &Config{
+			Connection: ConfigHolder{Type: "null"},
+			Games: []*Game{
+				{
+					Name: "test",
+					Transport: ConfigHolder{
+						Type: "process",
+						RealConf: tomlTreeFromMapMust(map[string]interface{}{
+							"binary": "asd",
+						}),
+					},
+					Chat: Chat{
+						BridgeChat:    true,
+						AllowForwards: true,
+						TopicInterval: 60,
+					},
+					Players: Players{
+						Join:         `^(?P<player>\S+) joined the game$`,
+						Leave:        `^(?P<player>\S+) left the game$`,
+						ListCommand:  "list",
+						List:         "players online: (.*)$",
+						ListInterval: 60,
+					},
+				},
+			},
+		},
+	},
+
+	{
+		name:    "routing",
+		IsValid: true,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[groups]
+			smp = ["survival", "creative"]
+
+		[[game]]
+			name = "survival"
+
+			[game.chat]
+			forwards_deny = ["lobby"]
+
+			[[game.regexp]]
+			name = "death"
+			regexp = "died"
+			send_to_games = ["smp", "lobby"]
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+
+		[[game]]
+			name = "creative"
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+
+		[[game]]
+			name = "lobby"
+
+			[game.chat]
+			forwards_allow = ["smp"]
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+		`,
+		expectedConf: &Config{
+			Connection: ConfigHolder{Type: "null"},
+			Groups:     map[string][]string{"smp": {"survival", "creative"}},
+			Games: []*Game{
+				{
+					Name:      "survival",
+					Transport: ConfigHolder{Type: "process", RealConf: tomlTreeFromMapMust(map[string]interface{}{"binary": "asd"})},
+					Chat:      Chat{BridgeChat: true, AllowForwards: true, TopicInterval: 60, ForwardsDeny: []string{"lobby"}},
+					Regexps: []Regexp{
+						{
+							Name:         "death",
+							Regexp:       "died",
+							Eat:          true,
+							SendToChan:   true,
+							SendToOthers: true,
+							SendToGames:  []string{"smp", "lobby"},
+						},
 					},
 				},
+				{
+					Name:      "creative",
+					Transport: ConfigHolder{Type: "process", RealConf: tomlTreeFromMapMust(map[string]interface{}{"binary": "asd"})},
+					Chat:      Chat{BridgeChat: true, AllowForwards: true, TopicInterval: 60},
+				},
+				{
+					Name:      "lobby",
+					Transport: ConfigHolder{Type: "process", RealConf: tomlTreeFromMapMust(map[string]interface{}{"binary": "asd"})},
+					Chat:      Chat{BridgeChat: true, AllowForwards: true, TopicInterval: 60, ForwardsAllow: []string{"smp"}},
+				},
 			},
 		},
 	},
+	{
+		name:    "group with unknown game",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[groups]
+			smp = ["survival"]
+		`,
+		expectedError: "invalid routing: group \"smp\" contains unknown game \"survival\"",
+	},
+	{
+		name:    "group named after game",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[groups]
+			test = ["test"]
+
+		[[game]]
+			name = "test"
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+		`,
+		expectedError: "invalid routing: group \"test\" has the same name as a game",
+	},
+	{
+		name:    "regexp with unknown target",
+		IsValid: false,
+		tomlStr: `
+		[connection]
+			type = "null"
+
+		[[game]]
+			name = "test"
+
+			[[game.regexp]]
+			name = "death"
+			regexp = "died"
+			send_to_games = ["nope"]
+
+			[game.transport]
+			type = "process"
+
+			config.binary = "asd"
+		`,
+		expectedError: "invalid routing: game \"test\" regexp \"death\" refers to unknown game or group \"nope\"",
+	},
 
 	{
 		name:    "import simple",
@@ -114,6 +582,7 @@ var tests = []confTest{
 			nick = "nick template test"
 			quit = "quit template test"
 			kick = "kick template test"
+			topic = "topic template test"
 			extra.test_one = "test_one: asd"
 
 		[[regexp_templates.test_regexps1]]
@@ -144,6 +613,7 @@ var tests = []confTest{
 					Nick:    makeStrPtr("nick template test"),
 					Quit:    makeStrPtr("quit template test"),
 					Kick:    makeStrPtr("kick template test"),
+					Topic:   makeStrPtr("topic template test"),
 					Extra:   map[string]string{"test_one": "test_one: asd"},
 				},
 			},
@@ -170,11 +640,13 @@ var tests = []confTest{
 							Nick:    makeStrPtr("nick template test"),
 							Quit:    makeStrPtr("quit template test"),
 							Kick:    makeStrPtr("kick template test"),
+							Topic:   makeStrPtr("topic template test"),
 							Extra:   map[string]string{"test_one": "test_one: asd"},
 						},
 
 						ImportFormat:  &strTest,
 						AllowForwards: true,
+						TopicInterval: 60,
 						BridgeChat:    true,
 					},
 					Transport: ConfigHolder{
@@ -279,6 +751,7 @@ var tests = []confTest{
 				Chat: Chat{
 					BridgeChat:    true,
 					AllowForwards: true,
+					TopicInterval: 60,
 				},
 			}},
 		},
@@ -362,6 +835,7 @@ var tests = []confTest{
 						},
 						BridgeChat:    true,
 						AllowForwards: true,
+						TopicInterval: 60,
 					},
 				},
 			},
@@ -432,6 +906,18 @@ func cmpConfig(a, b *Config) (out bool) { //nolint:gocognit // Its a struct comp
 		return false
 	}
 
+	if !reflect.DeepEqual(a.Permissions, b.Permissions) {
+		return false
+	}
+
+	if !reflect.DeepEqual(a.Webhooks, b.Webhooks) {
+		return false
+	}
+
+	if !reflect.DeepEqual(a.Groups, b.Groups) {
+		return false
+	}
+
 	if len(a.Games) != len(b.Games) || (a.Games == nil) != (b.Games == nil) {
 		return false
 	}
@@ -457,16 +943,20 @@ func cmpGame(a, b *Game) bool { //nolint:gocognit // Its a comparison
 	}
 
 	// Sanity check to make sure this wasn't updated/changed
-	if gameNumFields != 11 {
+	if gameNumFields != 16 {
 		panic(errors.New("tomlconf.Game updated but tests not"))
 	}
 
 	// Manual: Transport
-	// DeepEqualled: Chat, CommandImports, Commands, RegexpImports, Regexps
+	// DeepEqualled: Chat, CommandImports, Commands, RegexpImports, Regexps, Schedule
 	if a.Name != b.Name ||
 		a.Comment != b.Comment ||
 		a.AutoStart != b.AutoStart ||
 		a.AutoRestart != b.AutoRestart ||
+		a.StoragePath != b.StoragePath ||
+		a.Restart != b.Restart ||
+		a.Logs != b.Logs ||
+		a.Players != b.Players ||
 		a.PreRoll != b.PreRoll ||
 		a.Transport.Type != b.Transport.Type ||
 		a.Transport.RealConf.String() != b.Transport.RealConf.String() ||
@@ -474,7 +964,8 @@ func cmpGame(a, b *Game) bool { //nolint:gocognit // Its a comparison
 		!reflect.DeepEqual(a.CommandImports, b.CommandImports) ||
 		!reflect.DeepEqual(a.Commands, b.Commands) ||
 		!reflect.DeepEqual(a.RegexpImports, b.RegexpImports) ||
-		!reflect.DeepEqual(a.Regexps, b.Regexps) { //nolint:go-lint // Its done this way intentionally
+		!reflect.DeepEqual(a.Regexps, b.Regexps) ||
+		!reflect.DeepEqual(a.Schedule, b.Schedule) { //nolint:go-lint // Its done this way intentionally
 
 		return false
 	}
@@ -594,6 +1085,81 @@ func TestInclusion(t *testing.T) { //nolint:gocognit // Its a test
 
 func makeStrPtr(x string) *string { return &x }
 
+func TestResolveConnections(t *testing.T) {
+	tests := []struct {
+		name    string
+		tomlStr string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "legacy only",
+			tomlStr: minViableToml,
+			want:    []string{DefaultConnection},
+		},
+		{
+			name: "named only",
+			tomlStr: `
+			[connections.one]
+			type = "null"
+			[connections.two]
+			type = "null"
+			`,
+			want: []string{"one", "two"},
+		},
+		{
+			name: "both",
+			tomlStr: minViableToml + `
+			[connections.one]
+			type = "null"
+			`,
+			want: []string{DefaultConnection, "one"},
+		},
+		{
+			name: "conflicting default",
+			tomlStr: minViableToml + `
+			[connections.default]
+			type = "null"
+			`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := toml.Load(tt.tomlStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conf, err := configFromTree(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := conf.resolveConnections(); (err != nil) != tt.wantErr {
+				t.Fatalf("resolveConnections() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var got []string
+			for name := range conf.Connections {
+				got = append(got, name)
+			}
+
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveConnections() resulted in %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func dumpExampleConf(t *testing.T) { //nolint:funlen // Must be long
 	realConf, err := toml.TreeFromMap(
 		map[string]interface{}{
@@ -633,6 +1199,7 @@ func dumpExampleConf(t *testing.T) { //nolint:funlen // Must be long
 			DumpStdout:     false,
 			DumpStderr:     false,
 			AllowForwards:  true,
+			TopicInterval:  60,
 			Transformer:    &ConfigHolder{Type: "minecraft"},
 		},
 		CommandImports: []string{"some_template"},
@@ -665,6 +1232,9 @@ func dumpExampleConf(t *testing.T) { //nolint:funlen // Must be long
 				Nick:     makeStrPtr("nick"),
 				Quit:     makeStrPtr("quit"),
 				Kick:     makeStrPtr("kick"),
+				Topic:    makeStrPtr("topic"),
+				Mode:     makeStrPtr("mode"),
+				Notice:   makeStrPtr("notice"),
 				External: makeStrPtr("external"),
 				Extra: map[string]string{
 					"one": "two",
@@ -709,3 +1279,24 @@ func Test_Something(t *testing.T) {
 	t.SkipNow()
 	dumpExampleConf(t)
 }
+
+func TestChat_AllChannels(t *testing.T) {
+	c := Chat{
+		BridgedChannel: "#one",
+		Connection:     "first",
+		Channels: []BridgedChannel{
+			{Name: "#two"},
+			{Name: "#three", Connection: "second", Direction: DirectionOut, Events: []string{"status"}},
+		},
+	}
+
+	want := []BridgedChannel{
+		{Connection: "first", Name: "#one", Direction: DirectionBoth},
+		{Connection: "first", Name: "#two", Direction: DirectionBoth},
+		{Connection: "second", Name: "#three", Direction: DirectionOut, Events: []string{"status"}},
+	}
+
+	if got := c.AllChannels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllChannels() = %v, want %v", got, want)
+	}
+}
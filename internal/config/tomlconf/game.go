@@ -7,9 +7,13 @@ import (
 // Game holds the config for a Game instance
 type Game struct {
 	Name        string
-	AutoStart   bool   `toml:"auto_start"`
-	AutoRestart int    `toml:"auto_restart"`
-	Comment     string `comment:"A message to be added to the status line of this Game"`
+	AutoStart   bool    `toml:"auto_start"`
+	AutoRestart int     `toml:"auto_restart"`
+	Comment     string  `comment:"A message to be added to the status line of this Game"`
+	StoragePath string  `toml:"storage_path" comment:"File to save template storage to. Storage is lost on restart if unset"`     //nolint:lll // Cant shorten it
+	Restart     Restart `comment:"How and when to restart the game after it exits. auto_restart is the initial delay in seconds"` //nolint:lll // Cant shorten it
+	Logs        Logs    `comment:"Capture of the game's output, for the gamectl logs command"`
+	Players     Players `comment:"Tracking of the players online, for the online command and .Players in templates"`
 
 	Transport ConfigHolder
 
@@ -25,11 +29,15 @@ type Game struct {
 
 	RegexpImports []string `toml:"import_regexps"`
 	Regexps       []Regexp `toml:"regexp"`
+
+	Schedule []Schedule `toml:"schedule" comment:"Templates to run on a timer"`
 }
 
 // Chat is a config for game.Chat
 type Chat struct {
-	BridgedChannel string `toml:"bridged_channel" comment:"The channel to bridge chat between"`
+	BridgedChannel string           `toml:"bridged_channel" comment:"The channel to bridge chat between"`
+	Connection     string           `toml:"connection" comment:"The connection bridged_channel is on (default: the only connection, or \"default\")"` //nolint:lll // Cant shorten it
+	Channels       []BridgedChannel `toml:"channels" comment:"Extra channels to bridge chat between, possibly on other connections"`                  //nolint:lll // Cant shorten it
 	// string ptr to check for null
 	ImportFormat *string `toml:"import_format"`
 	Formats      FormatSet
@@ -39,9 +47,55 @@ type Chat struct {
 	DumpStderr    bool `toml:"dump_stderr" comment:"Dump stdout to the bridged channel (This is a spammy debug option)"`
 	AllowForwards bool `toml:"allow_forwards" default:"true" comment:"Allow messages from other games (default true)"`
 
+	ForwardsAllow []string `toml:"forwards_allow" comment:"Games or groups to accept messages from (default all)"`
+	ForwardsDeny  []string `toml:"forwards_deny" comment:"Games or groups to ignore messages from, even if allowed"`
+
+	Topic         string `toml:"topic" comment:"Template for the topic of bridged channels, re-rendered when storage changes. It should not change storage itself"` //nolint:lll // Cant shorten it
+	TopicInterval int    `toml:"topic_interval" default:"60" comment:"Minimum seconds between topic changes on a channel (default 60, min 300 on Discord)"`         //nolint:lll // Cant shorten it
+
 	Transformer *ConfigHolder `comment:"How to transform messages to and from this game. (leave out for StripTransformer)"`
 }
 
+// Directions a BridgedChannel can bridge in
+const (
+	DirectionBoth = "both" // Chat to game and game to chat
+	DirectionIn   = "in"   // Chat to game only
+	DirectionOut  = "out"  // Game to chat only
+)
+
+// BridgedChannel is a channel on a specific connection that a game bridges its chat to
+type BridgedChannel struct {
+	Connection string     `toml:"connection" comment:"The connection this channel is on (default: as with chat.connection)"` //nolint:lll // Cant shorten it
+	Name       string     `toml:"name" comment:"The channel to bridge chat between"`
+	Direction  string     `toml:"direction" comment:"One of in (chat to game), out (game to chat), or both (default both)"`
+	Events     []string   `toml:"events" comment:"Events to bridge, any of message, join, part, quit, nick, kick, topic, mode, notice, chat, status, and dump (default all)"` //nolint:lll // Cant shorten it
+	Formats    *FormatSet `toml:"formats" comment:"Overrides for the game's formats, for events from this channel"`
+}
+
+// AllChannels returns the bridged_channel (if any) followed by all other configured channels. Channels that do not
+// specify a connection inherit the chat's connection
+func (c *Chat) AllChannels() []BridgedChannel {
+	var out []BridgedChannel
+
+	if c.BridgedChannel != "" {
+		out = append(out, BridgedChannel{Connection: c.Connection, Name: c.BridgedChannel, Direction: DirectionBoth})
+	}
+
+	for _, ch := range c.Channels {
+		if ch.Connection == "" {
+			ch.Connection = c.Connection
+		}
+
+		if ch.Direction == "" {
+			ch.Direction = DirectionBoth
+		}
+
+		out = append(out, ch)
+	}
+
+	return out
+}
+
 // Command holds commands that can be executed by users
 type Command struct {
 	Format        string `comment:"go template based formatter"`
@@ -58,10 +112,63 @@ type Regexp struct {
 	Format   string
 	Priority int `toml:",omitempty"`
 
-	Eat          bool `default:"true" comment:"Stop processing regexps after this is matched. (default true)"`
-	SendToChan   bool `toml:"send_to_chan" default:"true" comment:"Send the formatted message to the bridged channel (default true)"`   //nolint:lll // Cant shorten them
-	SendToOthers bool `toml:"send_to_others" default:"true" comment:"Send the formatted message to other running games (default true)"` //nolint:lll // Cant shorten them
-	SendToLocal  bool `toml:"send_to_local" comment:"Send the formatted message to the game it came from (default false)"`
+	Eat           bool `default:"true" comment:"Stop processing regexps after this is matched. (default true)"`
+	SendToChan    bool `toml:"send_to_chan" default:"true" comment:"Send the formatted message to the bridged channel (default true)"`                         //nolint:lll // Cant shorten them
+	SendToOthers  bool `toml:"send_to_others" default:"true" comment:"Send the formatted message to other running games in this game's groups (default true)"` //nolint:lll // Cant shorten them
+	SendToLocal   bool `toml:"send_to_local" comment:"Send the formatted message to the game it came from (default false)"`
+	SendToWebhook bool `toml:"send_to_webhook" comment:"Send the formatted message to webhooks as a notify event (default false)"` //nolint:lll // Cant shorten them
+
+	SendToGames []string `toml:"send_to_games" comment:"Other games or groups to send the formatted message to, in or out of this game's groups"` //nolint:lll // Cant shorten it
+}
+
+// Restart policies
+const (
+	RestartNever     = "never"      // Never restart
+	RestartOnFailure = "on-failure" // Restart when the game exits with a non-zero exit code
+	RestartAlways    = "always"     // Restart whenever the game exits, unless it was stopped
+)
+
+// Restart configures restarting a game after it exits
+type Restart struct {
+	Policy     string `comment:"One of never, on-failure, or always (unset: clean exits only, if auto_restart is set)"`
+	MaxDelay   int    `toml:"max_delay" comment:"The maximum delay in seconds between restarts, as the delay doubles on quick exits (default 300)"` //nolint:lll // Cant shorten it
+	MaxExits   int    `toml:"max_exits" comment:"Stop restarting after this many exits within exit_window (default 5, negative to disable)"`        //nolint:lll // Cant shorten it
+	ExitWindow int    `toml:"exit_window" comment:"The window in minutes that max_exits applies to (default 10)"`
+}
+
+// Logs configures capturing a game's output
+type Logs struct {
+	Scrollback int    `comment:"Lines of output to keep in memory (default 500)"`
+	Dir        string `comment:"Directory to write the game's output to. Output is not written to disk if this is empty"`
+	MaxSize    int    `toml:"max_size" comment:"Size in KiB a log file can reach before it is rotated (default 10240)"`
+	MaxFiles   int    `toml:"max_files" comment:"Number of rotated log files to keep (default 5)"`
+}
+
+// Players configures tracking the players online in a game. Player names are taken from the "player" group of the join
+// and leave regexps, or their first group if they have no group with that name
+type Players struct {
+	Join          string `comment:"A regexp matching lines that show a player joining"`
+	Leave         string `comment:"A regexp matching lines that show a player leaving"`
+	ListCommand   string `toml:"list_command" comment:"A line to write to the game to list its players, eg \"list\""`
+	List          string `comment:"A regexp matching the response to list_command. Its \"players\" (or first) group is the list"` //nolint:lll // Cant shorten it
+	ListSeparator string `toml:"list_separator" comment:"The separator between names in the player list (default \",\")"`
+	ListInterval  int    `toml:"list_interval" comment:"Seconds between runs of list_command (default 300)"`
+}
+
+// Places a Schedule can send its result to
+const (
+	ScheduleStdin   = "stdin"   // The game's stdin
+	ScheduleChat    = "chat"    // The game's bridged channels
+	ScheduleCommand = "command" // Run as a bot command, as if from the terminal
+)
+
+// Schedule is a template that is run on a timer
+type Schedule struct {
+	Name   string
+	Cron   string `comment:"A cron expression (eg \"55 4 * * *\") or descriptor (eg \"@daily\") to run on"`
+	Every  string `comment:"An interval (eg \"10m\") to run on, instead of cron"`
+	Format string `comment:"The template to run. Empty results are not sent"`
+	SendTo string `toml:"send_to" default:"stdin" comment:"Where to send the result. One of stdin, chat, or command (default stdin)"` //nolint:lll // Cant shorten it
 }
 
 // FormatSet holds a set of formatters to be converted to a format.Format
@@ -73,6 +180,9 @@ type FormatSet struct {
 	Nick     *string
 	Quit     *string
 	Kick     *string
+	Topic    *string
+	Mode     *string
+	Notice   *string
 	External *string
 
 	Extra map[string]string
@@ -86,6 +196,9 @@ const (
 	NICK
 	QUIT
 	KICK
+	TOPIC
+	MODE
+	NOTICE
 	EXTERNAL
 )
 
@@ -103,6 +216,12 @@ func (f *FormatSet) index(i int) *string {
 		return f.Quit
 	case KICK:
 		return f.Kick
+	case TOPIC:
+		return f.Topic
+	case MODE:
+		return f.Mode
+	case NOTICE:
+		return f.Notice
 	case EXTERNAL:
 		return f.External
 	default:
@@ -124,6 +243,12 @@ func (f *FormatSet) setIndex(i int, s *string) {
 		f.Quit = s
 	case KICK:
 		f.Kick = s
+	case TOPIC:
+		f.Topic = s
+	case MODE:
+		f.Mode = s
+	case NOTICE:
+		f.Notice = s
 	case EXTERNAL:
 		f.External = s
 	default:
@@ -131,6 +256,22 @@ func (f *FormatSet) setIndex(i int, s *string) {
 	}
 }
 
+// WithOverrides returns a copy of the FormatSet with any non-nil formats on overrides replacing its own. Extra formats
+// are not overridden
+func (f FormatSet) WithOverrides(overrides *FormatSet) FormatSet {
+	if overrides == nil {
+		return f
+	}
+
+	for i := MESSAGE; i <= EXTERNAL; i++ {
+		if str := overrides.index(i); str != nil {
+			f.setIndex(i, str)
+		}
+	}
+
+	return f
+}
+
 func (g *Game) resolveImports(c *Config) error {
 	if err := g.resolveFormatImports(c); err != nil {
 		return err
@@ -163,13 +304,7 @@ func (g *Game) resolveFormatImports(c *Config) error {
 		)
 	}
 
-	g.Chat.Formats = fmtTemplate
-
-	for i := MESSAGE; i <= EXTERNAL; i++ {
-		if str := currentFormats.index(i); str != nil {
-			g.Chat.Formats.setIndex(i, str)
-		}
-	}
+	g.Chat.Formats = fmtTemplate.WithOverrides(&currentFormats)
 
 	return nil
 }
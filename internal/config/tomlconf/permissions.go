@@ -0,0 +1,53 @@
+package tomlconf
+
+import "fmt"
+
+// Permissions holds the role based permission config. Roles are checked before admin levels, and admin levels are
+// only used for commands that no role grants or denies for the user
+type Permissions struct {
+	Roles map[string]Role  `toml:"roles" comment:"Named sets of allowed and denied commands"`
+	Users []PermissionUser `toml:"users" comment:"Users and the roles they have"`
+}
+
+// Role is a named set of permissions. Each entry is a command, with subcommands separated by dots, optionally followed
+// by @ and the game it applies to. Both parts can contain * and ? wildcards, eg "gamectl.start@survival" or
+// "gamectl.*@test*". Denies take priority over allows
+type Role struct {
+	Allow []string `comment:"Commands this role may use, eg gamectl.start@survival"`
+	Deny  []string `comment:"Commands this role may not use, even if they are allowed by another role"`
+}
+
+// PermissionUser grants roles to anyone that matches it. If both Mask and Account are set, both must match
+type PermissionUser struct {
+	Mask    string   `comment:"A glob matched against the user's source, eg *!*@some.host"`
+	Account string   `comment:"A glob matched against the account the user is logged into"`
+	Roles   []string `comment:"The roles granted to the user"`
+}
+
+func (p *Permissions) validate() error {
+	for i, u := range p.Users {
+		if u.Mask == "" && u.Account == "" {
+			return fmt.Errorf("permission user %d has neither a mask nor an account", i)
+		}
+
+		if len(u.Roles) == 0 {
+			return fmt.Errorf("permission user %d has no roles", i)
+		}
+
+		for _, r := range u.Roles {
+			if _, exists := p.Roles[r]; !exists {
+				return fmt.Errorf("permission user %d references unknown role %q", i, r)
+			}
+		}
+	}
+
+	for name, r := range p.Roles {
+		for _, entry := range append(append([]string(nil), r.Allow...), r.Deny...) {
+			if entry == "" {
+				return fmt.Errorf("role %q has an empty permission", name)
+			}
+		}
+	}
+
+	return nil
+}
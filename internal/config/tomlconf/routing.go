@@ -0,0 +1,56 @@
+package tomlconf
+
+import "fmt"
+
+// validateRouting checks that groups only contain games that exist, and that everything that routes messages between
+// games refers to games or groups that exist
+func validateRouting(c *Config) error {
+	games := make(map[string]bool, len(c.Games))
+	for _, g := range c.Games {
+		games[g.Name] = true
+	}
+
+	for name, members := range c.Groups {
+		if name == "" {
+			return fmt.Errorf("groups cannot have an empty name")
+		}
+
+		if games[name] {
+			return fmt.Errorf("group %q has the same name as a game", name)
+		}
+
+		for _, m := range members {
+			if !games[m] {
+				return fmt.Errorf("group %q contains unknown game %q", name, m)
+			}
+		}
+	}
+
+	checkTargets := func(what string, targets []string) error {
+		for _, t := range targets {
+			if _, isGroup := c.Groups[t]; !games[t] && !isGroup {
+				return fmt.Errorf("%s refers to unknown game or group %q", what, t)
+			}
+		}
+
+		return nil
+	}
+
+	for _, g := range c.Games {
+		if err := checkTargets(fmt.Sprintf("game %q forwards_allow", g.Name), g.Chat.ForwardsAllow); err != nil {
+			return err
+		}
+
+		if err := checkTargets(fmt.Sprintf("game %q forwards_deny", g.Name), g.Chat.ForwardsDeny); err != nil {
+			return err
+		}
+
+		for _, re := range g.Regexps {
+			if err := checkTargets(fmt.Sprintf("game %q regexp %q", g.Name, re.Name), re.SendToGames); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
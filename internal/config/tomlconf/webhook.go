@@ -0,0 +1,69 @@
+package tomlconf
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Webhook payload types
+const (
+	WebhookJSON    = "json"    // The full event as JSON
+	WebhookSlack   = "slack"   // A Slack compatible incoming webhook message
+	WebhookDiscord = "discord" // A Discord compatible webhook message
+)
+
+// Webhook event types
+const (
+	WebhookStart  = "start"  // A game was started
+	WebhookStop   = "stop"   // A game exited cleanly, or was stopped
+	WebhookCrash  = "crash"  // A game exited with a non-zero exit code, or could not be started
+	WebhookNotify = "notify" // A regexp with send_to_webhook set matched
+)
+
+// Webhook is an HTTP endpoint that game events are sent to
+type Webhook struct {
+	Name       string
+	URL        string            `toml:"url" comment:"The URL to POST events to"`
+	Type       string            `default:"json" comment:"The payload to send. One of json, slack, or discord (default json)"` //nolint:lll // Cant shorten it
+	Secret     string            `comment:"Key to sign payloads with, as HMAC-SHA256 in the X-GoGoGameBot-Signature header"`   //nolint:lll // Cant shorten it
+	Events     []string          `comment:"Events to send, any of start, stop, crash, and notify (default all)"`
+	Games      []string          `comment:"Games to send events for (default all)"`
+	Headers    map[string]string `comment:"Extra headers to send with every request"`
+	Timeout    int               `default:"10" comment:"Seconds to wait for a response (default 10)"`
+	MaxRetries int               `toml:"max_retries" default:"5" comment:"Retries for a failed delivery before it is dropped (default 5)"` //nolint:lll // Cant shorten it
+}
+
+func (w *Webhook) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("webhook with URL %q has no name", w.URL)
+	}
+
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return fmt.Errorf("webhook %q has an invalid URL: %w", w.Name, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %q has an invalid URL %q. It must be an absolute http or https URL", w.Name, w.URL)
+	}
+
+	switch w.Type {
+	case WebhookJSON, WebhookSlack, WebhookDiscord:
+	default:
+		return fmt.Errorf("webhook %q has an unknown type %q", w.Name, w.Type)
+	}
+
+	for _, e := range w.Events {
+		switch e {
+		case WebhookStart, WebhookStop, WebhookCrash, WebhookNotify:
+		default:
+			return fmt.Errorf("webhook %q has an unknown event %q", w.Name, e)
+		}
+	}
+
+	if w.Timeout <= 0 {
+		return fmt.Errorf("webhook %q must have a positive timeout", w.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,628 @@
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+	"awesome-dragon.science/go/goGoGameBot/pkg/mutexTypes"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// Various Errors
+var (
+	ErrAlreadyConnected = errors.New("discord is already connected")
+	ErrNotConnected     = errors.New("cannot send a message when not connected")
+)
+
+const (
+	defaultAPIURL = "https://discord.com/api/v10"
+	readyTimeout  = time.Second * 30
+
+	// Discord allows a channel to be edited twice every ten minutes
+	minTopicInterval = time.Minute * 5
+)
+
+// Admin holds a role or user ID and the admin level that it grants
+type Admin struct {
+	Role  string `toml:"role" comment:"Role ID or name that grants this level"`
+	User  string `toml:"user" comment:"User ID that is granted this level"`
+	Level int    `toml:"level"`
+}
+
+// Conf holds the configuration for a Discord instance
+type Conf struct {
+	Token  string `toml:"token" comment:"Bot token to authenticate with"`
+	CmdPfx string `toml:"command_prefix" default:"~" comment:"Command prefix to respond to (default: '~')"`
+
+	Admins        []Admin  `toml:"admins"`
+	AdminChannels []string `toml:"admin_channels" comment:"Channel IDs to send admin messages to"`
+
+	APIURL     string `toml:"api_url" comment:"Base URL for the REST API (default: https://discord.com/api/v10)"`
+	GatewayURL string `toml:"gateway_url" comment:"Gateway URL to use. If unset it is requested from the REST API"`
+}
+
+// Discord represents a connection to Discord
+type Discord struct {
+	*Conf
+	channels      mutexTypes.StringSlice
+	Connected     mutexTypes.Bool
+	StopRequested mutexTypes.Bool
+	socket        *websocket.Conn
+	socketMutex   sync.Mutex
+	socketDone    chan struct{}
+	closeReason   mutexTypes.String
+	lastSeq       mutexTypes.Int
+	lag           mutexTypes.Duration
+	lastBeat      mutexTypes.Time
+	awaitingACK   mutexTypes.Bool
+	http          *http.Client
+	dialer        *websocket.Dialer
+	state         *state
+	log           *log.Logger
+	Events        *event.Manager
+}
+
+// New creates a new Discord instance ready for use
+func New(conf tomlconf.ConfigHolder, logger *log.Logger) (*Discord, error) {
+	out := &Discord{
+		log:        logger,
+		Events:     new(event.Manager),
+		http:       &http.Client{Timeout: time.Second * 30},
+		dialer:     websocket.DefaultDialer,
+		state:      newState(),
+		socketDone: make(chan struct{}),
+	}
+
+	if err := out.Reload(conf.RealConf); err != nil {
+		return nil, err
+	}
+
+	out.setupParsers()
+
+	return out, nil
+}
+
+func (d *Discord) setupParsers() {
+	d.Events.Attach("READY", d.onReady, event.PriHighest)
+	d.Events.Attach("GUILD_CREATE", d.onGuildCreate, event.PriHighest)
+	d.Events.Attach("CHANNEL_CREATE", d.onChannelCreate, event.PriHighest)
+	d.Events.Attach("MESSAGE_CREATE", d.onMessageCreate, event.PriHighest)
+	d.Events.Attach("GUILD_MEMBER_ADD", d.onMemberUpdate, event.PriHighest)
+	// These are run last so that hooks can still see the state from before the change
+	d.Events.Attach("GUILD_MEMBER_UPDATE", d.onMemberUpdate, event.PriLowest)
+	d.Events.Attach("GUILD_MEMBER_REMOVE", d.onMemberRemove, event.PriLowest)
+	d.Events.Attach("CHANNEL_UPDATE", d.onChannelCreate, event.PriLowest)
+}
+
+func (d *Discord) writeJSON(op int, data interface{}) error {
+	if !d.Connected.Get() {
+		return ErrNotConnected
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	d.socketMutex.Lock()
+	defer d.socketMutex.Unlock()
+
+	return d.socket.WriteJSON(payload{Op: op, D: raw})
+}
+
+// Connect connects to the Discord gateway and identifies. It returns once the gateway has sent READY
+func (d *Discord) Connect() error {
+	if d.Connected.Get() {
+		return fmt.Errorf("already connected to Discord: %w", ErrAlreadyConnected)
+	}
+
+	target, err := d.gatewayURL()
+	if err != nil {
+		return err
+	}
+
+	d.log.Infof("Starting Discord connection to %s", target)
+
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+
+	s, _, err := d.dialer.Dial(target+sep+"v=10&encoding=json", nil)
+	if err != nil {
+		return fmt.Errorf("Discord.Connect(): could not open socket: %w", err)
+	}
+
+	first := payload{}
+	if err := s.ReadJSON(&first); err != nil || first.Op != opHello {
+		s.Close()
+		return fmt.Errorf("Discord.Connect(): did not get HELLO from gateway (op %d): %v", first.Op, err)
+	}
+
+	h := hello{}
+	if err := json.Unmarshal(first.D, &h); err != nil {
+		s.Close()
+		return fmt.Errorf("Discord.Connect(): invalid HELLO: %w", err)
+	}
+
+	d.socket = s
+	d.socketDone = make(chan struct{})
+	d.closeReason.Set("")
+	d.lastSeq.Set(-1)
+	d.awaitingACK.Set(false)
+	d.Connected.Set(true)
+
+	readyChan := d.Events.WaitForChan("READY")
+	done, beatDone := d.socketDone, make(chan struct{})
+
+	go d.readLoop(s, done)
+	go d.heartbeatLoop(s, time.Duration(h.HeartbeatInterval)*time.Millisecond, done, beatDone)
+
+	// fail closes the socket and waits for both loops to exit before returning err
+	fail := func(err error) error {
+		s.Close()
+		<-done
+		<-beatDone
+		d.Connected.Set(false)
+
+		return err
+	}
+
+	identify := map[string]interface{}{
+		"token":   d.Token,
+		"intents": defaultIntents,
+		"properties": map[string]string{
+			"os":      "linux",
+			"browser": "goGoGameBot",
+			"device":  "goGoGameBot",
+		},
+	}
+
+	if err := d.writeJSON(opIdentify, identify); err != nil {
+		return fail(fmt.Errorf("could not send IDENTIFY: %w", err))
+	}
+
+	select {
+	case <-readyChan:
+		return nil
+	case <-done:
+		return fail(fmt.Errorf("socket closed while connecting: %s", d.closeReason.Get()))
+	case <-time.After(readyTimeout):
+		return fail(errors.New("timed out waiting for READY"))
+	}
+}
+
+// Disconnect disconnects the bot from Discord. Discord has no concept of a quit message, so msg is only logged
+func (d *Discord) Disconnect(msg string) {
+	d.log.Infof("Disconnecting: %s", msg)
+	d.StopRequested.Set(true)
+
+	if !d.Connected.Get() {
+		return
+	}
+
+	d.socketMutex.Lock()
+	err := d.socket.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, msg),
+		time.Now().Add(time.Second),
+	)
+	d.socketMutex.Unlock()
+
+	if err != nil {
+		d.log.Warnf("could not send close frame: %s", err)
+	}
+
+	s, done := d.socket, d.socketDone
+
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(time.Millisecond * 500):
+			d.log.Warn("disconnect did not happen as expected. forcing a socket close")
+			s.Close()
+		}
+	}()
+}
+
+// Run connects the bot and blocks until it disconnects
+func (d *Discord) Run() error {
+	d.StopRequested.Set(false)
+
+	if err := d.Connect(); err != nil {
+		if !errors.Is(err, ErrAlreadyConnected) {
+			d.Connected.Set(false)
+		}
+
+		return err
+	}
+
+	defer func() {
+		_ = d.socket.Close()
+		d.lag.Set(0)
+		d.Connected.Set(false)
+	}()
+
+	<-d.socketDone
+
+	if d.StopRequested.Get() {
+		return nil
+	}
+
+	return fmt.Errorf("discord gateway closed: %s", d.closeReason.Get())
+}
+
+func (d *Discord) readLoop(s *websocket.Conn, done chan struct{}) {
+	defer close(done)
+
+	for {
+		p := payload{}
+		if err := s.ReadJSON(&p); err != nil {
+			d.closeReason.Set(err.Error())
+
+			if !d.StopRequested.Get() {
+				d.log.Warnf("error while reading from gateway: %s", err)
+			}
+
+			break
+		}
+
+		d.handlePayload(s, &p)
+	}
+
+	d.log.Info("Discord socket closed")
+}
+
+func (d *Discord) handlePayload(s *websocket.Conn, p *payload) {
+	if p.S != nil {
+		d.lastSeq.Set(int(*p.S))
+	}
+
+	switch p.Op {
+	case opDispatch:
+		d.log.Tracef(">> %s %s", p.T, p.D)
+		d.Events.Dispatch(NewDispatchEvent(p.T, p.D, time.Now()))
+	case opHeartbeat:
+		d.sendHeartbeat()
+	case opHeartbeatACK:
+		d.awaitingACK.Set(false)
+		d.lag.Set(time.Since(d.lastBeat.Get()))
+	case opReconnect, opInvalidSession:
+		d.log.Infof("gateway requested a reconnect (op %d)", p.Op)
+		d.closeReason.Set("gateway requested reconnect")
+		s.Close()
+	default:
+		d.log.Debugf("unhandled gateway op %d: %s", p.Op, p.D)
+	}
+}
+
+func (d *Discord) sendHeartbeat() {
+	var seq interface{}
+	if s := d.lastSeq.Get(); s >= 0 {
+		seq = s
+	}
+
+	d.lastBeat.Set(time.Now())
+	d.awaitingACK.Set(true)
+
+	if err := d.writeJSON(opHeartbeat, seq); err != nil {
+		d.log.Warnf("could not write heartbeat: %s", err)
+	}
+}
+
+// heartbeatLoop sends heartbeats on s every interval until done is closed, closing s if one is not acknowledged.
+// exited is closed when it returns
+func (d *Discord) heartbeatLoop(s *websocket.Conn, interval time.Duration, done, exited chan struct{}) {
+	defer close(exited)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if d.awaitingACK.Get() {
+				d.log.Warn("gateway did not acknowledge our last heartbeat. Closing connection")
+				d.closeReason.Set("heartbeat not acknowledged")
+				s.Close()
+
+				return
+			}
+
+			d.sendHeartbeat()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (d *Discord) onReady(e event.Event) {
+	dispatch := event2Dispatch(e)
+	r := ready{}
+
+	if err := json.Unmarshal(dispatch.Data, &r); err != nil {
+		d.log.Warnf("could not parse READY: %s", err)
+		return
+	}
+
+	d.state.Lock()
+	d.state.me = r.User
+	d.state.Unlock()
+	d.log.Infof("Logged in as %s (%s)", r.User.Username, r.User.ID)
+}
+
+func (d *Discord) onGuildCreate(e event.Event) {
+	g := new(Guild)
+	if err := json.Unmarshal(event2Dispatch(e).Data, g); err != nil {
+		d.log.Warnf("could not parse GUILD_CREATE: %s", err)
+		return
+	}
+
+	d.state.addGuild(g)
+}
+
+func (d *Discord) onChannelCreate(e event.Event) {
+	c := Channel{}
+	if err := json.Unmarshal(event2Dispatch(e).Data, &c); err != nil || c.GuildID == "" {
+		return
+	}
+
+	d.state.updateChannel(c)
+}
+
+func (d *Discord) onMessageCreate(e event.Event) {
+	m := new(Message)
+	if err := json.Unmarshal(event2Dispatch(e).Data, m); err != nil {
+		d.log.Warnf("could not parse MESSAGE_CREATE: %s", err)
+		return
+	}
+
+	d.state.updateUser(m.Author)
+
+	for _, u := range m.Mentions {
+		d.state.updateUser(u)
+	}
+
+	if m.Member != nil && m.GuildID != "" {
+		m.Member.User = &m.Author
+		d.state.updateMember(m.GuildID, m.Member)
+	}
+}
+
+func (d *Discord) onMemberUpdate(e event.Event) {
+	m := new(GuildMemberEvent)
+	if err := json.Unmarshal(event2Dispatch(e).Data, m); err != nil {
+		d.log.Warnf("could not parse %s: %s", e.Name(), err)
+		return
+	}
+
+	d.state.updateMember(m.GuildID, &m.Member)
+}
+
+func (d *Discord) onMemberRemove(e event.Event) {
+	m := new(GuildMemberEvent)
+	if err := json.Unmarshal(event2Dispatch(e).Data, m); err != nil || m.User == nil {
+		return
+	}
+
+	d.state.removeMember(m.GuildID, m.User.ID)
+}
+
+// sourceFromID converts a user ID to a source string. Sources use Discord's own mention syntax
+func sourceFromID(id string) string { return "<@" + id + ">" }
+
+// idFromSource extracts the user ID from a source string, returning false if the given string is not a source
+func idFromSource(source string) (string, bool) {
+	if !strings.HasPrefix(source, "<@") || !strings.HasSuffix(source, ">") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(source[2:len(source)-1], "!"), true
+}
+
+func (d *Discord) me() User {
+	d.state.RLock()
+	defer d.state.RUnlock()
+
+	return d.state.me
+}
+
+// splitMessage converts the given message to markdown, and splits it between lines into messages that fit within
+// discord's length limit. Lines that are too long on their own are cut short. Discord counts characters, not bytes
+func splitMessage(message string) []string {
+	lines := strings.Split(discordTransformer.Transform(message), "\n")
+	out := util.JoinToMaxLength(lines, "\n", maxMessageLength)
+
+	for i, m := range out {
+		if r := []rune(m); len(r) > maxMessageLength {
+			out[i] = string(r[:maxMessageLength])
+		}
+	}
+
+	return out
+}
+
+func (d *Discord) send(target, message string) {
+	channel, err := d.resolveChannel(target)
+	if err != nil {
+		d.log.Warnf("could not resolve target %q: %s", target, err)
+		return
+	}
+
+	for _, m := range splitMessage(message) {
+		if err := d.createMessage(channel, m); err != nil {
+			d.log.Warnf("could not send message %q to target %q: %s", m, target, err)
+		}
+	}
+}
+
+// SendMessage sends a message to the given target. Targets are either channel IDs or user sources
+func (d *Discord) SendMessage(target, message string) { d.send(target, message) }
+
+// SendNotice sends a message to the given target. Discord has no concept of notices, so notices to channels are sent
+// as normal messages and notices to users are sent via DM
+func (d *Discord) SendNotice(target, message string) { d.send(target, message) }
+
+// AdminLevel returns the highest admin level granted to the given source by any of its roles, 0 means no admin access
+func (d *Discord) AdminLevel(source string) int {
+	id, ok := idFromSource(source)
+	if !ok {
+		return 0
+	}
+
+	level := 0
+
+	for _, a := range d.Admins {
+		if a.Level <= level {
+			continue
+		}
+
+		if (a.User != "" && a.User == id) || (a.Role != "" && d.state.hasRole(id, a.Role)) {
+			level = a.Level
+		}
+	}
+
+	return level
+}
+
+// AccountName returns the user ID in the given source. Discord users are always logged in, so their ID is their account
+func (d *Discord) AccountName(source string) string {
+	id, _ := idFromSource(source)
+	return id
+}
+
+// Lag returns the latency measured by the most recent heartbeat
+func (d *Discord) Lag() time.Duration { return d.lag.Get() }
+
+// SendAdminMessage sends the given message to all AdminChannels defined on the bot
+func (d *Discord) SendAdminMessage(msg string) {
+	for _, c := range d.AdminChannels {
+		d.SendMessage(c, msg)
+	}
+}
+
+// JoinChannel marks the given channel ID as one we are interested in. Discord bots are members of entire guilds
+// so there is nothing to actually join, but membership events are only dispatched for channels added here
+func (d *Discord) JoinChannel(name string) {
+	for _, c := range d.channels.Get() {
+		if c == name {
+			return
+		}
+	}
+
+	d.channels.Set(append(d.channels.Get(), name))
+}
+
+// MinTopicInterval implements interfaces.TopicLimiter
+func (d *Discord) MinTopicInterval() time.Duration { return minTopicInterval }
+
+// SetTopic sets the topic of the given channel ID, unless it is already set to the same thing. Discord only allows a
+// channel to be edited twice every ten minutes, so this should be rate limited by the caller
+func (d *Discord) SetTopic(channel, topic string) {
+	topic = discordTransformer.Transform(strings.ReplaceAll(topic, "\n", " "))
+	if r := []rune(topic); len(r) > maxTopicLength {
+		topic = string(r[:maxTopicLength])
+	}
+
+	if d.state.topic(channel) == topic {
+		return
+	}
+
+	if err := d.modifyChannelTopic(channel, topic); err != nil {
+		d.log.Warnf("could not set topic for %q: %s", channel, err)
+	}
+}
+
+func (d *Discord) String() string {
+	return fmt.Sprintf("Discord[Connected[%t], Lag[%dms]]", d.Connected.Get(), d.lag.Get().Milliseconds())
+}
+
+// Reload parses and reloads the config on the Discord instance. Changes to the token or URLs take effect on the next
+// reconnect
+func (d *Discord) Reload(tree interfaces.Unmarshaler) error {
+	newConf := new(Conf)
+	if err := tree.Unmarshal(newConf); err != nil {
+		return fmt.Errorf("could not unmarshal Discord config: %w", err)
+	}
+
+	if newConf.Token == "" {
+		return errors.New("discord config requires a token")
+	}
+
+	if newConf.APIURL == "" {
+		newConf.APIURL = defaultAPIURL
+	}
+
+	newConf.APIURL = strings.TrimSuffix(newConf.APIURL, "/")
+	d.Conf = newConf
+
+	return nil
+}
+
+// StaticCommandPrefixes returns the valid static command prefixes. Discord has none
+func (d *Discord) StaticCommandPrefixes() []string { return []string{} }
+
+// IsCommandPrefix returns whether or not the given string starts with the command prefix or a mention of the bot
+func (d *Discord) IsCommandPrefix(line string) (string, bool) {
+	if strings.HasPrefix(line, d.CmdPfx) {
+		return line[len(d.CmdPfx):], true
+	}
+
+	me := d.me()
+	if me.ID == "" {
+		return line, false
+	}
+
+	for _, pfx := range []string{"@" + d.HumanReadableSource(sourceFromID(me.ID)) + " ", sourceFromID(me.ID) + " "} {
+		if strings.HasPrefix(line, pfx) {
+			return line[len(pfx):], true
+		}
+	}
+
+	return line, false
+}
+
+// HumanReadableSource converts a source to the user's current display name
+func (d *Discord) HumanReadableSource(source string) string {
+	id, ok := idFromSource(source)
+	if !ok {
+		return source
+	}
+
+	if name, ok := d.state.displayName(id); ok {
+		return name
+	}
+
+	return source
+}
+
+// Status returns a human readable status string
+func (d *Discord) Status() string {
+	return fmt.Sprintf("Discord: Connected: %t Lag: %s", d.Connected.Get(), d.lag.Get())
+}
+
+// SendRaw sends a raw gateway payload, in the form of a JSON object, to Discord
+func (d *Discord) SendRaw(raw string) {
+	if !d.Connected.Get() {
+		d.log.Warn("cannot send a raw payload when not connected")
+		return
+	}
+
+	d.socketMutex.Lock()
+	defer d.socketMutex.Unlock()
+
+	if err := d.socket.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+		d.log.Warn("could not send raw payload: ", err)
+	}
+}
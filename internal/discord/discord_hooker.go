@@ -0,0 +1,179 @@
+package discord
+
+import (
+	"encoding/json"
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+)
+
+// messageToIntermediate converts a message's content to the intermediate format, replacing any user mentions with the
+// mentioned user's display name
+func (d *Discord) messageToIntermediate(m *Message) string {
+	out := discordTransformer.MakeIntermediate(m.Content)
+
+	for _, u := range m.Mentions {
+		name := strings.ReplaceAll("@"+d.HumanReadableSource(sourceFromID(u.ID)), "$", "$$")
+		out = strings.ReplaceAll(out, "<@"+u.ID+">", name)
+		out = strings.ReplaceAll(out, "<@!"+u.ID+">", name)
+	}
+
+	return out
+}
+
+func (d *Discord) parseMessage(e event.Event) *Message {
+	m := new(Message)
+	if err := json.Unmarshal(event2Dispatch(e).Data, m); err != nil {
+		return nil
+	}
+
+	if m.Author.ID == d.me().ID {
+		// Discord sends us our own messages, we dont want to see them
+		return nil
+	}
+
+	return m
+}
+
+func (d *Discord) parseMember(e event.Event) *GuildMemberEvent {
+	m := new(GuildMemberEvent)
+	if err := json.Unmarshal(event2Dispatch(e).Data, m); err != nil || m.User == nil {
+		return nil
+	}
+
+	return m
+}
+
+// channelsInGuild returns all the channels we have joined that are in the given guild
+func (d *Discord) channelsInGuild(guildID string) []string {
+	var out []string
+
+	for _, c := range d.channels.Get() {
+		if d.state.guildForChannel(c) == guildID {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// HookMessage hooks on messages to a channel
+func (d *Discord) HookMessage(f func(source, channel, message string, isAction bool)) {
+	d.Events.Attach("MESSAGE_CREATE", func(e event.Event) {
+		m := d.parseMessage(e)
+		if e.IsCancelled() || m == nil || m.GuildID == "" {
+			return
+		}
+
+		f(sourceFromID(m.Author.ID), m.ChannelID, d.messageToIntermediate(m), false)
+	}, event.PriNorm)
+}
+
+// HookPrivateMessage hooks on messages to us directly
+func (d *Discord) HookPrivateMessage(f func(source, channel, message string)) {
+	d.Events.Attach("MESSAGE_CREATE", func(e event.Event) {
+		m := d.parseMessage(e)
+		if e.IsCancelled() || m == nil || m.GuildID != "" {
+			return
+		}
+
+		f(sourceFromID(m.Author.ID), m.ChannelID, d.messageToIntermediate(m))
+	}, event.PriNorm)
+}
+
+// HookJoin hooks on users joining a guild. The callback is fired once for each joined channel in that guild
+func (d *Discord) HookJoin(f func(source, channel string)) {
+	d.Events.Attach("GUILD_MEMBER_ADD", func(e event.Event) {
+		m := d.parseMember(e)
+		if m == nil {
+			return
+		}
+
+		for _, c := range d.channelsInGuild(m.GuildID) {
+			f(sourceFromID(m.User.ID), c)
+		}
+	}, event.PriNorm)
+}
+
+// HookPart hooks on users leaving a guild. The callback is fired once for each joined channel in that guild
+func (d *Discord) HookPart(f func(source, channel, message string)) {
+	d.Events.Attach("GUILD_MEMBER_REMOVE", func(e event.Event) {
+		m := d.parseMember(e)
+		if m == nil {
+			return
+		}
+
+		for _, c := range d.channelsInGuild(m.GuildID) {
+			f(sourceFromID(m.User.ID), c, "")
+		}
+	}, event.PriNorm)
+}
+
+// HookQuit is a noop, as Discord does not differentiate between leaving a guild and disconnecting
+func (d *Discord) HookQuit(func(source, message string)) {}
+
+// HookKick hooks on users being banned from a guild. Discord does not tell us who issued the ban, so source is always
+// empty
+func (d *Discord) HookKick(f func(source, channel, target, message string)) {
+	d.Events.Attach("GUILD_BAN_ADD", func(e event.Event) {
+		m := d.parseMember(e)
+		if m == nil {
+			return
+		}
+
+		for _, c := range d.channelsInGuild(m.GuildID) {
+			f("", c, d.HumanReadableSource(sourceFromID(m.User.ID)), "banned")
+		}
+	}, event.PriNorm)
+}
+
+// HookNick hooks on a user changing their display name in a guild
+func (d *Discord) HookNick(f func(source, newNick string)) {
+	d.Events.Attach("GUILD_MEMBER_UPDATE", func(e event.Event) {
+		m := d.parseMember(e)
+		if m == nil {
+			return
+		}
+
+		newNick := m.Nick
+		if newNick == "" {
+			newNick = m.User.GlobalName
+		}
+
+		if newNick == "" {
+			newNick = m.User.Username
+		}
+
+		source := sourceFromID(m.User.ID)
+		if d.HumanReadableSource(source) == newNick {
+			return
+		}
+
+		f(source, newNick)
+	}, event.PriNorm)
+}
+
+// HookTopic hooks on the topic of a joined channel being changed. Discord does not tell us who changed it, so source is
+// always empty
+func (d *Discord) HookTopic(f func(source, channel, topic string)) {
+	d.Events.Attach("CHANNEL_UPDATE", func(e event.Event) {
+		c := Channel{}
+		if err := json.Unmarshal(event2Dispatch(e).Data, &c); err != nil || c.Topic == d.state.topic(c.ID) {
+			return
+		}
+
+		for _, joined := range d.channels.Get() {
+			if joined == c.ID {
+				f("", c.ID, discordTransformer.MakeIntermediate(c.Topic))
+				return
+			}
+		}
+	}, event.PriNorm)
+}
+
+// HookMode is a noop, as Discord has no channel modes
+func (d *Discord) HookMode(func(source, channel string, changes []interfaces.ModeChange)) {}
+
+// HookNotice is a noop, as Discord has no notices
+func (d *Discord) HookNotice(func(source, channel, message string)) {}
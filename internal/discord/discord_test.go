@@ -0,0 +1,403 @@
+package discord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/pelletier/go-toml"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+var testLogger = log.New(log.FTimestamp, os.Stdout, "TEST", log.INFO)
+
+// fakeDiscord is a tiny stand in for Discord's gateway and REST API
+type fakeDiscord struct {
+	t        *testing.T
+	server   *httptest.Server
+	mu       sync.Mutex
+	sent     [][2]string // channel, content
+	topics   [][2]string // channel, topic
+	dms      []string
+	conn     *websocket.Conn
+	identify chan json.RawMessage
+	connMu   sync.Mutex
+	rejectID bool // Close the socket on IDENTIFY, rather than sending READY
+}
+
+func newFakeDiscord(t *testing.T) *fakeDiscord {
+	f := &fakeDiscord{t: t, identify: make(chan json.RawMessage, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gateway/bot", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"url": "ws" + strings.TrimPrefix(f.server.URL, "http") + "/ws"})
+	})
+
+	mux.HandleFunc("/ws", f.gateway)
+	mux.HandleFunc("/users/@me/channels", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.dms = append(f.dms, body["recipient_id"])
+		f.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(Channel{ID: "dm-" + body["recipient_id"], Type: 1})
+	})
+	mux.HandleFunc("/channels/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		channel := strings.Split(strings.TrimPrefix(r.URL.Path, "/channels/"), "/")[0]
+		body := map[string]interface{}{}
+		b, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+		f.mu.Lock()
+		if r.Method == http.MethodPatch {
+			f.topics = append(f.topics, [2]string{channel, body["topic"].(string)})
+		} else {
+			f.sent = append(f.sent, [2]string{channel, body["content"].(string)})
+		}
+		f.mu.Unlock()
+		_, _ = w.Write([]byte("{}"))
+	})
+
+	f.server = httptest.NewServer(mux)
+
+	return f
+}
+
+func (f *fakeDiscord) send(op int, name string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	f.connMu.Lock()
+	defer f.connMu.Unlock()
+
+	if err := f.conn.WriteJSON(payload{Op: op, T: name, D: raw}); err != nil {
+		f.t.Log(err)
+	}
+}
+
+func (f *fakeDiscord) gateway(w http.ResponseWriter, r *http.Request) {
+	c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Error(err)
+		return
+	}
+
+	f.connMu.Lock()
+	f.conn = c
+	f.connMu.Unlock()
+
+	f.send(opHello, "", hello{HeartbeatInterval: 45000})
+
+	for {
+		p := payload{}
+		if err := c.ReadJSON(&p); err != nil {
+			return
+		}
+
+		switch p.Op {
+		case opIdentify:
+			f.identify <- p.D
+
+			if f.rejectID {
+				_ = c.Close()
+				return
+			}
+
+			f.send(opDispatch, "READY", ready{User: User{ID: "1", Username: "gggb", Bot: true}})
+			f.send(opDispatch, "GUILD_CREATE", Guild{
+				ID:       "100",
+				Name:     "test guild",
+				Roles:    []Role{{ID: "500", Name: "Admins"}},
+				Channels: []Channel{{ID: "200", Name: "bridge", GuildID: "100", Topic: "old topic"}},
+				Members: []Member{
+					{User: &User{ID: "2", Username: "someAdmin"}, Roles: []string{"500"}},
+					{User: &User{ID: "3", Username: "someUser"}, Nick: "nicknamed"},
+				},
+			})
+		case opHeartbeat:
+			f.send(opHeartbeatACK, "", nil)
+		}
+	}
+}
+
+func (f *fakeDiscord) setTopics() [][2]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([][2]string{}, f.topics...)
+}
+
+func (f *fakeDiscord) messages() [][2]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([][2]string{}, f.sent...)
+}
+
+func testConf(t *testing.T, url string) tomlconf.ConfigHolder {
+	tree, err := toml.Load(`
+		token = "test-token"
+		api_url = "` + url + `"
+		command_prefix = "!"
+
+		[[admins]]
+		role = "admins"
+		level = 3
+
+		[[admins]]
+		user = "3"
+		level = 1
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tomlconf.ConfigHolder{Type: "discord", RealConf: tree}
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestDiscord(t *testing.T) { //nolint:funlen // its an integration test
+	fake := newFakeDiscord(t)
+	defer fake.server.Close()
+
+	d, err := New(testConf(t, fake.server.URL), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.JoinChannel("200")
+
+	type msg struct{ source, channel, message string }
+
+	msgs := make(chan msg, 10)
+	d.HookMessage(func(source, channel, message string, _ bool) { msgs <- msg{source, channel, message} })
+
+	joins := make(chan msg, 10)
+	d.HookJoin(func(source, channel string) { joins <- msg{source, channel, ""} })
+
+	nicks := make(chan msg, 10)
+	d.HookNick(func(source, newNick string) { nicks <- msg{d.HumanReadableSource(source), "", newNick} })
+
+	topics := make(chan msg, 10)
+	d.HookTopic(func(source, channel, topic string) { topics <- msg{source, channel, topic} })
+
+	runErr := make(chan error, 1)
+
+	go func() { runErr <- d.Run() }()
+
+	select {
+	case raw := <-fake.identify:
+		if !strings.Contains(string(raw), `"token":"test-token"`) {
+			t.Errorf("identify did not contain token: %s", raw)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for IDENTIFY")
+	}
+
+	waitFor(t, "connection", d.Connected.Get)
+	waitFor(t, "guild", func() bool { return d.state.guildForChannel("200") == "100" })
+
+	if got := d.AdminLevel(sourceFromID("2")); got != 3 {
+		t.Errorf("AdminLevel() for role admin = %d, want 3", got)
+	}
+
+	if got := d.AdminLevel(sourceFromID("3")); got != 1 {
+		t.Errorf("AdminLevel() for user admin = %d, want 1", got)
+	}
+
+	if got := d.AdminLevel(sourceFromID("4")); got != 0 {
+		t.Errorf("AdminLevel() for unknown user = %d, want 0", got)
+	}
+
+	if got := d.HumanReadableSource(sourceFromID("3")); got != "nicknamed" {
+		t.Errorf("HumanReadableSource() = %q, want %q", got, "nicknamed")
+	}
+
+	fake.send(opDispatch, "MESSAGE_CREATE", Message{
+		ID: "1000", ChannelID: "200", GuildID: "100",
+		Author:   User{ID: "2", Username: "someAdmin"},
+		Content:  "**hello** <@3> $",
+		Mentions: []User{{ID: "3", Username: "someUser"}},
+	})
+
+	// Our own messages should never make it to hooks
+	fake.send(opDispatch, "MESSAGE_CREATE", Message{ID: "1001", ChannelID: "200", GuildID: "100", Author: User{ID: "1"}})
+
+	select {
+	case m := <-msgs:
+		want := msg{"<@2>", "200", "$bhello$b @nicknamed $$"}
+		if m != want {
+			t.Errorf("HookMessage got %#v, want %#v", m, want)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for message hook")
+	}
+
+	fake.send(opDispatch, "GUILD_MEMBER_ADD", GuildMemberEvent{Member: Member{User: &User{ID: "5"}}, GuildID: "100"})
+
+	select {
+	case j := <-joins:
+		if j.source != "<@5>" || j.channel != "200" {
+			t.Errorf("HookJoin got %#v", j)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for join hook")
+	}
+
+	fake.send(opDispatch, "GUILD_MEMBER_UPDATE", GuildMemberEvent{
+		Member: Member{User: &User{ID: "3", Username: "someUser"}, Nick: "renamed"}, GuildID: "100",
+	})
+
+	select {
+	case n := <-nicks:
+		if n.source != "nicknamed" || n.message != "renamed" {
+			t.Errorf("HookNick got %#v", n)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for nick hook")
+	}
+
+	// Only changes to the topic should be seen
+	fake.send(opDispatch, "CHANNEL_UPDATE", Channel{ID: "200", Name: "renamed", GuildID: "100", Topic: "old topic"})
+	fake.send(opDispatch, "CHANNEL_UPDATE", Channel{ID: "200", Name: "renamed", GuildID: "100", Topic: "**new**"})
+
+	select {
+	case tp := <-topics:
+		if want := (msg{"", "200", "$bnew$b"}); tp != want {
+			t.Errorf("HookTopic got %#v, want %#v", tp, want)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for topic hook")
+	}
+
+	// The topic is already set to this
+	waitFor(t, "topic", func() bool { return d.state.topic("200") == "**new**" })
+	d.SetTopic("200", "$bnew$b")
+	d.SetTopic("200", "$bnewer$b")
+
+	if got, want := fake.setTopics(), [][2]string{{"200", "**newer**"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SetTopic() set topics %q, want %q", got, want)
+	}
+
+	d.SendMessage("200", "$bbold$b\nsecond line")
+	d.SendNotice(sourceFromID("3"), "private")
+
+	waitFor(t, "messages", func() bool { return len(fake.messages()) == 2 })
+
+	want := [][2]string{{"200", "**bold**\nsecond line"}, {"dm-3", "private"}}
+	for i, m := range fake.messages() {
+		if m != want[i] {
+			t.Errorf("sent message %d = %v, want %v", i, m, want[i])
+		}
+	}
+
+	if out, ok := d.IsCommandPrefix("!status"); !ok || out != "status" {
+		t.Errorf("IsCommandPrefix() = %q, %t", out, ok)
+	}
+
+	d.Disconnect("bye")
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run() returned %s after a requested disconnect", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run did not return after Disconnect")
+	}
+}
+
+func TestDiscord_ConnectFailed(t *testing.T) {
+	fake := newFakeDiscord(t)
+	fake.rejectID = true
+
+	defer fake.server.Close()
+
+	d, err := New(testConf(t, fake.server.URL), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connect only returns once both of the socket's goroutines have exited
+	if err := d.Connect(); err == nil {
+		t.Fatal("Connect() did not error when the socket was closed before READY")
+	}
+
+	if d.Connected.Get() {
+		t.Error("still marked as connected after Connect() failed")
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{name: "short", message: "$bhi$b\nthere", want: []string{"**hi**\nthere"}},
+		{
+			name:    "lines joined to the limit",
+			message: strings.Repeat("a", 1500) + "\n" + strings.Repeat("b", 1000),
+			want:    []string{strings.Repeat("a", 1500), strings.Repeat("b", 1000)},
+		},
+		{
+			name:    "long ascii line",
+			message: strings.Repeat("a", 2500),
+			want:    []string{strings.Repeat("a", maxMessageLength)},
+		},
+		{
+			name:    "multi-byte line within the limit",
+			message: strings.Repeat("é", 1500),
+			want:    []string{strings.Repeat("é", 1500)},
+		},
+		{
+			name:    "long multi-byte line",
+			message: strings.Repeat("日本", 1500),
+			want:    []string{strings.Repeat("日本", maxMessageLength/2)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.message)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage() returned %d messages, want %d", len(got), len(tt.want))
+			}
+
+			for _, m := range got {
+				if !utf8.ValidString(m) {
+					t.Errorf("splitMessage() returned invalid UTF-8: %q", m)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+// Package discord contains a Bot implementation that works over Discord's gateway and REST APIs
+package discord
@@ -0,0 +1,127 @@
+package discord
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+)
+
+// Gateway opcodes
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatACK   = 11
+)
+
+// Gateway intents we request on identify
+const (
+	intentGuilds         = 1 << 0
+	intentGuildMembers   = 1 << 1
+	intentGuildBans      = 1 << 2
+	intentGuildMessages  = 1 << 9
+	intentDirectMessages = 1 << 12
+	intentMessageContent = 1 << 15
+
+	defaultIntents = intentGuilds | intentGuildMembers | intentGuildBans | intentGuildMessages |
+		intentDirectMessages | intentMessageContent
+)
+
+// payload is a single frame sent over the gateway
+type payload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+	S  *int64          `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// User represents a Discord user
+type User struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Bot        bool   `json:"bot"`
+}
+
+// Member represents a User's membership of a guild
+type Member struct {
+	User  *User    `json:"user"`
+	Nick  string   `json:"nick"`
+	Roles []string `json:"roles"`
+}
+
+// Role represents a guild role
+type Role struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Channel represents a guild text channel or a DM channel
+type Channel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	GuildID string `json:"guild_id"`
+	Type    int    `json:"type"`
+	Topic   string `json:"topic"`
+}
+
+// Guild represents the data sent in a GUILD_CREATE
+type Guild struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Roles    []Role    `json:"roles"`
+	Channels []Channel `json:"channels"`
+	Members  []Member  `json:"members"`
+}
+
+// Message represents a MESSAGE_CREATE
+type Message struct {
+	ID        string  `json:"id"`
+	ChannelID string  `json:"channel_id"`
+	GuildID   string  `json:"guild_id"`
+	Author    User    `json:"author"`
+	Member    *Member `json:"member"`
+	Content   string  `json:"content"`
+	Mentions  []User  `json:"mentions"`
+}
+
+// GuildMemberEvent represents GUILD_MEMBER_ADD, GUILD_MEMBER_UPDATE, GUILD_MEMBER_REMOVE, and GUILD_BAN_ADD
+type GuildMemberEvent struct {
+	Member
+	GuildID string `json:"guild_id"`
+}
+
+type ready struct {
+	User      User   `json:"user"`
+	SessionID string `json:"session_id"`
+}
+
+type hello struct {
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+}
+
+// DispatchEvent represents an incoming gateway dispatch that needs to be handled
+type DispatchEvent struct {
+	event.BaseEvent
+	Data json.RawMessage
+	Time time.Time
+}
+
+// NewDispatchEvent creates a DispatchEvent with the given name and data
+func NewDispatchEvent(name string, data json.RawMessage, tme time.Time) *DispatchEvent {
+	return &DispatchEvent{event.BaseEvent{Name_: strings.ToUpper(name)}, data, tme}
+}
+
+func event2Dispatch(e event.Event) *DispatchEvent {
+	d, ok := e.(*DispatchEvent)
+	if !ok {
+		return nil
+	}
+
+	return d
+}
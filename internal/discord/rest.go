@@ -0,0 +1,136 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/version"
+)
+
+const (
+	maxMessageLength = 2000
+	maxTopicLength   = 1024
+	maxRetries       = 3
+)
+
+type rateLimited struct {
+	RetryAfter float64 `json:"retry_after"`
+}
+
+// request makes a request against the Discord REST API, unmarshalling any response into out if it is non-nil.
+// requests that are rate limited are retried after the time Discord asks for
+func (d *Discord) request(method, path string, body, out interface{}) error {
+	var encoded []byte
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not marshal request body: %w", err)
+		}
+
+		encoded = b
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, d.APIURL+path, bytes.NewReader(encoded))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Authorization", "Bot "+d.Token)
+		req.Header.Set("User-Agent", fmt.Sprintf("DiscordBot (goGoGameBot, %s)", version.Version))
+
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		res, err := d.http.Do(req)
+		if err != nil {
+			return err
+		}
+
+		resBody, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case res.StatusCode == http.StatusTooManyRequests && attempt < maxRetries:
+			limit := rateLimited{}
+			_ = json.Unmarshal(resBody, &limit)
+			d.log.Debugf("rate limited on %s %s, retrying in %.2fs", method, path, limit.RetryAfter)
+			time.Sleep(time.Duration(limit.RetryAfter * float64(time.Second)))
+
+			continue
+
+		case res.StatusCode < 200 || res.StatusCode > 299:
+			return fmt.Errorf("%s %s returned %s: %s", method, path, res.Status, resBody)
+		}
+
+		if out == nil || len(resBody) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(resBody, out)
+	}
+}
+
+func (d *Discord) gatewayURL() (string, error) {
+	if d.GatewayURL != "" {
+		return d.GatewayURL, nil
+	}
+
+	out := struct {
+		URL string `json:"url"`
+	}{}
+
+	if err := d.request(http.MethodGet, "/gateway/bot", nil, &out); err != nil {
+		return "", fmt.Errorf("could not fetch gateway URL: %w", err)
+	}
+
+	return out.URL, nil
+}
+
+func (d *Discord) createMessage(channelID, content string) error {
+	return d.request(
+		http.MethodPost,
+		fmt.Sprintf("/channels/%s/messages", channelID),
+		map[string]interface{}{
+			"content":          content,
+			"allowed_mentions": map[string]interface{}{"parse": []string{}},
+		},
+		nil,
+	)
+}
+
+func (d *Discord) modifyChannelTopic(channelID, topic string) error {
+	return d.request(http.MethodPatch, fmt.Sprintf("/channels/%s", channelID), map[string]string{"topic": topic}, nil)
+}
+
+// resolveChannel turns a target into a channel ID. Targets are either channel IDs, or user sources, in which case
+// a DM channel is opened (and cached) for them
+func (d *Discord) resolveChannel(target string) (string, error) {
+	userID, isUser := idFromSource(target)
+	if !isUser {
+		return target, nil
+	}
+
+	if c, ok := d.state.dmChannel(userID); ok {
+		return c, nil
+	}
+
+	c := Channel{}
+	if err := d.request(http.MethodPost, "/users/@me/channels", map[string]string{"recipient_id": userID}, &c); err != nil {
+		return "", fmt.Errorf("could not open DM channel: %w", err)
+	}
+
+	d.state.setDMChannel(userID, c.ID)
+
+	return c.ID, nil
+}
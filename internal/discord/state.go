@@ -0,0 +1,188 @@
+package discord
+
+import (
+	"strings"
+	"sync"
+)
+
+type guildState struct {
+	name    string
+	roles   map[string]Role
+	members map[string]*Member
+}
+
+// state holds everything we know about the guilds we are in. It is fed from gateway dispatches
+type state struct {
+	sync.RWMutex
+	me       User
+	guilds   map[string]*guildState
+	channels map[string]string // channel ID -> guild ID
+	topics   map[string]string // channel ID -> topic
+	users    map[string]User
+	dms      map[string]string // user ID -> DM channel ID
+}
+
+func newState() *state {
+	return &state{
+		guilds:   make(map[string]*guildState),
+		channels: make(map[string]string),
+		topics:   make(map[string]string),
+		users:    make(map[string]User),
+		dms:      make(map[string]string),
+	}
+}
+
+func (s *state) getGuild(id string) *guildState {
+	g, ok := s.guilds[id]
+	if !ok {
+		g = &guildState{roles: make(map[string]Role), members: make(map[string]*Member)}
+		s.guilds[id] = g
+	}
+
+	return g
+}
+
+func (s *state) addGuild(guild *Guild) {
+	s.Lock()
+	defer s.Unlock()
+
+	g := s.getGuild(guild.ID)
+	g.name = guild.Name
+
+	for _, r := range guild.Roles {
+		g.roles[r.ID] = r
+	}
+
+	for _, c := range guild.Channels {
+		s.channels[c.ID] = guild.ID
+		s.topics[c.ID] = c.Topic
+	}
+
+	for i := range guild.Members {
+		s.updateMemberLocked(guild.ID, &guild.Members[i])
+	}
+}
+
+func (s *state) updateMemberLocked(guildID string, m *Member) {
+	if m.User == nil {
+		return
+	}
+
+	s.users[m.User.ID] = *m.User
+
+	if guildID != "" {
+		s.getGuild(guildID).members[m.User.ID] = m
+	}
+}
+
+func (s *state) updateMember(guildID string, m *Member) {
+	s.Lock()
+	s.updateMemberLocked(guildID, m)
+	s.Unlock()
+}
+
+func (s *state) updateUser(u User) {
+	s.Lock()
+	s.users[u.ID] = u
+	s.Unlock()
+}
+
+func (s *state) removeMember(guildID, userID string) {
+	s.Lock()
+	if g, ok := s.guilds[guildID]; ok {
+		delete(g.members, userID)
+	}
+	s.Unlock()
+}
+
+func (s *state) member(guildID, userID string) *Member {
+	s.RLock()
+	defer s.RUnlock()
+
+	if g, ok := s.guilds[guildID]; ok {
+		return g.members[userID]
+	}
+
+	return nil
+}
+
+// updateChannel records a channel's guild and topic
+func (s *state) updateChannel(c Channel) {
+	s.Lock()
+	s.channels[c.ID] = c.GuildID
+	s.topics[c.ID] = c.Topic
+	s.Unlock()
+}
+
+func (s *state) topic(channelID string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.topics[channelID]
+}
+
+func (s *state) guildForChannel(channelID string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.channels[channelID]
+}
+
+func (s *state) dmChannel(userID string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	c, ok := s.dms[userID]
+
+	return c, ok
+}
+
+func (s *state) setDMChannel(userID, channelID string) {
+	s.Lock()
+	s.dms[userID] = channelID
+	s.Unlock()
+}
+
+// displayName returns the best name we have for the given user ID. Guild nicknames are preferred, followed by
+// global display names, and finally usernames
+func (s *state) displayName(userID string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, g := range s.guilds {
+		if m, ok := g.members[userID]; ok && m.Nick != "" {
+			return m.Nick, true
+		}
+	}
+
+	u, ok := s.users[userID]
+	if !ok {
+		return "", false
+	}
+
+	if u.GlobalName != "" {
+		return u.GlobalName, true
+	}
+
+	return u.Username, true
+}
+
+// hasRole returns whether or not the given user holds a role matching the given ID or name in any guild
+func (s *state) hasRole(userID, role string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, g := range s.guilds {
+		m, ok := g.members[userID]
+		if !ok {
+			continue
+		}
+
+		for _, r := range m.Roles {
+			if r == role || strings.EqualFold(g.roles[r].Name, role) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
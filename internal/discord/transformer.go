@@ -0,0 +1,164 @@
+package discord
+
+import (
+	"strings"
+	"unicode"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/intermediate"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
+)
+
+var markdownMapping = map[int]string{
+	intermediate.Bold:          "**",
+	intermediate.Italic:        "_",
+	intermediate.Underline:     "__",
+	intermediate.Strikethrough: "~~",
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, `*`, `\*`, `_`, `\_`, `~`, `\~`, "`", "\\`", `|`, `\|`, `>`, `\>`,
+)
+
+var discordTransformer = Transformer{} // Copy of discordTransformer for use in internal stuff
+
+// Transformer is a dummy struct that holds methods for Discord's implementation of format/transformer's
+// transformer interface. Discord has no support for colours, so they are removed
+type Transformer struct{}
+
+// Transform implements Transformer.Transform. Intermediate formatting is toggle based, so open markdown spans are
+// closed (and reopened where needed) to keep them correctly nested
+func (Transformer) Transform(in string) string {
+	out := strings.Builder{}
+
+	var open []int
+
+	closeAll := func() {
+		for i := len(open) - 1; i >= 0; i-- {
+			out.WriteString(markdownMapping[open[i]])
+		}
+
+		open = open[:0]
+	}
+
+	for _, tok := range tokeniser.Tokenise(in) {
+		switch tok.TokenType {
+		case tokeniser.StringToken:
+			out.WriteString(markdownEscaper.Replace(tok.OriginalString))
+
+		case intermediate.Bold, intermediate.Italic, intermediate.Underline, intermediate.Strikethrough:
+			idx := -1
+
+			for i, t := range open {
+				if t == tok.TokenType {
+					idx = i
+					break
+				}
+			}
+
+			if idx == -1 {
+				open = append(open, tok.TokenType)
+				out.WriteString(markdownMapping[tok.TokenType])
+
+				continue
+			}
+
+			// close everything down to and including the span being toggled off, then reopen the others
+			reopen := append([]int{}, open[idx+1:]...)
+
+			for i := len(open) - 1; i >= idx; i-- {
+				out.WriteString(markdownMapping[open[i]])
+			}
+
+			open = open[:idx]
+
+			for _, t := range reopen {
+				open = append(open, t)
+				out.WriteString(markdownMapping[t])
+			}
+
+		case intermediate.Reset:
+			closeAll()
+		}
+	}
+
+	closeAll()
+
+	return out.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// MakeIntermediate implements Transformer.MakeIntermediate. Code spans are copied verbatim
+func (Transformer) MakeIntermediate(in string) string { //nolint:gocognit // its a parser
+	out := strings.Builder{}
+	runes := []rune(in)
+
+	writeLiteral := func(r rune) {
+		if r == intermediate.Sentinel {
+			out.WriteString(intermediate.SSentinelString)
+			return
+		}
+
+		out.WriteRune(r)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case r == '\\' && (unicode.IsPunct(next) || unicode.IsSymbol(next)):
+			writeLiteral(next)
+			i++
+
+		case r == '`':
+			end := strings.IndexRune(string(runes[i+1:]), '`')
+			if end == -1 {
+				writeLiteral(r)
+				continue
+			}
+
+			code := []rune(string(runes[i+1:])[:end])
+			for _, c := range code {
+				writeLiteral(c)
+			}
+
+			i += len(code) + 1
+
+		case r == '*' && next == '*':
+			out.WriteString(intermediate.SBoldString)
+			i++
+
+		case r == '_' && next == '_':
+			out.WriteString(intermediate.SUnderlineString)
+			i++
+
+		case r == '~' && next == '~':
+			out.WriteString(intermediate.SStrikethroughString)
+			i++
+
+		case r == '*':
+			out.WriteString(intermediate.SItalicString)
+
+		case r == '_':
+			// intra-word underscores are not formatting, eg snake_case
+			if i > 0 && isWordRune(runes[i-1]) && isWordRune(next) {
+				writeLiteral(r)
+				continue
+			}
+
+			out.WriteString(intermediate.SItalicString)
+
+		default:
+			writeLiteral(r)
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,109 @@
+package discord
+
+import "testing"
+
+func TestTransformer_Transform(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain",
+			in:   "this is a test",
+			want: "this is a test",
+		},
+		{
+			name: "bold",
+			in:   "this $bis$b a test",
+			want: "this **is** a test",
+		},
+		{
+			name: "unclosed",
+			in:   "this $iis a test",
+			want: "this _is a test_",
+		},
+		{
+			name: "overlapping",
+			in:   "$bbold $iboth$b italic$i",
+			want: "**bold _both_**_ italic_",
+		},
+		{
+			name: "reset",
+			in:   "$b$u$sall$r none",
+			want: "**__~~all~~__** none",
+		},
+		{
+			name: "colours are eaten",
+			in:   "$cFF0000red",
+			want: "red",
+		},
+		{
+			name: "escapes markdown",
+			in:   "some_user *waves*",
+			want: `some\_user \*waves\*`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Transformer{}).Transform(tt.in); got != tt.want {
+				t.Errorf("Transform() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformer_MakeIntermediate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain",
+			in:   "this is a test",
+			want: "this is a test",
+		},
+		{
+			name: "all formats",
+			in:   "**bold** *italic* _italic_ __underline__ ~~strike~~",
+			want: "$bbold$b $iitalic$i $iitalic$i $uunderline$u $sstrike$s",
+		},
+		{
+			name: "sentinels",
+			in:   "this co$ts $5",
+			want: "this co$$ts $$5",
+		},
+		{
+			name: "escapes",
+			in:   `\*not italic\*`,
+			want: "*not italic*",
+		},
+		{
+			name: "code",
+			in:   "run `**this**` now",
+			want: "run **this** now",
+		},
+		{
+			name: "unclosed code",
+			in:   "a ` b",
+			want: "a ` b",
+		},
+		{
+			name: "snake case",
+			in:   "snake_case_name",
+			want: "snake_case_name",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Transformer{}).MakeIntermediate(tt.in); got != tt.want {
+				t.Errorf("MakeIntermediate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
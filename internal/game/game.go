@@ -9,9 +9,13 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/robfig/cron/v3"
+
 	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
 	"awesome-dragon.science/go/goGoGameBot/internal/transport"
 	"awesome-dragon.science/go/goGoGameBot/internal/transport/util"
+	"awesome-dragon.science/go/goGoGameBot/internal/webhook"
 	"awesome-dragon.science/go/goGoGameBot/pkg/format"
 	"awesome-dragon.science/go/goGoGameBot/pkg/log"
 	"awesome-dragon.science/go/goGoGameBot/pkg/mutexTypes"
@@ -35,7 +39,17 @@ func NewGame(conf *tomlconf.Game, manager *Manager) (*Game, error) {
 		manager:   manager,
 		Logger:    manager.Logger.Clone().SetPrefix(conf.Name),
 		stdinChan: make(chan []byte),
+		topics: newTopicSetter(func(conn, channel, topic string) {
+			manager.getBot(conn).SetTopic(channel, topic)
+		}, func(conn string) time.Duration {
+			if l, ok := manager.getBot(conn).(interfaces.TopicLimiter); ok {
+				return l.MinTopicInterval()
+			}
+
+			return 0
+		}),
 	}
+	g.players = newPlayerTracker(g.renderTopic)
 	g.status.Set(normal)
 
 	go g.watchStdinChan()
@@ -45,8 +59,6 @@ func NewGame(conf *tomlconf.Game, manager *Manager) (*Game, error) {
 		return nil, err
 	}
 
-	manager.bot.JoinChannel(conf.Chat.BridgedChannel)
-
 	return g, nil
 }
 
@@ -58,8 +70,10 @@ type formatSet struct {
 	nick     *format.Format
 	quit     *format.Format
 	kick     *format.Format
+	topic    *format.Format
+	mode     *format.Format
+	notice   *format.Format
 	external *format.Format
-	storage  *format.Storage
 }
 
 // Game represents a game server and its transport
@@ -70,13 +84,21 @@ type Game struct {
 	transport      transport.Transport
 	manager        *Manager
 	status         mutexTypes.Int
-	autoRestart    int
+	restart        restartPolicy
+	pendingRestart mutexTypes.Bool
 	autoStart      mutexTypes.Bool
 	regexpManager  *RegexpManager
 	stdinChan      chan []byte
 	preRollRe      *regexp.Regexp
 	preRollReplace string
 	chatBridge     *chatBridge
+	scheduler      *cron.Cron
+	logs           outputLog
+	topics         *topicSetter
+	players        *playerTracker
+
+	stepMu   sync.Mutex
+	stepDone chan struct{} // Closed once the current or last runStep has returned
 }
 
 // Sentinel errors
@@ -85,9 +107,20 @@ var (
 	ErrGameNotRunning = errors.New("game is not running")
 )
 
-func (g *Game) runStep() bool {
+// runStep runs the game once, returning its exit code and whether or not it can be restarted. Games that were stopped,
+// or that could not be started at all, can not be restarted
+func (g *Game) runStep() (int, bool) {
+	done := make(chan struct{})
+	defer close(done)
+
+	g.stepMu.Lock()
+	g.stepDone = done
+	g.stepMu.Unlock()
+
 	g.sendToBridgedChannel("starting")
+	g.sendToWebhooks(webhook.Event{Type: tomlconf.WebhookStart, Message: "starting"})
 	g.status.Set(normal)
+	g.renderTopic()
 
 	start := make(chan struct{})
 	wg := new(sync.WaitGroup)
@@ -95,32 +128,88 @@ func (g *Game) runStep() bool {
 
 	go g.monitorStdIO(start, wg)
 
+	stopPolling := make(chan struct{})
+	go g.pollPlayers(stopPolling)
+
 	code, humanStatus, err := g.transport.Run(start)
 
 	wg.Wait()
+	close(stopPolling)
+	g.players.reset()
+
+	g.manager.metrics.exitCode.Set(float64(code), g.name)
 
 	if err != nil && !(errors.Is(err, util.ErrorAlreadyRunning) || strings.HasPrefix(err.Error(), "exit status")) {
-		return false
+		g.sendToWebhooks(webhook.Event{Type: tomlconf.WebhookCrash, Message: fmt.Sprintf("could not be run: %s", err)})
+		return code, false
 	}
 
 	g.sendToBridgedChannel(humanStatus)
+	g.notifyExit(code, humanStatus)
+
+	return code, g.status.Get() != killed
+}
+
+// waitForStep waits up to timeout for any running runStep to return, and so to have sent its exit notifications
+func (g *Game) waitForStep(timeout time.Duration) {
+	g.stepMu.Lock()
+	done := g.stepDone
+	g.stepMu.Unlock()
 
-	if g.status.Get() == killed || code != 0 || g.autoRestart <= 0 {
-		return false
+	if done == nil {
+		return
 	}
 
-	return true
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		g.Warnf("game did not finish exiting within %s", timeout)
+	}
 }
 
 // Run starts the given game if it is not already running. Note that this method blocks until the game exits, meaning
-// you will probably want to use it in a goroutine
+// you will probably want to use it in a goroutine. The game is restarted according to its restart policy, with
+// increasing delays between quick exits, and is given up on entirely if it exits too often
 func (g *Game) Run() error {
-	for g.runStep() {
-		g.sendToBridgedChannel(fmt.Sprintf("Clean exit. Restarting in %d seconds", g.autoRestart))
-		time.Sleep(time.Second * time.Duration(g.autoRestart))
-	}
+	tracker := new(restartTracker)
 
-	return nil
+	for {
+		started := time.Now()
+
+		code, canRestart := g.runStep()
+		if !canRestart || !g.restart.shouldRestart(code) || g.manager.status.Get() == shutdown {
+			return nil
+		}
+
+		delay, crashLoop := tracker.record(time.Now(), time.Since(started), g.restart)
+		if crashLoop {
+			msg := fmt.Sprintf(
+				"exited %d times in %s, not restarting. Start it manually once the problem is fixed",
+				len(tracker.exits), g.restart.window,
+			)
+
+			g.sendToBridgedChannel(msg)
+			g.manager.sendAdminMessage(g.prefixMsg(msg))
+
+			return nil
+		}
+
+		g.manager.metrics.restarts.Inc(g.name)
+
+		if code == 0 {
+			g.sendToBridgedChannel(fmt.Sprintf("Clean exit. Restarting in %s", delay))
+		} else {
+			g.sendToBridgedChannel(fmt.Sprintf("Exited with code %d. Restarting in %s", code, delay))
+		}
+
+		g.pendingRestart.Set(true)
+		time.Sleep(delay)
+		g.pendingRestart.Set(false)
+
+		if g.status.Get() == killed || g.manager.status.Get() == shutdown {
+			return nil
+		}
+	}
 }
 
 func (g *Game) validateConfig(conf *tomlconf.Game) error {
@@ -129,7 +218,7 @@ func (g *Game) validateConfig(conf *tomlconf.Game) error {
 		return fmt.Errorf("invalid config name")
 	}
 
-	if conf.Chat.BridgedChannel == "" {
+	if len(conf.Chat.AllChannels()) == 0 {
 		g.Warn("cannot have an empty bridged channel. bailing out of reload")
 		return fmt.Errorf("cannot have an empty bridged channel")
 	}
@@ -137,6 +226,55 @@ func (g *Game) validateConfig(conf *tomlconf.Game) error {
 	return nil
 }
 
+// resolveChannels returns all of the channels configured on the given config, with their connections resolved
+// to connections that exist on the manager
+func (g *Game) resolveChannels(conf *tomlconf.Game) ([]*bridgedChannel, error) {
+	channels := make([]*bridgedChannel, 0, len(conf.Chat.AllChannels()))
+
+	for _, c := range conf.Chat.AllChannels() {
+		if c.Connection == "" {
+			c.Connection = g.manager.defaultConnection()
+		}
+
+		if c.Connection == "" {
+			return nil, fmt.Errorf("channel %q has no connection set, and there is no default connection", c.Name)
+		}
+
+		if g.manager.getBot(c.Connection) == nil {
+			return nil, fmt.Errorf("channel %q is on connection %q, which does not exist", c.Name, c.Connection)
+		}
+
+		bc, err := newBridgedChannel(c)
+		if err != nil {
+			return nil, err
+		}
+
+		channels = append(channels, bc)
+	}
+
+	return channels, nil
+}
+
+// joinNewChannels joins any channel in the given list that is not currently bridged
+func (g *Game) joinNewChannels(channels []*bridgedChannel) {
+outer:
+	for _, c := range channels {
+		if c.Name == "*" {
+			continue
+		}
+
+		if g.chatBridge != nil {
+			for _, existing := range g.chatBridge.channels {
+				if existing.Connection == c.Connection && existing.Name == c.Name {
+					continue outer
+				}
+			}
+		}
+
+		g.manager.getBot(c.Connection).JoinChannel(c.Name)
+	}
+}
+
 // UpdateFromConfig updates the game object with the data from the config object.
 func (g *Game) UpdateFromConfig(conf *tomlconf.Game) error {
 	// Do as many of our checks as we can first before actually changing data, meaning that we can (hopefully)
@@ -145,6 +283,11 @@ func (g *Game) UpdateFromConfig(conf *tomlconf.Game) error {
 		return err
 	}
 
+	channels, err := g.resolveChannels(conf)
+	if err != nil {
+		return err
+	}
+
 	g.comment = conf.Comment
 
 	root := template.New(fmt.Sprintf("%s root", conf.Name))
@@ -154,10 +297,34 @@ func (g *Game) UpdateFromConfig(conf *tomlconf.Game) error {
 		return fmt.Errorf("could not compile formats: %s", err)
 	}
 
+	if err := g.compileChannelFormats(conf, channels, root); err != nil {
+		return fmt.Errorf("could not compile channel formats: %s", err)
+	}
+
 	if err := g.regexpManager.UpdateFromConf(conf.Regexps, root); err != nil {
 		return fmt.Errorf("could not update regexps from config: %s", err)
 	}
 
+	schedule, err := g.compileSchedule(conf.Schedule, root)
+	if err != nil {
+		return fmt.Errorf("could not update schedule from config: %w", err)
+	}
+
+	topic, err := g.compileTopic(conf.Chat.Topic, root)
+	if err != nil {
+		return err
+	}
+
+	restart, err := newRestartPolicy(conf.AutoRestart, conf.Restart)
+	if err != nil {
+		return err
+	}
+
+	players, err := newPlayerConfig(conf.Players)
+	if err != nil {
+		return err
+	}
+
 	var preRollRe *regexp.Regexp
 
 	if conf.PreRoll.Regexp != "" {
@@ -169,11 +336,20 @@ func (g *Game) UpdateFromConfig(conf *tomlconf.Game) error {
 		preRollRe = re
 	}
 
+	g.joinNewChannels(channels)
+
 	if g.chatBridge == nil {
 		g.chatBridge = new(chatBridge)
 	}
 
-	g.chatBridge.update(conf, outFmts)
+	g.chatBridge.update(conf, outFmts, channels)
+
+	if err := g.updateStorage(conf.StoragePath); err != nil {
+		return err
+	}
+
+	g.topics.update(time.Duration(conf.Chat.TopicInterval)*time.Second, topic)
+	g.chatBridge.storage.OnChange(g.renderTopic)
 
 	if err := g.setupTransformer(conf); err != nil {
 		return fmt.Errorf("could not update game %q's config: %w", conf.Name, err)
@@ -204,10 +380,21 @@ func (g *Game) UpdateFromConfig(conf *tomlconf.Game) error {
 
 	g.Info("transport reloaded successfully")
 	g.autoStart.Set(conf.AutoStart)
-	g.autoRestart = conf.AutoRestart // TODO: maybe check for 0 here; and/or check for restart loop
+	g.restart = restart
 
 	g.preRollRe = preRollRe
 	g.preRollReplace = conf.PreRoll.Replace
+	g.players.update(players)
+
+	g.updateSchedule(schedule)
+
+	if g.IsRunning() {
+		g.renderTopic()
+	}
+
+	if err := g.logs.update(conf.Name, conf.Logs); err != nil {
+		g.Warnf("could not close old log file: %s", err)
+	}
 
 	g.Info("reload completed successfully")
 
@@ -216,8 +403,47 @@ func (g *Game) UpdateFromConfig(conf *tomlconf.Game) error {
 
 // compileFormats compiles all the formats for the game. If one is nil....
 func (g *Game) compileFormats(gameConf *tomlconf.Game, root *template.Template) (*formatSet, error) {
-	fmts := gameConf.Chat.Formats
+	outFmts, err := compileFormatSet("", gameConf.Chat.Formats, root)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, fmtStr := range gameConf.Chat.Formats.Extra {
+		// we dont need to actually return this, because its attached to root already
+		extra := &format.Format{FormatString: fmtStr}
+		if err := extra.Compile(name, root); err != nil {
+			return nil, fmt.Errorf("could not compile extra format %q: %w", name, err)
+		}
+	}
 
+	return outFmts, nil
+}
+
+// compileChannelFormats compiles the format overrides for any channel that has them. Channel formats are layered over
+// the game's formats
+func (g *Game) compileChannelFormats(
+	gameConf *tomlconf.Game, channels []*bridgedChannel, root *template.Template,
+) error {
+	for _, c := range channels {
+		if c.Formats == nil {
+			continue
+		}
+
+		prefix := fmt.Sprintf("%s/%s/", c.Connection, c.Name)
+
+		fmts, err := compileFormatSet(prefix, gameConf.Chat.Formats.WithOverrides(c.Formats), root)
+		if err != nil {
+			return fmt.Errorf("channel %q: %w", c.Name, err)
+		}
+
+		c.format = fmts
+	}
+
+	return nil
+}
+
+// compileFormatSet compiles the given set of formats onto root, with the given prefix on their names
+func compileFormatSet(prefix string, fmts tomlconf.FormatSet, root *template.Template) (*formatSet, error) {
 	const cantCompile = "could not compile format %s: %w"
 
 	var (
@@ -232,7 +458,7 @@ func (g *Game) compileFormats(gameConf *tomlconf.Game, root *template.Template)
 
 		*target = &format.Format{FormatString: *fmtString}
 
-		return (*target).Compile(name, root)
+		return (*target).Compile(prefix+name, root)
 	}
 
 	if err := compile("message", fmts.Message, &outFmts.message); err != nil {
@@ -259,16 +485,20 @@ func (g *Game) compileFormats(gameConf *tomlconf.Game, root *template.Template)
 		return nil, fmt.Errorf(cantCompile, "kick", err)
 	}
 
-	if err := compile("external", fmts.External, &outFmts.external); err != nil {
-		return nil, fmt.Errorf(cantCompile, "external", err)
+	if err := compile("topic", fmts.Topic, &outFmts.topic); err != nil {
+		return nil, fmt.Errorf(cantCompile, "topic", err)
 	}
 
-	for name, fmtStr := range fmts.Extra {
-		// we dont need to actually return this, because its attached to root already
-		extra := &format.Format{FormatString: fmtStr}
-		if err := extra.Compile(name, root); err != nil {
-			return nil, fmt.Errorf("could not compile extra format %q: %w", name, err)
-		}
+	if err := compile("mode", fmts.Mode, &outFmts.mode); err != nil {
+		return nil, fmt.Errorf(cantCompile, "mode", err)
+	}
+
+	if err := compile("notice", fmts.Notice, &outFmts.notice); err != nil {
+		return nil, fmt.Errorf(cantCompile, "notice", err)
+	}
+
+	if err := compile("external", fmts.External, &outFmts.external); err != nil {
+		return nil, fmt.Errorf(cantCompile, "external", err)
 	}
 
 	outFmts.root = root
@@ -302,6 +532,13 @@ func (g *Game) String() string {
 // the transport is sent SIGKILL
 func (g *Game) StopOrKillTimeout(timeout time.Duration) error {
 	if !g.transport.IsRunning() {
+		if g.pendingRestart.Get() {
+			g.status.Set(killed)
+			g.sendToBridgedChannel("cancelled pending restart")
+
+			return nil
+		}
+
 		if g.manager.status.Get() != shutdown {
 			g.sendToBridgedChannel("cannot stop a non-running game")
 		}
@@ -0,0 +1,149 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+)
+
+// Event types that can be bridged between a game and a channel. The first set are from chat to the game, the second
+// are from the game to chat
+const (
+	eventMessage = "message"
+	eventJoin    = "join"
+	eventPart    = "part"
+	eventQuit    = "quit"
+	eventNick    = "nick"
+	eventKick    = "kick"
+	eventTopic   = "topic"
+	eventMode    = "mode"
+	eventNotice  = "notice"
+
+	eventChat   = "chat"   // messages sent to chat by regexps and templates
+	eventStatus = "status" // game status messages, eg starting and stopping
+	eventDump   = "dump"   // stdout and stderr dumps
+)
+
+var knownEvents = []string{
+	eventMessage, eventJoin, eventPart, eventQuit, eventNick, eventKick, eventTopic, eventMode, eventNotice, eventChat,
+	eventStatus, eventDump,
+}
+
+// bridgedChannel is a channel that a game bridges to, along with the settings for that channel
+type bridgedChannel struct {
+	tomlconf.BridgedChannel
+	in     bool
+	out    bool
+	events map[string]bool // nil means all events
+	format *formatSet      // nil means the game's formats
+}
+
+func newBridgedChannel(conf tomlconf.BridgedChannel) (*bridgedChannel, error) {
+	out := &bridgedChannel{BridgedChannel: conf}
+
+	switch strings.ToLower(conf.Direction) {
+	case tomlconf.DirectionBoth, "":
+		out.in, out.out = true, true
+	case tomlconf.DirectionIn:
+		out.in = true
+	case tomlconf.DirectionOut:
+		out.out = true
+	default:
+		return nil, fmt.Errorf("channel %q has an invalid direction %q", conf.Name, conf.Direction)
+	}
+
+	if len(conf.Events) == 0 {
+		return out, nil
+	}
+
+	out.events = make(map[string]bool, len(conf.Events))
+
+outer:
+	for _, e := range conf.Events {
+		e = strings.ToLower(e)
+		for _, known := range knownEvents {
+			if e == known {
+				out.events[e] = true
+				continue outer
+			}
+		}
+
+		return nil, fmt.Errorf("channel %q has an unknown event type %q", conf.Name, e)
+	}
+
+	return out, nil
+}
+
+// wants returns whether or not the channel accepts the given event type
+func (c *bridgedChannel) wants(event string) bool {
+	return c.events == nil || c.events[event]
+}
+
+// matches returns whether or not the channel matches the given connection and target. An empty target matches any
+// channel on the connection
+func (c *bridgedChannel) matches(conn, target string) bool {
+	return c.Connection == conn && (target == "" || c.Name == "*" || c.Name == target)
+}
+
+// inboundChannel returns the first bridged channel that accepts the given event from the given connection and target,
+// or nil if there is none
+func (g *Game) inboundChannel(conn, target, event string) *bridgedChannel {
+	if !g.chatBridge.shouldBridge || !g.transport.IsRunning() {
+		return nil
+	}
+
+	for _, c := range g.chatBridge.channels {
+		if c.in && c.wants(event) && c.matches(conn, target) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// inboundChannelIn returns the first bridged channel that accepts the given event from the given connection and any of
+// the given channels. nil channels means the connection does not know which channels the event applies to, in which
+// case any channel on the connection matches
+func (g *Game) inboundChannelIn(conn string, channels []string, event string) *bridgedChannel {
+	if channels == nil {
+		return g.inboundChannel(conn, "", event)
+	}
+
+	for _, name := range channels {
+		if c := g.inboundChannel(conn, name, event); c != nil {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// formatsFor returns the formats to use for events from the given channel
+func (g *Game) formatsFor(c *bridgedChannel) *formatSet {
+	if c.format != nil {
+		return c.format
+	}
+
+	return &g.chatBridge.format
+}
+
+// sendToChannels sends the given message to all of the game's bridged channels that accept the given event
+func (g *Game) sendToChannels(event string, args ...interface{}) {
+	msg := g.prefixMsg(args...)
+
+	for _, c := range g.chatBridge.channels {
+		if c.Name == "*" || !c.out || !c.wants(event) {
+			continue
+		}
+
+		bot := g.manager.getBot(c.Connection)
+		if b, ok := bot.(interfaces.BridgeMessager); ok {
+			b.SendBridgeMessage(c.Name, msg)
+			continue
+		}
+
+		bot.SendMessage(c.Name, msg)
+	}
+}
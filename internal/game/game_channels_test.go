@@ -0,0 +1,177 @@
+package game
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+func TestNewBridgedChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    tomlconf.BridgedChannel
+		in      bool
+		out     bool
+		wants   []string
+		notWant []string
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			conf:  tomlconf.BridgedChannel{Name: "#test"},
+			in:    true,
+			out:   true,
+			wants: knownEvents,
+		},
+		{
+			name:    "in only",
+			conf:    tomlconf.BridgedChannel{Name: "#test", Direction: "in", Events: []string{"message", "JOIN"}},
+			in:      true,
+			wants:   []string{eventMessage, eventJoin},
+			notWant: []string{eventKick, eventStatus},
+		},
+		{
+			name:    "out only",
+			conf:    tomlconf.BridgedChannel{Name: "#test", Direction: "out", Events: []string{"status"}},
+			out:     true,
+			wants:   []string{eventStatus},
+			notWant: []string{eventChat, eventDump},
+		},
+		{
+			name:    "bad direction",
+			conf:    tomlconf.BridgedChannel{Name: "#test", Direction: "sideways"},
+			wantErr: true,
+		},
+		{
+			name:    "bad event",
+			conf:    tomlconf.BridgedChannel{Name: "#test", Events: []string{"message", "explosions"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newBridgedChannel(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newBridgedChannel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.in != tt.in || got.out != tt.out {
+				t.Errorf("newBridgedChannel() in, out = %t, %t; want %t, %t", got.in, got.out, tt.in, tt.out)
+			}
+
+			for _, e := range tt.wants {
+				if !got.wants(e) {
+					t.Errorf("wants(%q) = false, want true", e)
+				}
+			}
+
+			for _, e := range tt.notWant {
+				if got.wants(e) {
+					t.Errorf("wants(%q) = true, want false", e)
+				}
+			}
+		})
+	}
+}
+
+func TestBridgedChannel_matches(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		conn    string
+		target  string
+		want    bool
+	}{
+		{name: "exact", channel: "#test", conn: "default", target: "#test", want: true},
+		{name: "other channel", channel: "#test", conn: "default", target: "#other", want: false},
+		{name: "other connection", channel: "#test", conn: "other", target: "#test", want: false},
+		{name: "any target", channel: "#test", conn: "default", target: "", want: true},
+		{name: "wildcard", channel: "*", conn: "default", target: "#other", want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := &bridgedChannel{BridgedChannel: tomlconf.BridgedChannel{Connection: "default", Name: tt.channel}}
+			if got := c.matches(tt.conn, tt.target); got != tt.want {
+				t.Errorf("matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+type trackingBot struct {
+	*nullconn.NullConn
+	members map[string][]interfaces.ChannelMember
+}
+
+func (b *trackingBot) ChannelMembers(channel string) []interfaces.ChannelMember {
+	return b.members[channel]
+}
+func (b *trackingBot) UserChannels(string) []string { return nil }
+
+func TestGame_templChatUsers(t *testing.T) {
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+	bots := map[string]interfaces.Bot{
+		"default": &trackingBot{NullConn: nullconn.New(logger), members: map[string][]interfaces.ChannelMember{
+			"#one": {{Nick: "a", Prefix: "@"}, {Nick: "C"}},
+			"#two": {{Nick: "A"}, {Nick: "b", Away: true}},
+			"#out": {{Nick: "out"}},
+		}},
+		"untracked": nullconn.New(logger),
+	}
+
+	m, err := NewManager(&tomlconf.Config{}, bots, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var channels []*bridgedChannel
+
+	for _, c := range []tomlconf.BridgedChannel{
+		{Connection: "default", Name: "#one"},
+		{Connection: "default", Name: "#two"},
+		{Connection: "default", Name: "#out", Direction: tomlconf.DirectionOut},
+		{Connection: "default", Name: "*"},
+		{Connection: "untracked", Name: "#one"},
+	} {
+		bc, err := newBridgedChannel(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		channels = append(channels, bc)
+	}
+
+	g := &Game{manager: m, chatBridge: &chatBridge{channels: channels}}
+
+	tests := []struct {
+		name  string
+		names []string
+		want  []interfaces.ChannelMember
+	}{
+		{name: "all", want: []interfaces.ChannelMember{{Nick: "a", Prefix: "@"}, {Nick: "b", Away: true}, {Nick: "C"}}},
+		{name: "named", names: []string{"#TWO"}, want: []interfaces.ChannelMember{{Nick: "A"}, {Nick: "b", Away: true}}},
+		{name: "outbound only", names: []string{"#out"}, want: []interfaces.ChannelMember{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.templChatUsers(tt.names...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templChatUsers(%q) = %+v, want %+v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package game
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
@@ -16,35 +18,76 @@ type chatBridge struct {
 	dumpStdout    bool
 	dumpStderr    bool
 	allowForwards bool
+	forwardsAllow []string
+	forwardsDeny  []string
 	stripMasks    []string
-	channel       string
+	channels      []*bridgedChannel
 	format        formatSet
+	storage       *format.Storage
+	storagePath   string
 	transformer   transformer.Transformer
 }
 
-func (c *chatBridge) update(gc *tomlconf.Game, fmtSet *formatSet) {
+func (c *chatBridge) update(gc *tomlconf.Game, fmtSet *formatSet, channels []*bridgedChannel) {
 	conf := gc.Chat
 	c.shouldBridge = conf.BridgeChat
 	c.dumpStdout = conf.DumpStdout
 	c.dumpStderr = conf.DumpStderr
 	c.allowForwards = conf.AllowForwards
-	c.channel = conf.BridgedChannel
+	c.forwardsAllow = conf.ForwardsAllow
+	c.forwardsDeny = conf.ForwardsDeny
+	c.channels = channels
 
 	c.format = *fmtSet
 
-	if c.format.storage == nil {
-		c.format.storage = new(format.Storage)
+	if c.storage == nil {
+		c.storage = new(format.Storage)
 	}
 }
 
+// updateStorage sets the file the game's storage is saved to, saving to the old file first if it changed
+func (g *Game) updateStorage(path string) error {
+	if path == g.chatBridge.storagePath {
+		return nil
+	}
+
+	if err := g.chatBridge.storage.Flush(); err != nil {
+		g.Warnf("could not save storage before changing its path: %s", err)
+	}
+
+	var p format.Persister
+	if path != "" {
+		p = &format.FilePersister{Path: path}
+	}
+
+	if err := g.chatBridge.storage.SetPersister(p, g.checkError); err != nil {
+		return fmt.Errorf("could not set up storage for %q: %w", g.name, err)
+	}
+
+	g.chatBridge.storagePath = path
+
+	return nil
+}
+
+// FlushStorage saves the game's storage immediately if it has unsaved changes
+func (g *Game) FlushStorage() error {
+	if g.chatBridge == nil {
+		return nil
+	}
+
+	return g.chatBridge.storage.Flush()
+}
+
 type dataForFmt struct {
 	game         *Game
+	Connection   string
 	SourceRaw    string
 	MsgRaw       string
 	Target       string
 	MatchesStrip bool
 	ExtraData    map[string]string
 	Storage      *format.Storage
+	Time         time.Time
 }
 
 // MsgEscaped returns the message in an escaped format
@@ -57,7 +100,19 @@ func (d *dataForFmt) MsgMapped() string { return d.game.chatBridge.transformer.T
 func (d *dataForFmt) MsgStripped() string { return tokeniser.Strip(d.MsgRaw) }
 
 // Source returns the source in a human readable form
-func (d *dataForFmt) Source() string { return d.game.manager.bot.HumanReadableSource(d.SourceRaw) }
+func (d *dataForFmt) Source() string {
+	if bot := d.game.manager.getBot(d.Connection); bot != nil {
+		return bot.HumanReadableSource(d.SourceRaw)
+	}
+
+	return d.SourceRaw
+}
+
+// Players returns the names of the players online in the game
+func (d *dataForFmt) Players() []string { return d.game.players.list() }
+
+// PlayerCount returns the number of players online in the game
+func (d *dataForFmt) PlayerCount() int { return len(d.game.players.list()) }
 
 // MapString applies the game's transformer to the given string
 func (d *dataForFmt) MapString(in ...string) string {
@@ -73,60 +128,82 @@ func (d *dataForFmt) InvokeTemplate(name string, args interface{}) (string, erro
 	return out.String(), nil
 }
 
-// This should always be given intermediate format data
-func (g *Game) makeDataForFormat(source, target, msg string) *dataForFmt {
+// This should always be given intermediate format data. conn may be empty for data that did not come from chat
+func (g *Game) makeDataForFormat(conn, source, target, msg string) *dataForFmt {
 	deZwsp := strings.ReplaceAll(msg, "\u200b", "")
 
 	return &dataForFmt{
 		game:         g,
+		Connection:   conn,
 		SourceRaw:    source,
 		Target:       target,
 		MsgRaw:       deZwsp,
 		MatchesStrip: util.AnyMaskMatch(source, g.chatBridge.stripMasks),
 		ExtraData:    make(map[string]string),
-		Storage:      g.chatBridge.format.storage,
-	}
-}
-
-func (g *Game) shouldBridge(target string) bool {
-	if !g.chatBridge.shouldBridge || !g.transport.IsRunning() {
-		return false
+		Storage:      g.chatBridge.storage,
+		Time:         time.Now(),
 	}
-
-	return g.chatBridge.channel == "*" || g.chatBridge.channel == target
 }
 
 type dataForPrivmsg struct {
 	dataForFmt
-	IsAction bool
+	IsAction      bool
+	MsgID         string
+	ReplyTo       string
+	ReplyToSource string
+	ReplyToMsg    string
+}
+
+// ReplyToSourceName returns the source of the message this is a reply to in a human readable form
+func (d *dataForPrivmsg) ReplyToSourceName() string {
+	if bot := d.game.manager.getBot(d.Connection); bot != nil && d.ReplyToSource != "" {
+		return bot.HumanReadableSource(d.ReplyToSource)
+	}
+
+	return d.ReplyToSource
 }
 
 // OnMessage is a callback that is fired when a PRIVMSG is received from IRC
-func (g *Game) OnMessage(source, target, msg string, isAction bool) {
-	if !g.shouldBridge(target) || g.chatBridge.format.message == nil {
+func (g *Game) OnMessage(conn, source, target, msg string, isAction bool, meta interfaces.MessageMeta) {
+	c := g.inboundChannel(conn, target, eventMessage)
+	if c == nil || g.formatsFor(c).message == nil {
 		return
 	}
 
-	data := dataForPrivmsg{*g.makeDataForFormat(source, target, msg), isAction}
-	g.checkError(g.SendFormattedLine(&data, g.chatBridge.format.message))
+	data := dataForPrivmsg{
+		dataForFmt:    *g.makeDataForFormat(conn, source, target, msg),
+		IsAction:      isAction,
+		MsgID:         meta.ID,
+		ReplyTo:       meta.ReplyTo,
+		ReplyToSource: meta.ReplyToSource,
+		ReplyToMsg:    meta.ReplyToMessage,
+	}
+
+	if !meta.Time.IsZero() {
+		data.Time = meta.Time
+	}
+
+	g.checkError(g.SendFormattedLine(&data, g.formatsFor(c).message))
 }
 
 // OnJoin is a callback that is fired when a user joins any channel
-func (g *Game) OnJoin(source, channel string) {
-	if !g.shouldBridge(channel) || g.chatBridge.format.join == nil {
+func (g *Game) OnJoin(conn, source, channel string) {
+	c := g.inboundChannel(conn, channel, eventJoin)
+	if c == nil || g.formatsFor(c).join == nil {
 		return
 	}
 
-	g.checkError(g.SendFormattedLine(g.makeDataForFormat(source, channel, ""), g.chatBridge.format.join))
+	g.checkError(g.SendFormattedLine(g.makeDataForFormat(conn, source, channel, ""), g.formatsFor(c).join))
 }
 
 // OnPart is a callback that is fired when a user leaves a channel
-func (g *Game) OnPart(source, target, message string) {
-	if !g.shouldBridge(target) || g.chatBridge.format.part == nil {
+func (g *Game) OnPart(conn, source, target, message string) {
+	c := g.inboundChannel(conn, target, eventPart)
+	if c == nil || g.formatsFor(c).part == nil {
 		return
 	}
 
-	g.checkError(g.SendFormattedLine(g.makeDataForFormat(source, target, message), g.chatBridge.format.part))
+	g.checkError(g.SendFormattedLine(g.makeDataForFormat(conn, source, target, message), g.formatsFor(c).part))
 }
 
 type dataForNick struct {
@@ -135,23 +212,25 @@ type dataForNick struct {
 }
 
 // OnNick is a callback that is fired when a user changes their nickname
-func (g *Game) OnNick(source, newnick string) {
-	if g.chatBridge.format.nick == nil {
+func (g *Game) OnNick(conn, source, newnick string, channels []string) {
+	c := g.inboundChannelIn(conn, channels, eventNick)
+	if c == nil || g.formatsFor(c).nick == nil {
 		return
 	}
 
-	data := dataForNick{*g.makeDataForFormat(source, "", ""), newnick}
-	g.checkError(g.SendFormattedLine(&data, g.chatBridge.format.nick))
+	data := dataForNick{*g.makeDataForFormat(conn, source, "", ""), newnick}
+	g.checkError(g.SendFormattedLine(&data, g.formatsFor(c).nick))
 }
 
 // OnQuit is a callback that is fired when a user quits from IRC
-func (g *Game) OnQuit(source, message string) {
-	if g.chatBridge.format.quit == nil {
+func (g *Game) OnQuit(conn, source, message string, channels []string) {
+	c := g.inboundChannelIn(conn, channels, eventQuit)
+	if c == nil || g.formatsFor(c).quit == nil {
 		return
 	}
 
-	data := g.makeDataForFormat(source, "", message)
-	g.checkError(g.SendFormattedLine(&data, g.chatBridge.format.quit))
+	data := g.makeDataForFormat(conn, source, "", message)
+	g.checkError(g.SendFormattedLine(data, g.formatsFor(c).quit))
 }
 
 type dataForKick struct {
@@ -160,13 +239,76 @@ type dataForKick struct {
 }
 
 // OnKick is a callback that is fired when a user kicks another user from the channel
-func (g *Game) OnKick(source, channel, kickee, message string) {
-	if !g.shouldBridge(channel) || g.chatBridge.format.kick == nil {
+func (g *Game) OnKick(conn, source, channel, kickee, message string) {
+	c := g.inboundChannel(conn, channel, eventKick)
+	if c == nil || g.formatsFor(c).kick == nil {
 		return
 	}
 
-	data := dataForKick{*g.makeDataForFormat(source, channel, message), kickee}
-	g.checkError(g.SendFormattedLine(&data, g.chatBridge.format.kick))
+	data := dataForKick{*g.makeDataForFormat(conn, source, channel, message), kickee}
+	g.checkError(g.SendFormattedLine(&data, g.formatsFor(c).kick))
+}
+
+// OnTopic is a callback that is fired when a channel's topic is changed
+func (g *Game) OnTopic(conn, source, channel, topic string) {
+	c := g.inboundChannel(conn, channel, eventTopic)
+	if c == nil || g.formatsFor(c).topic == nil {
+		return
+	}
+
+	g.checkError(g.SendFormattedLine(g.makeDataForFormat(conn, source, channel, topic), g.formatsFor(c).topic))
+}
+
+type dataForMode struct {
+	dataForFmt
+	Changes []interfaces.ModeChange
+}
+
+// Bans returns the masks that were banned by the mode change
+func (d *dataForMode) Bans() []string { return d.masks(true) }
+
+// Unbans returns the masks that were unbanned by the mode change
+func (d *dataForMode) Unbans() []string { return d.masks(false) }
+
+func (d *dataForMode) masks(adding bool) []string {
+	var out []string
+
+	for _, c := range d.Changes {
+		if c.Mode == "b" && c.Adding == adding && c.Arg != "" {
+			out = append(out, c.Arg)
+		}
+	}
+
+	return out
+}
+
+// OnMode is a callback that is fired when a channel's modes are changed. The message is the changes, as IRC would
+// show them
+func (g *Game) OnMode(conn, source, channel string, changes []interfaces.ModeChange) {
+	c := g.inboundChannel(conn, channel, eventMode)
+	if c == nil || g.formatsFor(c).mode == nil || len(changes) == 0 {
+		return
+	}
+
+	strs := make([]string, 0, len(changes))
+	for _, change := range changes {
+		strs = append(strs, change.String())
+	}
+
+	// Masks can contain $ (eg extbans), which is special in the intermediate format
+	msg := strings.ReplaceAll(strings.Join(strs, ", "), "$", "$$")
+	data := dataForMode{*g.makeDataForFormat(conn, source, channel, msg), changes}
+	g.checkError(g.SendFormattedLine(&data, g.formatsFor(c).mode))
+}
+
+// OnNotice is a callback that is fired when a NOTICE is sent to a channel
+func (g *Game) OnNotice(conn, source, channel, message string) {
+	c := g.inboundChannel(conn, channel, eventNotice)
+	if c == nil || g.formatsFor(c).notice == nil {
+		return
+	}
+
+	g.checkError(g.SendFormattedLine(g.makeDataForFormat(conn, source, channel, message), g.formatsFor(c).notice))
 }
 
 // SendLineFromOtherGame Is a frontend for sending messages to a game from other games. If the game in source is the
@@ -184,16 +326,32 @@ func (g *Game) SendLineFromOtherGame(msg string, source interfaces.Game) {
 		return
 	}
 
+	if source != g && !g.acceptsForwardsFrom(source.GetName()) {
+		g.Logger.Tracef("dropping forward from %q as it is not allowed: %q", source.GetName(), msg)
+		return
+	}
+
 	name := "LOCAL"
 
 	if source != g {
 		name = source.GetName()
 	}
 
-	data := g.makeDataForFormat(name, "", util.StripAll(msg))
+	data := g.makeDataForFormat("", name, "", util.StripAll(msg))
 	g.checkError(g.SendFormattedLine(data, g.chatBridge.format.external))
 }
 
+// acceptsForwardsFrom returns whether or not the game accepts messages from the named game, according to its allow and
+// deny lists. Denies take priority over allows
+func (g *Game) acceptsForwardsFrom(name string) bool {
+	routes := &g.manager.routes
+	if routes.matches(g.chatBridge.forwardsDeny, name) {
+		return false
+	}
+
+	return len(g.chatBridge.forwardsAllow) == 0 || routes.matches(g.chatBridge.forwardsAllow, name)
+}
+
 // SendFormattedLine executes the given format with the given data and sends the result to the transport's STDIN
 func (g *Game) SendFormattedLine(d interface{}, fmt *format.Format) error {
 	if !g.IsRunning() {
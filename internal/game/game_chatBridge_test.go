@@ -0,0 +1,26 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+)
+
+func TestDataForMode_Bans(t *testing.T) {
+	d := &dataForMode{Changes: []interfaces.ModeChange{
+		{Adding: true, Mode: "b", Arg: "*!*@one"},
+		{Mode: "b", Arg: "*!*@two"},
+		{Adding: true, Mode: "o", Arg: "someone"},
+		{Adding: true, Mode: "b", Arg: "$a:account"},
+		{Adding: true, Mode: "b"},
+	}}
+
+	if got, want := d.Bans(), []string{"*!*@one", "$a:account"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Bans() = %q, want %q", got, want)
+	}
+
+	if got, want := d.Unbans(), []string{"*!*@two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unbans() = %q, want %q", got, want)
+	}
+}
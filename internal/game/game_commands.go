@@ -37,7 +37,7 @@ func (g *Game) registerCommand(name string, conf tomlconf.Command) error {
 		return err
 	}
 
-	return g.manager.Cmd.AddSubCommand(
+	return g.manager.Cmd.AddGameSubCommand(
 		g.name,
 		name,
 		conf.RequiresAdmin,
@@ -0,0 +1,295 @@
+package game
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
+)
+
+// Defaults for output logs
+const (
+	defaultScrollback  = 500
+	defaultLogMaxSize  = 10 * 1024 // KiB
+	defaultLogMaxFiles = 5
+)
+
+// scrollback is a fixed size ring buffer of the most recent lines of output from a game
+type scrollback struct {
+	lines []OutputLine
+	start int
+	count int
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{lines: make([]OutputLine, size)}
+}
+
+// add adds a line to the buffer, overwriting the oldest line if it is full
+func (s *scrollback) add(line OutputLine) {
+	if len(s.lines) == 0 {
+		return
+	}
+
+	s.lines[(s.start+s.count)%len(s.lines)] = line
+
+	if s.count < len(s.lines) {
+		s.count++
+	} else {
+		s.start = (s.start + 1) % len(s.lines)
+	}
+}
+
+// all returns every line in the buffer, oldest first
+func (s *scrollback) all() []OutputLine {
+	out := make([]OutputLine, 0, s.count)
+	for i := 0; i < s.count; i++ {
+		out = append(out, s.lines[(s.start+i)%len(s.lines)])
+	}
+
+	return out
+}
+
+// resize changes the size of the buffer, keeping as many of the most recent lines as will fit
+func (s *scrollback) resize(size int) {
+	if size == len(s.lines) {
+		return
+	}
+
+	lines := s.all()
+	if len(lines) > size {
+		lines = lines[len(lines)-size:]
+	}
+
+	s.lines = make([]OutputLine, size)
+	s.start = 0
+	s.count = copy(s.lines, lines)
+}
+
+// rotatingFile is a log file that is rotated once it reaches a given size. Rotated files have a number appended to
+// their name, with .1 being the most recent
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if r.maxFiles > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return r.open()
+}
+
+// WriteString writes the given string to the file, rotating it first if the write would take it over its max size
+func (r *rotatingFile) WriteString(s string) (int, error) {
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.size > 0 && r.size+int64(len(s)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.WriteString(s)
+	r.size += int64(n)
+
+	return n, err
+}
+
+func (r *rotatingFile) close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// outputLog holds the recent output of a game in memory, and optionally writes it to disk
+type outputLog struct {
+	sync.Mutex
+	recent *scrollback
+	file   *rotatingFile
+}
+
+// update applies the given config. The current log file is closed if the new config changes it in any way
+func (o *outputLog) update(game string, conf tomlconf.Logs) error {
+	size := conf.Scrollback
+	if size <= 0 {
+		size = defaultScrollback
+	}
+
+	var file *rotatingFile
+
+	if conf.Dir != "" {
+		file = &rotatingFile{
+			path:     filepath.Join(conf.Dir, game+".log"),
+			maxSize:  int64(conf.MaxSize) * 1024,
+			maxFiles: conf.MaxFiles,
+		}
+
+		if file.maxSize <= 0 {
+			file.maxSize = defaultLogMaxSize * 1024
+		}
+
+		if file.maxFiles == 0 {
+			file.maxFiles = defaultLogMaxFiles
+		}
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	if o.recent == nil {
+		o.recent = newScrollback(size)
+	} else {
+		o.recent.resize(size)
+	}
+
+	if o.file != nil && file != nil && o.file.path == file.path {
+		o.file.maxSize, o.file.maxFiles = file.maxSize, file.maxFiles
+		return nil
+	}
+
+	err := o.closeFile()
+	o.file = file
+
+	return err
+}
+
+// add stores the given line. Lines are expected to be in the intermediate format
+func (o *outputLog) add(line OutputLine) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.recent != nil {
+		o.recent.add(line)
+	}
+
+	if o.file == nil {
+		return nil
+	}
+
+	_, err := o.file.WriteString(formatLogLine(line) + "\n")
+
+	return err
+}
+
+// recentLines returns up to n of the most recent lines that match filter, oldest first. A nil filter matches all lines,
+// and an n of 0 or less returns every matching line
+func (o *outputLog) recentLines(n int, filter *regexp.Regexp) []OutputLine {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.recent == nil {
+		return nil
+	}
+
+	var out []OutputLine
+
+	for _, l := range o.recent.all() {
+		if filter == nil || filter.MatchString(tokeniser.Strip(l.Line)) {
+			out = append(out, l)
+		}
+	}
+
+	if n > 0 && len(out) > n {
+		out = out[len(out)-n:]
+	}
+
+	return out
+}
+
+func (o *outputLog) closeFile() error {
+	if o.file == nil {
+		return nil
+	}
+
+	err := o.file.close()
+	o.file = nil
+
+	return err
+}
+
+func formatLogLine(line OutputLine) string {
+	return fmt.Sprintf(
+		"%s %s %s", line.Time.Format(time.RFC3339), pickString(stdout, stderr, line.Stdout), tokeniser.Strip(line.Line),
+	)
+}
+
+// RecentOutput returns up to n of the most recent lines of output from the game that match filter, oldest first. The
+// returned lines are in the intermediate format. A nil filter matches all lines
+func (g *Game) RecentOutput(n int, filter *regexp.Regexp) []string {
+	lines := g.logs.recentLines(n, filter)
+	out := make([]string, 0, len(lines))
+
+	for _, l := range lines {
+		out = append(out, fmt.Sprintf("%s %s %s", l.Time.Format("15:04:05"), pickString(stdout, stderr, l.Stdout), l.Line))
+	}
+
+	return out
+}
+
+// CloseLogs closes the game's log file, if it has one. It will be reopened if there is more output
+func (g *Game) CloseLogs() error {
+	g.logs.Lock()
+	defer g.logs.Unlock()
+
+	if g.logs.file == nil {
+		return nil
+	}
+
+	return g.logs.file.close()
+}
@@ -0,0 +1,219 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+)
+
+func linesOf(s *scrollback) []string {
+	var out []string
+	for _, l := range s.all() {
+		out = append(out, l.Line)
+	}
+
+	return out
+}
+
+func TestScrollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		add    []string
+		resize int
+		want   []string
+	}{
+		{name: "empty", size: 3},
+		{name: "partial", size: 3, add: []string{"a", "b"}, want: []string{"a", "b"}},
+		{name: "full", size: 3, add: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{name: "wrapped", size: 3, add: []string{"a", "b", "c", "d", "e"}, want: []string{"c", "d", "e"}},
+		{name: "zero size", size: 0, add: []string{"a"}},
+		{name: "grow", size: 2, add: []string{"a", "b", "c"}, resize: 4, want: []string{"b", "c"}},
+		{name: "shrink", size: 4, add: []string{"a", "b", "c", "d", "e"}, resize: 2, want: []string{"d", "e"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScrollback(tt.size)
+			for _, l := range tt.add {
+				s.add(OutputLine{Line: l})
+			}
+
+			if tt.resize != 0 {
+				s.resize(tt.resize)
+			}
+
+			if got := linesOf(s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrollback_resizeThenAdd(t *testing.T) {
+	s := newScrollback(3)
+	for _, l := range []string{"a", "b", "c", "d"} {
+		s.add(OutputLine{Line: l})
+	}
+
+	s.resize(2)
+	s.add(OutputLine{Line: "e"})
+
+	if got, want := linesOf(s), []string{"d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+}
+
+func TestOutputLog_recentLines(t *testing.T) {
+	o := new(outputLog)
+	if err := o.update("test", tomlconf.Logs{Scrollback: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []string{"starting", "player joined", "error: bad thing", "player left", "error: worse thing"} {
+		if err := o.add(OutputLine{Line: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		n      int
+		filter string
+		want   []string
+	}{
+		{
+			name: "all",
+			n:    0,
+			want: []string{"starting", "player joined", "error: bad thing", "player left", "error: worse thing"},
+		},
+		{name: "last two", n: 2, want: []string{"player left", "error: worse thing"}},
+		{name: "filtered", n: 0, filter: "^error", want: []string{"error: bad thing", "error: worse thing"}},
+		{name: "filtered and limited", n: 1, filter: "player", want: []string{"player left"}},
+		{name: "no match", n: 5, filter: "nothing"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var filter *regexp.Regexp
+			if tt.filter != "" {
+				filter = regexp.MustCompile(tt.filter)
+			}
+
+			var got []string
+			for _, l := range o.recentLines(tt.n, filter) {
+				got = append(got, l.Line)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recentLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputLog_rotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gggb-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	o := new(outputLog)
+	if err := o.update("test", tomlconf.Logs{Dir: dir, MaxSize: 1, MaxFiles: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	defer o.closeFile()
+
+	line := strings.Repeat("x", 300)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Each line is a bit over 300 bytes with its timestamp, so a 1KiB file fits three of them
+	for i := 0; i < 10; i++ {
+		if err := o.add(OutputLine{Line: line, Stdout: true, Time: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "test.log")
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %s", p, err)
+		}
+
+		if info.Size() > 1024 {
+			t.Errorf("%s is %d bytes, larger than the max size", p, info.Size())
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files to be kept, stat on .3 returned %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2020-01-01T00:00:00Z [STDOUT] " + line + "\n"
+	if !strings.HasPrefix(string(data), want) {
+		t.Errorf("unexpected log line format: %q", strings.SplitN(string(data), "\n", 2)[0])
+	}
+}
+
+func TestParseLogsArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantN      int
+		wantFilter string
+		wantErr    bool
+	}{
+		{name: "none", wantN: defaultLogLines},
+		{name: "count", args: []string{"25"}, wantN: 25},
+		{name: "capped count", args: []string{"1000"}, wantN: maxLogLines},
+		{name: "zero count", args: []string{"0"}, wantErr: true},
+		{name: "filter", args: []string{"error"}, wantN: defaultLogLines, wantFilter: "error"},
+		{name: "count and filter", args: []string{"5", "some", "error"}, wantN: 5, wantFilter: "some error"},
+		{name: "bad filter", args: []string{"5", "("}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n, filter, err := parseLogsArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogsArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if n != tt.wantN {
+				t.Errorf("parseLogsArgs() n = %d, want %d", n, tt.wantN)
+			}
+
+			gotFilter := ""
+			if filter != nil {
+				gotFilter = filter.String()
+			}
+
+			if gotFilter != tt.wantFilter {
+				t.Errorf("parseLogsArgs() filter = %q, want %q", gotFilter, tt.wantFilter)
+			}
+		})
+	}
+}
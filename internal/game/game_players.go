@@ -0,0 +1,253 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
+)
+
+const (
+	defaultListSeparator = ","
+	defaultListInterval  = time.Minute * 5
+)
+
+// playerConfig is a compiled tomlconf.Players
+type playerConfig struct {
+	join          *regexp.Regexp
+	leave         *regexp.Regexp
+	list          *regexp.Regexp
+	listCommand   string
+	listSeparator string
+	listInterval  time.Duration
+}
+
+// newPlayerConfig compiles the given config. Each regexp must have at least one group
+func newPlayerConfig(conf tomlconf.Players) (*playerConfig, error) {
+	out := &playerConfig{
+		listCommand:   conf.ListCommand,
+		listSeparator: conf.ListSeparator,
+		listInterval:  time.Duration(conf.ListInterval) * time.Second,
+	}
+
+	if out.listSeparator == "" {
+		out.listSeparator = defaultListSeparator
+	}
+
+	if out.listInterval <= 0 {
+		out.listInterval = defaultListInterval
+	}
+
+	for _, r := range []struct {
+		name   string
+		re     string
+		target **regexp.Regexp
+	}{{"join", conf.Join, &out.join}, {"leave", conf.Leave, &out.leave}, {"list", conf.List, &out.list}} {
+		if r.re == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(r.re)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile players %s regexp: %w", r.name, err)
+		}
+
+		if re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("players %s regexp must have a group to get names from", r.name)
+		}
+
+		*r.target = re
+	}
+
+	if out.listCommand != "" && out.list == nil {
+		return nil, errors.New("players list_command cannot be used without a list regexp")
+	}
+
+	return out, nil
+}
+
+// enabled returns whether or not any players are tracked at all
+func (c *playerConfig) enabled() bool {
+	return c.join != nil || c.leave != nil || c.list != nil
+}
+
+// matchGroup returns the named group from the given regexp's match on line, or its first group if it has no group with
+// that name
+func matchGroup(re *regexp.Regexp, line, group string) (string, bool) {
+	if re == nil {
+		return "", false
+	}
+
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+
+	for i, name := range re.SubexpNames() {
+		if name == group {
+			return match[i], true
+		}
+	}
+
+	return match[1], true
+}
+
+// playerTracker tracks the players online in a game, using lines of its output
+type playerTracker struct {
+	sync.Mutex
+	conf     *playerConfig
+	players  map[string]string // Lowercased names to names as the game last showed them
+	onChange func()
+}
+
+func newPlayerTracker(onChange func()) *playerTracker {
+	return &playerTracker{
+		conf:     &playerConfig{listSeparator: defaultListSeparator, listInterval: defaultListInterval},
+		players:  make(map[string]string),
+		onChange: onChange,
+	}
+}
+
+func (p *playerTracker) update(conf *playerConfig) {
+	p.Lock()
+	p.conf = conf
+	p.Unlock()
+}
+
+func (p *playerTracker) getConf() *playerConfig {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.conf
+}
+
+// modify runs f with the tracker locked, and runs onChange afterwards if f returns true
+func (p *playerTracker) modify(f func() bool) {
+	p.Lock()
+	changed := f()
+	p.Unlock()
+
+	if changed && p.onChange != nil {
+		p.onChange()
+	}
+}
+
+// handleLine updates the players from the given line of output
+func (p *playerTracker) handleLine(line string) {
+	conf := p.getConf()
+	if !conf.enabled() {
+		return
+	}
+
+	line = tokeniser.Strip(line)
+
+	if name, ok := matchGroup(conf.join, line, "player"); ok {
+		p.add(name)
+	} else if name, ok := matchGroup(conf.leave, line, "player"); ok {
+		p.remove(name)
+	} else if list, ok := matchGroup(conf.list, line, "players"); ok {
+		p.set(strings.Split(list, conf.listSeparator))
+	}
+}
+
+func (p *playerTracker) add(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+
+	p.modify(func() bool {
+		if p.players[strings.ToLower(name)] == name {
+			return false
+		}
+
+		p.players[strings.ToLower(name)] = name
+
+		return true
+	})
+}
+
+func (p *playerTracker) remove(name string) {
+	key := strings.ToLower(strings.TrimSpace(name))
+
+	p.modify(func() bool {
+		if _, exists := p.players[key]; !exists {
+			return false
+		}
+
+		delete(p.players, key)
+
+		return true
+	})
+}
+
+// set replaces the tracked players with the given names, as the game's own list is always more accurate
+func (p *playerTracker) set(names []string) {
+	players := make(map[string]string, len(names))
+
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			players[strings.ToLower(n)] = n
+		}
+	}
+
+	p.modify(func() bool {
+		if reflect.DeepEqual(players, p.players) {
+			return false
+		}
+
+		p.players = players
+
+		return true
+	})
+}
+
+// reset removes all tracked players
+func (p *playerTracker) reset() {
+	p.set(nil)
+}
+
+// list returns the names of the players online, sorted case insensitively
+func (p *playerTracker) list() []string {
+	p.Lock()
+	out := make([]string, 0, len(p.players))
+
+	for _, name := range p.players {
+		out = append(out, name)
+	}
+	p.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i]) < strings.ToLower(out[j]) })
+
+	return out
+}
+
+// Players returns the names of the players online in the game, and whether or not the game tracks its players
+func (g *Game) Players() ([]string, bool) {
+	return g.players.list(), g.players.getConf().enabled()
+}
+
+// pollPlayers writes the list command to the game every list interval until stop is closed, so that the tracked
+// players are corrected if any joins or leaves were missed
+func (g *Game) pollPlayers(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(g.players.getConf().listInterval):
+		}
+
+		if cmd := g.players.getConf().listCommand; cmd != "" && g.IsRunning() {
+			if _, err := g.WriteString(cmd); err != nil {
+				g.Warnf("could not request the player list: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package game
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+var testPlayersConf = tomlconf.Players{
+	Join:        `^(?P<player>\S+) joined the game$`,
+	Leave:       `^(\S+) left the game$`,
+	ListCommand: "list",
+	List:        `^There are \d+ players online:(?P<players>.*)$`,
+}
+
+func TestNewPlayerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    tomlconf.Players
+		enabled bool
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "full", conf: testPlayersConf, enabled: true},
+		{name: "bad regexp", conf: tomlconf.Players{Join: "("}, wantErr: true},
+		{name: "no group", conf: tomlconf.Players{Leave: `\S+ left`}, wantErr: true},
+		{name: "command without list", conf: tomlconf.Players{Join: `(\S+) joined`, ListCommand: "list"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newPlayerConfig(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPlayerConfig() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if err == nil && got.enabled() != tt.enabled {
+				t.Errorf("enabled() = %t, want %t", got.enabled(), tt.enabled)
+			}
+		})
+	}
+}
+
+func TestPlayerTracker_handleLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		want        []string
+		wantChanges int
+	}{
+		{
+			name:        "joins",
+			lines:       []string{"bob joined the game", "alice joined the game", "$bCarol$b joined the game"},
+			want:        []string{"alice", "bob", "Carol"},
+			wantChanges: 3,
+		},
+		{
+			name:        "leaves",
+			lines:       []string{"bob joined the game", "alice joined the game", "BOB left the game", "dave left the game"},
+			want:        []string{"alice"},
+			wantChanges: 3,
+		},
+		{
+			name:        "list replaces",
+			lines:       []string{"bob joined the game", "There are 2 players online: alice, carol"},
+			want:        []string{"alice", "carol"},
+			wantChanges: 2,
+		},
+		{
+			name:        "unchanged list",
+			lines:       []string{"There are 1 players online: alice", "There are 1 players online: alice"},
+			want:        []string{"alice"},
+			wantChanges: 1,
+		},
+		{
+			name:  "empty list",
+			lines: []string{"There are 0 players online:"},
+			want:  []string{},
+		},
+		{
+			name:  "other lines",
+			lines: []string{"bob said hi", "joined the game"},
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			changes := 0
+			p := newPlayerTracker(func() { changes++ })
+
+			conf, err := newPlayerConfig(testPlayersConf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.update(conf)
+
+			for _, l := range tt.lines {
+				p.handleLine(l)
+			}
+
+			if got := p.list(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("list() = %q, want %q", got, tt.want)
+			}
+
+			if changes != tt.wantChanges {
+				t.Errorf("got %d changes, want %d", changes, tt.wantChanges)
+			}
+
+			p.reset()
+
+			if got := p.list(); len(got) != 0 {
+				t.Errorf("list() after reset = %q, want nothing", got)
+			}
+		})
+	}
+}
+
+// playerGame is a game with a fixed list of players
+type playerGame struct {
+	interfaces.Game
+	name    string
+	running bool
+	tracked bool
+	players []string
+}
+
+func (p *playerGame) GetName() string           { return p.name }
+func (p *playerGame) IsRunning() bool           { return p.running }
+func (p *playerGame) Players() ([]string, bool) { return p.players, p.tracked }
+
+// recordingResponder records all messages and notices sent to it
+type recordingResponder struct {
+	nullResponder
+	lines []string
+}
+
+func (r *recordingResponder) SendMessage(_, msg string) { r.lines = append(r.lines, msg) }
+func (r *recordingResponder) SendNotice(_, msg string)  { r.lines = append(r.lines, "(notice) "+msg) }
+
+func TestManager_onlineCmd(t *testing.T) {
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+
+	m, err := NewManager(&tomlconf.Config{}, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, g := range []*playerGame{
+		{name: "survival", running: true, tracked: true, players: []string{"alice", "bob"}},
+		{name: "creative", running: true, tracked: true},
+		{name: "hardcore", tracked: true},
+		{name: "lobby", running: true},
+	} {
+		if err := m.AddGame(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{
+			name: "all",
+			line: "online",
+			want: []string{"[survival] 2 online: alice, bob", "[creative] nobody is online"},
+		},
+		{
+			name: "named",
+			line: "online hardcore lobby nope",
+			want: []string{
+				"(notice) game with name \"nope\" does not exist",
+				"[hardcore] not running",
+				"(notice) game \"lobby\" does not track its players",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recordingResponder{}
+			m.Cmd.ParseLine(tt.line, true, "", "", r)
+
+			if !reflect.DeepEqual(r.lines, tt.want) {
+				t.Errorf("online replied %q, want %q", r.lines, tt.want)
+			}
+		})
+	}
+}
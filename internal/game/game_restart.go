@@ -0,0 +1,129 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+)
+
+// Defaults for restart policies
+const (
+	defaultRestartDelay = time.Second
+	defaultMaxDelay     = time.Minute * 5
+	defaultMaxExits     = 5
+	defaultExitWindow   = time.Minute * 10
+)
+
+// restartOnCleanExit is used when no policy is set and auto_restart is. It keeps the behaviour auto_restart had before
+// restart policies were added, where only clean exits were restarted
+const restartOnCleanExit = "on-clean-exit"
+
+// restartPolicy decides whether a game is restarted after it exits, and how long to wait before doing so
+type restartPolicy struct {
+	policy   string
+	delay    time.Duration
+	maxDelay time.Duration
+	maxExits int
+	window   time.Duration
+}
+
+func newRestartPolicy(autoRestart int, conf tomlconf.Restart) (restartPolicy, error) {
+	out := restartPolicy{
+		policy:   strings.ToLower(conf.Policy),
+		delay:    time.Second * time.Duration(autoRestart),
+		maxDelay: time.Second * time.Duration(conf.MaxDelay),
+		maxExits: conf.MaxExits,
+		window:   time.Minute * time.Duration(conf.ExitWindow),
+	}
+
+	switch out.policy {
+	case "":
+		out.policy = tomlconf.RestartNever
+		if autoRestart > 0 {
+			out.policy = restartOnCleanExit
+		}
+
+	case tomlconf.RestartNever, tomlconf.RestartOnFailure, tomlconf.RestartAlways:
+	default:
+		return restartPolicy{}, fmt.Errorf("unknown restart policy %q", conf.Policy)
+	}
+
+	if out.delay <= 0 {
+		out.delay = defaultRestartDelay
+	}
+
+	if out.maxDelay <= 0 {
+		out.maxDelay = defaultMaxDelay
+	}
+
+	if out.maxDelay < out.delay {
+		out.maxDelay = out.delay
+	}
+
+	if out.maxExits == 0 {
+		out.maxExits = defaultMaxExits
+	}
+
+	if out.window <= 0 {
+		out.window = defaultExitWindow
+	}
+
+	return out, nil
+}
+
+// shouldRestart returns whether or not a game that exited with the given code should be restarted
+func (p restartPolicy) shouldRestart(code int) bool {
+	switch p.policy {
+	case tomlconf.RestartAlways:
+		return true
+	case tomlconf.RestartOnFailure:
+		return code != 0
+	case restartOnCleanExit:
+		return code == 0
+	default:
+		return false
+	}
+}
+
+// restartTracker tracks the exits of a game across restarts
+type restartTracker struct {
+	exits      []time.Time
+	quickExits int
+}
+
+// record records an exit at the given time, after the game ran for the given duration. It returns the delay before
+// restarting, and whether or not the game is in a crash loop and should not be restarted at all
+func (t *restartTracker) record(now time.Time, ranFor time.Duration, p restartPolicy) (time.Duration, bool) {
+	kept := t.exits[:0]
+
+	for _, e := range t.exits {
+		if now.Sub(e) < p.window {
+			kept = append(kept, e)
+		}
+	}
+
+	t.exits = append(kept, now)
+
+	if p.maxExits > 0 && len(t.exits) >= p.maxExits {
+		return 0, true
+	}
+
+	if ranFor >= p.window {
+		t.quickExits = 0
+	}
+
+	delay := p.delay
+	for i := 0; i < t.quickExits && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	t.quickExits++
+
+	return delay, false
+}
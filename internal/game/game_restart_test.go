@@ -0,0 +1,124 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+)
+
+func TestRestartPolicy_shouldRestart(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoRestart int
+		policy      string
+		code        int
+		want        bool
+		wantErr     bool
+	}{
+		{name: "legacy disabled", autoRestart: 0, code: 0, want: false},
+		{name: "legacy enabled clean", autoRestart: 5, code: 0, want: true},
+		{name: "legacy enabled crash", autoRestart: 5, code: 1, want: false},
+		{name: "never", autoRestart: 5, policy: "never", code: 1, want: false},
+		{name: "on-failure clean", policy: "on-failure", code: 0, want: false},
+		{name: "on-failure crash", policy: "On-Failure", code: 1, want: true},
+		{name: "always", policy: "always", code: 0, want: true},
+		{name: "invalid", policy: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newRestartPolicy(tt.autoRestart, tomlconf.Restart{Policy: tt.policy})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newRestartPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := p.shouldRestart(tt.code); got != tt.want {
+				t.Errorf("shouldRestart(%d) = %t, want %t", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartTracker_record(t *testing.T) {
+	p, err := newRestartPolicy(10, tomlconf.Restart{Policy: "always", MaxDelay: 60, MaxExits: 5, ExitWindow: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type exit struct {
+		after     time.Duration // time since the last exit
+		ranFor    time.Duration
+		wantDelay time.Duration
+		wantLoop  bool
+	}
+
+	tests := []struct {
+		name  string
+		exits []exit
+	}{
+		{
+			name: "backoff",
+			exits: []exit{
+				{after: 0, ranFor: time.Second, wantDelay: time.Second * 10},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 20},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 40},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 60},
+			},
+		},
+		{
+			name: "reset after a long run",
+			exits: []exit{
+				{after: 0, ranFor: time.Second, wantDelay: time.Second * 10},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 20},
+				{after: time.Hour, ranFor: time.Hour, wantDelay: time.Second * 10},
+			},
+		},
+		{
+			name: "crash loop",
+			exits: []exit{
+				{after: 0, ranFor: time.Second, wantDelay: time.Second * 10},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 20},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 40},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 60},
+				{after: time.Second, ranFor: time.Second, wantLoop: true},
+			},
+		},
+		{
+			name: "old exits expire",
+			exits: []exit{
+				{after: 0, ranFor: time.Second, wantDelay: time.Second * 10},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 20},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 40},
+				{after: time.Second, ranFor: time.Second, wantDelay: time.Second * 60},
+				{after: time.Minute * 10, ranFor: time.Second, wantDelay: time.Second * 60},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := new(restartTracker)
+			now := time.Now()
+
+			for i, e := range tt.exits {
+				now = now.Add(e.after)
+
+				delay, loop := tracker.record(now, e.ranFor, p)
+				if loop != e.wantLoop {
+					t.Fatalf("exit %d: record() crash loop = %t, want %t", i, loop, e.wantLoop)
+				}
+
+				if !loop && delay != e.wantDelay {
+					t.Errorf("exit %d: record() delay = %s, want %s", i, delay, e.wantDelay)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 )
 
 func (g *Game) watchStdinChan() {
@@ -36,6 +37,8 @@ func (g *Game) monitorStdIO(start chan struct{}, wg *sync.WaitGroup) {
 
 	if !g.IsRunning() {
 		g.manager.Error(errors.New(g.prefixMsg("cannot watch stdio on a non-running game")))
+		wg.Add(-2) // Neither stdout nor stderr will be watched
+
 		return
 	}
 
@@ -70,13 +73,21 @@ func (g *Game) handleStdIO(text string, isStdout bool) {
 		text = g.preRollRe.ReplaceAllString(text, g.preRollReplace)
 	}
 
+	g.manager.output.publish(OutputLine{Game: g.name, Stdout: isStdout, Line: text, Time: time.Now()})
+	g.manager.metrics.lines.Inc(g.name, pickString("stdout", "stderr", isStdout))
+
 	text = g.chatBridge.transformer.MakeIntermediate(text)
 
+	if err := g.logs.add(OutputLine{Game: g.name, Stdout: isStdout, Line: text, Time: time.Now()}); err != nil {
+		g.Warnf("could not write output to log file: %s", err)
+	}
+
 	g.Info(pickString(stdout, stderr, isStdout), " ", text)
 
 	if (g.chatBridge.dumpStdout && isStdout) || (g.chatBridge.dumpStderr && !isStdout) {
-		g.sendToBridgedChannel(pickString(stdout, stderr, isStdout), " ", text)
+		g.sendToChannels(eventDump, pickString(stdout, stderr, isStdout), " ", text)
 	}
 
+	g.players.handleLine(text)
 	g.regexpManager.checkAndExecute(text, isStdout)
 }
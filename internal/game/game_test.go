@@ -1,5 +1,62 @@
 package game
 
-import "awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/internal/transport"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
 
 var _ interfaces.Game = &Game{} // Make sure that Game is actually satisfying that interface
+
+// failingTransport is a transport whose game can never be started
+type failingTransport struct {
+	transport.Transport
+}
+
+func (failingTransport) IsRunning() bool { return false }
+func (failingTransport) Run(start chan struct{}) (int, string, error) {
+	close(start)
+	return -1, "", errors.New("could not start process: no such file or directory")
+}
+
+func TestGame_runStep_failedStart(t *testing.T) {
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+
+	m, err := NewManager(&tomlconf.Config{}, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &Game{
+		name:       "test",
+		manager:    m,
+		Logger:     logger,
+		transport:  failingTransport{},
+		chatBridge: new(chatBridge),
+		topics:     newTopicSetter(nil, nil),
+		players:    newPlayerTracker(nil),
+	}
+
+	done := make(chan bool)
+
+	go func() {
+		_, canRestart := g.runStep()
+		done <- canRestart
+	}()
+
+	select {
+	case canRestart := <-done:
+		if canRestart {
+			t.Error("runStep() returned that a game that failed to start can be restarted")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("runStep() did not return after the game failed to start")
+	}
+}
@@ -0,0 +1,154 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/format"
+)
+
+type topicKey struct {
+	conn    string
+	channel string
+}
+
+type channelTopic struct {
+	last    time.Time
+	pending string
+	timer   *time.Timer
+}
+
+// topicSetter sets the topics of a game's bridged channels, at most once per interval on each channel. Topics set
+// while a channel is rate limited are held back, and only the most recent one is set once the interval has passed
+type topicSetter struct {
+	sync.Mutex
+	interval    time.Duration
+	template    *format.Format
+	channels    map[topicKey]*channelTopic
+	send        func(conn, channel, topic string)
+	minInterval func(conn string) time.Duration // The shortest interval the connection allows, may be nil
+}
+
+func newTopicSetter(send func(conn, channel, topic string), minInterval func(conn string) time.Duration) *topicSetter {
+	return &topicSetter{channels: make(map[topicKey]*channelTopic), send: send, minInterval: minInterval}
+}
+
+// update sets the interval between topic changes, and the template used for topics. A nil template disables it
+func (t *topicSetter) update(interval time.Duration, template *format.Format) {
+	t.Lock()
+	t.interval = interval
+	t.template = template
+	t.Unlock()
+}
+
+func (t *topicSetter) getTemplate() *format.Format {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.template
+}
+
+// set sets the topic of the given channel, or queues it to be set if the channel's topic was changed too recently
+func (t *topicSetter) set(conn, channel, topic string) {
+	key := topicKey{conn: conn, channel: channel}
+	now := time.Now()
+
+	t.Lock()
+
+	c, ok := t.channels[key]
+	if !ok {
+		c = &channelTopic{}
+		t.channels[key] = c
+	}
+
+	interval := t.interval
+	if t.minInterval != nil {
+		if limit := t.minInterval(conn); limit > interval {
+			interval = limit
+		}
+	}
+
+	if wait := c.last.Add(interval).Sub(now); wait > 0 || c.timer != nil {
+		c.pending = topic
+
+		if c.timer == nil {
+			c.timer = time.AfterFunc(wait, func() { t.flush(key) })
+		}
+
+		t.Unlock()
+
+		return
+	}
+
+	c.last = now
+	t.Unlock()
+
+	t.send(conn, channel, topic)
+}
+
+// flush sets the pending topic for the given channel
+func (t *topicSetter) flush(key topicKey) {
+	t.Lock()
+	c := t.channels[key]
+	c.timer = nil
+	c.last = time.Now()
+	topic := c.pending
+	t.Unlock()
+
+	t.send(key.conn, key.channel, topic)
+}
+
+// setTopic sets the topic on all of the game's outbound bridged channels that accept topics
+func (g *Game) setTopic(topic string) {
+	for _, c := range g.chatBridge.channels {
+		if c.Name == "*" || !c.out || !c.wants(eventTopic) {
+			continue
+		}
+
+		g.topics.set(c.Connection, c.Name, topic)
+	}
+}
+
+func (g *Game) templSetTopic(v ...interface{}) string {
+	topic := fmt.Sprint(v...)
+	g.setTopic(topic)
+
+	return topic
+}
+
+// compileTopic compiles the given topic template. An empty template returns nil
+func (g *Game) compileTopic(topic string, root *template.Template) (*format.Format, error) {
+	funcs := template.FuncMap{"chatUsers": g.templChatUsers}
+	templ := &format.Format{FormatString: topic}
+
+	if err := templ.Compile("topic", root, funcs); err != nil {
+		if err == format.ErrEmptyFormat {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not compile topic template: %w", err)
+	}
+
+	return templ, nil
+}
+
+// renderTopic executes the game's topic template, if it has one, and sets the result as the topic. Empty results are
+// ignored
+func (g *Game) renderTopic() {
+	templ := g.topics.getTemplate()
+	if templ == nil {
+		return
+	}
+
+	res, err := templ.Execute(g.makeDataForFormat("", "", "", ""))
+	if err != nil {
+		g.checkError(fmt.Errorf("could not render topic for %q: %w", g.name, err))
+		return
+	}
+
+	if res != "" {
+		g.setTopic(res)
+	}
+}
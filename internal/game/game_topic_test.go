@@ -0,0 +1,80 @@
+package game
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTopicSetter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+
+	setter := newTopicSetter(func(conn, channel, topic string) {
+		mu.Lock()
+		sent = append(sent, conn+" "+channel+" "+topic)
+		mu.Unlock()
+	}, nil)
+
+	getSent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), sent...)
+	}
+
+	setter.update(time.Millisecond*50, nil)
+
+	setter.set("default", "#one", "first")
+	setter.set("default", "#one", "second")
+	setter.set("default", "#one", "third")
+	setter.set("default", "#two", "other")
+
+	if got, want := getSent(), []string{"default #one first", "default #two other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("topics set immediately = %q, want %q", got, want)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for len(getSent()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	want := []string{"default #one first", "default #two other", "default #one third"}
+	if got := getSent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("topics set after the interval = %q, want %q", got, want)
+	}
+}
+
+func TestTopicSetter_minInterval(t *testing.T) {
+	sent := make(chan string, 10)
+	limit := func(conn string) time.Duration {
+		if conn == "limited" {
+			return time.Hour
+		}
+
+		return 0
+	}
+
+	setter := newTopicSetter(func(conn, channel, topic string) { sent <- conn + " " + topic }, limit)
+
+	setter.update(0, nil)
+
+	for _, conn := range []string{"limited", "limited", "free", "free"} {
+		setter.set(conn, "#chan", "topic")
+	}
+
+	close(sent)
+
+	var got []string
+	for s := range sent {
+		got = append(got, s)
+	}
+
+	// The connection's limit applies even though the configured interval is shorter
+	if want := []string{"limited topic", "free topic", "free topic"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("topics set = %q, want %q", got, want)
+	}
+}
@@ -3,9 +3,11 @@ package game
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
 )
 
 func (g *Game) checkError(err error) {
@@ -23,15 +25,25 @@ func (g *Game) prefixMsg(args ...interface{}) string {
 	return fmt.Sprintf("[%s] %s", g.name, fmt.Sprint(args...))
 }
 
+// sendToBridgedChannel sends the given status message to all of the game's bridged channels that want status messages
 func (g *Game) sendToBridgedChannel(args ...interface{}) {
-	g.manager.bot.SendMessage(g.chatBridge.channel, g.prefixMsg(args...))
+	g.sendToChannels(eventStatus, args...)
 }
 
-func (g *Game) writeToAllOthers(msg string) {
+// primaryBot returns the Bot for the connection of the game's first bridged channel
+func (g *Game) primaryBot() interfaces.Bot {
+	return g.manager.getBot(g.chatBridge.channels[0].Connection)
+}
+
+// writeToOthers sends the given message to the other running games in this game's groups if toGroup is set, and to the
+// games referred to by targets. Each game is sent the message at most once
+func (g *Game) writeToOthers(msg string, toGroup bool, targets []string) {
 	msg = strings.ReplaceAll(msg, "\u200b", "")
+	routes := &g.manager.routes
 
 	g.manager.ForEachGame(func(game interfaces.Game) {
-		if !game.IsRunning() {
+		name := game.GetName()
+		if !game.IsRunning() || !(toGroup && routes.sameGroup(g.name, name) || routes.matches(targets, name)) {
 			return
 		}
 
@@ -39,9 +51,21 @@ func (g *Game) writeToAllOthers(msg string) {
 	}, []interfaces.Game{g})
 }
 
+// templSendToGame sends a message to the named game, or to the games in the named group
+func (g *Game) templSendToGame(target string, v ...interface{}) (string, error) {
+	if !g.manager.GameExists(target) && !g.manager.routes.isGroup(target) {
+		return "", fmt.Errorf("cannot send to unknown game or group %q", target)
+	}
+
+	msg := fmt.Sprint(v...)
+	g.writeToOthers(msg, false, []string{target})
+
+	return msg, nil
+}
+
 func (g *Game) templSendToMsgChan(v ...interface{}) string {
 	msg := fmt.Sprint(v...)
-	g.sendToBridgedChannel(msg)
+	g.sendToChannels(eventChat, msg)
 
 	return msg
 }
@@ -52,11 +76,42 @@ func (g *Game) templSendMessage(c string, v ...interface{}) (string, error) {
 	}
 
 	msg := fmt.Sprint(v...)
-	g.manager.bot.SendMessage(c, msg)
+	g.primaryBot().SendMessage(c, msg)
 
 	return msg, nil
 }
 
+// templChatUsers returns the users in the game's inbound bridged channels, or only in the named ones if any are given.
+// Users in more than one channel are only included once, and channels on connections that do not track their
+// members are skipped
+func (g *Game) templChatUsers(names ...string) []interfaces.ChannelMember {
+	seen := make(map[string]bool)
+	out := []interfaces.ChannelMember{}
+
+	for _, c := range g.chatBridge.channels {
+		if !c.in || c.Name == "*" || (len(names) > 0 && !util.ContainsFold(names, c.Name)) {
+			continue
+		}
+
+		tracker, ok := g.manager.getBot(c.Connection).(interfaces.ChannelTracker)
+		if !ok {
+			continue
+		}
+
+		for _, member := range tracker.ChannelMembers(c.Name) {
+			key := c.Connection + " " + strings.ToLower(member.Nick)
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, member)
+			}
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return strings.ToLower(out[i].Nick) < strings.ToLower(out[j].Nick) })
+
+	return out
+}
+
 // Status returns the status of the game's transport as a string
 func (g *Game) Status() string {
 	return g.transport.GetHumanStatus()
@@ -0,0 +1,26 @@
+package game
+
+import (
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/webhook"
+)
+
+// sendToWebhooks sends the given event to the manager's webhooks, as having happened on this game just now
+func (g *Game) sendToWebhooks(e webhook.Event) {
+	e.Game = g.name
+	e.Time = time.Now()
+	g.manager.webhooks.Notify(e)
+}
+
+// notifyExit sends a stop or crash event to webhooks for the game exiting with the given code. Games that were
+// stopped never count as crashing, as being stopped can itself cause a non-zero exit code
+func (g *Game) notifyExit(code int, humanStatus string) {
+	typ := tomlconf.WebhookStop
+	if code != 0 && g.status.Get() != killed {
+		typ = tomlconf.WebhookCrash
+	}
+
+	g.sendToWebhooks(webhook.Event{Type: typ, Message: humanStatus, ExitCode: &code})
+}
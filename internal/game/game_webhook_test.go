@@ -0,0 +1,200 @@
+package game
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/internal/transport"
+	"awesome-dragon.science/go/goGoGameBot/internal/webhook"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+	"awesome-dragon.science/go/goGoGameBot/pkg/mutexTypes"
+)
+
+// webhookGame returns a game with a manager that sends all events to a test server, and a function that stops the
+// manager's webhooks and returns the events that were sent
+func webhookGame(t *testing.T) (*Game, func() []webhook.Event) {
+	t.Helper()
+
+	var (
+		mu     sync.Mutex
+		events []webhook.Event
+	)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := webhook.Event{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+	conf := &tomlconf.Config{Webhooks: []tomlconf.Webhook{
+		{Name: "test", URL: s.URL, Type: tomlconf.WebhookJSON, Timeout: 5},
+	}}
+
+	m, err := NewManager(conf, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger)
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+
+	g := &Game{name: "test", manager: m, Logger: logger, players: newPlayerTracker(nil)}
+	g.regexpManager = NewRegexpManager(g)
+
+	return g, func() []webhook.Event {
+		m.webhooks.Close(time.Second * 5)
+		s.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		return events
+	}
+}
+
+func TestGame_notifyExit(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		status int
+		want   string
+	}{
+		{name: "clean exit", code: 0, status: normal, want: tomlconf.WebhookStop},
+		{name: "crash", code: 1, status: normal, want: tomlconf.WebhookCrash},
+		{name: "stopped", code: 143, status: killed, want: tomlconf.WebhookStop},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g, finish := webhookGame(t)
+			g.status.Set(tt.status)
+			g.notifyExit(tt.code, "exited")
+
+			events := finish()
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+
+			e := events[0]
+			if e.Type != tt.want || e.Game != "test" || e.Message != "exited" || e.ExitCode == nil || *e.ExitCode != tt.code {
+				t.Errorf("got event %+v, want a %s event with exit code %d", e, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestRegexp_sendToWebhook(t *testing.T) {
+	g, finish := webhookGame(t)
+
+	err := g.regexpManager.UpdateFromConf([]tomlconf.Regexp{
+		{
+			Name:          "death",
+			Regexp:        `^(?P<player>\S+) died$`,
+			Format:        "$b{{.Groups.player}}$b died",
+			SendToWebhook: true,
+		},
+		{
+			Name:   "join",
+			Regexp: `^(?P<player>\S+) joined$`,
+			Format: "{{.Groups.player}} joined",
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.regexpManager.checkAndExecute("someone joined", true)
+	g.regexpManager.checkAndExecute("someone died", true)
+
+	want := []webhook.Event{{
+		Type:    tomlconf.WebhookNotify,
+		Game:    "test",
+		Message: "someone died",
+		Regexp:  "death",
+		Groups:  map[string]string{"player": "someone"},
+	}}
+
+	got := finish()
+	for i := range got {
+		got[i].Time = time.Time{}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %+v, want %+v", got, want)
+	}
+}
+
+// slowTransport is a transport whose game takes a while to exit after StopOrKill returns, as a process does while it
+// is being cleaned up
+type slowTransport struct {
+	transport.Transport
+	running mutexTypes.Bool
+	stop    chan struct{}
+	output  chan []byte
+}
+
+func (s *slowTransport) IsRunning() bool       { return s.running.Get() }
+func (s *slowTransport) Stdout() <-chan []byte { return s.output }
+func (s *slowTransport) Stderr() <-chan []byte { return s.output }
+
+func (s *slowTransport) StopOrKillTimeout(time.Duration) error {
+	close(s.stop)
+	return nil
+}
+
+func (s *slowTransport) Run(start chan struct{}) (int, string, error) {
+	s.running.Set(true)
+	close(start)
+	<-s.stop
+	time.Sleep(time.Millisecond * 100)
+	close(s.output)
+	s.running.Set(false)
+
+	return 0, "stopped", nil
+}
+
+func TestManager_Stop_sendsStopEvents(t *testing.T) {
+	g, finish := webhookGame(t)
+	g.transport = &slowTransport{stop: make(chan struct{}), output: make(chan []byte)}
+	g.chatBridge = &chatBridge{storage: new(format.Storage)}
+	g.topics = newTopicSetter(nil, nil)
+	g.manager.games = append(g.manager.games, g)
+
+	go func() { _ = g.manager.conns[0].bot.Run() }() // Stop blocks on disconnecting it otherwise
+	go func() { _ = g.Run() }()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !g.IsRunning() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the game to start")
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	g.manager.Stop("shutting down", false)
+
+	var types []string
+	for _, e := range finish() {
+		types = append(types, e.Type)
+	}
+
+	if want := []string{tomlconf.WebhookStart, tomlconf.WebhookStop}; !reflect.DeepEqual(types, want) {
+		t.Errorf("got events %v, want %v", types, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -11,21 +12,50 @@ import (
 	"awesome-dragon.science/go/goGoGameBot/internal/command"
 	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/webhook"
 	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+	"awesome-dragon.science/go/goGoGameBot/pkg/metrics"
 	"awesome-dragon.science/go/goGoGameBot/pkg/mutexTypes"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util/systemstats"
 )
 
-// NewManager creates a Manager and configures it using the given data.
-func NewManager(conf *tomlconf.Config, bot interfaces.Bot, logger *log.Logger) (*Manager, error) {
+// NewManager creates a Manager and configures it using the given data. bots maps connection names to the Bot
+// instances for those connections
+func NewManager(conf *tomlconf.Config, bots map[string]interfaces.Bot, logger *log.Logger) (*Manager, error) {
+	if len(bots) == 0 {
+		return nil, errors.New("cannot create a Manager with no connections")
+	}
+
 	m := &Manager{
-		bot:      bot,
 		Logger:   logger.Clone().SetPrefix("GM"),
 		done:     sync.NewCond(new(sync.Mutex)),
 		rootConf: conf,
 	}
 
-	m.Cmd = command.NewManager(logger.Clone().SetPrefix("CMD"), bot.IsCommandPrefix, bot.StaticCommandPrefixes()...)
-	m.setupHooks()
+	for name, bot := range bots {
+		m.conns = append(m.conns, &connection{name: name, bot: bot})
+	}
+
+	sort.Slice(m.conns, func(i, j int) bool { return m.conns[i].name < m.conns[j].name })
+
+	m.Cmd = command.NewManager(logger.Clone().SetPrefix("CMD"), nil, m.staticCommandPrefixes()...)
+
+	perms, err := command.NewPermissions(conf.Permissions)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up permissions: %w", err)
+	}
+
+	m.Cmd.SetPermissions(perms)
+	m.setupMetrics()
+
+	m.webhooks = webhook.New(logger.Clone().SetPrefix("WH"))
+	m.webhooks.Update(conf.Webhooks)
+	m.routes.update(conf.Groups)
+
+	for _, c := range m.conns {
+		m.setupHooks(c)
+	}
+
 	m.ReloadGames(conf.Games)
 
 	if err := m.setupCommands(); err != nil {
@@ -35,53 +65,135 @@ func NewManager(conf *tomlconf.Config, bot interfaces.Bot, logger *log.Logger) (
 	return m, nil
 }
 
-func (m *Manager) setupHooks() {
-	m.bot.HookMessage(func(source, channel, message string, _ bool) {
-		m.Cmd.ParseLine(message, false, source, channel, m.bot)
+func (m *Manager) setupHooks(c *connection) {
+	name, bot := c.name, c.bot
+
+	onMessage := func(source, channel, message string, isAction bool, meta interfaces.MessageMeta) {
+		m.Cmd.ParseLine(message, false, source, channel, commandUtil(bot, channel, meta.ID))
+		m.ForEachGame(func(game interfaces.Game) { game.OnMessage(name, source, channel, message, isAction, meta) }, nil)
+	}
+
+	if hooker, ok := bot.(interfaces.MetaHooker); ok {
+		hooker.HookMessageMeta(onMessage)
+	} else {
+		bot.HookMessage(func(source, channel, message string, isAction bool) {
+			onMessage(source, channel, message, isAction, interfaces.MessageMeta{Time: time.Now()})
+		})
+	}
+
+	bot.HookJoin(func(source, channel string) {
+		m.ForEachGame(func(game interfaces.Game) { game.OnJoin(name, source, channel) }, nil)
 	})
 
-	m.bot.HookMessage(func(source, channel, message string, isAction bool) {
-		m.ForEachGame(func(game interfaces.Game) { game.OnMessage(source, channel, message, isAction) }, nil)
+	bot.HookPart(func(source, channel, message string) {
+		m.ForEachGame(func(game interfaces.Game) { game.OnPart(name, source, channel, message) }, nil)
 	})
 
-	m.bot.HookJoin(func(source, channel string) {
-		m.ForEachGame(func(game interfaces.Game) { game.OnJoin(source, channel) }, nil)
+	// userChannels returns the channels the source was in, or nil if the bot does not track them
+	userChannels := func(source string) []string {
+		if tracker, ok := bot.(interfaces.ChannelTracker); ok {
+			return tracker.UserChannels(source)
+		}
+
+		return nil
+	}
+
+	bot.HookQuit(func(source, message string) {
+		channels := userChannels(source)
+		m.ForEachGame(func(game interfaces.Game) { game.OnQuit(name, source, message, channels) }, nil)
+	})
+
+	bot.HookKick(func(source, channel, target, message string) {
+		m.ForEachGame(func(game interfaces.Game) { game.OnKick(name, source, channel, target, message) }, nil)
 	})
 
-	m.bot.HookPart(func(source, channel, message string) {
-		m.ForEachGame(func(game interfaces.Game) { game.OnPart(source, channel, message) }, nil)
+	bot.HookNick(func(source, newNick string) {
+		channels := userChannels(source)
+		m.ForEachGame(func(game interfaces.Game) { game.OnNick(name, source, newNick, channels) }, nil)
 	})
 
-	m.bot.HookQuit(func(source, message string) {
-		m.ForEachGame(func(game interfaces.Game) { game.OnQuit(source, message) }, nil)
+	bot.HookTopic(func(source, channel, topic string) {
+		m.ForEachGame(func(game interfaces.Game) { game.OnTopic(name, source, channel, topic) }, nil)
 	})
 
-	m.bot.HookKick(func(source, channel, target, message string) {
-		m.ForEachGame(func(game interfaces.Game) { game.OnKick(source, channel, target, message) }, nil)
+	bot.HookMode(func(source, channel string, changes []interfaces.ModeChange) {
+		m.ForEachGame(func(game interfaces.Game) { game.OnMode(name, source, channel, changes) }, nil)
 	})
 
-	m.bot.HookNick(func(source, newNick string) {
-		m.ForEachGame(func(game interfaces.Game) { game.OnNick(source, newNick) }, nil)
+	bot.HookNotice(func(source, channel, message string) {
+		m.ForEachGame(func(game interfaces.Game) { game.OnNotice(name, source, channel, message) }, nil)
 	})
 }
 
-// Manager manages games, and communication between them, eachother, and an interfaces.Bot
-type Manager struct {
-	rootConf     *tomlconf.Config
-	games        []interfaces.Game
-	gamesMutex   sync.RWMutex
+// threadedReplies sends messages to the channel a command was used in as replies to the message that used it
+type threadedReplies struct {
+	interfaces.Bot
+	replier interfaces.Replier
+	channel string
+	replyTo string
+}
+
+// SendMessage sends a message to the given target, as a reply if the target is the command's channel
+func (t *threadedReplies) SendMessage(target, message string) {
+	if target == t.channel {
+		t.replier.SendReply(target, t.replyTo, message)
+		return
+	}
+
+	t.Bot.SendMessage(target, message)
+}
+
+// AccountName implements command.AccountNamer for Bots that do
+func (t *threadedReplies) AccountName(source string) string {
+	if namer, ok := t.Bot.(command.AccountNamer); ok {
+		return namer.AccountName(source)
+	}
+
+	return ""
+}
+
+// commandUtil returns the command.DataUtil to use for a command used in the given channel, in the message with the
+// given ID. If the bot supports it, replies to the channel are sent as replies to that message
+func commandUtil(bot interfaces.Bot, channel, msgID string) command.DataUtil {
+	replier, ok := bot.(interfaces.Replier)
+	if !ok || msgID == "" {
+		return bot
+	}
+
+	return &threadedReplies{Bot: bot, replier: replier, channel: channel, replyTo: msgID}
+}
+
+// connection is a named Bot on the Manager
+type connection struct {
+	name         string
 	bot          interfaces.Bot
 	reconnecting mutexTypes.Bool
-	Cmd          *command.Manager
-	done         *sync.Cond
-	restarting   mutexTypes.Bool
-	status       mutexTypes.Int
+}
+
+// Manager manages games, and communication between them, eachother, and any number of interfaces.Bot instances
+type Manager struct {
+	rootConf   *tomlconf.Config
+	games      []interfaces.Game
+	gamesMutex sync.RWMutex
+	conns      []*connection // Sorted by name, never changes after creation
+	Cmd        *command.Manager
+	done       *sync.Cond
+	restarting mutexTypes.Bool
+	status     mutexTypes.Int
+	output     outputBroadcaster
+	metrics    managerMetrics
+	Metrics    *metrics.Registry
+	webhooks   *webhook.Notifier
+	routes     routes
 	*log.Logger
 }
 
 // Run starts the manager, connects its bots
 func (m *Manager) Run() (bool, error) {
-	go m.runBot()
+	for _, c := range m.conns {
+		go m.runBot(c)
+	}
+
 	go func() {
 		time.Sleep(time.Second * 5)
 		m.StartAutoStartGames()
@@ -96,10 +208,10 @@ func (m *Manager) Run() (bool, error) {
 	return m.restarting.Get(), nil
 }
 
-func (m *Manager) runBot() {
+func (m *Manager) runBot(c *connection) {
 	for {
-		if err := m.bot.Run(); err != nil {
-			m.Warnf("error occurred while running bot %s: %s", m.bot, err)
+		if err := c.bot.Run(); err != nil {
+			m.Warnf("error occurred while running bot %s (%s): %s", c.name, c.bot, err)
 			m.Info("Sleeping for 1s")
 			time.Sleep(time.Second * 1)
 		}
@@ -108,17 +220,60 @@ func (m *Manager) runBot() {
 			break
 		}
 
-		if !m.reconnecting.Get() {
-			m.reconnecting.Set(false)
-			m.sendStatusMessageToAllGames("Chat is disconnected. Reconnecting in 10 seconds")
+		if !c.reconnecting.Get() {
+			m.sendStatusMessageToAllGames(fmt.Sprintf("Chat (%s) is disconnected. Reconnecting in 10 seconds", c.name))
 			time.Sleep(time.Second * 10)
 		} else {
-			m.sendStatusMessageToAllGames("Chat is disconnected due to a reconnect request")
+			c.reconnecting.Set(false)
+			m.sendStatusMessageToAllGames(fmt.Sprintf("Chat (%s) is disconnected due to a reconnect request", c.name))
 			time.Sleep(time.Millisecond * 100)
 		}
 	}
 }
 
+// getConnection returns the connection with the given name, or nil if it does not exist
+func (m *Manager) getConnection(name string) *connection {
+	for _, c := range m.conns {
+		if c.name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// getBot returns the Bot for the named connection, or nil if it does not exist
+func (m *Manager) getBot(name string) interfaces.Bot {
+	if c := m.getConnection(name); c != nil {
+		return c.bot
+	}
+
+	return nil
+}
+
+// defaultConnection returns the name of the connection used when none is specified. This is either the only
+// connection, or the one named tomlconf.DefaultConnection. If neither exist, it returns an empty string
+func (m *Manager) defaultConnection() string {
+	if len(m.conns) == 1 {
+		return m.conns[0].name
+	}
+
+	if m.getConnection(tomlconf.DefaultConnection) != nil {
+		return tomlconf.DefaultConnection
+	}
+
+	return ""
+}
+
+func (m *Manager) staticCommandPrefixes() []string {
+	var out []string
+	for _, c := range m.conns {
+		out = append(out, c.bot.StaticCommandPrefixes()...)
+	}
+
+	return out
+}
+
 func (m *Manager) sendStatusMessageToAllGames(msg string) {
 	m.ForEachGame(func(g interfaces.Game) {
 		g.SendLineFromOtherGame(msg, g)
@@ -295,14 +450,105 @@ func (m *Manager) StopGame(name string) error {
 		if err := g.StopOrKill(); err != nil {
 			return err
 		}
+
+		return nil
 	}
 
+	return ErrGameNotExist
+}
+
+// RestartGame stops the named game if it exists and is running, and then starts it again
+func (m *Manager) RestartGame(name string) error {
+	g := m.GetGameFromName(name)
+	if g == nil {
+		return ErrGameNotExist
+	}
+
+	if !g.IsRunning() {
+		return ErrGameNotRunning
+	}
+
+	if err := g.StopOrKill(); err != nil {
+		return err
+	}
+
+	go func() { _ = g.Run() }()
+
 	return nil
 }
 
+// WriteToGame writes the given line to the standard in of the named game, if it exists and is running
+func (m *Manager) WriteToGame(name, line string) error {
+	g := m.GetGameFromName(name)
+	if g == nil {
+		return ErrGameNotExist
+	}
+
+	if !g.IsRunning() {
+		return ErrGameNotRunning
+	}
+
+	_, err := g.WriteString(line)
+
+	return err
+}
+
+// Reload reloads the config file from disk and applies it
+func (m *Manager) Reload() error {
+	newConf, err := tomlconf.GetConfig(m.rootConf.OriginalPath)
+	if err != nil {
+		return err
+	}
+
+	return m.reload(newConf)
+}
+
+// GameStatus is the status of a single game
+type GameStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+}
+
+// StatusReport is the status of the manager, its connections, and its games
+type StatusReport struct {
+	System      string            `json:"system"`
+	Connections map[string]string `json:"connections"`
+	Games       []GameStatus      `json:"games"`
+}
+
+// Status returns a report of the status of the manager, its connections, and all of its games
+func (m *Manager) Status() StatusReport {
+	out := StatusReport{System: systemstats.GetStats(), Connections: make(map[string]string, len(m.conns))}
+
+	for _, c := range m.conns {
+		out.Connections[c.name] = c.bot.Status()
+	}
+
+	m.ForEachGame(func(g interfaces.Game) {
+		out.Games = append(out.Games, GameStatus{
+			Name:    g.GetName(),
+			Running: g.IsRunning(),
+			Status:  g.Status(),
+			Comment: g.GetComment(),
+		})
+	}, nil)
+
+	return out
+}
+
+// sendAdminMessage sends the given message to the admins of all of the manager's bots
+func (m *Manager) sendAdminMessage(msg string) {
+	for _, c := range m.conns {
+		c.bot.SendAdminMessage(msg)
+	}
+}
+
 // Error is a helper function that returns the passed error to the manager's bot instance
 func (m *Manager) Error(err error) {
-	m.bot.SendAdminMessage(fmt.Sprintf("game.Manager: %s", err))
+	m.sendAdminMessage(fmt.Sprintf("game.Manager: %s", err))
+
 	m.Logger.Warn(err)
 
 	for _, l := range strings.Split(string(debug.Stack()), "\n") {
@@ -317,6 +563,8 @@ func (m *Manager) setupCommands() error {
 		stopHelp    = "stops the provided games, killing them if needed"
 		restartHelp = "restarts the specified games, as with stop, games may be killed if a stop times out"
 		rawHelp     = "sends the arguments provided directly to the standard in of the running game"
+		logsHelp    = "returns recent output from the given game. Optionally takes the number of lines to return, " +
+			"and a regexp that lines must match"
 
 		shutdownHelp = "shuts down the running bot instance, disconnects all connections, and stops all games"
 		restartMHelp = "stops the running bot instance, disconnects all connections, and stops all games, " +
@@ -327,23 +575,29 @@ func (m *Manager) setupCommands() error {
 		statusHelp = "returns the status of the bot. If a list of games is provided as arguments, " +
 			"gets the status for each game. If all is provided as the first arg, all game's statuses are reported"
 
-		reconnHelp = "reconnects the bot to the chat layer. "
+		reconnHelp = "reconnects the bot to the chat layer. If the first argument is a connection name, only that " +
+			"connection is reconnected"
+
+		onlineHelp = "lists the players online in the given games, or in every running game that tracks its players"
 
 		bot        = "bot"
-		botRawHelp = "Sends a raw line directly to the chat platform in use"
+		botRawHelp = "Sends a raw line directly to the chat platform in use. If there is more than one connection, the " +
+			"first argument must be the name of the connection to use"
 	)
 
 	var errs []error
 	errs = append(
 		errs,
-		m.Cmd.AddSubCommand(gamectl, "start", 2, m.startGameCmd, startHelp),
-		m.Cmd.AddSubCommand(gamectl, "stop", 2, m.stopGameCmd, stopHelp),
-		m.Cmd.AddSubCommand(gamectl, "raw", 3, m.rawGameCmd, rawHelp),
-		m.Cmd.AddSubCommand(gamectl, "restart", 2, m.restartGameCmd, restartHelp),
+		m.Cmd.AddGameControlSubCommand(gamectl, "start", 2, m.startGameCmd, startHelp),
+		m.Cmd.AddGameControlSubCommand(gamectl, "stop", 2, m.stopGameCmd, stopHelp),
+		m.Cmd.AddGameControlSubCommand(gamectl, "raw", 3, m.rawGameCmd, rawHelp),
+		m.Cmd.AddGameControlSubCommand(gamectl, "restart", 2, m.restartGameCmd, restartHelp),
+		m.Cmd.AddGameControlSubCommand(gamectl, "logs", 2, m.logsGameCmd, logsHelp),
 		m.Cmd.AddCommand("shutdown", 3, m.shutdownCmd, shutdownHelp),
 		m.Cmd.AddCommand("restart", 3, m.restartCmd, restartMHelp),
 		m.Cmd.AddCommand("reload", 3, m.reloadCmd, reloadHelp),
 		m.Cmd.AddCommand("status", 0, m.statusCmd, statusHelp),
+		m.Cmd.AddCommand("online", 0, m.onlineCmd, onlineHelp),
 		m.Cmd.AddCommand("reconnect", 3, m.reconnectCmd, reconnHelp),
 		m.Cmd.AddSubCommand(bot, "raw", 3, m.rawCmd, botRawHelp),
 	)
@@ -370,20 +624,70 @@ func (m *Manager) Stop(msg string, restart bool) {
 	m.restarting.Set(restart)
 	m.status.Set(shutdown)
 	m.StopAllGames()
-	m.bot.Disconnect(msg)
+
+	// StopOrKill can return before the game has finished exiting, wait for that so that its stop event is sent
+	deadline := time.Now().Add(time.Second * 10)
+
+	m.ForEachGame(func(game interfaces.Game) {
+		if g, ok := game.(*Game); ok {
+			g.waitForStep(time.Until(deadline))
+		}
+
+		if err := game.FlushStorage(); err != nil {
+			m.Warnf("could not save storage for %q: %s", game.GetName(), err)
+		}
+
+		if err := game.CloseLogs(); err != nil {
+			m.Warnf("could not close log file for %q: %s", game.GetName(), err)
+		}
+	}, nil)
+
+	// Give the stop events from the games a chance to be sent. Nothing can send any more now that the games have exited
+	m.webhooks.Close(time.Second * 10)
+
+	for _, c := range m.conns {
+		c.bot.Disconnect(msg)
+	}
+
 	m.done.Broadcast()
 }
 
 func (m *Manager) reload(conf *tomlconf.Config) error {
+	for name, connConf := range conf.Connections {
+		old, ok := m.rootConf.Connections[name]
+		if !ok {
+			return fmt.Errorf("connection %q was added. Adding connections requires a restart", name)
+		}
+
+		if !strings.EqualFold(old.Type, connConf.Type) {
+			return fmt.Errorf("connection %q changed type from %q to %q. This requires a restart", name, old.Type, connConf.Type)
+		}
+	}
+
+	for name := range m.rootConf.Connections {
+		if _, ok := conf.Connections[name]; !ok {
+			return fmt.Errorf("connection %q was removed. Removing connections requires a restart", name)
+		}
+	}
+
+	perms, err := command.NewPermissions(conf.Permissions)
+	if err != nil {
+		return fmt.Errorf("could not reload permissions: %w", err)
+	}
+
 	m.rootConf = conf
+	m.Cmd.SetPermissions(perms)
+	m.webhooks.Update(conf.Webhooks)
+	m.routes.update(conf.Groups)
 	m.ReloadGames(conf.Games)
 
-	// TODO: ensure that type wasn't changed
-	if err := m.bot.Reload(conf.Connection.RealConf); err != nil {
-		return err
+	for _, c := range m.conns {
+		if err := c.bot.Reload(conf.Connections[c.name].RealConf); err != nil {
+			return fmt.Errorf("could not reload connection %q: %w", c.name, err)
+		}
 	}
 
-	m.Cmd.SetPrefixes(m.bot.StaticCommandPrefixes())
+	m.Cmd.SetPrefixes(m.staticCommandPrefixes())
 
 	return nil
 }
@@ -2,11 +2,13 @@ package game
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"awesome-dragon.science/go/goGoGameBot/internal/command"
-	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
 	"awesome-dragon.science/go/goGoGameBot/pkg/util/systemstats"
 )
 
@@ -38,6 +40,10 @@ func (m *Manager) startGameCmd(data *command.Data) {
 			continue
 		}
 
+		if !data.CheckGamePerms(name) {
+			continue
+		}
+
 		if g.IsRunning() {
 			data.ReturnNotice(fmt.Sprintf(gameAlreadyRunning, name))
 			continue
@@ -63,6 +69,10 @@ func (m *Manager) stopGameCmd(data *command.Data) {
 			continue
 		}
 
+		if !data.CheckGamePerms(name) {
+			continue
+		}
+
 		if !g.IsRunning() {
 			data.ReturnNotice(fmt.Sprintf(gameNotRunning, name))
 			continue
@@ -90,6 +100,10 @@ func (m *Manager) rawGameCmd(data *command.Data) {
 		return
 	}
 
+	if !data.CheckGamePerms(name) {
+		return
+	}
+
 	if !g.IsRunning() {
 		data.ReturnNotice(fmt.Sprintf(gameNotRunning, name))
 		return
@@ -113,6 +127,10 @@ func (m *Manager) restartGameCmd(data *command.Data) {
 			continue
 		}
 
+		if !data.CheckGamePerms(name) {
+			continue
+		}
+
 		go restartGame(g, data) // Restart games in parallel, while still waiting for each to stop on their own
 	}
 }
@@ -133,6 +151,78 @@ func restartGame(game interfaces.Game, responder interfaces.CommandResponder) {
 	}()
 }
 
+const (
+	defaultLogLines = 10
+	maxLogLines     = 100
+	logPageLength   = 400
+)
+
+// parseLogsArgs parses the arguments to gamectl logs, after the game name. The first argument is the number of lines to
+// return if it is a number, and anything else is a regexp that lines must match
+func parseLogsArgs(args []string) (int, *regexp.Regexp, error) {
+	n := defaultLogLines
+
+	if len(args) > 0 {
+		if i, err := strconv.Atoi(args[0]); err == nil {
+			if i <= 0 {
+				return 0, nil, fmt.Errorf("invalid number of lines %d", i)
+			}
+
+			n = i
+			args = args[1:]
+		}
+	}
+
+	if n > maxLogLines {
+		n = maxLogLines
+	}
+
+	if len(args) == 0 {
+		return n, nil, nil
+	}
+
+	re, err := regexp.Compile(strings.Join(args, " "))
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid regexp: %w", err)
+	}
+
+	return n, re, nil
+}
+
+func (m *Manager) logsGameCmd(data *command.Data) {
+	if !checkArgs(data.Args, 1, "logs requires a game to get logs for", data) {
+		return
+	}
+
+	name := data.Args[0]
+
+	g := m.GetGameFromName(name)
+	if g == nil {
+		data.ReturnNotice(fmt.Sprintf(gameNotExist, name))
+		return
+	}
+
+	if !data.CheckGamePerms(name) {
+		return
+	}
+
+	n, filter, err := parseLogsArgs(data.Args[1:])
+	if err != nil {
+		data.ReturnNotice(err.Error())
+		return
+	}
+
+	lines := g.RecentOutput(n, filter)
+	if len(lines) == 0 {
+		data.ReturnNotice(fmt.Sprintf("no matching output from %q", name))
+		return
+	}
+
+	for _, page := range util.JoinToMaxLength(lines, " | ", logPageLength) {
+		data.ReturnNotice(page)
+	}
+}
+
 func (m *Manager) shutdownCmd(data *command.Data) {
 	msg := "Stop requested"
 	if len(data.Args) > 0 {
@@ -154,15 +244,7 @@ func (m *Manager) restartCmd(data *command.Data) {
 func (m *Manager) reloadCmd(data *command.Data) {
 	data.ReturnMessage("reloading config")
 
-	newConf, err := tomlconf.GetConfig(m.rootConf.OriginalPath)
-	if err != nil {
-		m.Error(err)
-		data.ReturnMessage("reload failed")
-
-		return
-	}
-
-	if err := m.reload(newConf); err != nil {
+	if err := m.Reload(); err != nil {
 		m.Error(err)
 		data.ReturnMessage("reload failed")
 
@@ -173,7 +255,10 @@ func (m *Manager) reloadCmd(data *command.Data) {
 }
 
 func (m *Manager) statusCmd(data *command.Data) {
-	ourStats := fmt.Sprintf("%s %s", systemstats.GetStats(), m.bot.Status())
+	ourStats := systemstats.GetStats()
+	for _, c := range m.conns {
+		ourStats += fmt.Sprintf(" [%s] %s", c.name, c.bot.Status())
+	}
 
 	if len(data.Args) == 0 {
 		data.ReturnMessage(ourStats)
@@ -201,22 +286,90 @@ func (m *Manager) statusCmd(data *command.Data) {
 	}
 }
 
+func (m *Manager) onlineCmd(data *command.Data) {
+	var games []interfaces.Game
+
+	if len(data.Args) == 0 {
+		m.ForEachGame(func(g interfaces.Game) {
+			if _, tracked := g.Players(); tracked && g.IsRunning() {
+				games = append(games, g)
+			}
+		}, nil)
+
+		if len(games) == 0 {
+			data.ReturnNotice("no running games are tracking their players")
+			return
+		}
+	}
+
+	for _, name := range data.Args {
+		g := m.GetGameFromName(name)
+		if g == nil {
+			data.ReturnNotice(fmt.Sprintf(gameNotExist, name))
+			continue
+		}
+
+		games = append(games, g)
+	}
+
+	for _, g := range games {
+		players, tracked := g.Players()
+
+		switch {
+		case !tracked:
+			data.ReturnNotice(fmt.Sprintf("game %q does not track its players", g.GetName()))
+		case !g.IsRunning():
+			data.ReturnMessage(fmt.Sprintf("[%s] not running", g.GetName()))
+		case len(players) == 0:
+			data.ReturnMessage(fmt.Sprintf("[%s] nobody is online", g.GetName()))
+		default:
+			prefix := fmt.Sprintf("[%s] %d online: ", g.GetName(), len(players))
+			for _, page := range util.JoinToMaxLength(players, ", ", logPageLength-len(prefix)) {
+				data.ReturnMessage(prefix + page)
+				prefix = fmt.Sprintf("[%s] ", g.GetName())
+			}
+		}
+	}
+}
+
+// connectionsFromArgs returns the connection named by the first argument, removing it from the arguments. If the first
+// argument does not name a connection, all connections are returned and the arguments are unchanged
+func (m *Manager) connectionsFromArgs(args []string) ([]*connection, []string) {
+	if len(args) > 0 {
+		if c := m.getConnection(args[0]); c != nil {
+			return []*connection{c}, args[1:]
+		}
+	}
+
+	return m.conns, args
+}
+
 func (m *Manager) reconnectCmd(data *command.Data) {
-	m.reconnecting.Set(true)
+	conns, args := m.connectionsFromArgs(data.Args)
 
 	msg := "reconnecting"
 
-	if len(data.Args) > 0 {
-		msg = strings.Join(data.Args, " ")
+	if len(args) > 0 {
+		msg = strings.Join(args, " ")
 	}
 
-	m.bot.Disconnect(msg)
+	for _, c := range conns {
+		c.reconnecting.Set(true)
+		c.bot.Disconnect(msg)
+	}
 }
 
 func (m *Manager) rawCmd(data *command.Data) {
-	if len(data.Args) == 0 {
+	conns, args := m.connectionsFromArgs(data.Args)
+	if len(conns) > 1 {
+		data.ReturnNotice("raw requires a connection name as its first argument when more than one connection exists")
+		return
+	}
+
+	if len(args) == 0 {
 		data.ReturnNotice("raw requires an argument")
+		return
 	}
 
-	m.bot.SendRaw(strings.Join(data.Args, " "))
+	conns[0].bot.SendRaw(strings.Join(args, " "))
 }
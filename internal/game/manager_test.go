@@ -0,0 +1,49 @@
+package game
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+type replyingBot struct {
+	*nullconn.NullConn
+	sent []string
+}
+
+func (r *replyingBot) SendMessage(target, message string) {
+	r.sent = append(r.sent, "message "+target+" "+message)
+}
+
+func (r *replyingBot) SendReply(target, replyTo, message string) {
+	r.sent = append(r.sent, "reply "+target+" "+replyTo+" "+message)
+}
+
+func Test_commandUtil(t *testing.T) {
+	tests := []struct {
+		name   string
+		msgID  string
+		target string
+		want   []string
+	}{
+		{name: "no id", target: "#chan", want: []string{"message #chan hi"}},
+		{name: "reply", msgID: "abc", target: "#chan", want: []string{"reply #chan abc hi"}},
+		{name: "other target", msgID: "abc", target: "someone", want: []string{"message someone hi"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &replyingBot{NullConn: nullconn.New(log.New(0, ioutil.Discard, "TEST", log.INFO))}
+
+			commandUtil(bot, "#chan", tt.msgID).SendMessage(tt.target, "hi")
+
+			if !reflect.DeepEqual(bot.sent, tt.want) {
+				t.Errorf("sent %q, want %q", bot.sent, tt.want)
+			}
+		})
+	}
+}
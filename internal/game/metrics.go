@@ -0,0 +1,125 @@
+package game
+
+import (
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/metrics"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util/systemstats"
+)
+
+// managerMetrics holds the metrics that are updated as things happen, rather than being collected when read
+type managerMetrics struct {
+	restarts      *metrics.Counter
+	exitCode      *metrics.Gauge
+	lines         *metrics.Counter
+	regexpMatches *metrics.Counter
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// setupMetrics creates the manager's metrics registry, and registers all of its metrics
+func (m *Manager) setupMetrics() {
+	r := metrics.NewRegistry()
+	m.Metrics = r
+
+	m.metrics = managerMetrics{
+		restarts:      r.NewCounter("gggb_game_restarts_total", "Automatic restarts of a game", "game"),
+		exitCode:      r.NewGauge("gggb_game_last_exit_code", "The exit code of the last run of a game", "game"),
+		lines:         r.NewCounter("gggb_game_output_lines_total", "Lines of output from a game", "game", "stream"),
+		regexpMatches: r.NewCounter("gggb_regexp_matches_total", "Matches of a game's regexps", "game", "regexp"),
+	}
+
+	r.NewFunc("gggb_game_up", "Whether or not a game is running", metrics.GaugeType, []string{"game"},
+		func() []metrics.Sample {
+			var out []metrics.Sample
+
+			m.ForEachGame(func(g interfaces.Game) {
+				out = append(out, metrics.Sample{LabelValues: []string{g.GetName()}, Value: boolToFloat(g.IsRunning())})
+			}, nil)
+
+			return out
+		},
+	)
+
+	r.NewFunc("gggb_connection_lag_seconds", "Latency to a chat connection", metrics.GaugeType, []string{"connection"},
+		func() []metrics.Sample {
+			var out []metrics.Sample
+
+			for _, c := range m.conns {
+				if l, ok := c.bot.(interfaces.Lagger); ok {
+					out = append(out, metrics.Sample{LabelValues: []string{c.name}, Value: l.Lag().Seconds()})
+				}
+			}
+
+			return out
+		},
+	)
+
+	r.NewFunc("gggb_command_invocations_total", "Invocations of a command", metrics.CounterType, []string{"command"},
+		func() []metrics.Sample {
+			var out []metrics.Sample
+			for name, count := range m.Cmd.Invocations() {
+				out = append(out, metrics.Sample{LabelValues: []string{name}, Value: float64(count)})
+			}
+
+			return out
+		},
+	)
+
+	m.setupHostMetrics(r)
+}
+
+// hostStatsMaxAge is how long collected host stats are reused for, so that all of the host metrics in a scrape share
+// one collection. CPU usage is measured since the last collection, and reading memory stats stops the world
+var hostStatsMaxAge = time.Second
+
+// hostStatsCache collects host stats at most once every hostStatsMaxAge
+type hostStatsCache struct {
+	mu        sync.Mutex
+	stats     systemstats.Stats
+	collected time.Time
+}
+
+func (c *hostStatsCache) get() systemstats.Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.collected) >= hostStatsMaxAge {
+		c.stats, c.collected = systemstats.Collect(), time.Now()
+	}
+
+	return c.stats
+}
+
+func (m *Manager) setupHostMetrics(r *metrics.Registry) {
+	stats := new(hostStatsCache)
+	gauge := func(name, help string, f func(s systemstats.Stats) float64) {
+		r.NewFunc(name, help, metrics.GaugeType, nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: f(stats.get())}}
+		})
+	}
+
+	gauge("gggb_host_cpu_percent", "Host CPU usage", func(s systemstats.Stats) float64 { return s.CPUPercent })
+	gauge("gggb_host_memory_used_bytes", "Host memory in use", func(s systemstats.Stats) float64 { return s.MemoryUsed })
+	gauge("gggb_host_memory_total_bytes", "Host memory", func(s systemstats.Stats) float64 { return s.MemoryTotal })
+	gauge("gggb_bot_memory_bytes", "Memory obtained from the OS by the bot", func(s systemstats.Stats) float64 {
+		return s.BotMemory
+	})
+	gauge("gggb_bot_goroutines", "Goroutines in the bot", func(s systemstats.Stats) float64 { return s.Goroutines })
+
+	r.NewFunc(
+		"gggb_build_info", "The bot's version information", metrics.GaugeType, []string{"version", "go_version"},
+		func() []metrics.Sample {
+			s := stats.get()
+			return []metrics.Sample{{LabelValues: []string{s.BotVersion, s.RuntimeVersion}, Value: 1}}
+		},
+	)
+}
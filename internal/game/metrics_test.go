@@ -0,0 +1,100 @@
+package game
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+func TestManager_Metrics(t *testing.T) {
+	logger := log.New(log.FTimestamp, os.Stdout, "TEST", log.INFO)
+
+	m, err := NewManager(
+		&tomlconf.Config{}, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.metrics.restarts.Inc("test")
+	m.metrics.lines.Inc("test", "stdout")
+	m.Cmd.ParseLine("status", true, "", "", &nullResponder{})
+
+	out := strings.Builder{}
+	if err := m.Metrics.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`gggb_game_restarts_total{game="test"} 1`,
+		`gggb_game_output_lines_total{game="test",stream="stdout"} 1`,
+		`gggb_command_invocations_total{command="status"} 1`,
+		"# TYPE gggb_host_cpu_percent gauge",
+		"gggb_bot_goroutines ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestManager_hostMetrics(t *testing.T) {
+	defer func(old time.Duration) { hostStatsMaxAge = old }(hostStatsMaxAge)
+	hostStatsMaxAge = time.Millisecond * 100
+
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+
+	m, err := NewManager(&tomlconf.Config{}, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpuPercent := func() float64 {
+		out := strings.Builder{}
+		if err := m.Metrics.WriteText(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, l := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(l, "gggb_host_cpu_percent ") {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(l, "gggb_host_cpu_percent "), 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return v
+			}
+		}
+
+		t.Fatalf("no CPU usage in metrics output:\n%s", out.String())
+
+		return 0
+	}
+
+	cpuPercent()
+
+	// Use some CPU, so that there is something to measure
+	for deadline := time.Now().Add(time.Millisecond * 300); time.Now().Before(deadline); {
+		runtime.Gosched()
+	}
+
+	if got := cpuPercent(); math.IsNaN(got) || got == 0 {
+		t.Errorf("gggb_host_cpu_percent = %v after using CPU, want a positive value", got)
+	}
+}
+
+type nullResponder struct{}
+
+func (nullResponder) AdminLevel(string) int   { return 0 }
+func (nullResponder) SendMessage(_, _ string) {}
+func (nullResponder) SendNotice(_, _ string)  {}
@@ -0,0 +1,75 @@
+package game
+
+import (
+	"sync"
+	"time"
+)
+
+// OutputLine is a single line of output from a game
+type OutputLine struct {
+	Game   string    `json:"game"`
+	Stdout bool      `json:"stdout"`
+	Line   string    `json:"line"`
+	Time   time.Time `json:"time"`
+}
+
+const outputBufferSize = 64
+
+type outputSub struct {
+	game string
+	c    chan OutputLine
+}
+
+// outputBroadcaster sends game output to any number of subscribers. Subscribers that fall behind have lines dropped
+// rather than blocking the game
+type outputBroadcaster struct {
+	mu   sync.Mutex
+	subs map[*outputSub]struct{}
+}
+
+// subscribe returns a channel that receives output from the named game, or from all games if game is empty, and a
+// function that must be called to unsubscribe
+func (b *outputBroadcaster) subscribe(game string) (<-chan OutputLine, func()) {
+	sub := &outputSub{game: game, c: make(chan OutputLine, outputBufferSize)}
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[*outputSub]struct{})
+	}
+
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	once := sync.Once{}
+
+	return sub.c, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.c)
+		})
+	}
+}
+
+func (b *outputBroadcaster) publish(line OutputLine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.game != "" && sub.game != line.Game {
+			continue
+		}
+
+		select {
+		case sub.c <- line:
+		default:
+		}
+	}
+}
+
+// SubscribeOutput returns a channel that receives lines of output from the named game, or from all games if name is
+// empty, and a function that must be called once the channel is no longer needed
+func (m *Manager) SubscribeOutput(name string) (<-chan OutputLine, func()) {
+	return m.output.subscribe(name)
+}
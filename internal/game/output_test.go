@@ -0,0 +1,49 @@
+package game
+
+import "testing"
+
+func TestOutputBroadcaster(t *testing.T) {
+	b := outputBroadcaster{}
+
+	all, cancelAll := b.subscribe("")
+	one, cancelOne := b.subscribe("one")
+
+	b.publish(OutputLine{Game: "one", Line: "first"})
+	b.publish(OutputLine{Game: "two", Line: "second"})
+
+	if got := (<-all).Line; got != "first" {
+		t.Errorf("all subscriber got %q, want first", got)
+	}
+
+	if got := (<-all).Line; got != "second" {
+		t.Errorf("all subscriber got %q, want second", got)
+	}
+
+	if got := (<-one).Line; got != "first" {
+		t.Errorf("filtered subscriber got %q, want first", got)
+	}
+
+	select {
+	case l := <-one:
+		t.Errorf("filtered subscriber got a line for another game: %#v", l)
+	default:
+	}
+
+	cancelOne()
+	cancelOne() // Must be safe to call twice
+
+	if _, ok := <-one; ok {
+		t.Error("channel was not closed after unsubscribing")
+	}
+
+	// Slow subscribers should have lines dropped, not block publishing
+	for i := 0; i < outputBufferSize*2; i++ {
+		b.publish(OutputLine{Game: "one"})
+	}
+
+	if len(all) != outputBufferSize {
+		t.Errorf("buffered lines = %d, want %d", len(all), outputBufferSize)
+	}
+
+	cancelAll()
+}
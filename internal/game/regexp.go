@@ -9,7 +9,9 @@ import (
 	"text/template"
 
 	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/webhook"
 	"awesome-dragon.science/go/goGoGameBot/pkg/format"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
 )
 
 // RegexpList is a slice of pointers to regexps that exists simply to implement the sort interface
@@ -39,6 +41,9 @@ func NewRegexp(conf tomlconf.Regexp, manager *RegexpManager, root *template.Temp
 	funcs := template.FuncMap{
 		"sendToMsgChan": manager.game.templSendToMsgChan,
 		"sendPrivmsg":   manager.game.templSendMessage, // TODO: rename this
+		"chatUsers":     manager.game.templChatUsers,
+		"setTopic":      manager.game.templSetTopic,
+		"sendToGame":    manager.game.templSendToGame,
 	}
 
 	templ := &format.Format{FormatString: conf.Format}
@@ -52,6 +57,7 @@ func NewRegexp(conf tomlconf.Regexp, manager *RegexpManager, root *template.Temp
 	}
 
 	return &Regexp{
+		name:             conf.Name,
 		priority:         conf.Priority,
 		regexp:           compiledRe,
 		template:         templ,
@@ -60,11 +66,14 @@ func NewRegexp(conf tomlconf.Regexp, manager *RegexpManager, root *template.Temp
 		sendToChan:       conf.SendToChan,
 		sendToOtherGames: conf.SendToOthers,
 		sendToLocalGame:  conf.SendToLocal,
+		sendToWebhook:    conf.SendToWebhook,
+		sendToGames:      conf.SendToGames,
 	}, nil
 }
 
 // Regexp is a representation of a regex and a util.Format pair that is applied to stdout lines of a game
 type Regexp struct {
+	name     string
 	priority int
 	regexp   *regexp.Regexp
 	template *format.Format
@@ -74,6 +83,8 @@ type Regexp struct {
 	sendToChan       bool
 	sendToOtherGames bool
 	sendToLocalGame  bool
+	sendToWebhook    bool
+	sendToGames      []string
 }
 
 func (r *Regexp) String() string {
@@ -109,16 +120,21 @@ func (r *Regexp) checkAndExecute(line string, stdout bool) (bool, error) {
 		return false, nil
 	}
 
+	r.manager.game.manager.metrics.regexpMatches.Inc(r.manager.game.name, r.name)
+
 	if r.template == nil {
 		// we matched, but dont have any template to use.
 		// we're probably being used to strip out data
 		return true, nil
 	}
 
+	players := r.manager.game.players.list()
 	data := struct {
-		IsStdout bool
-		Groups   map[string]string
-	}{stdout, matchMap}
+		IsStdout    bool
+		Groups      map[string]string
+		Players     []string
+		PlayerCount int
+	}{stdout, matchMap, players, len(players)}
 
 	resp, err := r.template.Execute(data)
 	if err != nil {
@@ -131,17 +147,26 @@ func (r *Regexp) checkAndExecute(line string, stdout bool) (bool, error) {
 	}
 
 	if r.sendToChan {
-		r.manager.game.sendToBridgedChannel(resp)
+		r.manager.game.sendToChannels(eventChat, resp)
 	}
 
-	if r.sendToOtherGames {
-		r.manager.game.writeToAllOthers(resp)
+	if r.sendToOtherGames || len(r.sendToGames) > 0 {
+		r.manager.game.writeToOthers(resp, r.sendToOtherGames, r.sendToGames)
 	}
 
 	if r.sendToLocalGame {
 		r.manager.game.SendLineFromOtherGame(resp, r.manager.game)
 	}
 
+	if r.sendToWebhook {
+		r.manager.game.sendToWebhooks(webhook.Event{
+			Type:    tomlconf.WebhookNotify,
+			Message: tokeniser.Strip(resp),
+			Regexp:  r.name,
+			Groups:  matchMap,
+		})
+	}
+
 	return true, nil
 }
 
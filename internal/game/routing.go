@@ -0,0 +1,77 @@
+package game
+
+import (
+	"sync"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// routes holds the groups games are in, and decides which games messages from another game are sent to. Games that
+// are in no group are treated as being in a group together, so without any groups every game forwards to every other
+type routes struct {
+	sync.RWMutex
+	groups map[string][]string
+}
+
+func (r *routes) update(groups map[string][]string) {
+	r.Lock()
+	r.groups = groups
+	r.Unlock()
+}
+
+// groupsOf returns the names of the groups the given game is in
+func (r *routes) groupsOf(game string) []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	var out []string
+
+	for name, members := range r.groups {
+		if util.ContainsFold(members, game) {
+			out = append(out, name)
+		}
+	}
+
+	return out
+}
+
+// sameGroup returns whether or not the two games share a group
+func (r *routes) sameGroup(a, b string) bool {
+	aGroups, bGroups := r.groupsOf(a), r.groupsOf(b)
+	if len(aGroups) == 0 && len(bGroups) == 0 {
+		return true
+	}
+
+	for _, g := range aGroups {
+		if util.ContainsFold(bGroups, g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isGroup returns whether or not a group with the given name exists
+func (r *routes) isGroup(name string) bool {
+	r.RLock()
+	defer r.RUnlock()
+
+	_, exists := r.groups[name]
+
+	return exists
+}
+
+// matches returns whether or not the given game is referred to by the given list, either by name or by a group it is in
+func (r *routes) matches(targets []string, game string) bool {
+	if util.ContainsFold(targets, game) {
+		return true
+	}
+
+	for _, g := range r.groupsOf(game) {
+		if util.ContainsFold(targets, g) {
+			return true
+		}
+	}
+
+	return false
+}
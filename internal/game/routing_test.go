@@ -0,0 +1,156 @@
+package game
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+var testGroups = map[string][]string{
+	"smp":     {"survival", "creative"},
+	"hardest": {"hardcore", "survival"},
+}
+
+func TestRoutes(t *testing.T) {
+	r := &routes{}
+	r.update(testGroups)
+
+	tests := []struct {
+		name      string
+		a         string
+		b         string
+		targets   []string
+		sameGroup bool
+		matches   bool
+	}{
+		{name: "same group", a: "survival", b: "creative", sameGroup: true},
+		{name: "different groups", a: "creative", b: "hardcore"},
+		{name: "ungrouped", a: "lobby", b: "minigames", sameGroup: true},
+		{name: "grouped and ungrouped", a: "survival", b: "lobby"},
+		{name: "target by name", a: "lobby", b: "hardcore", targets: []string{"hardcore"}, matches: true},
+		{name: "target by group", a: "lobby", b: "creative", targets: []string{"smp"}, matches: true},
+		{name: "not targeted", a: "lobby", b: "hardcore", targets: []string{"smp", "creative"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.sameGroup(tt.a, tt.b); got != tt.sameGroup {
+				t.Errorf("sameGroup(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.sameGroup)
+			}
+
+			if got := r.matches(tt.targets, tt.b); got != tt.matches {
+				t.Errorf("matches(%q, %q) = %t, want %t", tt.targets, tt.b, got, tt.matches)
+			}
+		})
+	}
+}
+
+// routedGame is a running game that records the messages forwarded to it
+type routedGame struct {
+	interfaces.Game
+	name     string
+	received *[]string
+}
+
+func (r *routedGame) GetName() string { return r.name }
+func (r *routedGame) IsRunning() bool { return true }
+
+func (r *routedGame) SendLineFromOtherGame(string, interfaces.Game) {
+	*r.received = append(*r.received, r.name)
+}
+
+func TestGame_writeToOthers(t *testing.T) {
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+
+	m, err := NewManager(
+		&tomlconf.Config{Groups: testGroups}, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []string
+
+	for _, name := range []string{"creative", "hardcore", "lobby", "minigames"} {
+		if err := m.AddGame(&routedGame{name: name, received: &received}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		from    string
+		toGroup bool
+		targets []string
+		want    []string
+	}{
+		{name: "groups", from: "survival", toGroup: true, want: []string{"creative", "hardcore"}},
+		{name: "ungrouped", from: "arcade", toGroup: true, want: []string{"lobby", "minigames"}},
+		{name: "targets", from: "arcade", targets: []string{"smp", "hardcore"}, want: []string{"creative", "hardcore"}},
+		{
+			name:    "group and targets",
+			from:    "survival",
+			toGroup: true,
+			targets: []string{"lobby", "creative"},
+			want:    []string{"creative", "hardcore", "lobby"},
+		},
+		{name: "nothing", from: "survival"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+
+			g := &Game{name: tt.from, manager: m}
+			g.writeToOthers("test", tt.toGroup, tt.targets)
+			sort.Strings(received)
+
+			if !reflect.DeepEqual(received, tt.want) {
+				t.Errorf("writeToOthers() sent to %q, want %q", received, tt.want)
+			}
+		})
+	}
+}
+
+func TestGame_acceptsForwardsFrom(t *testing.T) {
+	logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+
+	m, err := NewManager(
+		&tomlconf.Config{Groups: testGroups}, map[string]interfaces.Bot{"default": nullconn.New(logger)}, logger,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		from  string
+		want  bool
+	}{
+		{name: "defaults", from: "survival", want: true},
+		{name: "allowed group", allow: []string{"smp"}, from: "creative", want: true},
+		{name: "not allowed", allow: []string{"smp"}, from: "hardcore", want: false},
+		{name: "denied", deny: []string{"hardcore"}, from: "hardcore", want: false},
+		{name: "deny wins", allow: []string{"smp"}, deny: []string{"hardest"}, from: "survival", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Game{manager: m, chatBridge: &chatBridge{forwardsAllow: tt.allow, forwardsDeny: tt.deny}}
+			if got := g.acceptsForwardsFrom(tt.from); got != tt.want {
+				t.Errorf("acceptsForwardsFrom(%q) = %t, want %t", tt.from, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
+)
+
+// scheduledTask is a template that is run on a timer, with its result sent to the game, chat, or the command manager
+type scheduledTask struct {
+	name     string
+	sendTo   string
+	schedule cron.Schedule
+	template *format.Format
+	game     *Game
+}
+
+func parseSchedule(conf tomlconf.Schedule) (cron.Schedule, error) {
+	switch {
+	case conf.Cron != "" && conf.Every != "":
+		return nil, errors.New("cannot have both cron and every set")
+
+	case conf.Cron != "":
+		return cron.ParseStandard(conf.Cron)
+
+	case conf.Every != "":
+		d, err := time.ParseDuration(conf.Every)
+		if err != nil {
+			return nil, err
+		}
+
+		if d < time.Second {
+			return nil, fmt.Errorf("interval %s is too short", d)
+		}
+
+		return cron.Every(d), nil
+
+	default:
+		return nil, errors.New("one of cron or every must be set")
+	}
+}
+
+func newScheduledTask(conf tomlconf.Schedule, g *Game, root *template.Template) (*scheduledTask, error) {
+	if conf.Name == "" {
+		return nil, errors.New("scheduled tasks must have a name")
+	}
+
+	sched, err := parseSchedule(conf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule for %q: %w", conf.Name, err)
+	}
+
+	sendTo := strings.ToLower(conf.SendTo)
+	switch sendTo {
+	case "":
+		sendTo = tomlconf.ScheduleStdin
+	case tomlconf.ScheduleStdin, tomlconf.ScheduleChat, tomlconf.ScheduleCommand:
+	default:
+		return nil, fmt.Errorf("invalid send_to %q for %q", conf.SendTo, conf.Name)
+	}
+
+	funcs := template.FuncMap{
+		"sendToMsgChan": g.templSendToMsgChan,
+		"sendPrivmsg":   g.templSendMessage,
+		"chatUsers":     g.templChatUsers,
+		"setTopic":      g.templSetTopic,
+		"sendToGame":    g.templSendToGame,
+	}
+
+	templ := &format.Format{FormatString: conf.Format}
+	if err := templ.Compile("schedule_"+conf.Name, root, funcs); err != nil {
+		return nil, fmt.Errorf("could not compile format for scheduled task %q: %w", conf.Name, err)
+	}
+
+	return &scheduledTask{name: conf.Name, sendTo: sendTo, schedule: sched, template: templ, game: g}, nil
+}
+
+type dataForSchedule struct {
+	dataForFmt
+	Name string
+	Time time.Time
+}
+
+// Run implements cron.Job. It executes the task's template and sends the result on
+func (t *scheduledTask) Run() {
+	g := t.game
+	if g.manager.status.Get() == shutdown || (t.sendTo == tomlconf.ScheduleStdin && !g.IsRunning()) {
+		return
+	}
+
+	data := dataForSchedule{*g.makeDataForFormat("", "", "", ""), t.name, time.Now()}
+
+	res, err := t.template.Execute(&data)
+	if err != nil {
+		g.checkError(fmt.Errorf("could not run scheduled task %q on %q: %w", t.name, g.name, err))
+		return
+	}
+
+	if res == "" {
+		return
+	}
+
+	switch t.sendTo {
+	case tomlconf.ScheduleStdin:
+		_, err = g.WriteString(res)
+		g.checkError(err)
+
+	case tomlconf.ScheduleChat:
+		g.sendToChannels(eventChat, res)
+
+	case tomlconf.ScheduleCommand:
+		for _, line := range strings.Split(res, "\n") {
+			g.manager.Cmd.ParseLine(strings.TrimSpace(line), true, "", "", scheduleUtil{g, t.name})
+		}
+	}
+}
+
+// scheduleUtil is a command.DataUtil that logs any responses to commands run by a scheduled task
+type scheduleUtil struct {
+	game *Game
+	name string
+}
+
+// AdminLevel grants no admin level. Commands from scheduled tasks come from the config, and are run as if they were
+// from the terminal, which skips permission checks entirely
+func (scheduleUtil) AdminLevel(string) int { return 0 }
+
+func (s scheduleUtil) SendMessage(_, message string) {
+	s.game.Infof("[schedule %s] %s", s.name, tokeniser.Strip(message))
+}
+
+func (s scheduleUtil) SendNotice(_, message string) {
+	s.game.Infof("[schedule %s] (notice) %s", s.name, tokeniser.Strip(message))
+}
+
+// compileSchedule creates the scheduled tasks for the given configs, without starting them
+func (g *Game) compileSchedule(confs []tomlconf.Schedule, root *template.Template) ([]*scheduledTask, error) {
+	out := make([]*scheduledTask, 0, len(confs))
+
+	for _, conf := range confs {
+		task, err := newScheduledTask(conf, g, root)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, task)
+	}
+
+	return out, nil
+}
+
+// updateSchedule stops any currently scheduled tasks, and starts the given tasks in their place
+func (g *Game) updateSchedule(tasks []*scheduledTask) {
+	if g.scheduler != nil {
+		g.scheduler.Stop()
+		g.scheduler = nil
+	}
+
+	if len(tasks) == 0 {
+		return
+	}
+
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+
+	for _, task := range tasks {
+		c.Schedule(task.schedule, task)
+	}
+
+	c.Start()
+	g.scheduler = c
+}
@@ -0,0 +1,190 @@
+package game
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"text/template"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/command"
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/nullconn"
+	"awesome-dragon.science/go/goGoGameBot/internal/transport"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+func TestNewScheduledTask(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		conf     tomlconf.Schedule
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "interval",
+			conf:     tomlconf.Schedule{Name: "save", Every: "10m", Format: "save-all"},
+			wantNext: start.Add(time.Minute * 10),
+		},
+		{
+			name:     "cron",
+			conf:     tomlconf.Schedule{Name: "warn", Cron: "55 4 * * *", Format: "say restarting soon", SendTo: "chat"},
+			wantNext: time.Date(2020, 10, 2, 4, 55, 0, 0, time.Local),
+		},
+		{
+			name:     "descriptor",
+			conf:     tomlconf.Schedule{Name: "restart", Cron: "@daily", Format: "gamectl restart test", SendTo: "command"},
+			wantNext: time.Date(2020, 10, 2, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:    "no name",
+			conf:    tomlconf.Schedule{Every: "10m", Format: "save-all"},
+			wantErr: true,
+		},
+		{
+			name:    "both",
+			conf:    tomlconf.Schedule{Name: "both", Cron: "@daily", Every: "10m", Format: "save-all"},
+			wantErr: true,
+		},
+		{
+			name:    "neither",
+			conf:    tomlconf.Schedule{Name: "neither", Format: "save-all"},
+			wantErr: true,
+		},
+		{
+			name:    "bad cron",
+			conf:    tomlconf.Schedule{Name: "bad", Cron: "not a cron", Format: "save-all"},
+			wantErr: true,
+		},
+		{
+			name:    "short interval",
+			conf:    tomlconf.Schedule{Name: "short", Every: "1ms", Format: "save-all"},
+			wantErr: true,
+		},
+		{
+			name:    "bad target",
+			conf:    tomlconf.Schedule{Name: "bad", Every: "10m", Format: "save-all", SendTo: "nowhere"},
+			wantErr: true,
+		},
+		{
+			name:    "empty format",
+			conf:    tomlconf.Schedule{Name: "empty", Every: "10m"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newScheduledTask(tt.conf, &Game{}, template.New("root"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newScheduledTask() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if next := got.schedule.Next(start); !next.Equal(tt.wantNext) {
+				t.Errorf("schedule.Next() = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+// stdinTransport is a transport that records the lines written to it
+type stdinTransport struct {
+	transport.Transport
+	running bool
+	written chan string
+}
+
+func (s *stdinTransport) IsRunning() bool { return s.running }
+
+func (s *stdinTransport) Write(p []byte) (int, error) {
+	s.written <- string(p)
+	return len(p), nil
+}
+
+func TestScheduledTask_Run(t *testing.T) {
+	tests := []struct {
+		name    string
+		sendTo  string
+		running bool
+		want    []string
+	}{
+		{name: "stdin", sendTo: tomlconf.ScheduleStdin, running: true, want: []string{"stdin say hi\n"}},
+		{name: "stdin not running", sendTo: tomlconf.ScheduleStdin},
+		{name: "chat", sendTo: tomlconf.ScheduleChat, want: []string{"message #chan [test] say hi"}},
+		{name: "command", sendTo: tomlconf.ScheduleCommand, want: []string{"command say hi, from terminal true"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(0, ioutil.Discard, "TEST", log.INFO)
+			bot := &replyingBot{NullConn: nullconn.New(logger)}
+
+			m, err := NewManager(&tomlconf.Config{}, map[string]interfaces.Bot{"default": bot}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+
+			// Requires a higher admin level than anyone has, so that it only runs if permission checks are skipped
+			err = m.Cmd.AddCommand("say", 1000, func(data *command.Data) {
+				got = append(got, fmt.Sprintf("command say %s, from terminal %t", data, data.FromTerminal))
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			channel, err := newBridgedChannel(tomlconf.BridgedChannel{Connection: "default", Name: "#chan"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tr := &stdinTransport{running: tt.running, written: make(chan string, 1)}
+			g := &Game{
+				name:       "test",
+				manager:    m,
+				Logger:     logger,
+				transport:  tr,
+				stdinChan:  make(chan []byte),
+				chatBridge: &chatBridge{channels: []*bridgedChannel{channel}},
+			}
+
+			go g.watchStdinChan()
+			defer close(g.stdinChan)
+
+			task, err := newScheduledTask(
+				tomlconf.Schedule{Name: "greet", Every: "10m", Format: "say hi", SendTo: tt.sendTo}, g, template.New("root"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			task.Run()
+
+			if tt.running {
+				select {
+				case line := <-tr.written:
+					got = append(got, "stdin "+line)
+				case <-time.After(time.Second * 5):
+					t.Fatal("timed out waiting for the line to be written to the game")
+				}
+			}
+
+			got = append(got, bot.sent...)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package interfaces
 
+import "time"
+
 // Bot represents a bot, that is, a connection to a chat service that we are bridging though
 type Bot interface {
 	// Connect connects to the service. It MUST NOT block after negotiation with the service is complete
@@ -17,6 +19,8 @@ type Bot interface {
 	AdminLeveller
 	// JoinChannel joins the given channel
 	JoinChannel(name string)
+	// SetTopic sets the topic of the given channel. The topic is in the intermediate format
+	SetTopic(channel, topic string)
 	// Reload reloads the Bot using the given unmarshalable config
 	Reload(unmarshaller Unmarshaler) error
 	// StaticCommandPrefixes returns the bots current static prefixes
@@ -30,6 +34,62 @@ type Bot interface {
 	Statuser //nolint:misspell // intentional.
 }
 
+// Lagger is an optional interface for Bots that can report the latency of their connection
+type Lagger interface {
+	// Lag returns the most recently measured latency to the chat service
+	Lag() time.Duration
+}
+
+// BridgeMessager is an optional interface for Bots that can send messages bridged from games at a lower priority than
+// other messages
+type BridgeMessager interface {
+	// SendBridgeMessage sends a bridged message to the given target
+	SendBridgeMessage(target, message string)
+}
+
+// Replier is an optional interface for Bots that can send messages as replies to other messages
+type Replier interface {
+	// SendReply sends a message to the given target, as a reply to the message with the given ID
+	SendReply(target, replyTo, message string)
+}
+
+// MessageMeta holds extra information about a chat message, where the chat service provides it
+type MessageMeta struct {
+	ID             string    // The ID of the message
+	Time           time.Time // When the message was sent
+	ReplyTo        string    // The ID of the message this is a reply to, if any
+	ReplyToSource  string    // The source of the message this is a reply to, if it is known
+	ReplyToMessage string    // The message this is a reply to, in the intermediate format, if it is known
+}
+
+// MetaHooker is an optional interface for Bots that can provide MessageMeta with channel messages
+type MetaHooker interface {
+	// HookMessageMeta hooks on messages to a channel, like Hooker.HookMessage. Bots implementing MetaHooker should
+	// be hooked with HookMessageMeta instead of HookMessage
+	HookMessageMeta(func(source, channel, message string, isAction bool, meta MessageMeta))
+}
+
+// TopicLimiter is an optional interface for Bots whose service limits how often a channel's topic can be changed
+type TopicLimiter interface {
+	// MinTopicInterval returns the shortest time the service allows between topic changes on a channel
+	MinTopicInterval() time.Duration
+}
+
+// ChannelMember is a user in a channel
+type ChannelMember struct {
+	Nick   string
+	Prefix string // The user's status prefixes in the channel, such as @ or +, highest first
+	Away   bool
+}
+
+// ChannelTracker is an optional interface for Bots that track who is in the channels they are in
+type ChannelTracker interface {
+	// ChannelMembers returns the members of the given channel sorted by nick, or nil if the Bot is not in it
+	ChannelMembers(channel string) []ChannelMember
+	// UserChannels returns the channels the Bot shares with the given source
+	UserChannels(source string) []string
+}
+
 // Messager represents a type that can send messages to a chat system. Implementations should expect and handle
 // newlines if needed. Implementations should also convert incoming lines to their protocol level formatting if
 // applicable
@@ -57,8 +117,33 @@ type Hooker interface {
 	HookKick(func(source, channel, target, message string))
 	// HookNick hoops on a user changing their nickname
 	HookNick(func(source, newNick string))
+	// HookTopic hooks on a channel's topic being changed
+	HookTopic(func(source, channel, topic string))
+	// HookMode hooks on a channel's modes being changed, including bans and user status
+	HookMode(func(source, channel string, changes []ModeChange))
+	// HookNotice hooks on notices to a channel
+	HookNotice(func(source, channel, message string))
+}
+
+// ModeChange is a single mode being set or unset on a channel
+type ModeChange struct {
+	Adding bool   // Whether the mode is being set or unset
+	Mode   string // The mode character, eg "b" for a ban
+	Arg    string // The mode's argument, if it has one, eg the mask being banned
+}
+
+// String returns the change in the form used by IRC, eg "+b *!*@host"
+func (m ModeChange) String() string {
+	out := "-" + m.Mode
+	if m.Adding {
+		out = "+" + m.Mode
+	}
+
+	if m.Arg != "" {
+		out += " " + m.Arg
+	}
 
-	// TODO: bans, system notices (this is where modes etc will go)
+	return out
 }
 
 // CommandResponder provides helper methods for responding to command calls with Messages, and Notices
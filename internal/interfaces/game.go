@@ -4,6 +4,7 @@ package interfaces
 
 import (
 	"io"
+	"regexp"
 	"sync"
 	"time"
 
@@ -29,15 +30,23 @@ type Game interface {
 	Runner
 	AutoStarter
 	Statuser //nolint:misspell // Its Status-er not a misspelling of stature
+	StorageFlusher
+	OutputLogger
+	PlayerLister
 	io.Writer
 	io.StringWriter
 
-	OnMessage(source, target, msg string, isAction bool)
-	OnJoin(source, channel string)
-	OnPart(source, channel, message string)
-	OnNick(source, newnick string)
-	OnQuit(source, message string)
-	OnKick(source, channel, kickee, message string)
+	// Chat callbacks. conn is the name of the connection the event came from. channels is the channels the user was
+	// in, or nil if the connection does not track them
+	OnMessage(conn, source, target, msg string, isAction bool, meta MessageMeta)
+	OnJoin(conn, source, channel string)
+	OnPart(conn, source, channel, message string)
+	OnNick(conn, source, newnick string, channels []string)
+	OnQuit(conn, source, message string, channels []string)
+	OnKick(conn, source, channel, kickee, message string)
+	OnTopic(conn, source, channel, topic string)
+	OnMode(conn, source, channel string, changes []ModeChange)
+	OnNotice(conn, source, channel, message string)
 	SendLineFromOtherGame(msg string, source Game)
 }
 
@@ -54,6 +63,27 @@ type Runner interface {
 	IsRunning() bool
 }
 
+// StorageFlusher refers to any type that holds storage that may need to be saved before exit
+type StorageFlusher interface {
+	// FlushStorage saves any unsaved storage immediately
+	FlushStorage() error
+}
+
+// OutputLogger refers to any type that keeps a log of its output
+type OutputLogger interface {
+	// RecentOutput returns up to n of the most recent lines of output that match filter, oldest first. A nil filter
+	// matches all lines
+	RecentOutput(n int, filter *regexp.Regexp) []string
+	// CloseLogs closes any open log files
+	CloseLogs() error
+}
+
+// PlayerLister refers to any type that tracks the players online in it
+type PlayerLister interface {
+	// Players returns the names of the players online, and whether or not players are tracked at all
+	Players() ([]string, bool)
+}
+
 // AutoStarter refers to any type that can be autostarted
 type AutoStarter interface {
 	AutoStart()
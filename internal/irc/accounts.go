@@ -0,0 +1,143 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/goshuirc/irc-go/ircmsg"
+	"github.com/goshuirc/irc-go/ircutils"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// Capabilities used to track the services accounts of users
+const (
+	capAccountNotify = "account-notify"
+	capExtendedJoin  = "extended-join"
+	capAccountTag    = "account-tag"
+)
+
+// noAccount is sent by servers in place of an account name for users that are not logged in
+const noAccount = "*"
+
+// accountTracker tracks the services accounts of users by nick
+type accountTracker struct {
+	sync.RWMutex
+	accounts map[string]string
+}
+
+func newAccountTracker() *accountTracker {
+	return &accountTracker{accounts: make(map[string]string)}
+}
+
+// set sets the account for the given nick. An empty account, or noAccount, marks the nick as logged out
+func (a *accountTracker) set(nick, account string) {
+	a.Lock()
+	defer a.Unlock()
+
+	if account == "" || account == noAccount {
+		delete(a.accounts, strings.ToLower(nick))
+		return
+	}
+
+	a.accounts[strings.ToLower(nick)] = account
+}
+
+// get returns the account for the given nick, or an empty string if it is not logged in
+func (a *accountTracker) get(nick string) string {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.accounts[strings.ToLower(nick)]
+}
+
+func (a *accountTracker) rename(oldNick, newNick string) {
+	a.Lock()
+	defer a.Unlock()
+
+	account, ok := a.accounts[strings.ToLower(oldNick)]
+	if !ok {
+		return
+	}
+
+	delete(a.accounts, strings.ToLower(oldNick))
+	a.accounts[strings.ToLower(newNick)] = account
+}
+
+// prune stops tracking the accounts of all nicks that keep returns false for
+func (a *accountTracker) prune(keep func(nick string) bool) {
+	a.Lock()
+	defer a.Unlock()
+
+	for nick := range a.accounts {
+		if !keep(nick) {
+			delete(a.accounts, nick)
+		}
+	}
+}
+
+func (a *accountTracker) clear() {
+	a.Lock()
+	a.accounts = make(map[string]string)
+	a.Unlock()
+}
+
+func (i *IRC) setupAccountTracking() {
+	i.RawEvents.Attach("ACCOUNT", i.onAccount, event.PriHighest)
+	i.RawEvents.Attach("JOIN", i.onExtendedJoin, event.PriHighest)
+	i.HookNick(func(source, newNick string) { i.accounts.rename(i.HumanReadableSource(source), newNick) })
+	i.HookQuit(func(source, _ string) { i.accounts.set(i.HumanReadableSource(source), "") })
+}
+
+// onAccount handles account-notify ACCOUNT messages, sent when a user logs in or out
+func (i *IRC) onAccount(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 1 {
+		return
+	}
+
+	i.accounts.set(ircutils.ParseUserhost(raw.Line.Prefix).Nick, raw.Line.Params[0])
+}
+
+// onExtendedJoin handles the account sent with JOINs when extended-join is enabled
+func (i *IRC) onExtendedJoin(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 2 || !i.capabilityManager.capEnabled(capExtendedJoin) {
+		return
+	}
+
+	i.accounts.set(ircutils.ParseUserhost(raw.Line.Prefix).Nick, raw.Line.Params[1])
+}
+
+// updateAccountFromTag updates the account of the source of the given line from its account tag. When account-tag is
+// enabled, a line from a user with no account tag means they are not logged in. This must be called before the line
+// is dispatched, so that anything handling it sees the current account
+func (i *IRC) updateAccountFromTag(line ircmsg.IrcMessage) {
+	if line.Command == "NICK" || !strings.Contains(line.Prefix, "!") || !i.capabilityManager.capEnabled(capAccountTag) {
+		return // NICKs are handled by renaming, the prefix is the old nick
+	}
+
+	_, account := line.GetTag("account")
+	i.accounts.set(ircutils.ParseUserhost(line.Prefix).Nick, account)
+}
+
+// AccountName returns the services account the given source is logged into, or an empty string if they are not
+// logged in or their account is unknown
+func (i *IRC) AccountName(source string) string {
+	return i.accounts.get(i.HumanReadableSource(source))
+}
+
+// matches returns whether or not the given source and account match the Admin. If both a mask and an account are set
+// on the Admin, both must match
+func (a *Admin) matches(source, account string) bool {
+	if a.Mask == "" && a.Account == "" {
+		return false
+	}
+
+	if a.Mask != "" && !util.GlobToRegexp(strings.ToLower(a.Mask)).MatchString(strings.ToLower(source)) {
+		return false
+	}
+
+	return a.Account == "" || (account != "" && strings.EqualFold(a.Account, account))
+}
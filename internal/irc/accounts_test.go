@@ -0,0 +1,193 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestIRC_AccountName(t *testing.T) {
+	tests := []struct {
+		name   string
+		caps   []string
+		lines  []string
+		source string
+		want   string
+	}{
+		{
+			name:   "unknown",
+			source: "nick!user@host",
+		},
+		{
+			name:   "account-notify login",
+			caps:   []string{capAccountNotify},
+			lines:  []string{":nick!user@host ACCOUNT someaccount"},
+			source: "nick!user@host",
+			want:   "someaccount",
+		},
+		{
+			name:   "account-notify logout",
+			caps:   []string{capAccountNotify},
+			lines:  []string{":nick!user@host ACCOUNT someaccount", ":nick!user@host ACCOUNT *"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "extended-join",
+			caps:   []string{capExtendedJoin},
+			lines:  []string{":nick!user@host JOIN #chan someaccount :Real Name"},
+			source: "NICK!user@host",
+			want:   "someaccount",
+		},
+		{
+			name:   "extended-join not logged in",
+			caps:   []string{capExtendedJoin},
+			lines:  []string{":nick!user@host JOIN #chan * :Real Name"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "plain join ignored without extended-join",
+			lines:  []string{":nick!user@host JOIN #chan someaccount :Real Name"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "account-tag",
+			caps:   []string{capAccountTag},
+			lines:  []string{"@account=tagged :nick!user@host PRIVMSG #chan :hi"},
+			source: "nick!user@host",
+			want:   "tagged",
+		},
+		{
+			name:   "account-tag missing means logged out",
+			caps:   []string{capAccountNotify, capAccountTag},
+			lines:  []string{":nick!user@host ACCOUNT someaccount", ":nick!user@host PRIVMSG #chan :hi"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "account-tag ignored without cap",
+			lines:  []string{"@account=tagged :nick!user@host PRIVMSG #chan :hi"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "nick change",
+			caps:   []string{capAccountNotify, capAccountTag},
+			lines:  []string{"@account=acc :nick!user@host ACCOUNT acc", "@account=acc :nick!user@host NICK other"},
+			source: "other!user@host",
+			want:   "acc",
+		},
+		{
+			name:   "nick change old nick",
+			caps:   []string{capAccountNotify, capAccountTag},
+			lines:  []string{"@account=acc :nick!user@host ACCOUNT acc", "@account=acc :nick!user@host NICK other"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "part from last shared channel",
+			caps:   []string{capExtendedJoin},
+			lines:  []string{":bot!b@c JOIN #chan * :Bot", ":nick!user@host JOIN #chan acc :Real", ":nick!user@host PART #chan"},
+			source: "nick!user@host",
+		},
+		{
+			name: "part with a channel still shared",
+			caps: []string{capExtendedJoin},
+			lines: []string{
+				":bot!b@c JOIN #chan * :Bot", ":bot!b@c JOIN #other * :Bot", ":nick!user@host JOIN #chan acc :Real",
+				":nick!user@host JOIN #other acc :Real", ":nick!user@host PART #chan",
+			},
+			source: "nick!user@host",
+			want:   "acc",
+		},
+		{
+			name: "kicked from last shared channel",
+			caps: []string{capExtendedJoin},
+			lines: []string{
+				":bot!b@c JOIN #chan * :Bot", ":nick!user@host JOIN #chan acc :Real", ":op!b@c KICK #chan nick :out",
+			},
+			source: "nick!user@host",
+		},
+		{
+			name:   "we part",
+			caps:   []string{capExtendedJoin},
+			lines:  []string{":bot!b@c JOIN #chan * :Bot", ":nick!user@host JOIN #chan acc :Real", ":bot!b@c PART #chan"},
+			source: "nick!user@host",
+		},
+		{
+			name:   "quit",
+			caps:   []string{capAccountNotify},
+			lines:  []string{":nick!user@host ACCOUNT acc", ":nick!user@host QUIT :bye"},
+			source: "nick!user@host",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{}, tt.caps...)
+			i.runtimeNick.Set("bot")
+			feedLines(t, i, tt.lines...)
+
+			if got := i.AccountName(tt.source); got != tt.want {
+				t.Errorf("AccountName(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_AdminLevel(t *testing.T) {
+	conf := &Conf{Admins: []Admin{
+		{Account: "owner", Level: 3},
+		{Mask: "*!*@trusted.host", Account: "helper", Level: 2},
+		{Mask: "*!*@old.host", Level: 1},
+		{Level: 1337}, // Matches nothing
+	}}
+
+	i := newTestIRC(t, conf, capAccountTag)
+
+	tests := []struct {
+		name   string
+		line   string
+		source string
+		want   int
+	}{
+		{name: "account", line: "@account=Owner :a!b@anywhere PRIVMSG #c :hi", source: "a!b@anywhere", want: 3},
+		{name: "no account", line: ":a!b@anywhere PRIVMSG #c :hi", source: "a!b@anywhere", want: 0},
+		{
+			name:   "mask and account",
+			line:   "@account=helper :a!b@trusted.host PRIVMSG #c :hi",
+			source: "a!b@trusted.host",
+			want:   2,
+		},
+		{
+			name:   "account wrong mask",
+			line:   "@account=helper :a!b@other.host PRIVMSG #c :hi",
+			source: "a!b@other.host",
+			want:   0,
+		},
+		{name: "mask only", line: ":a!b@OLD.host PRIVMSG #c :hi", source: "a!b@OLD.host", want: 1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			feedLines(t, i, tt.line)
+
+			if got := i.AdminLevel(tt.source); got != tt.want {
+				t.Errorf("AdminLevel(%q) = %d, want %d", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_AdminLevel_nickTaken(t *testing.T) {
+	i := newTestIRC(t, &Conf{Admins: []Admin{{Account: "owner", Level: 3}}}, capExtendedJoin)
+	i.runtimeNick.Set("bot")
+
+	// Once the owner leaves, we can no longer see if someone else takes their nick
+	feedLines(t, i,
+		":bot!b@c JOIN #chan * :Bot",
+		":owner!o@host JOIN #chan owner :Owner",
+		":owner!o@host PART #chan",
+		":server 353 bot = #chan :@bot owner",
+	)
+
+	if got := i.AdminLevel("owner!impostor@elsewhere"); got != 0 {
+		t.Errorf("AdminLevel() for a new user with a departed admin's nick = %d, want 0", got)
+	}
+}
@@ -36,3 +36,12 @@ func Parse(s string) (CTCP, error) {
 
 	return CTCP{strings.ToUpper(strings.Trim(cmd, ctcpCharString)), strings.Trim(args, ctcpCharString)}, nil
 }
+
+// String returns the CTCP command and argument wrapped for sending
+func (c CTCP) String() string {
+	if c.Arg == "" {
+		return ctcpCharString + c.Command + ctcpCharString
+	}
+
+	return ctcpCharString + c.Command + " " + c.Arg + ctcpCharString
+}
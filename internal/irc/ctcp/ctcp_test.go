@@ -88,3 +88,27 @@ func BenchmarkParse(b *testing.B) {
 		b.Run(str, bench(str))
 	}
 }
+
+func TestCTCP_String(t *testing.T) {
+	tests := []struct {
+		name string
+		ctcp CTCP
+		want string
+	}{
+		{name: "no arg", ctcp: CTCP{Command: "VERSION"}, want: "\x01VERSION\x01"},
+		{name: "arg", ctcp: CTCP{Command: "PING", Arg: "1234 5678"}, want: "\x01PING 1234 5678\x01"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ctcp.String(); got != tt.want {
+				t.Errorf("CTCP.String() = %q, want %q", got, tt.want)
+			}
+
+			if parsed, err := Parse(tt.ctcp.String()); err != nil || parsed != tt.ctcp {
+				t.Errorf("Parse(CTCP.String()) = %v, %v, want %v", parsed, err, tt.ctcp)
+			}
+		})
+	}
+}
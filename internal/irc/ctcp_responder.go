@@ -0,0 +1,159 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/irc/ctcp"
+	"awesome-dragon.science/go/goGoGameBot/internal/version"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// CTCP queries that we reply to
+const (
+	ctcpClientInfo = "CLIENTINFO"
+	ctcpPing       = "PING"
+	ctcpSource     = "SOURCE"
+	ctcpTime       = "TIME"
+	ctcpVersion    = "VERSION"
+)
+
+// ctcpQueries is every CTCP query we can reply to, in the order CLIENTINFO lists them
+var ctcpQueries = []string{ctcpClientInfo, ctcpPing, ctcpSource, ctcpTime, ctcpVersion}
+
+const defaultCTCPSource = "https://github.com/A-UNDERSCORE-D/goGoGameBot"
+
+// Limits on CTCP replies across all users, so that many users at once cannot flood us off the network
+const (
+	ctcpBurst = 5
+	ctcpRate  = 1 // replies per second
+)
+
+// maxCTCPTracked is the number of users rate limits are tracked for before expired ones are cleaned up
+const maxCTCPTracked = 100
+
+// ctcpLimiter limits how often CTCP queries are replied to, both per user and overall
+type ctcpLimiter struct {
+	sync.Mutex
+	bucket *tokenBucket
+	last   map[string]time.Time
+}
+
+func newCTCPLimiter() *ctcpLimiter {
+	return &ctcpLimiter{bucket: newTokenBucket(ctcpBurst, ctcpRate, time.Now()), last: make(map[string]time.Time)}
+}
+
+// allow returns whether or not a reply can be sent to the given user, who can get one reply per interval
+func (l *ctcpLimiter) allow(user string, interval time.Duration, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if last, ok := l.last[user]; ok && now.Sub(last) < interval {
+		return false
+	}
+
+	if l.bucket.take(now) > 0 {
+		return false
+	}
+
+	if len(l.last) >= maxCTCPTracked {
+		for u, last := range l.last {
+			if now.Sub(last) >= interval {
+				delete(l.last, u)
+			}
+		}
+	}
+
+	l.last[user] = now
+
+	return true
+}
+
+func validateCTCPDisable(disabled []string) error {
+	for _, d := range disabled {
+		if !util.ContainsFold(ctcpQueries, d) {
+			return fmt.Errorf("ctcp_disable: unknown CTCP query %q, must be one of %s", d, strings.Join(ctcpQueries, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (i *IRC) setupCTCP() {
+	i.ParsedEvents.Attach("CTCP", i.onCTCP, event.PriLow)
+}
+
+// ctcpEnabled returns whether or not we reply to the given CTCP query
+func (i *IRC) ctcpEnabled(command string) bool {
+	return util.ContainsFold(ctcpQueries, command) && !util.ContainsFold(i.CTCPDisable, command)
+}
+
+// ctcpReply returns the reply to the given CTCP query, if we reply to it
+func (i *IRC) ctcpReply(command, arg string) (string, bool) {
+	if !i.ctcpEnabled(command) {
+		return "", false
+	}
+
+	switch command {
+	case ctcpClientInfo:
+		out := []string{"ACTION"}
+
+		for _, q := range ctcpQueries {
+			if i.ctcpEnabled(q) {
+				out = append(out, q)
+			}
+		}
+
+		return strings.Join(out, " "), true
+	case ctcpPing:
+		return arg, true
+	case ctcpSource:
+		if i.CTCPSource != "" {
+			return i.CTCPSource, true
+		}
+
+		return defaultCTCPSource, true
+	case ctcpTime:
+		return time.Now().Format(time.RFC1123Z), true
+	case ctcpVersion:
+		if i.CTCPVersion != "" {
+			return i.CTCPVersion, true
+		}
+
+		return "goGoGameBot " + version.Version, true
+	}
+
+	return "", false
+}
+
+// onCTCP replies to CTCP queries, unless the event was cancelled by an earlier handler
+func (i *IRC) onCTCP(e event.Event) {
+	query := e.(*CTCPEvent)
+	if e.IsCancelled() || query.IsReply || query.Source.Nick == "" {
+		return
+	}
+
+	reply, ok := i.ctcpReply(query.Command, query.Arg)
+	if !ok {
+		return
+	}
+
+	user := strings.ToLower(query.Source.Host)
+	if user == "" {
+		user = strings.ToLower(query.Source.Nick)
+	}
+
+	if !i.ctcpLimiter.allow(user, time.Second*time.Duration(i.CTCPInterval), time.Now()) {
+		i.log.Debugf("Not replying to CTCP %s from %s as they are rate limited", query.Command, query.Source.Nick)
+		return
+	}
+
+	i.queueLine(priorityNormal, queuedLine{
+		command: "NOTICE",
+		target:  query.Source.Nick,
+		message: ctcp.CTCP{Command: query.Command, Arg: reply}.String(),
+	})
+}
@@ -0,0 +1,157 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/version"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+)
+
+func TestIRC_onCTCP(t *testing.T) {
+	tests := []struct {
+		name   string
+		conf   Conf
+		lines  []string
+		want   []string
+		prefix string // If set, the single line sent is only checked for this prefix
+	}{
+		{
+			name:  "version",
+			lines: []string{":a!c@c PRIVMSG bot :\x01VERSION\x01"},
+			want:  []string{"NOTICE a :\x01VERSION goGoGameBot " + version.Version + "\x01"},
+		},
+		{
+			name:  "custom version",
+			conf:  Conf{CTCPVersion: "some bot"},
+			lines: []string{":a!c@c PRIVMSG bot :\x01VERSION\x01"},
+			want:  []string{"NOTICE a :\x01VERSION some bot\x01"},
+		},
+		{
+			name:  "ping",
+			lines: []string{":a!c@c PRIVMSG #chan :\x01PING 1234 5678\x01"},
+			want:  []string{"NOTICE a :\x01PING 1234 5678\x01"},
+		},
+		{
+			name:   "time",
+			lines:  []string{":a!c@c PRIVMSG bot :\x01TIME\x01"},
+			prefix: "NOTICE a :\x01TIME ",
+		},
+		{
+			name:  "source",
+			lines: []string{":a!c@c PRIVMSG bot :\x01SOURCE\x01"},
+			want:  []string{"NOTICE a :\x01SOURCE " + defaultCTCPSource + "\x01"},
+		},
+		{
+			name:  "clientinfo",
+			conf:  Conf{CTCPDisable: []string{"time"}},
+			lines: []string{":a!c@c PRIVMSG bot :\x01CLIENTINFO\x01"},
+			want:  []string{"NOTICE a :\x01CLIENTINFO ACTION CLIENTINFO PING SOURCE VERSION\x01"},
+		},
+		{
+			name:  "disabled",
+			conf:  Conf{CTCPDisable: []string{"version"}},
+			lines: []string{":a!c@c PRIVMSG bot :\x01VERSION\x01"},
+		},
+		{name: "unknown", lines: []string{":a!c@c PRIVMSG bot :\x01FINGER\x01"}},
+		{name: "reply", lines: []string{":a!c@c NOTICE bot :\x01VERSION some client\x01"}},
+		{name: "action", lines: []string{":a!c@c PRIVMSG bot :\x01ACTION waves\x01"}},
+		{name: "server", lines: []string{":server PRIVMSG bot :\x01VERSION\x01"}},
+		{
+			name: "rate limited",
+			conf: Conf{CTCPInterval: 60},
+			lines: []string{
+				":a!c@c PRIVMSG bot :\x01PING 1\x01",
+				":a!c@c PRIVMSG bot :\x01PING 2\x01",
+				":b!c@c PRIVMSG bot :\x01PING 3\x01",
+				":d!e@e PRIVMSG bot :\x01PING 4\x01",
+			},
+			want: []string{"NOTICE a :\x01PING 1\x01", "NOTICE d :\x01PING 4\x01"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Nick = "bot"
+			i := newTestIRC(t, &conf)
+			i.runtimeNick.Set("bot")
+
+			sent, disconnect := connectTestIRC(i)
+
+			defer disconnect()
+
+			feedLines(t, i, tt.lines...)
+
+			if tt.prefix == "" {
+				expectLines(t, sent, tt.want...)
+				return
+			}
+
+			select {
+			case got := <-sent:
+				if !strings.HasPrefix(got, tt.prefix) {
+					t.Errorf("sent %q, want a line starting with %q", got, tt.prefix)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for %q", tt.prefix)
+			}
+		})
+	}
+}
+
+func TestIRC_CTCPEvent(t *testing.T) {
+	i := newTestIRC(t, &Conf{Nick: "bot"})
+	i.runtimeNick.Set("bot")
+
+	var got *CTCPEvent
+
+	i.ParsedEvents.Attach("CTCP", func(e event.Event) {
+		got = e.(*CTCPEvent)
+		e.SetCancelled(true)
+	}, event.PriNorm)
+
+	i.HookPrivateMessage(func(source, channel, message string) {
+		t.Errorf("CTCP query was dispatched as a message: %q", message)
+	})
+
+	sent, disconnect := connectTestIRC(i)
+
+	defer disconnect()
+
+	feedLines(t, i, ":a!c@c PRIVMSG bot :\x01PING 1234\x01")
+
+	if got == nil {
+		t.Fatal("CTCP event was not dispatched")
+	}
+
+	if got.Command != "PING" || got.Arg != "1234" || got.Target != "bot" || got.Source.Nick != "a" || got.IsReply {
+		t.Errorf("unexpected CTCP event: %+v", got)
+	}
+
+	// The event was cancelled, so there should be no reply
+	expectLines(t, sent)
+}
+
+func TestConf_validateCTCPDisable(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled []string
+		wantErr  bool
+	}{
+		{name: "empty"},
+		{name: "known", disabled: []string{"VERSION", "time"}},
+		{name: "unknown", disabled: []string{"VERSION", "FINGER"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCTCPDisable(tt.disabled); (err != nil) != tt.wantErr {
+				t.Errorf("validateCTCPDisable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
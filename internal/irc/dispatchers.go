@@ -1,7 +1,11 @@
 package irc
 
 import (
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/irc/ctcp"
 	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
 )
 
 func event2RawEvent(e event.Event) *RawEvent {
@@ -20,7 +24,23 @@ func (i *IRC) dispatchMessage(e event.Event) {
 		return
 	}
 
-	i.ParsedEvents.Dispatch(NewMessageEvent("MSG", raw.Line, raw.Time))
+	msg := NewMessageEvent("MSG", raw.Line, raw.Time)
+	msg.Batch = i.batchOf(raw.Line).typ
+	msg.IsEcho = i.capEnabled(capEchoMessage) && strings.EqualFold(msg.Source.Nick, i.runtimeNick.Get())
+
+	if parsed, err := ctcp.Parse(msg.Message); err == nil && parsed.Command != "ACTION" {
+		if !msg.isReplay() {
+			i.ParsedEvents.Dispatch(NewCTCPEvent("CTCP", msg, parsed))
+		}
+
+		return
+	}
+
+	if msg.MsgID != "" {
+		i.recent.add(msg.MsgID, util.UserHost2Canonical(msg.Source), ircTransformer.MakeIntermediate(msg.Message))
+	}
+
+	i.ParsedEvents.Dispatch(msg)
 }
 
 func (i *IRC) dispatchJoin(e event.Event) {
@@ -72,3 +92,31 @@ func (i *IRC) dispatchNick(e event.Event) {
 
 	i.ParsedEvents.Dispatch(NewNickEvent("NICK", raw.Line, raw.Time))
 }
+
+func (i *IRC) dispatchTopic(e event.Event) {
+	var raw *RawEvent
+	if raw = event2RawEvent(e); raw == nil || !raw.CommandIs("TOPIC") {
+		i.log.Warnf("Got a TOPIC message that was invalid: %v", raw)
+		return
+	}
+
+	i.ParsedEvents.Dispatch(NewTopicEvent("TOPIC", raw.Line, raw.Time))
+}
+
+func (i *IRC) dispatchMode(e event.Event) {
+	var raw *RawEvent
+	if raw = event2RawEvent(e); raw == nil || !raw.CommandIs("MODE") {
+		i.log.Warnf("Got a MODE message that was invalid: %v", raw)
+		return
+	}
+
+	if len(raw.Line.Params) < 2 || !strings.HasPrefix(raw.Line.Params[0], "#") {
+		// User modes, most likely our own
+		return
+	}
+
+	mode := NewModeEvent("MODE", raw.Line, raw.Time)
+	mode.Changes = i.parseModes(raw.Line.Params[1], raw.Line.Params[2:])
+
+	i.ParsedEvents.Dispatch(mode)
+}
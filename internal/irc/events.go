@@ -7,6 +7,8 @@ import (
 	"github.com/goshuirc/irc-go/ircmsg"
 	"github.com/goshuirc/irc-go/ircutils"
 
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/internal/irc/ctcp"
 	"awesome-dragon.science/go/goGoGameBot/pkg/event"
 	"awesome-dragon.science/go/goGoGameBot/pkg/util"
 )
@@ -42,19 +44,33 @@ type MessageEvent struct {
 	Source   ircutils.UserHost
 	Channel  string
 	Message  string
+	MsgID    string // The ID the server gave the message, if any
+	ReplyTo  string // The ID of the message this is a reply to, if any
+	Batch    string // The type of the batch this message is part of, if any
+	IsEcho   bool   // Whether or not this is an echo of a message we sent
 }
 
 // NewMessageEvent creates a MessageEvent with the given data.
 func NewMessageEvent(name string, line ircmsg.IrcMessage, tme time.Time) *MessageEvent {
+	_, msgID := line.GetTag(tagMsgID)
+	_, replyTo := line.GetTag(tagReply)
+
 	return &MessageEvent{
-		NewRawEvent(name, line, tme),
-		line.Command == "NOTICE",
-		ircutils.ParseUserhost(line.Prefix),
-		util.IdxOrEmpty(line.Params, 0),
-		util.IdxOrEmpty(line.Params, 1),
+		RawEvent: NewRawEvent(name, line, tme),
+		IsNotice: line.Command == "NOTICE",
+		Source:   ircutils.ParseUserhost(line.Prefix),
+		Channel:  util.IdxOrEmpty(line.Params, 0),
+		Message:  util.IdxOrEmpty(line.Params, 1),
+		MsgID:    msgID,
+		ReplyTo:  replyTo,
 	}
 }
 
+// isReplay returns whether or not the message is one we have seen before or sent ourselves, rather than a new message
+func (m *MessageEvent) isReplay() bool {
+	return m.IsEcho || m.Batch == batchChatHistory
+}
+
 // JoinEvent represents an IRC channel JOIN
 type JoinEvent struct {
 	*RawEvent
@@ -136,3 +152,60 @@ func NewKickEvent(name string, line ircmsg.IrcMessage, tme time.Time) *KickEvent
 		Message:    util.IdxOrEmpty(line.Params, 2),
 	}
 }
+
+// TopicEvent represents a channel TOPIC change
+type TopicEvent struct {
+	*RawEvent
+	Source  ircutils.UserHost
+	Channel string
+	Topic   string
+}
+
+// NewTopicEvent creates a TopicEvent from the given data
+func NewTopicEvent(name string, line ircmsg.IrcMessage, tme time.Time) *TopicEvent {
+	return &TopicEvent{
+		RawEvent: NewRawEvent(name, line, tme),
+		Source:   ircutils.ParseUserhost(line.Prefix),
+		Channel:  util.IdxOrEmpty(line.Params, 0),
+		Topic:    util.IdxOrEmpty(line.Params, 1),
+	}
+}
+
+// ModeEvent represents a channel MODE change
+type ModeEvent struct {
+	*RawEvent
+	Source  ircutils.UserHost
+	Channel string
+	Changes []interfaces.ModeChange
+}
+
+// NewModeEvent creates a ModeEvent from the given data. Changes are not parsed, as that depends on the server
+func NewModeEvent(name string, line ircmsg.IrcMessage, tme time.Time) *ModeEvent {
+	return &ModeEvent{
+		RawEvent: NewRawEvent(name, line, tme),
+		Source:   ircutils.ParseUserhost(line.Prefix),
+		Channel:  util.IdxOrEmpty(line.Params, 0),
+	}
+}
+
+// CTCPEvent represents a CTCP query or reply, other than an ACTION, which are dispatched as messages
+type CTCPEvent struct {
+	*RawEvent
+	IsReply bool // Whether or not this is a reply (sent in a NOTICE) rather than a query
+	Source  ircutils.UserHost
+	Target  string
+	Command string
+	Arg     string
+}
+
+// NewCTCPEvent creates a CTCPEvent from the given MessageEvent and parsed CTCP
+func NewCTCPEvent(name string, msg *MessageEvent, parsed ctcp.CTCP) *CTCPEvent {
+	return &CTCPEvent{
+		RawEvent: NewRawEvent(name, msg.Line, msg.Time),
+		IsReply:  msg.IsNotice,
+		Source:   msg.Source,
+		Target:   msg.Channel,
+		Command:  parsed.Command,
+		Arg:      parsed.Arg,
+	}
+}
@@ -1,6 +1,11 @@
 package irc
 
-import "awesome-dragon.science/go/goGoGameBot/pkg/event"
+import (
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
 
 func (i *IRC) handleNickInUse(e event.Event) {
 	rawEvent := event2RawEvent(e)
@@ -9,21 +14,39 @@ func (i *IRC) handleNickInUse(e event.Event) {
 		return
 	}
 
-	newNick := rawEvent.Line.Params[1] + "_"
+	if util.IdxOrEmpty(rawEvent.Line.Params, 0) != "*" {
+		// We're already registered, so this was an attempt to reclaim our nick. Keep the one we have
+		i.log.Debugf("nick %q is still in use", util.IdxOrEmpty(rawEvent.Line.Params, 1))
+		return
+	}
+
+	newNick := util.IdxOrEmpty(rawEvent.Line.Params, 1) + "_"
 
 	if _, err := i.writeLine("NICK", newNick); err != nil {
 		i.log.Warnf("Error while updating nick")
 	}
 
-	// TODO: add a goroutine here that tries to regain our original nick if its in use
-	i.runtimeNick = newNick
+	// nickRecoveryLoop will try to get our original nick back once we're connected
+	i.runtimeNick.Set(newNick)
 }
 
 func (i *IRC) onNick(source, newNick string) {
 	oldNick := i.HumanReadableSource(source)
-	if oldNick != i.runtimeNick {
+	if !strings.EqualFold(oldNick, i.runtimeNick.Get()) {
+		return
+	}
+
+	i.runtimeNick.Set(newNick)
+
+	if !i.hasNick() {
 		return
 	}
 
-	i.runtimeNick = newNick
+	i.log.Infof("reclaimed nick %q", newNick)
+
+	if _, ok := i.isupport.get("MONITOR"); ok {
+		if _, err := i.writeLine("MONITOR", "-", i.Nick); err != nil {
+			i.log.Warnf("could not stop monitoring our nick: %s", err)
+		}
+	}
 }
@@ -28,10 +28,11 @@ var (
 	ErrorIRCAlreadyConnected = errors.New("IRC is already connected")
 )
 
-// Admin holds a mask level pair, for use in commands
+// Admin holds a mask level pair, for use in commands. Admins can be matched by mask, services account, or both
 type Admin struct {
-	Mask  string `xml:"mask,attr"`
-	Level int    `xml:"level,attr"`
+	Mask    string `xml:"mask,attr"`
+	Account string `xml:"account,attr" comment:"Services account to match, instead of or as well as the mask"`
+	Level   int    `xml:"level,attr"`
 }
 
 // Conf holds the configuration for an IRC instance
@@ -50,20 +51,76 @@ type Conf struct {
 	Ident string `toml:"ident"`
 	Gecos string `toml:"gecos"`
 
-	// TODO: Cert based auth? (via SASL)
-	Authenticate bool   `toml:"authenticate" comment:"Should we authenticate with the IRC network"`
-	SASL         bool   `toml:"sasl" comment:"Should authentication use SASL for negotiation (this is faster and more secure)"` //nolint:lll // Cant be made shorter
-	AuthUser     string `toml:"auth_user" comment:"User account to authenticate for"`
-	AuthPasswd   string `toml:"auth_passwd" comment:"Password for account authentication"`
+	NickRecovery int  `toml:"nick_recovery_interval" comment:"Seconds between attempts to reclaim nick if it is in use. Negative disables (default 30)"` //nolint:lll // Cant be made shorter
+	Regain       bool `toml:"regain" comment:"Ask NickServ to REGAIN nick if it is in use and we are logged in"`
+
+	Authenticate  bool   `toml:"authenticate" comment:"Should we authenticate with the IRC network"`
+	SASL          bool   `toml:"sasl" comment:"Should authentication use SASL for negotiation (this is faster and more secure)"`                       //nolint:lll // Cant be made shorter
+	SASLMechanism string `toml:"sasl_mechanism" comment:"PLAIN, EXTERNAL, or SCRAM-SHA-256 (default EXTERNAL if client_cert is set, otherwise PLAIN)"` //nolint:lll // Cant be made shorter
+	AuthUser      string `toml:"auth_user" comment:"User account to authenticate for"`
+	AuthPasswd    string `toml:"auth_passwd" comment:"Password for account authentication"`
+	ClientCert    string `toml:"client_cert" comment:"Path to a PEM client certificate to present when using TLS, for SASL EXTERNAL or CertFP"` //nolint:lll // Cant be made shorter
+	ClientKey     string `toml:"client_key" comment:"Path to the PEM private key for client_cert"`
+
+	FloodBurst       int     `toml:"flood_burst" default:"5" comment:"Lines that can be sent at once before flood control applies (default 5)"`                                //nolint:lll // Cant be made shorter
+	FloodRate        float64 `toml:"flood_rate" default:"2" comment:"Lines per second that can be sent after a burst. Zero disables flood control (default 2)"`                //nolint:lll // Cant be made shorter
+	BridgeQueueLimit int     `toml:"bridge_queue_limit" default:"20" comment:"Queued bridged lines after which new ones are coalesced or dropped. Zero disables (default 20)"` //nolint:lll // Cant be made shorter
+	BridgeOverflow   string  `toml:"bridge_overflow" default:"coalesce" comment:"What to do with bridged lines past bridge_queue_limit, coalesce or drop (default coalesce)"`  //nolint:lll // Cant be made shorter
+
+	CTCPDisable  []string `toml:"ctcp_disable" comment:"CTCP queries not to reply to, from VERSION, PING, TIME, CLIENTINFO, and SOURCE"` //nolint:lll // Cant be made shorter
+	CTCPVersion  string   `toml:"ctcp_version" comment:"Reply to CTCP VERSION with this, rather than the bot's version"`                 //nolint:lll // Cant be made shorter
+	CTCPSource   string   `toml:"ctcp_source" comment:"Reply to CTCP SOURCE with this, rather than the bot's repository"`                //nolint:lll // Cant be made shorter
+	CTCPInterval int      `toml:"ctcp_interval" default:"5" comment:"Minimum seconds between CTCP replies to a user (default 5)"`        //nolint:lll // Cant be made shorter
 
 	SuppressMOTD bool `toml:"suppress_motd" comment:"Suppress logging of IRC MOTD messages being logged"`
 	SuppressPing bool `toml:"suppress_ping" comment:"Suppress logging of internal PING messages being logged"`
 }
 
+// saslMechanism returns the SASL mechanism to use
+func (c *Conf) saslMechanism() string {
+	switch {
+	case c.SASLMechanism != "":
+		return strings.ToUpper(c.SASLMechanism)
+	case c.ClientCert != "":
+		return saslExternal
+	default:
+		return saslPlain
+	}
+}
+
+func (c *Conf) validate() error {
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("client_cert and client_key must be set together")
+	}
+
+	if o := strings.ToLower(c.BridgeOverflow); o != "" && o != overflowCoalesce && o != overflowDrop {
+		return fmt.Errorf("bridge_overflow must be %q or %q, not %q", overflowCoalesce, overflowDrop, c.BridgeOverflow)
+	}
+
+	if err := validateCTCPDisable(c.CTCPDisable); err != nil {
+		return err
+	}
+
+	if !c.SASL {
+		return nil
+	}
+
+	if _, err := newSaslMechanism(c.saslMechanism(), c); err != nil {
+		return err
+	}
+
+	if c.saslMechanism() == saslExternal && c.ClientCert == "" {
+		return errors.New("SASL EXTERNAL requires a client_cert")
+	}
+
+	return nil
+}
+
 // IRC Represents a connection to an IRC server
 type IRC struct {
 	*Conf
-	runtimeNick       string
+	runtimeNick       mutexTypes.String
+	ownUserhost       mutexTypes.String
 	channels          mutexTypes.StringSlice
 	Connected         mutexTypes.Bool
 	StopRequested     mutexTypes.Bool
@@ -75,6 +132,15 @@ type IRC struct {
 	RawEvents         *event.Manager
 	ParsedEvents      *event.Manager
 	capabilityManager *capabilityManager
+	accounts          *accountTracker
+	isupport          *isupport
+	loggedIn          mutexTypes.Bool
+	sendQueue         *sendQueue
+	batches           *batchTracker
+	labels            *labelTracker
+	recent            *recentMessages
+	channelState      *channelState
+	ctcpLimiter       *ctcpLimiter
 }
 
 // New creates a new IRC instance ready for use
@@ -84,6 +150,14 @@ func New(conf tomlconf.ConfigHolder, logger *log.Logger) (*IRC, error) {
 		RawEvents:      new(event.Manager),
 		ParsedEvents:   new(event.Manager),
 		socketDoneChan: make(chan struct{}),
+		accounts:       newAccountTracker(),
+		isupport:       newISupport(),
+		sendQueue:      newSendQueue(),
+		batches:        newBatchTracker(),
+		labels:         newLabelTracker(),
+		recent:         newRecentMessages(),
+		channelState:   newChannelState(),
+		ctcpLimiter:    newCTCPLimiter(),
 	}
 
 	if err := out.Reload(conf.RealConf); err != nil {
@@ -103,6 +177,15 @@ func (i *IRC) setupCapManager() {
 	i.capabilityManager = newCapabilityManager(i)
 	i.capabilityManager.supportCap("userhost-in-names")
 	i.capabilityManager.supportCap("server-time")
+	i.capabilityManager.supportCap(capAccountNotify)
+	i.capabilityManager.supportCap(capExtendedJoin)
+	i.capabilityManager.supportCap(capAccountTag)
+	i.capabilityManager.supportCap(capMessageTags)
+	i.capabilityManager.supportCap(capEchoMessage)
+	i.capabilityManager.supportCap(capLabeledResponse)
+	i.capabilityManager.supportCap(capBatch)
+	i.capabilityManager.supportCap(capMultiPrefix)
+	i.capabilityManager.supportCap(capAwayNotify)
 
 	if i.SSL && i.SASL {
 		i.capabilityManager.supportCap("sasl")
@@ -122,11 +205,19 @@ func (i *IRC) setupParsers() {
 	i.RawEvents.Attach("QUIT", i.dispatchQuit, event.PriHighest)
 	i.RawEvents.Attach("KICK", i.dispatchKick, event.PriHighest)
 	i.RawEvents.Attach("NICK", i.dispatchNick, event.PriHighest)
+	i.RawEvents.Attach("TOPIC", i.dispatchTopic, event.PriHighest)
+	i.RawEvents.Attach("MODE", i.dispatchMode, event.PriHighest)
 	i.RawEvents.Attach("PONG", i.pongHandler, event.PriHighest)
 
 	// internal handlers
-	i.RawEvents.Attach("433", i.handleNickInUse, event.PriHighest)
+	i.RawEvents.Attach(errNickInUse, i.handleNickInUse, event.PriHighest)
 	i.HookNick(i.onNick)
+	i.setupAccountTracking()
+	i.setupNickRecovery()
+	i.setupHostTracking()
+	i.setupTags()
+	i.setupChannelState()
+	i.setupCTCP()
 }
 
 // LineHandler is a function that is called on every raw Line
@@ -156,7 +247,12 @@ func (i *IRC) write(toSend []byte, logMsg bool) (int, error) {
 
 //nolint:unparam // Its to mimic the Write interface
 func (i *IRC) writeLine(command string, args ...string) (int, error) {
-	l := util.MakeSimpleIRCLine(command, args...)
+	return i.writeTaggedLine(nil, command, args...)
+}
+
+// writeTaggedLine works like writeLine, but sends the given IRCv3 tags with the line
+func (i *IRC) writeTaggedLine(tags map[string]string, command string, args ...string) (int, error) {
+	l := ircmsg.MakeMessage(tags, "", command, args...)
 	lBytes, err := l.LineBytes()
 
 	if err != nil {
@@ -177,6 +273,14 @@ func (i *IRC) Connect() error {
 
 	i.log.Infof("Starting IRC connection to %s:%s SSL: %t", i.Host, i.Port, i.SSL)
 	i.setupCapManager()
+	i.accounts.clear()
+	i.isupport.clear()
+	i.loggedIn.Set(false)
+	i.ownUserhost.Set("")
+	i.batches.clear()
+	i.channelState.clear()
+	i.sendQueue.clear()
+	i.sendQueue.configure(i.BridgeQueueLimit, i.BridgeOverflow)
 
 	target := net.JoinHostPort(i.Host, i.Port)
 
@@ -190,12 +294,27 @@ func (i *IRC) Connect() error {
 
 	if i.SSL {
 		// nolint:gosec // The user explicitly asked for it and we warn about it
-		s, err = tls.DialWithDialer(dialer, "tcp", target, &tls.Config{InsecureSkipVerify: !i.VerifyCerts})
+		tlsConf := &tls.Config{InsecureSkipVerify: !i.VerifyCerts}
+
+		if i.ClientCert != "" {
+			cert, err := tls.LoadX509KeyPair(i.ClientCert, i.ClientKey)
+			if err != nil {
+				return fmt.Errorf("IRC.Connect(): could not load client certificate: %w", err)
+			}
+
+			tlsConf.Certificates = []tls.Certificate{cert}
+		}
+
+		s, err = tls.DialWithDialer(dialer, "tcp", target, tlsConf)
 
 		if !i.VerifyCerts {
 			i.log.Warnf("**** Not verifying certs. THIS IS INSECURE ****")
 		}
 	} else {
+		if i.ClientCert != "" {
+			i.log.Warn("client certificate not used as the connection is not SSL")
+		}
+
 		s, err = dialer.Dial("tcp", target)
 	}
 
@@ -220,7 +339,7 @@ func (i *IRC) Connect() error {
 		return err
 	}
 
-	i.runtimeNick = i.Nick
+	i.runtimeNick.Set(i.Nick)
 	if _, err := i.writeLine("NICK", i.Nick); err != nil {
 		return err
 	}
@@ -286,6 +405,8 @@ func (i *IRC) Run() error {
 
 	pingCtx, cancel := context.WithCancel(context.Background())
 	go i.pingLoop(pingCtx)
+	go i.nickRecoveryLoop(pingCtx)
+	go i.sendLoop(pingCtx)
 
 	defer func() {
 		// clean up
@@ -354,6 +475,9 @@ func (i *IRC) pongHandler(e event.Event) {
 	i.checkLag()
 }
 
+// Lag returns the latency measured by the most recent PING to the server
+func (i *IRC) Lag() time.Duration { return i.lag.Get() }
+
 func (i *IRC) checkLag() {
 	lp := i.lastPong.Get()
 	if !lp.IsZero() && time.Since(lp) > time.Second*30 {
@@ -430,6 +554,8 @@ func (i *IRC) handleLine(line ircmsg.IrcMessage) {
 		}
 	}
 
+	i.updateAccountFromTag(line)
+
 	i.RawEvents.Dispatch(NewRawEvent(line.Command, line, t))
 	i.RawEvents.Dispatch(NewRawEvent("*", line, t))
 }
@@ -451,13 +577,23 @@ func (i *IRC) authenticateWithSasl(e event.Event) {
 	defer close(exiting)
 	defer i.RawEvents.Detach(id)
 
-	if _, err := i.writeLine(authenticate, "PLAIN"); err != nil {
+	mech, err := newSaslMechanism(i.saslMechanism(), i.Conf)
+	if err != nil {
+		i.log.Warnf("authenticateWithSasl(): %s. Aborting SASL", err)
+		i.SASL = false
+
+		return
+	}
+
+	if _, err := i.writeLine(authenticate, mech.Name()); err != nil {
 		i.log.Warn("authenticateWithSasl(): could not send SASL authentication request. Aborting SASL")
 		i.SASL = false
 
 		return
 	}
 
+	challenges := saslReader{}
+
 	for e := range capChan {
 		raw := event2RawEvent(e)
 		if raw == nil {
@@ -467,14 +603,9 @@ func (i *IRC) authenticateWithSasl(e event.Event) {
 
 		switch raw.Line.Command {
 		case authenticate:
-			if raw.Line.Params[0] == "+" {
-				_, err := i.writeLine(authenticate, util.GenerateSASLString(i.Nick, i.AuthUser, i.AuthPasswd))
-				if err != nil {
-					i.log.Warn("authenticateWithSasl(): could not send SASL authentication. Aborting")
-					i.SASL = false
-
-					return
-				}
+			if !i.saslStep(mech, &challenges, util.IdxOrEmpty(raw.Line.Params, 0)) {
+				i.SASL = false
+				return
 			}
 
 		case util.RPL_NICKLOCKED, util.RPL_SASLFAIL, util.RPL_SASLTOOLONG, util.RPL_SASLABORTED,
@@ -492,6 +623,41 @@ func (i *IRC) authenticateWithSasl(e event.Event) {
 	}
 }
 
+// saslStep handles a single AUTHENTICATE from the server, sending our response once the challenge is complete. It
+// returns false if authentication should be aborted
+func (i *IRC) saslStep(mech saslMechanism, challenges *saslReader, chunk string) bool {
+	const authenticate = "AUTHENTICATE"
+
+	challenge, complete, err := challenges.add(chunk)
+	if err != nil {
+		i.log.Warnf("authenticateWithSasl(): %s. Aborting", err)
+		_, _ = i.writeLine(authenticate, "*")
+
+		return false
+	}
+
+	if !complete {
+		return true
+	}
+
+	response, err := mech.Next(challenge)
+	if err != nil {
+		i.log.Warnf("authenticateWithSasl(): %s authentication failed: %s. Aborting", mech.Name(), err)
+		_, _ = i.writeLine(authenticate, "*")
+
+		return false
+	}
+
+	for _, c := range saslChunks(response) {
+		if _, err := i.writeLine(authenticate, c); err != nil {
+			i.log.Warn("authenticateWithSasl(): could not send SASL authentication. Aborting")
+			return false
+		}
+	}
+
+	return true
+}
+
 func nickOrOriginal(toParse string) string {
 	parsed := ircutils.ParseUserhost(toParse)
 	if parsed.Nick != "" {
@@ -501,33 +667,52 @@ func nickOrOriginal(toParse string) string {
 	return toParse
 }
 
-// SendMessage sends a message to the given target
-func (i *IRC) SendMessage(target, message string) {
-	msgs := strings.Split(message, "\n")
-	for _, m := range msgs {
-		if _, err := i.writeLine("PRIVMSG", nickOrOriginal(target), ircTransformer.Transform(m)); err != nil {
-			i.log.Warnf("could not send message %q to target %q: %s", m, target, err)
+// queueMessage transforms and queues each line of the given message, splitting any that are too long to send
+func (i *IRC) queueMessage(priority sendPriority, command, target, message string) {
+	i.queueTaggedMessage(priority, command, target, message, nil)
+}
+
+// queueTaggedMessage works like queueMessage, but if tags is not nil, each line is sent with them, and labelled if the
+// server supports labeled-response
+func (i *IRC) queueTaggedMessage(priority sendPriority, command, target, message string, tags map[string]string) {
+	target = nickOrOriginal(target)
+	limit := i.messageLimit(command, target)
+
+	for _, m := range strings.Split(message, "\n") {
+		for _, part := range splitMessage(m, limit) {
+			line := queuedLine{command: command, target: target, message: part, limit: limit}
+			if tags != nil {
+				line.tags = i.lineTags(tags, command, target)
+			}
+
+			i.queueLine(priority, line)
 		}
 	}
 }
 
+// SendMessage sends a message to the given target
+func (i *IRC) SendMessage(target, message string) {
+	i.queueMessage(priorityNormal, "PRIVMSG", target, message)
+}
+
 // SendNotice sends a notice to the given notice
 func (i *IRC) SendNotice(target, message string) {
-	msgs := strings.Split(message, "\n")
-	for _, m := range msgs {
-		if _, err := i.writeLine("NOTICE", nickOrOriginal(target), ircTransformer.Transform(m)); err != nil {
-			i.log.Warnf("could not send notice %q to target %q: %s", m, target, err)
-		}
-	}
+	i.queueMessage(priorityNormal, "NOTICE", target, message)
 }
 
-// AdminLevel returns what admin level the given mask has, 0 means no admin access
+// SendBridgeMessage sends a message to the given target with the lowest priority. If the send queue backs up,
+// bridged messages may be coalesced or dropped
+func (i *IRC) SendBridgeMessage(target, message string) {
+	i.queueMessage(priorityBridge, "PRIVMSG", target, message)
+}
+
+// AdminLevel returns what admin level the given source has, 0 means no admin access. Sources are matched against
+// both the mask and the services account of each admin entry
 func (i *IRC) AdminLevel(source string) int {
-	for _, a := range i.Admins {
-		lowerAdmin := strings.ToLower(a.Mask)
-		lowerSource := strings.ToLower(source)
+	account := i.AccountName(source)
 
-		if util.GlobToRegexp(lowerAdmin).MatchString(lowerSource) {
+	for _, a := range i.Admins {
+		if a.matches(source, account) {
 			return a.Level
 		}
 	}
@@ -538,7 +723,7 @@ func (i *IRC) AdminLevel(source string) int {
 // SendAdminMessage sends the given message to all AdminChannels defined on the bot
 func (i *IRC) SendAdminMessage(msg string) {
 	for _, c := range i.AdminChannels {
-		i.SendMessage(c, msg)
+		i.queueMessage(priorityHigh, "PRIVMSG", c, msg)
 	}
 }
 
@@ -570,6 +755,10 @@ func (i *IRC) Reload(tree interfaces.Unmarshaler) error {
 		return fmt.Errorf("could not unmarshal IRC config: %w", err)
 	}
 
+	if err := newConf.validate(); err != nil {
+		return fmt.Errorf("invalid IRC config: %w", err)
+	}
+
 	i.Conf = newConf
 
 	return nil
@@ -585,8 +774,8 @@ func (i *IRC) IsCommandPrefix(line string) (string, bool) {
 		return line[len(i.CmdPfx):], true
 	}
 
-	if strings.HasPrefix(line, i.runtimeNick+": ") {
-		return line[len(i.runtimeNick)+2:], true
+	if nick := i.runtimeNick.Get(); strings.HasPrefix(line, nick+": ") {
+		return line[len(nick)+2:], true
 	}
 
 	return line, false
@@ -603,7 +792,7 @@ func (i *IRC) HumanReadableSource(source string) string {
 
 // Status returns a human readable status string
 func (i *IRC) Status() string {
-	return fmt.Sprintf("IRC: Connected: %t Lag: %s", i.Connected.Get(), i.lag.Get())
+	return fmt.Sprintf("IRC: Connected: %t Lag: %s Queued: %d", i.Connected.Get(), i.lag.Get(), i.sendQueue.len())
 }
 
 // SendRaw sends a raw IRC line to the server
@@ -613,14 +802,5 @@ func (i *IRC) SendRaw(raw string) {
 		return
 	}
 
-	rawBytes := []byte(raw)
-
-	n, err := i.write([]byte(raw), true)
-	if n != len(rawBytes) {
-		i.log.Warnf("Did not send enough bytes: %d != %d", n, len(rawBytes))
-	}
-
-	if err != nil {
-		i.log.Warn("could not send message: ", err)
-	}
+	i.queueLine(priorityHigh, queuedLine{raw: raw})
 }
@@ -3,16 +3,18 @@ package irc
 import (
 	"strings"
 
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
 	"awesome-dragon.science/go/goGoGameBot/internal/irc/ctcp"
 	"awesome-dragon.science/go/goGoGameBot/pkg/event"
 	"awesome-dragon.science/go/goGoGameBot/pkg/util"
 )
 
-// HookMessage hooks on messages to a channel
-func (i *IRC) HookMessage(f func(source, channel, message string, isAction bool)) {
+// hookChannelMessage hooks on new messages to a channel, with CTCP ACTIONs unwrapped
+func (i *IRC) hookChannelMessage(f func(messageEvent *MessageEvent, msg string, isAction bool)) {
 	i.ParsedEvents.Attach("MSG", func(e event.Event) {
 		messageEvent := e.(*MessageEvent)
-		if e.IsCancelled() || messageEvent.IsNotice || !strings.HasPrefix(messageEvent.Channel, "#") {
+		if e.IsCancelled() || messageEvent.IsNotice || !strings.HasPrefix(messageEvent.Channel, "#") ||
+			messageEvent.isReplay() {
 			return
 		}
 		act := false
@@ -24,15 +26,36 @@ func (i *IRC) HookMessage(f func(source, channel, message string, isAction bool)
 			msg = out.Arg
 			act = true
 		}
-		f(util.UserHost2Canonical(messageEvent.Source), messageEvent.Channel, ircTransformer.MakeIntermediate(msg), act)
+		f(messageEvent, msg, act)
 	}, event.PriNorm)
 }
 
+// HookMessage hooks on messages to a channel
+func (i *IRC) HookMessage(f func(source, channel, message string, isAction bool)) {
+	i.hookChannelMessage(func(messageEvent *MessageEvent, msg string, isAction bool) {
+		f(util.UserHost2Canonical(messageEvent.Source), messageEvent.Channel, ircTransformer.MakeIntermediate(msg), isAction)
+	})
+}
+
+// HookMessageMeta hooks on messages to a channel, and includes the message's ID, server time, and what it is a reply
+// to, if the server provides them
+func (i *IRC) HookMessageMeta(f func(source, channel, message string, isAction bool, meta interfaces.MessageMeta)) {
+	i.hookChannelMessage(func(messageEvent *MessageEvent, msg string, isAction bool) {
+		f(
+			util.UserHost2Canonical(messageEvent.Source),
+			messageEvent.Channel,
+			ircTransformer.MakeIntermediate(msg),
+			isAction,
+			i.messageMeta(messageEvent),
+		)
+	})
+}
+
 // HookPrivateMessage hooks on messages to us directly
 func (i *IRC) HookPrivateMessage(f func(source, channel, message string)) {
 	i.ParsedEvents.Attach("MSG", func(e event.Event) {
 		msg := e.(*MessageEvent)
-		if e.IsCancelled() || msg.IsNotice || strings.HasPrefix(msg.Channel, "#") {
+		if e.IsCancelled() || msg.IsNotice || strings.HasPrefix(msg.Channel, "#") || msg.isReplay() {
 			return
 		}
 		f(util.UserHost2Canonical(msg.Source), msg.Channel, ircTransformer.MakeIntermediate(msg.Message))
@@ -78,3 +101,36 @@ func (i *IRC) HookNick(f func(source, newNick string)) {
 		f(util.UserHost2Canonical(nick.Source), nick.NewNick)
 	}, event.PriNorm)
 }
+
+// HookTopic hooks on a channel's topic being changed
+func (i *IRC) HookTopic(f func(source, channel, topic string)) {
+	i.ParsedEvents.Attach("TOPIC", func(e event.Event) {
+		topic := e.(*TopicEvent)
+		f(util.UserHost2Canonical(topic.Source), topic.Channel, ircTransformer.MakeIntermediate(topic.Topic))
+	}, event.PriNorm)
+}
+
+// HookMode hooks on a channel's modes being changed. Changes are parsed using the server's CHANMODES and PREFIX
+func (i *IRC) HookMode(f func(source, channel string, changes []interfaces.ModeChange)) {
+	i.ParsedEvents.Attach("MODE", func(e event.Event) {
+		mode := e.(*ModeEvent)
+		f(util.UserHost2Canonical(mode.Source), mode.Channel, mode.Changes)
+	}, event.PriNorm)
+}
+
+// HookNotice hooks on notices to a channel
+func (i *IRC) HookNotice(f func(source, channel, message string)) {
+	i.ParsedEvents.Attach("MSG", func(e event.Event) {
+		msg := e.(*MessageEvent)
+		if e.IsCancelled() || !msg.IsNotice || !strings.HasPrefix(msg.Channel, "#") || msg.isReplay() {
+			return
+		}
+
+		if _, err := ctcp.Parse(msg.Message); err == nil {
+			// CTCP replies are not notices anyone should see
+			return
+		}
+
+		f(util.UserHost2Canonical(msg.Source), msg.Channel, ircTransformer.MakeIntermediate(msg.Message))
+	}, event.PriNorm)
+}
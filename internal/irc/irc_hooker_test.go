@@ -0,0 +1,96 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+)
+
+func TestIRC_HookTopic(t *testing.T) {
+	i := newTestIRC(t, &Conf{})
+
+	var got []string
+
+	i.HookTopic(func(source, channel, topic string) { got = append(got, source+" "+channel+" "+topic) })
+
+	feedLines(t, i,
+		":server 332 bot #chan :topic on join",
+		":a!c@c TOPIC #chan :\x02new\x02 topic",
+		":a!c@c TOPIC #chan :",
+	)
+
+	if want := []string{"a!c@c #chan $bnew$b topic", "a!c@c #chan "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HookTopic got %q, want %q", got, want)
+	}
+}
+
+func TestIRC_HookMode(t *testing.T) {
+	type mode struct {
+		channel string
+		changes []interfaces.ModeChange
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []mode
+	}{
+		{name: "user modes", lines: []string{":bot MODE bot :+i"}},
+		{
+			name:  "ban",
+			lines: []string{":a!c@c MODE #chan +b-o *!*@host a"},
+			want: []mode{{"#chan", []interfaces.ModeChange{
+				{Adding: true, Mode: "b", Arg: "*!*@host"}, {Mode: "o", Arg: "a"},
+			}}},
+		},
+		{
+			name: "server CHANMODES",
+			lines: []string{
+				":server 005 bot CHANMODES=beqI,k,lf,imnpst :are supported by this server",
+				":a!c@c MODE #chan +qf-f *!*@host [5j]:10",
+			},
+			want: []mode{{"#chan", []interfaces.ModeChange{
+				{Adding: true, Mode: "q", Arg: "*!*@host"}, {Adding: true, Mode: "f", Arg: "[5j]:10"}, {Mode: "f"},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{})
+
+			var got []mode
+
+			i.HookMode(func(_, channel string, changes []interfaces.ModeChange) {
+				got = append(got, mode{channel, changes})
+			})
+
+			feedLines(t, i, tt.lines...)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HookMode got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_HookNotice(t *testing.T) {
+	i := newTestIRC(t, &Conf{})
+
+	var got []string
+
+	i.HookNotice(func(source, channel, message string) { got = append(got, source+" "+channel+" "+message) })
+
+	feedLines(t, i,
+		":a!c@c NOTICE #chan :hello",
+		":a!c@c PRIVMSG #chan :not a notice",
+		":a!c@c NOTICE bot :private",
+		":a!c@c NOTICE #chan :\x01VERSION gggb\x01",
+	)
+
+	if want := []string{"a!c@c #chan hello"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HookNotice got %q, want %q", got, want)
+	}
+}
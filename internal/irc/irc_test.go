@@ -0,0 +1,104 @@
+package irc
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goshuirc/irc-go/ircmsg"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+// newTestIRC creates an IRC instance that has not connected anywhere, with the given capabilities enabled. Lines can
+// be fed to it with handleLine
+func newTestIRC(t *testing.T, conf *Conf, caps ...string) *IRC {
+	t.Helper()
+
+	i := &IRC{
+		Conf:         conf,
+		log:          log.New(0, ioutil.Discard, "TEST", log.INFO),
+		RawEvents:    new(event.Manager),
+		ParsedEvents: new(event.Manager),
+		accounts:     newAccountTracker(),
+		isupport:     newISupport(),
+		sendQueue:    newSendQueue(),
+		batches:      newBatchTracker(),
+		labels:       newLabelTracker(),
+		recent:       newRecentMessages(),
+		channelState: newChannelState(),
+		ctcpLimiter:  newCTCPLimiter(),
+	}
+
+	i.setupParsers()
+	i.capabilityManager = newCapabilityManager(i)
+
+	for _, c := range caps {
+		capab := i.capabilityManager.addOrGetCap(c)
+		capab.supported, capab.available, capab.enabled = true, true, true
+	}
+
+	return i
+}
+
+func feedLines(t *testing.T, i *IRC, lines ...string) {
+	t.Helper()
+
+	for _, l := range lines {
+		line, err := ircmsg.ParseLine(l)
+		if err != nil {
+			t.Fatalf("invalid test line %q: %s", l, err)
+		}
+
+		i.handleLine(line)
+	}
+}
+
+// connectTestIRC marks the given IRC as connected to a fake server, and returns a channel that receives every line
+// the IRC sends to it, and a function to disconnect it
+func connectTestIRC(i *IRC) (<-chan string, func()) {
+	client, server := net.Pipe()
+	i.socket = client
+	i.Connected.Set(true)
+
+	out := make(chan string, 100)
+
+	go func() {
+		defer close(out)
+
+		lines := bufio.NewScanner(server)
+		for lines.Scan() {
+			out <- lines.Text()
+		}
+	}()
+
+	return out, func() {
+		client.Close()
+		server.Close()
+	}
+}
+
+// expectLines checks that the next lines sent by the IRC are the given lines, and that nothing else is sent
+func expectLines(t *testing.T, sent <-chan string, want ...string) {
+	t.Helper()
+
+	for _, w := range want {
+		select {
+		case got := <-sent:
+			if got != w {
+				t.Errorf("sent %q, want %q", got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+
+	select {
+	case got := <-sent:
+		t.Errorf("unexpected line sent: %q", got)
+	case <-time.After(time.Millisecond * 20):
+	}
+}
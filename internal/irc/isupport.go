@@ -0,0 +1,61 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+)
+
+// isupport holds the ISUPPORT (005) tokens sent by the server on connection
+type isupport struct {
+	sync.RWMutex
+	tokens map[string]string
+}
+
+func newISupport() *isupport {
+	return &isupport{tokens: make(map[string]string)}
+}
+
+func (s *isupport) onISupport(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 3 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// The first param is our nick, and the last is the "are supported by this server" text
+	for _, token := range raw.Line.Params[1 : len(raw.Line.Params)-1] {
+		if strings.HasPrefix(token, "-") {
+			delete(s.tokens, strings.ToUpper(token[1:]))
+			continue
+		}
+
+		split := strings.SplitN(token, "=", 2)
+		value := ""
+
+		if len(split) == 2 {
+			value = split[1]
+		}
+
+		s.tokens[strings.ToUpper(split[0])] = value
+	}
+}
+
+// get returns the value of the named token, and whether or not the server sent it at all
+func (s *isupport) get(name string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	v, ok := s.tokens[strings.ToUpper(name)]
+
+	return v, ok
+}
+
+func (s *isupport) clear() {
+	s.Lock()
+	s.tokens = make(map[string]string)
+	s.Unlock()
+}
@@ -0,0 +1,60 @@
+package irc
+
+import (
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+)
+
+// defaultChanModes is the CHANMODES ISUPPORT token assumed if the server does not send one
+const defaultChanModes = "beI,k,l,imnpst"
+
+// chanModeTypes returns the modes that always take a parameter, and those that only take one when being set, based
+// on the CHANMODES and PREFIX ISUPPORT tokens
+func (i *IRC) chanModeTypes() (always, whenSet string) {
+	v, ok := i.isupport.get("CHANMODES")
+	if !ok {
+		v = defaultChanModes
+	}
+
+	// Types A and B always take a parameter, C only when being set, and D never does
+	types := strings.SplitN(v, ",", 4)
+	for len(types) < 4 {
+		types = append(types, "")
+	}
+
+	prefixModes, _ := i.prefixModes()
+
+	return types[0] + types[1] + prefixModes, types[2]
+}
+
+// parseModes parses a channel mode string and its arguments into the individual changes it makes. Modes missing an
+// expected argument are given an empty one
+func (i *IRC) parseModes(modes string, args []string) []interfaces.ModeChange {
+	always, whenSet := i.chanModeTypes()
+
+	var out []interfaces.ModeChange
+
+	adding := true
+
+	for idx := 0; idx < len(modes); idx++ {
+		switch c := modes[idx]; c {
+		case '+':
+			adding = true
+		case '-':
+			adding = false
+		default:
+			change := interfaces.ModeChange{Adding: adding, Mode: string(c)}
+
+			if strings.IndexByte(always, c) != -1 || (adding && strings.IndexByte(whenSet, c) != -1) {
+				if len(args) > 0 {
+					change.Arg, args = args[0], args[1:]
+				}
+			}
+
+			out = append(out, change)
+		}
+	}
+
+	return out
+}
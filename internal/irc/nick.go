@@ -0,0 +1,137 @@
+package irc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// Numerics used for nick recovery
+const (
+	rplWelcome    = "001"
+	rplISupport   = "005"
+	rplIsOn       = "303"
+	rplMonOffline = "731"
+	errNickInUse  = "433"
+)
+
+func (i *IRC) setupNickRecovery() {
+	i.RawEvents.Attach(rplISupport, i.isupport.onISupport, event.PriHighest)
+	i.RawEvents.Attach(rplWelcome, i.onWelcome, event.PriNorm)
+	i.RawEvents.Attach(rplIsOn, i.onIsOn, event.PriNorm)
+	i.RawEvents.Attach(rplMonOffline, i.onMonOffline, event.PriNorm)
+	i.RawEvents.Attach(util.RPL_LOGGEDIN, func(event.Event) { i.loggedIn.Set(true) }, event.PriNorm)
+	i.RawEvents.Attach(util.RPL_LOGGEDOUT, func(event.Event) { i.loggedIn.Set(false) }, event.PriNorm)
+}
+
+// hasNick returns whether or not we are currently using our configured nick
+func (i *IRC) hasNick() bool {
+	return strings.EqualFold(i.runtimeNick.Get(), i.Nick)
+}
+
+func (i *IRC) nickRecoveryInterval() time.Duration {
+	if i.NickRecovery == 0 {
+		return time.Second * 30
+	}
+
+	return time.Second * time.Duration(i.NickRecovery)
+}
+
+// nickRecoveryLoop periodically tries to reclaim our configured nick, until the context is cancelled
+func (i *IRC) nickRecoveryLoop(ctx context.Context) {
+	if i.NickRecovery < 0 {
+		return
+	}
+
+	ticker := time.NewTicker(i.nickRecoveryInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			i.tryRecoverNick()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tryRecoverNick makes an attempt to reclaim our nick if we are not using it. If we are logged in and regain is
+// enabled, NickServ is asked to REGAIN it. Otherwise, if the server does not support MONITOR, we check for the nick
+// with ISON. When MONITOR is supported the server tells us when the nick is free, so there is nothing to do
+func (i *IRC) tryRecoverNick() {
+	if i.hasNick() || !i.Connected.Get() {
+		return
+	}
+
+	if i.Regain && i.loggedIn.Get() {
+		i.SendMessage("NickServ", "REGAIN "+i.Nick)
+		return
+	}
+
+	if _, ok := i.isupport.get("MONITOR"); ok {
+		return
+	}
+
+	if _, err := i.writeLine("ISON", i.Nick); err != nil {
+		i.log.Warnf("could not check if our nick is in use: %s", err)
+	}
+}
+
+func (i *IRC) reclaimNick() {
+	if _, err := i.writeLine("NICK", i.Nick); err != nil {
+		i.log.Warnf("could not reclaim nick %q: %s", i.Nick, err)
+	}
+}
+
+func (i *IRC) onWelcome(event.Event) {
+	if i.hasNick() {
+		return
+	}
+
+	i.log.Infof("connected with fallback nick %q, will try to reclaim %q", i.runtimeNick.Get(), i.Nick)
+
+	if _, ok := i.isupport.get("MONITOR"); ok {
+		if _, err := i.writeLine("MONITOR", "+", i.Nick); err != nil {
+			i.log.Warnf("could not MONITOR our nick: %s", err)
+		}
+	}
+
+	if i.Regain && i.loggedIn.Get() {
+		i.tryRecoverNick()
+	}
+}
+
+// onIsOn handles replies to ISON, reclaiming our nick if it is not online
+func (i *IRC) onIsOn(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || i.hasNick() {
+		return
+	}
+
+	for _, nick := range strings.Fields(util.IdxOrEmpty(raw.Line.Params, 1)) {
+		if strings.EqualFold(nick, i.Nick) {
+			return
+		}
+	}
+
+	i.reclaimNick()
+}
+
+// onMonOffline handles MONITOR notifications that nicks have gone offline, reclaiming our nick if it is one of them
+func (i *IRC) onMonOffline(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || i.hasNick() {
+		return
+	}
+
+	for _, target := range strings.Split(util.IdxOrEmpty(raw.Line.Params, 1), ",") {
+		if strings.EqualFold(strings.SplitN(target, "!", 2)[0], i.Nick) {
+			i.reclaimNick()
+			return
+		}
+	}
+}
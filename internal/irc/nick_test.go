@@ -0,0 +1,160 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestIRC_nickRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     *Conf
+		lines    []string
+		recover  bool // whether or not to call tryRecoverNick after the lines
+		want     []string
+		wantNick string
+	}{
+		{
+			name:     "in use during registration",
+			lines:    []string{":server 433 * bot :Nickname is already in use"},
+			want:     []string{"NICK bot_"},
+			wantNick: "bot_",
+		},
+		{
+			name: "in use after registration",
+			lines: []string{
+				":server 433 * bot :Nickname is already in use",
+				":server 433 bot_ bot :Nickname is already in use",
+			},
+			want:     []string{"NICK bot_"},
+			wantNick: "bot_",
+		},
+		{
+			name:     "ISON nick online",
+			lines:    []string{":server 433 * bot :Nickname is already in use", ":server 303 bot_ :bot"},
+			want:     []string{"NICK bot_"},
+			wantNick: "bot_",
+		},
+		{
+			name:     "ISON nick offline",
+			lines:    []string{":server 433 * bot :Nickname is already in use", ":server 303 bot_ :"},
+			want:     []string{"NICK bot_", "NICK bot"},
+			wantNick: "bot_",
+		},
+		{
+			name: "MONITOR",
+			lines: []string{
+				":server 433 * bot :Nickname is already in use",
+				":server 005 bot_ MONITOR=100 :are supported by this server",
+				":server 001 bot_ :Welcome",
+				":server 731 bot_ :someone,BOT!user@host",
+				":bot_!user@host NICK bot",
+			},
+			recover:  true, // Nothing should be sent, the server tells us when the nick is free
+			want:     []string{"NICK bot_", "MONITOR + bot", "NICK bot", "MONITOR - bot"},
+			wantNick: "bot",
+		},
+		{
+			name: "MONITOR other nick offline",
+			lines: []string{
+				":server 433 * bot :Nickname is already in use",
+				":server 005 bot_ MONITOR=100 :are supported by this server",
+				":server 001 bot_ :Welcome",
+				":server 731 bot_ :someone",
+			},
+			want:     []string{"NICK bot_", "MONITOR + bot"},
+			wantNick: "bot_",
+		},
+		{
+			name: "regain",
+			conf: &Conf{Nick: "bot", Regain: true},
+			lines: []string{
+				":server 433 * bot :Nickname is already in use",
+				":server 900 bot_ bot_!user@host bot :You are now logged in as bot",
+				":server 001 bot_ :Welcome",
+			},
+			want:     []string{"NICK bot_", "PRIVMSG NickServ :REGAIN bot"},
+			wantNick: "bot_",
+		},
+		{
+			name: "regain not logged in",
+			conf: &Conf{Nick: "bot", Regain: true},
+			lines: []string{
+				":server 433 * bot :Nickname is already in use",
+				":server 001 bot_ :Welcome",
+			},
+			recover:  true,
+			want:     []string{"NICK bot_", "ISON bot"},
+			wantNick: "bot_",
+		},
+		{
+			name:     "have nick",
+			lines:    []string{":server 001 bot :Welcome", ":server 303 bot :"},
+			recover:  true,
+			wantNick: "bot",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			if conf == nil {
+				conf = &Conf{Nick: "bot"}
+			}
+
+			i := newTestIRC(t, conf)
+			i.runtimeNick.Set(i.Nick)
+
+			sent, disconnect := connectTestIRC(i)
+			defer disconnect()
+
+			feedLines(t, i, tt.lines...)
+
+			if tt.recover {
+				i.tryRecoverNick()
+			}
+
+			expectLines(t, sent, tt.want...)
+
+			if got := i.runtimeNick.Get(); got != tt.wantNick {
+				t.Errorf("runtime nick = %q, want %q", got, tt.wantNick)
+			}
+		})
+	}
+}
+
+func Test_isupport_onISupport(t *testing.T) {
+	i := newTestIRC(t, &Conf{})
+	feedLines(t, i,
+		":server 005 bot MONITOR=100 chanmodes=b,k,l,imnpst EXCEPTS :are supported by this server",
+		":server 005 bot -EXCEPTS NETWORK=test :are supported by this server",
+	)
+
+	tests := []struct {
+		token     string
+		want      string
+		wantFound bool
+	}{
+		{token: "MONITOR", want: "100", wantFound: true},
+		{token: "chanmodes", want: "b,k,l,imnpst", wantFound: true},
+		{token: "NETWORK", want: "test", wantFound: true},
+		{token: "EXCEPTS"},
+		{token: "are supported by this server"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.token, func(t *testing.T) {
+			got, found := i.isupport.get(tt.token)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("get(%q) = (%q, %t), want (%q, %t)", tt.token, got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+
+	i.isupport.clear()
+
+	if _, found := i.isupport.get("MONITOR"); found {
+		t.Error("token still exists after clear()")
+	}
+}
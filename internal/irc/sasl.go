@@ -0,0 +1,235 @@
+package irc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Supported SASL mechanisms
+const (
+	saslPlain       = "PLAIN"
+	saslExternal    = "EXTERNAL"
+	saslScramSHA256 = "SCRAM-SHA-256"
+)
+
+// saslMechanism is a single SASL authentication attempt
+type saslMechanism interface {
+	// Name returns the name of the mechanism, as sent to the server
+	Name() string
+	// Next returns the response to the given challenge from the server
+	Next(challenge []byte) ([]byte, error)
+}
+
+// newSaslMechanism creates a mechanism with the given name, using the credentials on the given Conf
+func newSaslMechanism(name string, conf *Conf) (saslMechanism, error) {
+	switch strings.ToUpper(name) {
+	case saslPlain:
+		return &plainMech{authzid: conf.Nick, user: conf.AuthUser, passwd: conf.AuthPasswd}, nil
+	case saslExternal:
+		return externalMech{}, nil
+	case saslScramSHA256:
+		return &scramMech{user: conf.AuthUser, passwd: conf.AuthPasswd}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q", name)
+	}
+}
+
+type plainMech struct {
+	authzid, user, passwd string
+}
+
+func (*plainMech) Name() string { return saslPlain }
+
+func (p *plainMech) Next([]byte) ([]byte, error) {
+	return []byte(fmt.Sprintf("%s\x00%s\x00%s", p.authzid, p.user, p.passwd)), nil
+}
+
+// externalMech authenticates with the client certificate presented during the TLS handshake
+type externalMech struct{}
+
+func (externalMech) Name() string { return saslExternal }
+
+func (externalMech) Next([]byte) ([]byte, error) { return nil, nil } // Empty authzid, use the cert's account
+
+// scramMech implements SCRAM-SHA-256 as described in RFC 5802 and RFC 7677. Channel binding is not supported
+type scramMech struct {
+	user, passwd string
+	nonce        string // client nonce, generated if empty
+
+	step            int
+	clientFirstBare string
+	serverSignature []byte
+}
+
+func (*scramMech) Name() string { return saslScramSHA256 }
+
+const scramGS2Header = "n,,"
+
+// scramEscape escapes a username as required by SCRAM
+func scramEscape(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+func (s *scramMech) Next(challenge []byte) ([]byte, error) {
+	s.step++
+
+	switch s.step {
+	case 1:
+		if s.nonce == "" {
+			buf := make([]byte, 24)
+			if _, err := rand.Read(buf); err != nil {
+				return nil, err
+			}
+
+			s.nonce = base64.RawStdEncoding.EncodeToString(buf)
+		}
+
+		s.clientFirstBare = fmt.Sprintf("n=%s,r=%s", scramEscape(s.user), s.nonce)
+
+		return []byte(scramGS2Header + s.clientFirstBare), nil
+
+	case 2:
+		return s.clientFinal(string(challenge))
+
+	case 3:
+		attrs := scramAttrs(string(challenge))
+		if e, ok := attrs["e"]; ok {
+			return nil, fmt.Errorf("server rejected authentication: %s", e)
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(sig, s.serverSignature) {
+			return nil, errors.New("server signature did not match, the server may not be who it claims to be")
+		}
+
+		return nil, nil
+
+	default:
+		return nil, errors.New("unexpected extra SCRAM challenge")
+	}
+}
+
+func (s *scramMech) clientFinal(serverFirst string) ([]byte, error) {
+	attrs := scramAttrs(serverFirst)
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, s.nonce) || nonce == s.nonce {
+		return nil, errors.New("server nonce is invalid")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count %q", attrs["i"])
+	}
+
+	salted := scramHi([]byte(s.passwd), salt, iterations)
+	clientKey := hmacSHA256(salted, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(salted, []byte("Server Key"))
+
+	withoutProof := fmt.Sprintf("c=%s,r=%s", base64.StdEncoding.EncodeToString([]byte(scramGS2Header)), nonce)
+	authMessage := []byte(s.clientFirstBare + "," + serverFirst + "," + withoutProof)
+
+	proof := hmacSHA256(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+
+	s.serverSignature = hmacSHA256(serverKey, authMessage)
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// scramAttrs parses a SCRAM message into its attributes
+func scramAttrs(msg string) map[string]string {
+	out := make(map[string]string)
+
+	for _, part := range strings.Split(msg, ",") {
+		if split := strings.SplitN(part, "=", 2); len(split) == 2 {
+			out[split[0]] = split[1]
+		}
+	}
+
+	return out
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data) //nolint:errcheck // hash.Hash never returns an error
+
+	return h.Sum(nil)
+}
+
+// scramHi is the Hi function from RFC 5802, which is PBKDF2 with HMAC-SHA-256 and a single block of output
+func scramHi(passwd, salt []byte, iterations int) []byte {
+	u := hmacSHA256(passwd, append(append([]byte(nil), salt...), 0, 0, 0, 1))
+	out := append([]byte(nil), u...)
+
+	for i := 1; i < iterations; i++ {
+		u = hmacSHA256(passwd, u)
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+
+	return out
+}
+
+// maxSaslChunk is the largest chunk of base64 encoded data that can be sent in a single AUTHENTICATE
+const maxSaslChunk = 400
+
+// saslChunks encodes the given response and splits it into AUTHENTICATE parameters. An empty response is sent as "+",
+// as is the end of a response that is an exact multiple of the chunk size
+func saslChunks(response []byte) []string {
+	encoded := base64.StdEncoding.EncodeToString(response)
+
+	var out []string
+
+	for len(encoded) >= maxSaslChunk {
+		out = append(out, encoded[:maxSaslChunk])
+		encoded = encoded[maxSaslChunk:]
+	}
+
+	if encoded == "" {
+		encoded = "+"
+	}
+
+	return append(out, encoded)
+}
+
+// saslReader collects chunked AUTHENTICATE challenges from the server
+type saslReader struct {
+	buf bytes.Buffer
+}
+
+// add adds a chunk of challenge, and returns the full decoded challenge once it is complete
+func (r *saslReader) add(chunk string) ([]byte, bool, error) {
+	if chunk != "+" {
+		r.buf.WriteString(chunk)
+	}
+
+	if len(chunk) == maxSaslChunk {
+		return nil, false, nil
+	}
+
+	defer r.buf.Reset()
+
+	out, err := base64.StdEncoding.DecodeString(r.buf.String())
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid SASL challenge: %w", err)
+	}
+
+	return out, true, nil
+}
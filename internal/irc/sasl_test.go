@@ -0,0 +1,261 @@
+package irc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScramMech_RFC7677(t *testing.T) {
+	// Test vector from RFC 7677 section 3
+	m := &scramMech{user: "user", passwd: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO"}
+
+	first, err := m.Next(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"; string(first) != want {
+		t.Errorf("client-first = %q, want %q", first, want)
+	}
+
+	final, err := m.Next([]byte(
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if string(final) != want {
+		t.Errorf("client-final = %q, want %q", final, want)
+	}
+
+	last, err := m.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	if err != nil {
+		t.Errorf("valid server-final rejected: %s", err)
+	}
+
+	if len(last) != 0 {
+		t.Errorf("response to server-final = %q, want nothing", last)
+	}
+}
+
+func TestScramMech_errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverFirst string
+		serverFinal string
+	}{
+		{name: "nonce mismatch", serverFirst: "r=someoneelse,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"},
+		{name: "nonce not extended", serverFirst: "r=abc,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"},
+		{name: "bad iterations", serverFirst: "r=abcdef,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=none"},
+		{name: "bad salt", serverFirst: "r=abcdef,s=!!!,i=4096"},
+		{name: "server error", serverFirst: "r=abcdef,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=1", serverFinal: "e=invalid-proof"},
+		{name: "bad signature", serverFirst: "r=abcdef,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=1", serverFinal: "v=AAAA"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &scramMech{user: "user", passwd: "pencil", nonce: "abc"}
+			if _, err := m.Next(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := m.Next([]byte(tt.serverFirst))
+			if tt.serverFinal == "" {
+				if err == nil {
+					t.Error("expected an error from the server-first message")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := m.Next([]byte(tt.serverFinal)); err == nil {
+				t.Error("expected an error from the server-final message")
+			}
+		})
+	}
+}
+
+func TestScramEscape(t *testing.T) {
+	if got, want := scramEscape("a=b,c"), "a=3Db=2Cc"; got != want {
+		t.Errorf("scramEscape() = %q, want %q", got, want)
+	}
+}
+
+func TestSaslChunks(t *testing.T) {
+	exact := make([]byte, 300) // 300 bytes encodes to exactly 400 characters
+	encodedExact := base64.StdEncoding.EncodeToString(exact)
+
+	long := make([]byte, 450)
+	encodedLong := base64.StdEncoding.EncodeToString(long)
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []string
+	}{
+		{name: "empty", in: nil, want: []string{"+"}},
+		{name: "short", in: []byte("test"), want: []string{"dGVzdA=="}},
+		{name: "exact", in: exact, want: []string{encodedExact, "+"}},
+		{name: "long", in: long, want: []string{encodedLong[:400], encodedLong[400:]}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := saslChunks(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("saslChunks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaslReader(t *testing.T) {
+	long := []byte(strings.Repeat("x", 450))
+
+	r := saslReader{}
+	for i, chunk := range saslChunks(long) {
+		got, complete, err := r.add(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if last := i == len(saslChunks(long))-1; complete != last {
+			t.Fatalf("chunk %d complete = %t, want %t", i, complete, last)
+		}
+
+		if complete && string(got) != string(long) {
+			t.Errorf("reassembled challenge = %q, want %q", got, long)
+		}
+	}
+
+	got, complete, err := r.add("+")
+	if err != nil || !complete || len(got) != 0 {
+		t.Errorf("add(\"+\") = (%q, %t, %v), want an empty complete challenge", got, complete, err)
+	}
+
+	if _, _, err := r.add("not base64!"); err == nil {
+		t.Error("invalid base64 did not error")
+	}
+}
+
+func TestConf_validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     Conf
+		wantMech string
+		wantErr  bool
+	}{
+		{name: "no sasl", conf: Conf{}, wantMech: saslPlain},
+		{name: "plain", conf: Conf{SASL: true}, wantMech: saslPlain},
+		{name: "external default", conf: Conf{SASL: true, ClientCert: "c", ClientKey: "k"}, wantMech: saslExternal},
+		{name: "scram", conf: Conf{SASL: true, SASLMechanism: "scram-sha-256"}, wantMech: saslScramSHA256},
+		{name: "external without cert", conf: Conf{SASL: true, SASLMechanism: "EXTERNAL"}, wantErr: true},
+		{name: "cert without key", conf: Conf{ClientCert: "c"}, wantErr: true},
+		{name: "unknown mechanism", conf: Conf{SASL: true, SASLMechanism: "DIGEST-MD5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil && tt.conf.saslMechanism() != tt.wantMech {
+				t.Errorf("saslMechanism() = %q, want %q", tt.conf.saslMechanism(), tt.wantMech)
+			}
+		})
+	}
+}
+
+func TestIRC_authenticateWithSasl(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     *Conf
+		exchange [][2]string // lines we expect from the bot, and the server's reply to each
+		wantSASL bool
+	}{
+		{
+			name: "external",
+			conf: &Conf{SASL: true, ClientCert: "c", ClientKey: "k"},
+			exchange: [][2]string{
+				{"AUTHENTICATE EXTERNAL", "AUTHENTICATE +"},
+				{"AUTHENTICATE +", ":server 903 bot :SASL authentication successful"},
+			},
+			wantSASL: true,
+		},
+		{
+			name: "plain",
+			conf: &Conf{SASL: true, Nick: "bot", AuthUser: "user", AuthPasswd: "pass"},
+			exchange: [][2]string{
+				{"AUTHENTICATE PLAIN", "AUTHENTICATE +"},
+				{"AUTHENTICATE Ym90AHVzZXIAcGFzcw==", ":server 903 bot :SASL authentication successful"},
+			},
+			wantSASL: true,
+		},
+		{
+			name: "failure",
+			conf: &Conf{SASL: true, SASLMechanism: "EXTERNAL", ClientCert: "c", ClientKey: "k"},
+			exchange: [][2]string{
+				{"AUTHENTICATE EXTERNAL", ":server 904 bot :SASL authentication failed"},
+			},
+			wantSASL: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, tt.conf)
+			client, server := net.Pipe()
+
+			defer client.Close()
+			defer server.Close()
+
+			i.socket = client
+			i.Connected.Set(true)
+
+			done := make(chan struct{})
+			go func() {
+				i.authenticateWithSasl(nil)
+				close(done)
+			}()
+
+			lines := bufio.NewScanner(server)
+			for _, step := range tt.exchange {
+				if !lines.Scan() {
+					t.Fatalf("connection closed while waiting for %q", step[0])
+				}
+
+				if lines.Text() != step[0] {
+					t.Fatalf("got line %q, want %q", lines.Text(), step[0])
+				}
+
+				feedLines(t, i, step[1])
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("authentication did not finish")
+			}
+
+			if i.SASL != tt.wantSASL {
+				t.Errorf("SASL = %t after authentication, want %t", i.SASL, tt.wantSASL)
+			}
+		})
+	}
+}
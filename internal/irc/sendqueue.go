@@ -0,0 +1,257 @@
+package irc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sendPriority is the lane a queued line is sent from. Lower values are sent first
+type sendPriority int
+
+const (
+	priorityHigh   sendPriority = iota // Admin messages and raw lines
+	priorityNormal                     // Messages and notices, including command replies
+	priorityBridge                     // Lines bridged from games
+
+	numPriorities
+)
+
+// Overflow behaviours for bridged lines when the bridge lane backs up
+const (
+	overflowCoalesce = "coalesce"
+	overflowDrop     = "drop"
+)
+
+// maxCoalescedLength is the longest message that bridged lines will be merged into
+const maxCoalescedLength = 400
+
+const coalesceSeparator = " | "
+
+// queuedLine is a line waiting to be sent. If raw is set, it is sent as is, otherwise a line is built from the other
+// fields
+type queuedLine struct {
+	command string
+	target  string
+	message string
+	limit   int // the longest message that can be sent to target, if known
+	tags    map[string]string
+	raw     string
+}
+
+// coalesceSeparator returns the separator to use when merging another line into this one. If this line contains
+// any formatting, it is reset first so that it does not carry over
+func (q queuedLine) coalesceSeparator() string {
+	if strings.ContainsAny(q.message, string([]rune{bold, italic, underline, colour})) {
+		return string(reset) + coalesceSeparator
+	}
+
+	return coalesceSeparator
+}
+
+func (q queuedLine) canCoalesce(other queuedLine) bool {
+	limit := maxCoalescedLength
+	if q.limit > 0 && q.limit < limit {
+		limit = q.limit
+	}
+
+	return q.raw == "" && len(q.tags) == 0 && len(other.tags) == 0 &&
+		q.command == other.command && q.target == other.target &&
+		len(q.message)+len(q.coalesceSeparator())+len(other.message) <= limit
+}
+
+// sendQueue holds outgoing lines in priority lanes until flood control allows them to be sent
+type sendQueue struct {
+	sync.Mutex
+	lanes [numPriorities][]queuedLine
+	wake  chan struct{}
+
+	bridgeLimit int
+	overflow    string
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{wake: make(chan struct{}, 1)}
+}
+
+// configure updates the bridge lane settings
+func (q *sendQueue) configure(bridgeLimit int, overflow string) {
+	q.Lock()
+	q.bridgeLimit = bridgeLimit
+	q.overflow = strings.ToLower(overflow)
+	q.Unlock()
+}
+
+// push adds a line to the given lane. Once the bridge lane has bridgeLimit lines waiting, new bridged lines
+// are merged into the last line to the same target where possible, or dropped. push returns false if the line was
+// dropped
+func (q *sendQueue) push(priority sendPriority, line queuedLine) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	lane := q.lanes[priority]
+
+	if priority == priorityBridge && q.bridgeLimit > 0 && len(lane) >= q.bridgeLimit {
+		if q.overflow != overflowDrop {
+			for idx := len(lane) - 1; idx >= 0; idx-- {
+				if lane[idx].canCoalesce(line) {
+					lane[idx].message += lane[idx].coalesceSeparator() + line.message
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	q.lanes[priority] = append(lane, line)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// pop removes and returns the next line to send, from the highest priority lane that has one
+func (q *sendQueue) pop() (queuedLine, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for priority, lane := range q.lanes {
+		if len(lane) == 0 {
+			continue
+		}
+
+		out := lane[0]
+		q.lanes[priority] = lane[1:]
+
+		return out, true
+	}
+
+	return queuedLine{}, false
+}
+
+// len returns the total number of queued lines
+func (q *sendQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	out := 0
+	for _, lane := range q.lanes {
+		out += len(lane)
+	}
+
+	return out
+}
+
+// clear drops all queued lines
+func (q *sendQueue) clear() {
+	q.Lock()
+	q.lanes = [numPriorities][]queuedLine{}
+	q.Unlock()
+}
+
+// tokenBucket limits the rate lines are sent at, while allowing short bursts
+type tokenBucket struct {
+	capacity float64
+	rate     float64 // tokens added per second
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, rate float64, now time.Time) *tokenBucket {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &tokenBucket{capacity: float64(capacity), rate: rate, tokens: float64(capacity), last: now}
+}
+
+// take takes a token from the bucket if one is available, otherwise it returns how long to wait until one will be
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// floodControlEnabled returns whether or not lines should go through the send queue
+func (i *IRC) floodControlEnabled() bool {
+	return i.FloodRate > 0
+}
+
+// queueLine queues a line to be sent with the given priority, or sends it immediately if flood control is disabled
+func (i *IRC) queueLine(priority sendPriority, line queuedLine) {
+	if !i.Connected.Get() {
+		i.log.Warnf("could not send %q to %q: %s", line.message+line.raw, line.target, ErrNotConnected)
+		return
+	}
+
+	if !i.floodControlEnabled() {
+		i.sendLine(line)
+		return
+	}
+
+	if !i.sendQueue.push(priority, line) {
+		i.log.Debugf("send queue is backed up, dropped bridged line to %q: %q", line.target, line.message)
+	}
+}
+
+func (i *IRC) sendLine(line queuedLine) {
+	var err error
+	if line.raw != "" {
+		var n int
+		if n, err = i.write([]byte(line.raw), true); err == nil && n < len(line.raw) {
+			i.log.Warnf("Did not send enough bytes: %d != %d", n, len(line.raw))
+		}
+	} else {
+		_, err = i.writeTaggedLine(line.tags, line.command, line.target, line.message)
+	}
+
+	if err != nil {
+		i.log.Warnf("could not send line %q to %q: %s", line.message+line.raw, line.target, err)
+	}
+}
+
+// sendLoop sends queued lines as flood control allows, until the context is cancelled
+func (i *IRC) sendLoop(ctx context.Context) {
+	bucket := newTokenBucket(i.FloodBurst, i.FloodRate, time.Now())
+
+	for {
+		line, ok := i.sendQueue.pop()
+		if !ok {
+			select {
+			case <-i.sendQueue.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for wait := bucket.take(time.Now()); wait > 0; wait = bucket.take(time.Now()) {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		i.sendLine(line)
+	}
+}
@@ -0,0 +1,176 @@
+package irc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tokenBucket_take(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(2, 2, start)
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  time.Duration
+	}{
+		{name: "burst 1", want: 0},
+		{name: "burst 2", want: 0},
+		{name: "empty", want: time.Millisecond * 500},
+		{name: "partly refilled", after: time.Millisecond * 250, want: time.Millisecond * 250},
+		{name: "refilled", after: time.Millisecond * 500, want: 0},
+		{name: "capped at capacity", after: time.Hour, want: 0},
+		{name: "capped at capacity 2", after: time.Hour, want: 0},
+		{name: "capped at capacity 3", after: time.Hour, want: time.Millisecond * 500},
+	}
+
+	for _, tt := range tests {
+		if got := b.take(start.Add(tt.after)); got != tt.want {
+			t.Errorf("%s: take() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func lineMessages(q *sendQueue) []string {
+	var out []string
+
+	for l, ok := q.pop(); ok; l, ok = q.pop() {
+		out = append(out, l.message)
+	}
+
+	return out
+}
+
+func Test_sendQueue_push(t *testing.T) {
+	type push struct {
+		priority sendPriority
+		target   string
+		message  string
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		overflow string
+		pushes   []push
+		want     []string
+	}{
+		{
+			name: "priority order",
+			pushes: []push{
+				{priorityBridge, "#c", "bridge"},
+				{priorityNormal, "#c", "normal"},
+				{priorityHigh, "#c", "high"},
+				{priorityNormal, "#c", "normal 2"},
+			},
+			want: []string{"high", "normal", "normal 2", "bridge"},
+		},
+		{
+			name:     "coalesce",
+			limit:    2,
+			overflow: overflowCoalesce,
+			pushes: []push{
+				{priorityBridge, "#a", "one"},
+				{priorityBridge, "#b", "two"},
+				{priorityBridge, "#a", "three"},
+				{priorityBridge, "#b", "four"},
+				{priorityNormal, "#a", "normal"},
+			},
+			want: []string{"normal", "one | three", "two | four"},
+		},
+		{
+			name:     "coalesce too long",
+			limit:    1,
+			overflow: overflowCoalesce,
+			pushes: []push{
+				{priorityBridge, "#a", strings.Repeat("x", maxCoalescedLength-3)},
+				{priorityBridge, "#a", "x"},
+			},
+			want: []string{strings.Repeat("x", maxCoalescedLength-3)},
+		},
+		{
+			name:     "drop",
+			limit:    1,
+			overflow: overflowDrop,
+			pushes: []push{
+				{priorityBridge, "#a", "one"},
+				{priorityBridge, "#a", "two"},
+				{priorityHigh, "#a", "high"},
+			},
+			want: []string{"high", "one"},
+		},
+		{
+			name:     "no limit",
+			overflow: overflowDrop,
+			pushes: []push{
+				{priorityBridge, "#a", "one"},
+				{priorityBridge, "#a", "two"},
+			},
+			want: []string{"one", "two"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSendQueue()
+			q.configure(tt.limit, tt.overflow)
+
+			for _, p := range tt.pushes {
+				q.push(p.priority, queuedLine{command: "PRIVMSG", target: p.target, message: p.message})
+			}
+
+			if got := q.len(); got != len(tt.want) {
+				t.Errorf("len() = %d, want %d", got, len(tt.want))
+			}
+
+			if got := lineMessages(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_sendLoop(t *testing.T) {
+	i := newTestIRC(t, &Conf{FloodBurst: 1, FloodRate: 100, AdminChannels: []string{"#admin"}})
+	sent, disconnect := connectTestIRC(i)
+
+	defer disconnect()
+
+	i.SendBridgeMessage("#c", "bridged")
+	i.SendMessage("#c", "reply\nsecond line")
+	i.SendAdminMessage("admin")
+	i.SendRaw("PRIVMSG #c :raw")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go i.sendLoop(ctx)
+
+	expectLines(t, sent,
+		"PRIVMSG #admin admin",
+		"PRIVMSG #c :raw",
+		"PRIVMSG #c reply",
+		"PRIVMSG #c :second line",
+		"PRIVMSG #c bridged",
+	)
+}
+
+func TestIRC_queueLine_disabled(t *testing.T) {
+	i := newTestIRC(t, &Conf{})
+	sent, disconnect := connectTestIRC(i)
+
+	defer disconnect()
+
+	i.SendBridgeMessage("#c", "bridged")
+	i.SendMessage("#c", "message")
+
+	expectLines(t, sent, "PRIVMSG #c bridged", "PRIVMSG #c message")
+
+	if got := i.sendQueue.len(); got != 0 {
+		t.Errorf("%d lines queued with flood control disabled", got)
+	}
+}
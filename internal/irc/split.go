@@ -0,0 +1,249 @@
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goshuirc/irc-go/ircutils"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/intermediate"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
+)
+
+// maxLineLength is the longest line IRC allows, including the trailing CRLF
+const maxLineLength = 512
+
+// fallbackHostLength is the longest hostname most servers allow, assumed until we have seen our own host
+const fallbackHostLength = 63
+
+const rplHostHidden = "396"
+
+func (i *IRC) setupHostTracking() {
+	i.RawEvents.Attach("JOIN", i.onOwnJoin, event.PriNorm)
+	i.RawEvents.Attach(rplHostHidden, i.onHostHidden, event.PriNorm)
+}
+
+// onOwnJoin records our own user@host from our JOINs
+func (i *IRC) onOwnJoin(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil {
+		return
+	}
+
+	uh := ircutils.ParseUserhost(raw.Line.Prefix)
+	if uh.User == "" || uh.Host == "" || !strings.EqualFold(uh.Nick, i.runtimeNick.Get()) {
+		return
+	}
+
+	i.ownUserhost.Set(uh.User + "@" + uh.Host)
+}
+
+// onHostHidden updates our host when the server changes it, for example when a cloak is applied
+func (i *IRC) onHostHidden(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 2 {
+		return
+	}
+
+	host := raw.Line.Params[1]
+	if strings.Contains(host, "@") {
+		// Some servers send user@host
+		i.ownUserhost.Set(host)
+		return
+	}
+
+	if userhost := i.ownUserhost.Get(); userhost != "" {
+		i.ownUserhost.Set(strings.SplitN(userhost, "@", 2)[0] + "@" + host)
+	}
+}
+
+// hostmaskLength returns the length of our nick!user@host, as seen by others
+func (i *IRC) hostmaskLength() int {
+	userhost := len(i.ownUserhost.Get())
+	if userhost == 0 {
+		userhost = len("~") + len(i.Ident) + len("@") + fallbackHostLength
+	}
+
+	return len(i.runtimeNick.Get()) + len("!") + userhost
+}
+
+// messageLimit returns how many bytes of message can be sent with the given command and target, such that the line
+// relayed by the server, with our hostmask as a prefix, still fits within maxLineLength
+func (i *IRC) messageLimit(command, target string) int {
+	// :nick!user@host COMMAND target :message\r\n
+	return maxLineLength - len(":") - i.hostmaskLength() - len(" ") - len(command) - len(" ") - len(target) -
+		len(" :") - len("\r\n")
+}
+
+// formatState tracks the IRC formatting active at a point in a message
+type formatState struct {
+	bold      bool
+	italic    bool
+	underline bool
+	colour    string
+}
+
+// formatCode returns the IRC formatting code for the given format token
+func formatCode(tok tokeniser.Token) string {
+	if tok.TokenType == intermediate.Colour {
+		return ircColour(tok.Colour)
+	}
+
+	return ircFmtMapping[rune(tok.TokenType)]
+}
+
+func (f *formatState) update(tok tokeniser.Token) {
+	switch tok.TokenType {
+	case intermediate.Bold:
+		f.bold = !f.bold
+	case intermediate.Italic:
+		f.italic = !f.italic
+	case intermediate.Underline:
+		f.underline = !f.underline
+	case intermediate.Colour:
+		f.colour = ircColour(tok.Colour)
+	case intermediate.Reset:
+		*f = formatState{}
+	}
+}
+
+// codes returns the IRC formatting codes needed to get from no formatting to this state
+func (f *formatState) codes() string {
+	out := strings.Builder{}
+
+	for _, c := range []struct {
+		active bool
+		code   rune
+	}{{f.bold, bold}, {f.italic, italic}, {f.underline, underline}} {
+		if c.active {
+			out.WriteRune(c.code)
+		}
+	}
+
+	out.WriteString(f.colour)
+
+	return out.String()
+}
+
+// splitter builds lines of at most limit bytes
+type splitter struct {
+	limit   int
+	state   formatState
+	lines   []string
+	cur     strings.Builder
+	hasText bool // whether cur has any text, rather than just formatting codes
+}
+
+func (s *splitter) fits(str string) bool { return s.cur.Len()+len(str) <= s.limit }
+
+func (s *splitter) write(str string) {
+	s.cur.WriteString(str)
+	s.hasText = true
+}
+
+// flush ends the current line, and starts a new one with the current formatting re-applied
+func (s *splitter) flush() {
+	s.lines = append(s.lines, strings.TrimRight(s.cur.String(), " "))
+	s.cur.Reset()
+	s.cur.WriteString(s.state.codes())
+	s.hasText = false
+}
+
+func (s *splitter) addFormat(tok tokeniser.Token) {
+	code := formatCode(tok)
+	if !s.fits(code) && s.hasText {
+		s.flush()
+	}
+
+	s.state.update(tok)
+	s.cur.WriteString(code)
+}
+
+func (s *splitter) addWord(word string) {
+	if s.fits(word) {
+		s.write(word)
+		return
+	}
+
+	if trimmed := strings.TrimRight(word, " "); trimmed != word && s.fits(trimmed) {
+		// The word fits, but the space after it does not. There is no need to send that
+		s.write(trimmed)
+		s.flush()
+
+		return
+	}
+
+	if s.hasText {
+		s.flush()
+
+		if s.fits(word) {
+			s.write(word)
+			return
+		}
+	}
+
+	// The word is too long for a line of its own, split it wherever we can
+	for word != "" {
+		n := runeBoundary(word, s.limit-s.cur.Len())
+
+		switch {
+		case n == 0 && s.hasText:
+			s.flush()
+			continue
+		case n == 0:
+			// Not even a single rune fits after the formatting codes, there is nothing to do but send it anyway
+			_, n = utf8.DecodeRuneInString(word)
+		}
+
+		s.write(word[:n])
+		word = word[n:]
+
+		if word != "" {
+			s.flush()
+		}
+	}
+}
+
+// runeBoundary returns the largest index no greater than max that does not split a UTF-8 sequence in str
+func runeBoundary(str string, max int) int {
+	if len(str) <= max {
+		return len(str)
+	}
+
+	if max <= 0 {
+		return 0
+	}
+
+	for max > 0 && !utf8.RuneStart(str[max]) {
+		max--
+	}
+
+	return max
+}
+
+// splitMessage converts a message in the intermediate format to IRC formatting, and splits it into lines of at most
+// limit bytes. Lines are split between words where possible, and never inside a formatting code or UTF-8 sequence.
+// Any formatting active at the end of a line is re-applied at the start of the next
+func splitMessage(msg string, limit int) []string {
+	s := splitter{limit: limit}
+
+	for _, tok := range tokeniser.Tokenise(msg) {
+		if tok.TokenType != tokeniser.StringToken {
+			s.addFormat(tok)
+			continue
+		}
+
+		for _, word := range strings.SplitAfter(tok.OriginalString, " ") {
+			if word != "" {
+				s.addWord(word)
+			}
+		}
+	}
+
+	if s.hasText || len(s.lines) == 0 {
+		s.lines = append(s.lines, s.cur.String())
+	}
+
+	return s.lines
+}
@@ -0,0 +1,119 @@
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_splitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   string
+		limit int
+		want  []string
+	}{
+		{name: "empty", msg: "", limit: 10, want: []string{""}},
+		{name: "short", msg: "hello world", limit: 20, want: []string{"hello world"}},
+		{name: "exact", msg: "hello world", limit: 11, want: []string{"hello world"}},
+		{name: "words", msg: "hello world foo", limit: 11, want: []string{"hello world", "foo"}},
+		{name: "space at split", msg: "hello world", limit: 6, want: []string{"hello", "world"}},
+		{name: "long word", msg: "abcdefghij", limit: 4, want: []string{"abcd", "efgh", "ij"}},
+		{name: "long word after short", msg: "a bcdefgh", limit: 4, want: []string{"a", "bcde", "fgh"}},
+		{name: "utf-8", msg: "ééé", limit: 3, want: []string{"é", "é", "é"}},
+		{name: "utf-8 in word", msg: "aé€b", limit: 4, want: []string{"aé", "€b"}},
+		{name: "sentinel", msg: "$$5 $$6", limit: 2, want: []string{"$5", "$6"}},
+		{
+			name:  "bold carries over",
+			msg:   "$bbold text here$b plain",
+			limit: 10,
+			want:  []string{"\x02bold text", "\x02here\x02", "plain"},
+		},
+		{
+			name:  "colour carries over",
+			msg:   "$cFF0000red words",
+			limit: 8,
+			want:  []string{"\x0304red", "\x0304words"},
+		},
+		{
+			name:  "reset",
+			msg:   "$b$iab$r cd",
+			limit: 5,
+			want:  []string{"\x02\x1dab\x0f", "cd"},
+		},
+		{
+			name:  "format code not split",
+			msg:   "abcd$cFF0000e",
+			limit: 5,
+			want:  []string{"abcd", "\x0304e"},
+		},
+		{
+			name:  "unsupported format dropped",
+			msg:   "$sstrike$s",
+			limit: 10,
+			want:  []string{"strike"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.msg, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage() = %q, want %q", got, tt.want)
+			}
+
+			for _, l := range got {
+				if len(l) > tt.limit || !utf8.ValidString(l) {
+					t.Errorf("invalid line %q", l)
+				}
+			}
+		})
+	}
+}
+
+func Test_splitMessage_long(t *testing.T) {
+	msg := strings.Repeat("$bsome €uro text$b and $cFF0000colours$r ", 100)
+	limit := 50
+
+	lines := splitMessage(msg, limit)
+
+	for _, l := range lines {
+		if len(l) > limit || !utf8.ValidString(l) {
+			t.Errorf("invalid line %q", l)
+		}
+	}
+
+	joined := strings.Join(lines, " ")
+	if got, want := strings.Count(joined, "€"), 100; got != want {
+		t.Errorf("%d instances of € after splitting, want %d", got, want)
+	}
+}
+
+func TestIRC_messageLimit(t *testing.T) {
+	i := newTestIRC(t, &Conf{Nick: "bot", Ident: "gggb"})
+	i.runtimeNick.Set("bot")
+
+	tests := []struct {
+		name string
+		line string
+		want int
+	}{
+		{name: "unknown host", want: 423},
+		{name: "other join", line: ":someone!~gggb@host.example JOIN #c", want: 423},
+		{name: "own join", line: ":bot!~gggb@host.example JOIN #c", want: 474},
+		{name: "cloak", line: ":server 396 bot cloak/x :is now your hidden host", want: 479},
+		{name: "cloak with user", line: ":server 396 bot gggb@cloak/y :is now your hidden host", want: 480},
+	}
+
+	for _, tt := range tests {
+		if tt.line != "" {
+			feedLines(t, i, tt.line)
+		}
+
+		if got := i.messageLimit("PRIVMSG", "#c"); got != tt.want {
+			t.Errorf("%s: messageLimit() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package irc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// defaultPrefix is the PREFIX ISUPPORT token assumed if the server does not send one
+const defaultPrefix = "(qaohv)~&@%+"
+
+// Capabilities used to track channel state
+const (
+	capMultiPrefix = "multi-prefix"
+	capAwayNotify  = "away-notify"
+)
+
+// Numerics used to track channel state
+const (
+	rplNoTopic  = "331"
+	rplTopic    = "332"
+	rplWhoReply = "352"
+	rplNamReply = "353"
+)
+
+type trackedUser struct {
+	nick     string
+	away     bool
+	channels map[string]string // lower case channel name to the user's prefixes in it
+}
+
+type trackedChannel struct {
+	name    string
+	topic   string
+	members map[string]*trackedUser // lower case nick to user
+}
+
+// channelState tracks the channels we are in, and who is in them
+type channelState struct {
+	sync.RWMutex
+	channels map[string]*trackedChannel
+	users    map[string]*trackedUser
+}
+
+func newChannelState() *channelState {
+	s := &channelState{}
+	s.clear()
+
+	return s
+}
+
+func (s *channelState) clear() {
+	s.Lock()
+	s.channels = make(map[string]*trackedChannel)
+	s.users = make(map[string]*trackedUser)
+	s.Unlock()
+}
+
+// addChannel starts tracking a channel we have joined
+func (s *channelState) addChannel(name string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.removeChannelLocked(name)
+	s.channels[strings.ToLower(name)] = &trackedChannel{name: name, members: make(map[string]*trackedUser)}
+}
+
+// removeChannel stops tracking a channel we have left, and any users we no longer share a channel with
+func (s *channelState) removeChannel(name string) {
+	s.Lock()
+	s.removeChannelLocked(name)
+	s.Unlock()
+}
+
+func (s *channelState) removeChannelLocked(name string) {
+	c, ok := s.channels[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+
+	for nick := range c.members {
+		s.partLocked(c, nick)
+	}
+
+	delete(s.channels, strings.ToLower(name))
+}
+
+// join adds a user to a channel, with the given prefixes. If they are already in the channel, their prefixes are
+// replaced
+func (s *channelState) join(channel, nick, prefixes string) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.channels[strings.ToLower(channel)]
+	if !ok {
+		return
+	}
+
+	u, ok := s.users[strings.ToLower(nick)]
+	if !ok {
+		u = &trackedUser{nick: nick, channels: make(map[string]string)}
+		s.users[strings.ToLower(nick)] = u
+	}
+
+	u.channels[strings.ToLower(channel)] = prefixes
+	c.members[strings.ToLower(nick)] = u
+}
+
+func (s *channelState) part(channel, nick string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if c, ok := s.channels[strings.ToLower(channel)]; ok {
+		s.partLocked(c, strings.ToLower(nick))
+	}
+}
+
+func (s *channelState) partLocked(c *trackedChannel, lowerNick string) {
+	u, ok := c.members[lowerNick]
+	if !ok {
+		return
+	}
+
+	delete(c.members, lowerNick)
+	delete(u.channels, strings.ToLower(c.name))
+
+	if len(u.channels) == 0 {
+		delete(s.users, lowerNick)
+	}
+}
+
+func (s *channelState) quit(nick string) {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[strings.ToLower(nick)]
+	if !ok {
+		return
+	}
+
+	for name := range u.channels {
+		delete(s.channels[name].members, strings.ToLower(nick))
+	}
+
+	delete(s.users, strings.ToLower(nick))
+}
+
+func (s *channelState) rename(oldNick, newNick string) {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[strings.ToLower(oldNick)]
+	if !ok {
+		return
+	}
+
+	delete(s.users, strings.ToLower(oldNick))
+	u.nick = newNick
+	s.users[strings.ToLower(newNick)] = u
+
+	for name := range u.channels {
+		c := s.channels[name]
+		delete(c.members, strings.ToLower(oldNick))
+		c.members[strings.ToLower(newNick)] = u
+	}
+}
+
+func (s *channelState) setAway(nick string, away bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if u, ok := s.users[strings.ToLower(nick)]; ok {
+		u.away = away
+	}
+}
+
+// setPrefix adds or removes a prefix for the user in the given channel. order holds all prefixes, highest first
+func (s *channelState) setPrefix(channel, nick string, prefix byte, adding bool, order string) {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[strings.ToLower(nick)]
+	if !ok {
+		return
+	}
+
+	current, ok := u.channels[strings.ToLower(channel)]
+	if !ok {
+		return
+	}
+
+	out := strings.Builder{}
+
+	for idx := 0; idx < len(order); idx++ {
+		has := strings.IndexByte(current, order[idx]) != -1
+		if order[idx] == prefix {
+			has = adding
+		}
+
+		if has {
+			out.WriteByte(order[idx])
+		}
+	}
+
+	u.channels[strings.ToLower(channel)] = out.String()
+}
+
+func (s *channelState) setTopic(channel, topic string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if c, ok := s.channels[strings.ToLower(channel)]; ok {
+		c.topic = topic
+	}
+}
+
+// topic returns the topic of the given channel, and whether or not we are in it
+func (s *channelState) topic(channel string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	c, ok := s.channels[strings.ToLower(channel)]
+	if !ok {
+		return "", false
+	}
+
+	return c.topic, true
+}
+
+// members returns the members of the given channel sorted by nick, or nil if we are not in it
+func (s *channelState) members(channel string) []interfaces.ChannelMember {
+	s.RLock()
+	defer s.RUnlock()
+
+	c, ok := s.channels[strings.ToLower(channel)]
+	if !ok {
+		return nil
+	}
+
+	out := make([]interfaces.ChannelMember, 0, len(c.members))
+	for _, u := range c.members {
+		out = append(out, interfaces.ChannelMember{
+			Nick:   u.nick,
+			Prefix: u.channels[strings.ToLower(channel)],
+			Away:   u.away,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Nick) < strings.ToLower(out[j].Nick) })
+
+	return out
+}
+
+// hasUser returns whether or not the given nick is in any channel we are in
+func (s *channelState) hasUser(nick string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.users[strings.ToLower(nick)]
+
+	return ok
+}
+
+// userChannels returns the names of the channels the given nick is in, sorted
+func (s *channelState) userChannels(nick string) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := []string{}
+
+	if u, ok := s.users[strings.ToLower(nick)]; ok {
+		for name := range u.channels {
+			out = append(out, s.channels[name].name)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// prefixModes returns the channel membership modes, and the matching prefixes, from ISUPPORT. Both are highest first
+func (i *IRC) prefixModes() (modes, prefixes string) {
+	v, ok := i.isupport.get("PREFIX")
+	if !ok {
+		v = defaultPrefix
+	}
+
+	split := strings.SplitN(strings.TrimPrefix(v, "("), ")", 2)
+	if len(split) != 2 || len(split[0]) != len(split[1]) {
+		return "", ""
+	}
+
+	return split[0], split[1]
+}
+
+// splitPrefixes splits the prefixes from the start of a name in a NAMES or WHO reply
+func (i *IRC) splitPrefixes(name string) (string, string) {
+	_, prefixes := i.prefixModes()
+	idx := 0
+
+	for idx < len(name) && strings.IndexByte(prefixes, name[idx]) != -1 {
+		idx++
+	}
+
+	return name[:idx], name[idx:]
+}
+
+// isOurs returns whether or not the given source is us
+func (i *IRC) isOurs(source string) bool {
+	return strings.EqualFold(i.HumanReadableSource(source), i.runtimeNick.Get())
+}
+
+// setupChannelState attaches the handlers that maintain channel state. They run at the lowest priority so that hooks
+// on events see the state from before the event, for example the channels a user was in before they quit
+func (i *IRC) setupChannelState() {
+	i.RawEvents.Attach("JOIN", i.stateOnJoin, event.PriLowest)
+	i.RawEvents.Attach("PART", i.stateOnPart, event.PriLowest)
+	i.RawEvents.Attach("KICK", i.stateOnKick, event.PriLowest)
+	i.RawEvents.Attach("QUIT", i.stateOnQuit, event.PriLowest)
+	i.RawEvents.Attach("NICK", i.stateOnNick, event.PriLowest)
+	i.RawEvents.Attach("MODE", i.stateOnMode, event.PriLowest)
+	i.RawEvents.Attach("AWAY", i.stateOnAway, event.PriLowest)
+	i.RawEvents.Attach(rplNamReply, i.stateOnNames, event.PriLowest)
+	i.RawEvents.Attach(rplWhoReply, i.stateOnWho, event.PriLowest)
+	i.RawEvents.Attach("TOPIC", i.stateOnTopic, event.PriLowest)
+	i.RawEvents.Attach(rplTopic, i.stateOnTopic, event.PriLowest)
+	i.RawEvents.Attach(rplNoTopic, i.stateOnTopic, event.PriLowest)
+}
+
+func (i *IRC) stateOnJoin(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil {
+		return
+	}
+
+	channel := util.IdxOrEmpty(raw.Line.Params, 0)
+
+	if i.isOurs(raw.Line.Prefix) {
+		i.channelState.addChannel(channel)
+
+		// NAMES is sent automatically, WHO gets us away status as well
+		i.queueLine(priorityNormal, queuedLine{raw: "WHO " + channel})
+	}
+
+	i.channelState.join(channel, i.HumanReadableSource(raw.Line.Prefix), "")
+}
+
+func (i *IRC) stateOnPart(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil {
+		return
+	}
+
+	i.stateOnLeave(util.IdxOrEmpty(raw.Line.Params, 0), raw.Line.Prefix)
+}
+
+func (i *IRC) stateOnKick(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil {
+		return
+	}
+
+	i.stateOnLeave(util.IdxOrEmpty(raw.Line.Params, 0), util.IdxOrEmpty(raw.Line.Params, 1))
+}
+
+// stateOnLeave updates channel state when source leaves channel. The accounts of any users we no longer share a
+// channel with are forgotten, as we would not see them change nick or log out, and someone else could take the nick
+func (i *IRC) stateOnLeave(channel, source string) {
+	if i.isOurs(source) {
+		i.channelState.removeChannel(channel)
+		i.accounts.prune(i.channelState.hasUser)
+
+		return
+	}
+
+	nick := i.HumanReadableSource(source)
+	i.channelState.part(channel, nick)
+
+	if !i.channelState.hasUser(nick) {
+		i.accounts.set(nick, "")
+	}
+}
+
+func (i *IRC) stateOnQuit(e event.Event) {
+	if raw := event2RawEvent(e); raw != nil {
+		i.channelState.quit(i.HumanReadableSource(raw.Line.Prefix))
+	}
+}
+
+func (i *IRC) stateOnNick(e event.Event) {
+	if raw := event2RawEvent(e); raw != nil {
+		i.channelState.rename(i.HumanReadableSource(raw.Line.Prefix), util.IdxOrEmpty(raw.Line.Params, 0))
+	}
+}
+
+func (i *IRC) stateOnAway(e event.Event) {
+	if raw := event2RawEvent(e); raw != nil {
+		i.channelState.setAway(i.HumanReadableSource(raw.Line.Prefix), len(raw.Line.Params) > 0)
+	}
+}
+
+func (i *IRC) stateOnMode(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 2 {
+		return
+	}
+
+	modes, prefixes := i.prefixModes()
+
+	for _, change := range i.parseModes(raw.Line.Params[1], raw.Line.Params[2:]) {
+		if idx := strings.Index(modes, change.Mode); idx != -1 {
+			i.channelState.setPrefix(raw.Line.Params[0], change.Arg, prefixes[idx], change.Adding, prefixes)
+		}
+	}
+}
+
+// stateOnTopic handles TOPIC, and the topic numerics, which have our nick before the channel
+func (i *IRC) stateOnTopic(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil {
+		return
+	}
+
+	params := raw.Line.Params
+	if raw.Line.Command != "TOPIC" && len(params) > 0 {
+		params = params[1:]
+	}
+
+	topic := util.IdxOrEmpty(params, 1)
+	if raw.Line.Command == rplNoTopic {
+		topic = ""
+	}
+
+	i.channelState.setTopic(util.IdxOrEmpty(params, 0), topic)
+}
+
+// stateOnNames handles NAMES replies, which look like "<us> <symbol> <channel> :<prefixes><nick>[!user@host] ..."
+func (i *IRC) stateOnNames(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 4 {
+		return
+	}
+
+	for _, name := range strings.Fields(raw.Line.Params[3]) {
+		prefixes, source := i.splitPrefixes(name)
+		i.channelState.join(raw.Line.Params[2], i.HumanReadableSource(source), prefixes)
+	}
+}
+
+// stateOnWho handles WHO replies, which look like
+// "<us> <channel> <user> <host> <server> <nick> <flags> :<hops> <gecos>"
+func (i *IRC) stateOnWho(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) < 7 {
+		return
+	}
+
+	i.channelState.setAway(raw.Line.Params[5], strings.HasPrefix(raw.Line.Params[6], "G"))
+}
+
+// ChannelMembers returns the members of the given channel, sorted by nick, or nil if we are not in it
+func (i *IRC) ChannelMembers(channel string) []interfaces.ChannelMember {
+	return i.channelState.members(channel)
+}
+
+// UserChannels returns the channels we share with the given source
+func (i *IRC) UserChannels(source string) []string {
+	return i.channelState.userChannels(i.HumanReadableSource(source))
+}
+
+// SetTopic sets the topic of the given channel, unless it is already set to the same thing. Topics are truncated to
+// fit within the server's TOPICLEN, and newlines are replaced with spaces
+func (i *IRC) SetTopic(channel, topic string) {
+	limit := i.messageLimit("TOPIC", channel)
+
+	topicLen, _ := i.isupport.get("TOPICLEN")
+	if max, err := strconv.Atoi(topicLen); err == nil && max > 0 && max < limit {
+		limit = max
+	}
+
+	topic = splitMessage(strings.ReplaceAll(topic, "\n", " "), limit)[0]
+	if current, ok := i.channelState.topic(channel); ok && current == topic {
+		return
+	}
+
+	i.queueLine(priorityNormal, queuedLine{command: "TOPIC", target: channel, message: topic, limit: limit})
+}
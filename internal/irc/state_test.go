@@ -0,0 +1,252 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+)
+
+func TestIRC_ChannelMembers(t *testing.T) {
+	join := []string{
+		":bot!b@c JOIN #chan",
+		":server 353 bot = #chan :@bot +voiced @+opped plain",
+		":server 366 bot #chan :End of /NAMES list.",
+	}
+
+	tests := []struct {
+		name    string
+		caps    []string
+		lines   []string
+		channel string
+		want    []interfaces.ChannelMember
+	}{
+		{name: "not joined", lines: []string{":other!b@c JOIN #chan"}, channel: "#chan"},
+		{
+			name:    "names",
+			lines:   join,
+			channel: "#CHAN",
+			want: []interfaces.ChannelMember{
+				{Nick: "bot", Prefix: "@"},
+				{Nick: "opped", Prefix: "@+"},
+				{Nick: "plain"},
+				{Nick: "voiced", Prefix: "+"},
+			},
+		},
+		{
+			name:    "userhost-in-names",
+			lines:   []string{":bot!b@c JOIN #chan", ":server 353 bot = #chan :@bot!b@c +a!c@c"},
+			channel: "#chan",
+			want:    []interfaces.ChannelMember{{Nick: "a", Prefix: "+"}, {Nick: "bot", Prefix: "@"}},
+		},
+		{
+			name: "join part kick quit",
+			lines: append(join,
+				":new!b@c JOIN #chan", ":plain!b@c PART #chan :bye", ":bot!b@c KICK #chan voiced :out",
+				":opped!b@c QUIT :gone",
+			),
+			channel: "#chan",
+			want:    []interfaces.ChannelMember{{Nick: "bot", Prefix: "@"}, {Nick: "new"}},
+		},
+		{
+			name:    "nick",
+			lines:   append(join, ":plain!b@c NICK renamed", ":bot!b@c PART #chan"),
+			channel: "#chan",
+		},
+		{
+			name:    "rename",
+			lines:   []string{":bot!b@c JOIN #chan", ":server 353 bot = #chan :@bot plain", ":plain!b@c NICK Renamed"},
+			channel: "#chan",
+			want:    []interfaces.ChannelMember{{Nick: "bot", Prefix: "@"}, {Nick: "Renamed"}},
+		},
+		{
+			name: "modes",
+			lines: append(join,
+				":bot!b@c MODE #chan +vo-o+kl plain voiced opped key 10",
+				":bot!b@c MODE #chan -bv+b *!*@* opped *!*@c",
+			),
+			channel: "#chan",
+			want: []interfaces.ChannelMember{
+				{Nick: "bot", Prefix: "@"},
+				{Nick: "opped"},
+				{Nick: "plain", Prefix: "+"},
+				{Nick: "voiced", Prefix: "@+"},
+			},
+		},
+		{
+			name: "custom prefixes",
+			lines: []string{
+				":server 005 bot PREFIX=(Yov)!@+ :are supported by this server",
+				":bot!b@c JOIN #chan", ":server 353 bot = #chan :!bot plain", ":bot!b@c MODE #chan +Y plain",
+			},
+			channel: "#chan",
+			want:    []interfaces.ChannelMember{{Nick: "bot", Prefix: "!"}, {Nick: "plain", Prefix: "!"}},
+		},
+		{
+			name: "away",
+			caps: []string{capAwayNotify},
+			lines: append(join,
+				":server 352 bot #chan b c server voiced G :0 gecos",
+				":server 352 bot #chan b c server plain H@ :0 gecos",
+				":plain!b@c AWAY :busy",
+				":voiced!b@c AWAY",
+			),
+			channel: "#chan",
+			want: []interfaces.ChannelMember{
+				{Nick: "bot", Prefix: "@"},
+				{Nick: "opped", Prefix: "@+"},
+				{Nick: "plain", Away: true},
+				{Nick: "voiced", Prefix: "+"},
+			},
+		},
+		{name: "own part", lines: append(join, ":bot!b@c PART #chan"), channel: "#chan"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{Nick: "bot"}, tt.caps...)
+			i.runtimeNick.Set("bot")
+
+			feedLines(t, i, tt.lines...)
+
+			if got := i.ChannelMembers(tt.channel); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChannelMembers(%q) = %+v, want %+v", tt.channel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_UserChannels(t *testing.T) {
+	i := newTestIRC(t, &Conf{Nick: "bot"})
+	i.runtimeNick.Set("bot")
+
+	var onQuit, onNick []string
+
+	i.HookQuit(func(source, _ string) { onQuit = i.UserChannels(source) })
+	i.HookNick(func(source, _ string) { onNick = i.UserChannels(source) })
+
+	feedLines(t, i,
+		":bot!b@c JOIN #one", ":bot!b@c JOIN #two", ":bot!b@c JOIN #three",
+		":a!b@c JOIN #two", ":a!b@c JOIN #one", ":other!b@c JOIN #three",
+	)
+
+	if got, want := i.UserChannels("a!b@c"), []string{"#one", "#two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UserChannels() = %q, want %q", got, want)
+	}
+
+	if got := i.UserChannels("unknown"); got == nil || len(got) != 0 {
+		t.Errorf("UserChannels() for an unknown user = %#v, want an empty slice", got)
+	}
+
+	feedLines(t, i, ":a!b@c NICK d", ":d!b@c QUIT :bye")
+
+	// Hooks should see the channels the user was in before the event
+	for _, hook := range []struct {
+		name string
+		got  []string
+	}{{"quit", onQuit}, {"nick", onNick}} {
+		if want := []string{"#one", "#two"}; !reflect.DeepEqual(hook.got, want) {
+			t.Errorf("channels seen by %s hook = %q, want %q", hook.name, hook.got, want)
+		}
+	}
+
+	if got := i.UserChannels("d"); len(got) != 0 {
+		t.Errorf("UserChannels() after quit = %q, want none", got)
+	}
+}
+
+func TestIRC_parseModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		modes string
+		args  []string
+		want  []interfaces.ModeChange
+	}{
+		{
+			name:  "simple",
+			modes: "+nt",
+			want:  []interfaces.ModeChange{{Adding: true, Mode: "n"}, {Adding: true, Mode: "t"}},
+		},
+		{
+			name:  "params",
+			modes: "+kl-l+b-k",
+			args:  []string{"key", "10", "*!*@*", "key"},
+			want: []interfaces.ModeChange{
+				{Adding: true, Mode: "k", Arg: "key"},
+				{Adding: true, Mode: "l", Arg: "10"},
+				{Mode: "l"},
+				{Adding: true, Mode: "b", Arg: "*!*@*"},
+				{Mode: "k", Arg: "key"},
+			},
+		},
+		{
+			name:  "prefixes",
+			modes: "-o+v",
+			args:  []string{"a", "b"},
+			want:  []interfaces.ModeChange{{Mode: "o", Arg: "a"}, {Adding: true, Mode: "v", Arg: "b"}},
+		},
+		{name: "missing args", modes: "+b", want: []interfaces.ModeChange{{Adding: true, Mode: "b"}}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{})
+
+			if got := i.parseModes(tt.modes, tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseModes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_SetTopic(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		topic string
+		want  []string
+	}{
+		{name: "not joined", topic: "hello", want: []string{"TOPIC #chan hello"}},
+		{name: "formatted", topic: "$bhello$b\nworld", want: []string{"TOPIC #chan :\x02hello\x02 world"}},
+		{
+			name:  "same topic",
+			lines: []string{":bot!b@c JOIN #chan", ":server 332 bot #chan :same topic"},
+			topic: "same topic",
+		},
+		{
+			name:  "changed topic",
+			lines: []string{":bot!b@c JOIN #chan", ":server 332 bot #chan :same topic", ":a!c@c TOPIC #chan :new"},
+			topic: "same topic",
+			want:  []string{"TOPIC #chan :same topic"},
+		},
+		{
+			name:  "no topic",
+			lines: []string{":bot!b@c JOIN #chan", ":server 331 bot #chan :No topic is set"},
+			topic: "",
+		},
+		{
+			name:  "TOPICLEN",
+			lines: []string{":server 005 bot TOPICLEN=10 :are supported by this server"},
+			topic: "a long topic that needs truncating",
+			want:  []string{"TOPIC #chan :a long"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{Nick: "bot"})
+			i.runtimeNick.Set("bot")
+			feedLines(t, i, tt.lines...)
+
+			sent, disconnect := connectTestIRC(i)
+
+			defer disconnect()
+
+			i.SetTopic("#chan", tt.topic)
+			expectLines(t, sent, tt.want...)
+		})
+	}
+}
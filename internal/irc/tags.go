@@ -0,0 +1,269 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goshuirc/irc-go/ircmsg"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// IRCv3 capabilities used for message tags, echoes, labels, and batches
+const (
+	capMessageTags     = "message-tags"
+	capEchoMessage     = "echo-message"
+	capLabeledResponse = "labeled-response"
+	capBatch           = "batch"
+)
+
+// Message tags we use
+const (
+	tagMsgID = "msgid"
+	tagReply = "+draft/reply"
+	tagLabel = "label"
+	tagBatch = "batch"
+)
+
+// batchChatHistory is the type of batches used to play back history, which should not be handled as new messages
+const batchChatHistory = "chathistory"
+
+func (i *IRC) setupTags() {
+	i.RawEvents.Attach("BATCH", i.onBatch, event.PriHighest)
+	i.RawEvents.Attach("*", i.onLabeledResponse, event.PriNorm)
+}
+
+// capEnabled returns whether or not the named capability is enabled, and is safe to use before connecting
+func (i *IRC) capEnabled(name string) bool {
+	return i.capabilityManager != nil && i.capabilityManager.capEnabled(name)
+}
+
+// batch is an open IRCv3 batch
+type batch struct {
+	typ   string
+	label string // description of the labelled line that started this batch, if any
+}
+
+// batchTracker tracks currently open batches by their reference tags
+type batchTracker struct {
+	sync.Mutex
+	batches map[string]batch
+}
+
+func newBatchTracker() *batchTracker {
+	return &batchTracker{batches: make(map[string]batch)}
+}
+
+func (b *batchTracker) get(ref string) batch {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.batches[ref]
+}
+
+func (b *batchTracker) clear() {
+	b.Lock()
+	b.batches = make(map[string]batch)
+	b.Unlock()
+}
+
+// batchOf returns the batch the given line is a part of
+func (i *IRC) batchOf(line ircmsg.IrcMessage) batch {
+	ok, ref := line.GetTag(tagBatch)
+	if !ok {
+		return batch{}
+	}
+
+	return i.batches.get(ref)
+}
+
+func (i *IRC) onBatch(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || len(raw.Line.Params) == 0 || len(raw.Line.Params[0]) < 2 {
+		return
+	}
+
+	ref := raw.Line.Params[0][1:]
+
+	i.batches.Lock()
+	defer i.batches.Unlock()
+
+	if raw.Line.Params[0][0] == '-' {
+		delete(i.batches.batches, ref)
+		return
+	}
+
+	b := batch{typ: util.IdxOrEmpty(raw.Line.Params, 1)}
+	if ok, label := raw.Line.GetTag(tagLabel); ok {
+		b.label, _ = i.labels.resolve(label)
+	}
+
+	i.batches.batches[ref] = b
+}
+
+// labelTimeout is how long we wait for a response to a labelled line before forgetting about it
+const labelTimeout = time.Minute
+
+type pendingLabel struct {
+	desc string
+	sent time.Time
+}
+
+// labelTracker tracks the labels we have sent and not yet had a response to
+type labelTracker struct {
+	sync.Mutex
+	next    uint64
+	pending map[string]pendingLabel
+}
+
+func newLabelTracker() *labelTracker {
+	return &labelTracker{pending: make(map[string]pendingLabel)}
+}
+
+// add creates a new label for a line with the given description
+func (l *labelTracker) add(desc string) string {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+
+	for label, p := range l.pending {
+		if now.Sub(p.sent) > labelTimeout {
+			delete(l.pending, label)
+		}
+	}
+
+	l.next++
+	label := "gggb" + strconv.FormatUint(l.next, 36)
+	l.pending[label] = pendingLabel{desc: desc, sent: now}
+
+	return label
+}
+
+// resolve removes the given label, and returns the description of the line it was sent with
+func (l *labelTracker) resolve(label string) (string, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	p, ok := l.pending[label]
+	delete(l.pending, label)
+
+	return p.desc, ok
+}
+
+// isErrorReply returns whether or not the given line is the server reporting an error
+func isErrorReply(line ircmsg.IrcMessage) bool {
+	if line.Command == "FAIL" {
+		return true
+	}
+
+	n, err := strconv.Atoi(line.Command)
+
+	return err == nil && len(line.Command) == 3 && n >= 400 && n < 600
+}
+
+// onLabeledResponse matches responses to the lines we labelled, and reports any errors in response to them
+func (i *IRC) onLabeledResponse(e event.Event) {
+	raw := event2RawEvent(e)
+	if raw == nil || raw.Line.Command == "BATCH" {
+		return
+	}
+
+	var desc string
+	if ok, label := raw.Line.GetTag(tagLabel); ok {
+		if desc, ok = i.labels.resolve(label); !ok {
+			return
+		}
+	} else if desc = i.batchOf(raw.Line).label; desc == "" {
+		return
+	}
+
+	if isErrorReply(raw.Line) {
+		i.log.Warnf("server rejected %s: %s", desc, strings.Join(raw.Line.Params, " "))
+	}
+}
+
+type recentMessage struct {
+	source  string
+	message string
+}
+
+// recentMessages holds the last few messages we have seen that had IDs, so that replies to them can be resolved
+type recentMessages struct {
+	sync.Mutex
+	order    []string
+	messages map[string]recentMessage
+}
+
+const maxRecentMessages = 100
+
+func newRecentMessages() *recentMessages {
+	return &recentMessages{messages: make(map[string]recentMessage)}
+}
+
+func (r *recentMessages) add(id, source, message string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, exists := r.messages[id]; exists {
+		return
+	}
+
+	if len(r.order) >= maxRecentMessages {
+		delete(r.messages, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	r.order = append(r.order, id)
+	r.messages[id] = recentMessage{source: source, message: message}
+}
+
+// get returns the source and message of the message with the given ID
+func (r *recentMessages) get(id string) (string, string) {
+	r.Lock()
+	defer r.Unlock()
+
+	m := r.messages[id]
+
+	return m.source, m.message
+}
+
+// messageMeta builds the MessageMeta for the given event
+func (i *IRC) messageMeta(msg *MessageEvent) interfaces.MessageMeta {
+	out := interfaces.MessageMeta{ID: msg.MsgID, Time: msg.Time, ReplyTo: msg.ReplyTo}
+	if msg.ReplyTo != "" {
+		out.ReplyToSource, out.ReplyToMessage = i.recent.get(msg.ReplyTo)
+	}
+
+	return out
+}
+
+// SendReply sends a message to the given target as a reply to the message with the given ID. The reply is only
+// threaded if the server supports message-tags, otherwise it is sent as a normal message
+func (i *IRC) SendReply(target, replyTo, message string) {
+	tags := make(map[string]string)
+	if replyTo != "" && i.capEnabled(capMessageTags) {
+		tags[tagReply] = replyTo
+	}
+
+	i.queueTaggedMessage(priorityNormal, "PRIVMSG", target, message, tags)
+}
+
+// lineTags returns a copy of the given tags, with a label added if labeled-response is enabled
+func (i *IRC) lineTags(tags map[string]string, command, target string) map[string]string {
+	out := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		out[k] = v
+	}
+
+	if i.capEnabled(capLabeledResponse) {
+		out[tagLabel] = i.labels.add(fmt.Sprintf("%s to %s", command, target))
+	}
+
+	return out
+}
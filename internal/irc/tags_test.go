@@ -0,0 +1,194 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/goshuirc/irc-go/ircmsg"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+)
+
+func TestIRC_HookMessageMeta(t *testing.T) {
+	serverTime := time.Date(2020, 10, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		caps  []string
+		lines []string
+		want  []interfaces.MessageMeta
+	}{
+		{
+			name:  "no tags",
+			lines: []string{":a!b@c PRIVMSG #chan :hi"},
+			want:  []interfaces.MessageMeta{{}},
+		},
+		{
+			name:  "msgid and server-time",
+			caps:  []string{capMessageTags, "server-time"},
+			lines: []string{"@msgid=abc;time=2020-10-01T12:30:00.000Z :a!b@c PRIVMSG #chan :hi"},
+			want:  []interfaces.MessageMeta{{ID: "abc", Time: serverTime}},
+		},
+		{
+			name: "reply",
+			caps: []string{capMessageTags},
+			lines: []string{
+				"@msgid=abc :a!c@c PRIVMSG #chan :$ hello",
+				"@msgid=def;+draft/reply=abc :d!e@f PRIVMSG #chan :\x02hi\x02",
+			},
+			want: []interfaces.MessageMeta{
+				{ID: "abc"},
+				{ID: "def", ReplyTo: "abc", ReplyToSource: "a!c@c", ReplyToMessage: "$$ hello"},
+			},
+		},
+		{
+			name:  "reply to unknown message",
+			caps:  []string{capMessageTags},
+			lines: []string{"@msgid=def;+draft/reply=abc :d!e@f PRIVMSG #chan :hi"},
+			want:  []interfaces.MessageMeta{{ID: "def", ReplyTo: "abc"}},
+		},
+		{
+			name:  "echo",
+			caps:  []string{capEchoMessage},
+			lines: []string{":bot!b@c PRIVMSG #chan :hi", ":a!b@c PRIVMSG #chan :hi"},
+			want:  []interfaces.MessageMeta{{}},
+		},
+		{
+			name:  "own message without echo-message",
+			lines: []string{":bot!b@c PRIVMSG #chan :hi"},
+			want:  []interfaces.MessageMeta{{}},
+		},
+		{
+			name: "chathistory batch",
+			caps: []string{capBatch, capMessageTags},
+			lines: []string{
+				":server BATCH +1 chathistory #chan",
+				"@batch=1;msgid=old :a!b@c PRIVMSG #chan :old",
+				":server BATCH -1",
+				"@batch=1;msgid=new :a!b@c PRIVMSG #chan :new",
+			},
+			want: []interfaces.MessageMeta{{ID: "new"}},
+		},
+		{
+			name: "other batch",
+			caps: []string{capBatch},
+			lines: []string{
+				":server BATCH +1 draft/multiline #chan",
+				"@batch=1 :a!b@c PRIVMSG #chan :hi",
+			},
+			want: []interfaces.MessageMeta{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{Nick: "bot"}, tt.caps...)
+			i.runtimeNick.Set("bot")
+
+			var got []interfaces.MessageMeta
+
+			i.HookMessageMeta(func(_, _, _ string, _ bool, meta interfaces.MessageMeta) {
+				if !meta.Time.Equal(serverTime) {
+					meta.Time = time.Time{}
+				}
+
+				got = append(got, meta)
+			})
+
+			feedLines(t, i, tt.lines...)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got meta %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIRC_SendReply(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []string
+		want string
+	}{
+		{name: "no message-tags", want: "PRIVMSG #chan reply"},
+		{name: "message-tags", caps: []string{capMessageTags}, want: "@+draft/reply=abc PRIVMSG #chan reply"},
+		{
+			name: "labeled-response",
+			caps: []string{capMessageTags, capLabeledResponse},
+			want: "@label=gggb1;+draft/reply=abc PRIVMSG #chan reply",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{}, tt.caps...)
+			sent, disconnect := connectTestIRC(i)
+
+			defer disconnect()
+
+			i.SendReply("#chan", "abc", "reply")
+			expectLines(t, sent, tt.want)
+		})
+	}
+}
+
+func TestIRC_onLabeledResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		wantPending bool
+	}{
+		{name: "no response", wantPending: true},
+		{name: "echo", lines: []string{"@label=gggb1 :bot!b@c PRIVMSG #chan :hi"}},
+		{name: "error", lines: []string{"@label=gggb1 :server 404 bot #chan :Cannot send to channel"}},
+		{name: "other label", lines: []string{"@label=other :server ACK"}, wantPending: true},
+		{
+			name:  "batch",
+			lines: []string{"@label=gggb1 :server BATCH +x labeled-response", "@batch=x :server FAIL PRIVMSG X"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIRC(t, &Conf{}, capBatch, capLabeledResponse)
+
+			if label := i.labels.add("PRIVMSG to #chan"); label != "gggb1" {
+				t.Fatalf("first label = %q, want gggb1", label)
+			}
+
+			feedLines(t, i, tt.lines...)
+
+			if _, pending := i.labels.pending["gggb1"]; pending != tt.wantPending {
+				t.Errorf("label pending = %t, want %t", pending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func Test_isErrorReply(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: ":server 404 bot #chan :Cannot send to channel", want: true},
+		{line: ":server FAIL PRIVMSG UNKNOWN :nope", want: true},
+		{line: ":server 001 bot :Welcome"},
+		{line: ":server ACK"},
+		{line: ":server 4040 bot :not a numeric"},
+	}
+
+	for _, tt := range tests {
+		line, err := ircmsg.ParseLine(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := isErrorReply(line); got != tt.want {
+			t.Errorf("isErrorReply(%q) = %t, want %t", tt.line, got, tt.want)
+		}
+	}
+}
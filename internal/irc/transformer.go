@@ -71,10 +71,15 @@ func (Transformer) Transform(in string) string {
 	return tokeniser.Map(
 		in,
 		ircFmtMapping,
-		func(c color.Color) string { return fmt.Sprintf("%c%02d", colour, ircPalette.Index(c)) },
+		ircColour,
 	)
 }
 
+// ircColour returns the IRC colour code for the closest colour in the IRC palette to the given colour
+func ircColour(c color.Color) string {
+	return fmt.Sprintf("%c%02d", colour, ircPalette.Index(c))
+}
+
 // MakeIntermediate implements Transformer.MakeIntermediate
 func (Transformer) MakeIntermediate(in string) string {
 	out := strings.Builder{}
@@ -0,0 +1,2 @@
+// Package matrix contains a Bot implementation that works over the Matrix client-server API
+package matrix
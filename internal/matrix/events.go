@@ -0,0 +1,141 @@
+package matrix
+
+import (
+	"encoding/json"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+)
+
+// Event types we handle
+const (
+	eventMessage     = "m.room.message"
+	eventMember      = "m.room.member"
+	eventTopic       = "m.room.topic"
+	eventPowerLevels = "m.room.power_levels"
+)
+
+// Message types for m.room.message
+const (
+	msgText   = "m.text"
+	msgEmote  = "m.emote"
+	msgNotice = "m.notice"
+)
+
+// Room memberships
+const (
+	membershipJoin   = "join"
+	membershipLeave  = "leave"
+	membershipBan    = "ban"
+	membershipInvite = "invite"
+)
+
+const formatHTML = "org.matrix.custom.html"
+
+// Event represents a single event in a room, as sent by the client-server API
+type Event struct {
+	Type      string          `json:"type"`
+	Sender    string          `json:"sender"`
+	StateKey  *string         `json:"state_key,omitempty"`
+	Content   json.RawMessage `json:"content"`
+	EventID   string          `json:"event_id"`
+	Timestamp int64           `json:"origin_server_ts"`
+}
+
+// stateKey returns the event's state key, or an empty string if it is not a state event
+func (e *Event) stateKey() string {
+	if e.StateKey == nil {
+		return ""
+	}
+
+	return *e.StateKey
+}
+
+// MessageContent is the content of an m.room.message event
+type MessageContent struct {
+	MsgType       string     `json:"msgtype"`
+	Body          string     `json:"body"`
+	Format        string     `json:"format,omitempty"`
+	FormattedBody string     `json:"formatted_body,omitempty"`
+	RelatesTo     *relatesTo `json:"m.relates_to,omitempty"`
+}
+
+type relatesTo struct {
+	InReplyTo *struct {
+		EventID string `json:"event_id"`
+	} `json:"m.in_reply_to,omitempty"`
+}
+
+// isReply returns whether or not the message is a reply to another message
+func (m *MessageContent) isReply() bool {
+	return m.RelatesTo != nil && m.RelatesTo.InReplyTo != nil
+}
+
+// MemberContent is the content of an m.room.member event
+type MemberContent struct {
+	Membership  string `json:"membership"`
+	DisplayName string `json:"displayname"`
+	Reason      string `json:"reason"`
+	IsDirect    bool   `json:"is_direct"`
+}
+
+// TopicContent is the content of an m.room.topic event
+type TopicContent struct {
+	Topic string `json:"topic"`
+}
+
+// PowerLevelsContent is the content of an m.room.power_levels event
+type PowerLevelsContent struct {
+	Users        map[string]int `json:"users"`
+	UsersDefault int            `json:"users_default"`
+}
+
+type roomEvents struct {
+	Events []*Event `json:"events"`
+}
+
+type joinedRoom struct {
+	State    roomEvents `json:"state"`
+	Timeline roomEvents `json:"timeline"`
+}
+
+type invitedRoom struct {
+	InviteState roomEvents `json:"invite_state"`
+}
+
+// syncResponse is the response to a /sync request
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join   map[string]joinedRoom  `json:"join"`
+		Invite map[string]invitedRoom `json:"invite"`
+		Leave  map[string]struct{}    `json:"leave"`
+	} `json:"rooms"`
+}
+
+// RoomEvent represents an incoming room event that needs to be handled. It is dispatched under the event's type
+type RoomEvent struct {
+	event.BaseEvent
+	RoomID string
+	Event  *Event
+	Time   time.Time
+}
+
+// NewRoomEvent creates a RoomEvent for the given event in the given room
+func NewRoomEvent(roomID string, ev *Event) *RoomEvent {
+	return &RoomEvent{
+		BaseEvent: event.BaseEvent{Name_: ev.Type},
+		RoomID:    roomID,
+		Event:     ev,
+		Time:      time.Unix(0, ev.Timestamp*int64(time.Millisecond)),
+	}
+}
+
+func event2RoomEvent(e event.Event) *RoomEvent {
+	r, ok := e.(*RoomEvent)
+	if !ok {
+		return nil
+	}
+
+	return r
+}
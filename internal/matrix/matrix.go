@@ -0,0 +1,467 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+	"awesome-dragon.science/go/goGoGameBot/pkg/mutexTypes"
+)
+
+// Various Errors
+var (
+	ErrAlreadyConnected = errors.New("matrix is already connected")
+	ErrNotConnected     = errors.New("cannot send a message when not connected")
+)
+
+const (
+	defaultSyncTimeout = time.Second * 30
+	// requestTimeout is how much longer than the sync timeout a request can take before it is given up on
+	requestTimeout = time.Second * 30
+)
+
+// Admin holds a user ID or power level and the admin level that it grants
+type Admin struct {
+	User       string `toml:"user" comment:"User ID that is granted this level"`
+	PowerLevel int    `toml:"power_level" comment:"Users with at least this power level in a joined room are granted this level"` //nolint:lll // Cant be made shorter
+	Level      int    `toml:"level"`
+}
+
+// Conf holds the configuration for a Matrix instance
+type Conf struct {
+	Homeserver  string `toml:"homeserver" comment:"Base URL of the homeserver, eg https://matrix.org"`
+	AccessToken string `toml:"access_token" comment:"Access token to authenticate with"`
+	CmdPfx      string `toml:"command_prefix" default:"~" comment:"Command prefix to respond to (default: '~')"`
+
+	Admins        []Admin  `toml:"admins"`
+	AdminChannels []string `toml:"admin_channels" comment:"Room IDs or aliases to send admin messages to"`
+
+	SyncTimeout int `toml:"sync_timeout" comment:"Seconds the homeserver can wait for new events before answering a sync (default 30)"` //nolint:lll // Cant be made shorter
+}
+
+// Matrix represents a connection to a Matrix homeserver
+type Matrix struct {
+	*Conf
+	channels      mutexTypes.StringSlice
+	Connected     mutexTypes.Bool
+	StopRequested mutexTypes.Bool
+	userID        mutexTypes.String
+	since         mutexTypes.String
+	lag           mutexTypes.Duration
+	ctx           context.Context
+	cancel        context.CancelFunc
+	ctxMutex      sync.Mutex
+	started       time.Time
+	txnID         int64
+	http          *http.Client
+	state         *state
+	log           *log.Logger
+	Events        *event.Manager
+}
+
+// New creates a new Matrix instance ready for use
+func New(conf tomlconf.ConfigHolder, logger *log.Logger) (*Matrix, error) {
+	out := &Matrix{
+		log:     logger,
+		Events:  new(event.Manager),
+		http:    new(http.Client),
+		state:   newState(),
+		started: time.Now(),
+		ctx:     context.Background(),
+		cancel:  func() {},
+	}
+
+	if err := out.Reload(conf.RealConf); err != nil {
+		return nil, err
+	}
+
+	out.setupParsers()
+
+	return out, nil
+}
+
+func (m *Matrix) setupParsers() {
+	// These are run last so that hooks can still see the state from before the change
+	for _, typ := range []string{eventMember, eventPowerLevels, eventTopic} {
+		m.Events.Attach(typ, m.onStateEvent, event.PriLowest)
+	}
+}
+
+func (m *Matrix) syncTimeout() time.Duration {
+	if m.SyncTimeout <= 0 {
+		return defaultSyncTimeout
+	}
+
+	return time.Second * time.Duration(m.SyncTimeout)
+}
+
+// context returns the context for the current connection, which is cancelled on Disconnect
+func (m *Matrix) context() context.Context {
+	m.ctxMutex.Lock()
+	defer m.ctxMutex.Unlock()
+
+	return m.ctx
+}
+
+// Connect authenticates with the homeserver, joins our channels, and fetches their current state. It returns once
+// the initial sync is complete
+func (m *Matrix) Connect() error {
+	if m.Connected.Get() {
+		return fmt.Errorf("already connected to Matrix: %w", ErrAlreadyConnected)
+	}
+
+	m.log.Infof("Starting Matrix connection to %s", m.Homeserver)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.ctxMutex.Lock()
+	m.ctx, m.cancel = ctx, cancel
+	m.ctxMutex.Unlock()
+
+	userID, err := m.whoami(ctx)
+	if err != nil {
+		return fmt.Errorf("Matrix.Connect(): could not authenticate: %w", err)
+	}
+
+	m.userID.Set(userID)
+	m.since.Set("")
+	m.state.clear()
+	m.Connected.Set(true)
+
+	for _, c := range m.channels.Get() {
+		m.join(ctx, c)
+	}
+
+	res, err := m.sync(ctx, "", 0, initialFilter)
+	if err != nil {
+		return fmt.Errorf("Matrix.Connect(): initial sync failed: %w", err)
+	}
+
+	m.handleSync(res, false)
+	m.log.Infof("Logged in as %s", userID)
+
+	return nil
+}
+
+// join joins the given channel, and records its room ID
+func (m *Matrix) join(ctx context.Context, channel string) {
+	id, err := m.joinRoom(ctx, channel)
+	if err != nil {
+		m.log.Warnf("could not join %q: %s", channel, err)
+		return
+	}
+
+	m.state.setRoomID(channel, id)
+}
+
+// Disconnect stops syncing with the homeserver. Matrix has no concept of a quit message, so msg is only logged
+func (m *Matrix) Disconnect(msg string) {
+	m.log.Infof("Disconnecting: %s", msg)
+	m.StopRequested.Set(true)
+
+	m.ctxMutex.Lock()
+	m.cancel()
+	m.ctxMutex.Unlock()
+}
+
+// Run connects the bot and syncs with the homeserver until it disconnects
+func (m *Matrix) Run() error {
+	m.StopRequested.Set(false)
+
+	if err := m.Connect(); err != nil {
+		if !errors.Is(err, ErrAlreadyConnected) {
+			m.Connected.Set(false)
+		}
+
+		return err
+	}
+
+	defer func() {
+		m.lag.Set(0)
+		m.Connected.Set(false)
+	}()
+
+	ctx := m.context()
+
+	for {
+		res, err := m.sync(ctx, m.since.Get(), m.syncTimeout(), "")
+
+		switch {
+		case m.StopRequested.Get():
+			return nil
+		case err != nil:
+			return fmt.Errorf("matrix sync failed: %w", err)
+		}
+
+		m.handleSync(res, true)
+	}
+}
+
+// handleSync updates our state from the given sync response. If dispatch is set, timeline events are dispatched
+// to hooks, otherwise only the state they contain is used
+func (m *Matrix) handleSync(res *syncResponse, dispatch bool) {
+	m.since.Set(res.NextBatch)
+
+	for roomID, room := range res.Rooms.Invite {
+		m.onInvite(roomID, room.InviteState.Events)
+	}
+
+	for roomID, room := range res.Rooms.Join {
+		for _, ev := range room.State.Events {
+			m.state.apply(roomID, ev)
+		}
+
+		for _, ev := range room.Timeline.Events {
+			if !dispatch {
+				m.state.apply(roomID, ev)
+				continue
+			}
+
+			m.log.Tracef(">> %s %s %s %s", roomID, ev.Type, ev.Sender, ev.Content)
+			m.Events.Dispatch(NewRoomEvent(roomID, ev))
+		}
+	}
+
+	for roomID := range res.Rooms.Leave {
+		m.state.removeRoom(roomID)
+	}
+}
+
+func (m *Matrix) onStateEvent(e event.Event) {
+	if r := event2RoomEvent(e); r != nil {
+		m.state.apply(r.RoomID, r.Event)
+	}
+}
+
+// onInvite joins rooms we are invited to as DMs, so that users can message us privately
+func (m *Matrix) onInvite(roomID string, events []*Event) {
+	me := m.userID.Get()
+
+	for _, ev := range events {
+		if ev.Type != eventMember || ev.stateKey() != me {
+			continue
+		}
+
+		c := MemberContent{}
+		if err := json.Unmarshal(ev.Content, &c); err != nil || c.Membership != membershipInvite || !c.IsDirect {
+			m.log.Debugf("ignoring invite to %s from %s", roomID, ev.Sender)
+			return
+		}
+
+		if _, err := m.joinRoom(m.context(), roomID); err != nil {
+			m.log.Warnf("could not join DM from %s: %s", ev.Sender, err)
+			return
+		}
+
+		m.state.setDMRoom(ev.Sender, roomID)
+
+		return
+	}
+}
+
+// isUserID returns whether or not the given string is a Matrix user ID
+func isUserID(s string) bool { return strings.HasPrefix(s, "@") && strings.Contains(s, ":") }
+
+// localpart returns the localpart of the given user ID, eg "someone" for "@someone:example.org"
+func localpart(userID string) string {
+	return strings.SplitN(strings.TrimPrefix(userID, "@"), ":", 2)[0]
+}
+
+func (m *Matrix) send(target, message, msgType string) {
+	if !m.Connected.Get() {
+		m.log.Warnf("could not send %q to %q: %s", message, target, ErrNotConnected)
+		return
+	}
+
+	roomID, err := m.resolveRoom(target)
+	if err != nil {
+		m.log.Warnf("could not resolve target %q: %s", target, err)
+		return
+	}
+
+	content := MessageContent{
+		MsgType:       msgType,
+		Body:          plainText(message),
+		Format:        formatHTML,
+		FormattedBody: matrixTransformer.Transform(message),
+	}
+
+	if err := m.sendEvent(roomID, eventMessage, content); err != nil {
+		m.log.Warnf("could not send message %q to target %q: %s", message, target, err)
+	}
+}
+
+// SendMessage sends a message to the given target. Targets are either channels or user IDs
+func (m *Matrix) SendMessage(target, message string) { m.send(target, message, msgText) }
+
+// SendNotice sends a notice to the given target. Notices to users are sent via a DM room
+func (m *Matrix) SendNotice(target, message string) { m.send(target, message, msgNotice) }
+
+// AdminLevel returns the highest admin level granted to the given user ID, either directly or by their power level in
+// our channels. 0 means no admin access
+func (m *Matrix) AdminLevel(source string) int {
+	if !isUserID(source) {
+		return 0
+	}
+
+	powerLevel := m.state.powerLevel(source, m.state.channelRooms())
+	level := 0
+
+	for _, a := range m.Admins {
+		if a.Level <= level {
+			continue
+		}
+
+		if (a.User != "" && a.User == source) || (a.User == "" && a.PowerLevel > 0 && powerLevel >= a.PowerLevel) {
+			level = a.Level
+		}
+	}
+
+	return level
+}
+
+// AccountName returns the given user ID. Matrix users are always logged in, so their ID is their account
+func (m *Matrix) AccountName(source string) string {
+	if !isUserID(source) {
+		return ""
+	}
+
+	return source
+}
+
+// Lag returns how long the most recent request to the homeserver, other than a sync, took
+func (m *Matrix) Lag() time.Duration { return m.lag.Get() }
+
+// SendAdminMessage sends the given message to all AdminChannels defined on the bot
+func (m *Matrix) SendAdminMessage(msg string) {
+	for _, c := range m.AdminChannels {
+		m.SendMessage(c, msg)
+	}
+}
+
+// JoinChannel joins the given room ID or alias, which is then used as the room's channel name
+func (m *Matrix) JoinChannel(name string) {
+	for _, c := range m.channels.Get() {
+		if c == name {
+			return
+		}
+	}
+
+	m.channels.Set(append(m.channels.Get(), name))
+
+	if m.Connected.Get() {
+		m.join(m.context(), name)
+	}
+}
+
+// SetTopic sets the topic of the given channel, unless it is already set to the same thing. Matrix topics are plain
+// text, so any formatting is removed
+func (m *Matrix) SetTopic(channel, topic string) {
+	roomID, err := m.resolveRoom(channel)
+	if err != nil {
+		m.log.Warnf("could not resolve channel %q: %s", channel, err)
+		return
+	}
+
+	topic = plainText(strings.ReplaceAll(topic, "\n", " "))
+	if m.state.topic(roomID) == topic {
+		return
+	}
+
+	if err := m.setState(roomID, eventTopic, TopicContent{Topic: topic}); err != nil {
+		m.log.Warnf("could not set topic for %q: %s", channel, err)
+	}
+}
+
+func (m *Matrix) String() string {
+	return fmt.Sprintf("Matrix[Connected[%t], Lag[%dms]]", m.Connected.Get(), m.lag.Get().Milliseconds())
+}
+
+// Reload parses and reloads the config on the Matrix instance. Changes to the homeserver or token take effect on the
+// next reconnect
+func (m *Matrix) Reload(tree interfaces.Unmarshaler) error {
+	newConf := new(Conf)
+	if err := tree.Unmarshal(newConf); err != nil {
+		return fmt.Errorf("could not unmarshal Matrix config: %w", err)
+	}
+
+	if newConf.Homeserver == "" || newConf.AccessToken == "" {
+		return errors.New("matrix config requires a homeserver and an access_token")
+	}
+
+	newConf.Homeserver = strings.TrimSuffix(newConf.Homeserver, "/")
+	m.Conf = newConf
+
+	return nil
+}
+
+// StaticCommandPrefixes returns the valid static command prefixes. Matrix has none
+func (m *Matrix) StaticCommandPrefixes() []string { return []string{} }
+
+// IsCommandPrefix returns whether or not the given string starts with the command prefix or a mention of the bot, in
+// the form clients use ("name: ")
+func (m *Matrix) IsCommandPrefix(line string) (string, bool) {
+	if strings.HasPrefix(line, m.CmdPfx) {
+		return line[len(m.CmdPfx):], true
+	}
+
+	me := m.userID.Get()
+	if me == "" {
+		return line, false
+	}
+
+	for _, name := range []string{m.HumanReadableSource(me), me, localpart(me)} {
+		if pfx := name + ": "; strings.HasPrefix(line, pfx) {
+			return line[len(pfx):], true
+		}
+	}
+
+	return line, false
+}
+
+// HumanReadableSource converts a user ID to the user's current display name, or their localpart if they have none
+func (m *Matrix) HumanReadableSource(source string) string {
+	if !isUserID(source) {
+		return source
+	}
+
+	if name, ok := m.state.displayName(source); ok {
+		return name
+	}
+
+	return localpart(source)
+}
+
+// Status returns a human readable status string
+func (m *Matrix) Status() string {
+	return fmt.Sprintf("Matrix: Connected: %t Lag: %s", m.Connected.Get(), m.lag.Get())
+}
+
+// SendRaw sends a raw request to the client-server API, in the form "METHOD /path [JSON body]", where the path is
+// relative to /_matrix/client/v3
+func (m *Matrix) SendRaw(raw string) {
+	split := strings.SplitN(raw, " ", 3)
+	if len(split) < 2 {
+		m.log.Warnf("invalid raw request %q, expected METHOD /path [JSON body]", raw)
+		return
+	}
+
+	var body interface{}
+
+	if len(split) == 3 {
+		body = json.RawMessage(split[2])
+	}
+
+	if err := m.timedRequest(strings.ToUpper(split[0]), split[1], body, nil); err != nil {
+		m.log.Warn("could not send raw request: ", err)
+	}
+}
@@ -0,0 +1,215 @@
+package matrix
+
+import (
+	"encoding/json"
+	"strings"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
+	"awesome-dragon.science/go/goGoGameBot/pkg/event"
+)
+
+// messageToIntermediate converts a message's content to the intermediate format. The HTML body is used if there is
+// one, otherwise the plain body is used with any reply fallback removed
+func messageToIntermediate(c *MessageContent) string {
+	if c.Format == formatHTML && c.FormattedBody != "" {
+		return matrixTransformer.MakeIntermediate(c.FormattedBody)
+	}
+
+	body := c.Body
+	if c.isReply() && strings.HasPrefix(body, "> ") {
+		if idx := strings.Index(body, "\n\n"); idx != -1 {
+			body = body[idx+2:]
+		}
+	}
+
+	return escapeText(body)
+}
+
+// parseRoomEvent returns the RoomEvent in e, unless it was cancelled or sent by us
+func (m *Matrix) parseRoomEvent(e event.Event) *RoomEvent {
+	r := event2RoomEvent(e)
+	if e.IsCancelled() || r == nil || r.Event.Sender == m.userID.Get() {
+		return nil
+	}
+
+	return r
+}
+
+// parseMessage returns the RoomEvent and message content in e, if it is a message of one of the given types
+func (m *Matrix) parseMessage(e event.Event, msgTypes ...string) (*RoomEvent, *MessageContent) {
+	r := m.parseRoomEvent(e)
+	if r == nil {
+		return nil, nil
+	}
+
+	c := new(MessageContent)
+	if err := json.Unmarshal(r.Event.Content, c); err != nil {
+		return nil, nil
+	}
+
+	for _, t := range msgTypes {
+		if c.MsgType == t {
+			return r, c
+		}
+	}
+
+	return nil, nil
+}
+
+// memberChange is a change to a user's membership of one of our channels
+type memberChange struct {
+	channel string
+	target  string
+	old     MemberContent
+	wasIn   bool
+	new     MemberContent
+}
+
+// parseMemberChange returns the membership change in e, if it is in one of our channels. As hooks are run before the
+// state is updated, the old membership comes from our state
+func (m *Matrix) parseMemberChange(e event.Event) *memberChange {
+	r := m.parseRoomEvent(e)
+	if r == nil {
+		return nil
+	}
+
+	channel, ok := m.state.channelName(r.RoomID)
+	if !ok {
+		return nil
+	}
+
+	out := &memberChange{channel: channel, target: r.Event.stateKey()}
+	if err := json.Unmarshal(r.Event.Content, &out.new); err != nil {
+		return nil
+	}
+
+	out.old, out.wasIn = m.state.member(r.RoomID, out.target)
+
+	return out
+}
+
+// HookMessage hooks on messages and emotes in a channel
+func (m *Matrix) HookMessage(f func(source, channel, message string, isAction bool)) {
+	m.Events.Attach(eventMessage, func(e event.Event) {
+		r, c := m.parseMessage(e, msgText, msgEmote)
+		if r == nil {
+			return
+		}
+
+		if channel, ok := m.state.channelName(r.RoomID); ok {
+			f(r.Event.Sender, channel, messageToIntermediate(c), c.MsgType == msgEmote)
+		}
+	}, event.PriNorm)
+}
+
+// HookPrivateMessage hooks on messages to us in DM rooms
+func (m *Matrix) HookPrivateMessage(f func(source, channel, message string)) {
+	m.Events.Attach(eventMessage, func(e event.Event) {
+		r, c := m.parseMessage(e, msgText)
+		if r == nil || !m.state.isDM(r.RoomID) {
+			return
+		}
+
+		f(r.Event.Sender, r.RoomID, messageToIntermediate(c))
+	}, event.PriNorm)
+}
+
+// HookNotice hooks on notices in a channel. Matrix bots use notices for their messages
+func (m *Matrix) HookNotice(f func(source, channel, message string)) {
+	m.Events.Attach(eventMessage, func(e event.Event) {
+		r, c := m.parseMessage(e, msgNotice)
+		if r == nil {
+			return
+		}
+
+		if channel, ok := m.state.channelName(r.RoomID); ok {
+			f(r.Event.Sender, channel, messageToIntermediate(c))
+		}
+	}, event.PriNorm)
+}
+
+// HookJoin hooks on users joining a channel
+func (m *Matrix) HookJoin(f func(source, channel string)) {
+	m.Events.Attach(eventMember, func(e event.Event) {
+		c := m.parseMemberChange(e)
+		if c == nil || c.wasIn || c.new.Membership != membershipJoin {
+			return
+		}
+
+		f(c.target, c.channel)
+	}, event.PriNorm)
+}
+
+// HookPart hooks on users leaving a channel
+func (m *Matrix) HookPart(f func(source, channel, message string)) {
+	m.Events.Attach(eventMember, func(e event.Event) {
+		c := m.parseMemberChange(e)
+		if c == nil || !c.wasIn || c.new.Membership != membershipLeave || event2RoomEvent(e).Event.Sender != c.target {
+			return
+		}
+
+		f(c.target, c.channel, escapeText(c.new.Reason))
+	}, event.PriNorm)
+}
+
+// HookQuit is a noop, as Matrix does not differentiate between leaving a room and disconnecting
+func (m *Matrix) HookQuit(func(source, message string)) {}
+
+// HookKick hooks on users being kicked or banned from a channel
+func (m *Matrix) HookKick(f func(source, channel, target, message string)) {
+	m.Events.Attach(eventMember, func(e event.Event) {
+		c := m.parseMemberChange(e)
+		if c == nil || !c.wasIn {
+			return
+		}
+
+		source := event2RoomEvent(e).Event.Sender
+		reason := escapeText(c.new.Reason)
+
+		switch {
+		case c.new.Membership == membershipBan && reason == "":
+			reason = "banned"
+		case c.new.Membership == membershipBan:
+		case c.new.Membership != membershipLeave || source == c.target:
+			return
+		}
+
+		f(source, c.channel, m.HumanReadableSource(c.target), reason)
+	}, event.PriNorm)
+}
+
+// HookNick hooks on a user changing their display name. Matrix sends the change to every room the user is in, but the
+// callback is only fired for the first
+func (m *Matrix) HookNick(f func(source, newNick string)) {
+	m.Events.Attach(eventMember, func(e event.Event) {
+		c := m.parseMemberChange(e)
+		if c == nil || !c.wasIn || c.new.Membership != membershipJoin || c.new.DisplayName == "" ||
+			c.new.DisplayName == m.HumanReadableSource(c.target) {
+			return
+		}
+
+		f(c.target, c.new.DisplayName)
+	}, event.PriNorm)
+}
+
+// HookTopic hooks on the topic of a channel being changed
+func (m *Matrix) HookTopic(f func(source, channel, topic string)) {
+	m.Events.Attach(eventTopic, func(e event.Event) {
+		r := m.parseRoomEvent(e)
+		if r == nil {
+			return
+		}
+
+		channel, ok := m.state.channelName(r.RoomID)
+		t := TopicContent{}
+
+		if !ok || json.Unmarshal(r.Event.Content, &t) != nil || t.Topic == m.state.topic(r.RoomID) {
+			return
+		}
+
+		f(r.Event.Sender, channel, escapeText(t.Topic))
+	}, event.PriNorm)
+}
+
+// HookMode is a noop, as Matrix has no channel modes
+func (m *Matrix) HookMode(func(source, channel string, changes []interfaces.ModeChange)) {}
@@ -0,0 +1,380 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+var testLogger = log.New(log.FTimestamp, os.Stdout, "TEST", log.INFO)
+
+const (
+	testRoom = "!bridge:test"
+	testDM   = "!dm:test"
+)
+
+type sentEvent struct {
+	room    string
+	typ     string
+	content map[string]interface{}
+}
+
+// fakeHomeserver is a tiny stand in for a Matrix homeserver's client-server API
+type fakeHomeserver struct {
+	t       *testing.T
+	server  *httptest.Server
+	mu      sync.Mutex
+	joins   []string
+	sent    []sentEvent
+	filters []string
+	batches chan syncResponse
+	limited bool // whether or not the next send has been rate limited
+}
+
+func newFakeHomeserver(t *testing.T) *fakeHomeserver {
+	f := &fakeHomeserver{t: t, batches: make(chan syncResponse, 10)}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(clientAPI+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`))
+
+			return
+		}
+
+		path := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), clientAPI+"/"), "/")
+		for i, p := range path {
+			path[i], _ = url.PathUnescape(p)
+		}
+
+		body := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		var out interface{} = struct{}{}
+
+		switch {
+		case path[0] == "account":
+			out = map[string]string{"user_id": "@gggb:test"}
+		case path[0] == "join":
+			f.joins = append(f.joins, path[1])
+			out = map[string]string{"room_id": strings.Replace(path[1], "#", "!", 1)}
+		case path[0] == "sync":
+			f.mu.Unlock()
+			out = f.sync(r)
+			f.mu.Lock()
+		case path[0] == "createRoom":
+			invite := body["invite"].([]interface{})[0].(string)
+			out = map[string]string{"room_id": "!dm-" + invite}
+		case path[0] == "rooms" && path[2] == "send" && !f.limited:
+			f.limited = true
+
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			out = apiError{ErrCode: "M_LIMIT_EXCEEDED", RetryAfterMS: 10}
+		case path[0] == "rooms":
+			f.sent = append(f.sent, sentEvent{room: path[1], typ: path[3], content: body})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+		_ = json.NewEncoder(w).Encode(out)
+	})
+
+	f.server = httptest.NewServer(mux)
+
+	return f
+}
+
+func (f *fakeHomeserver) sync(r *http.Request) syncResponse {
+	if r.URL.Query().Get("since") == "" {
+		f.mu.Lock()
+		f.filters = append(f.filters, r.URL.Query().Get("filter"))
+		f.mu.Unlock()
+
+		return initialSync()
+	}
+
+	select {
+	case res := <-f.batches:
+		return res
+	case <-time.After(time.Second):
+		return syncResponse{NextBatch: "empty"}
+	case <-r.Context().Done():
+		return syncResponse{}
+	}
+}
+
+// push queues the given events to be sent in the next sync
+func (f *fakeHomeserver) push(room string, events ...*Event) {
+	res := syncResponse{NextBatch: "next"}
+	res.Rooms.Join = map[string]joinedRoom{room: {Timeline: roomEvents{Events: events}}}
+	f.batches <- res
+}
+
+func (f *fakeHomeserver) invite(room string, events ...*Event) {
+	res := syncResponse{NextBatch: "next"}
+	res.Rooms.Invite = map[string]invitedRoom{room: {InviteState: roomEvents{Events: events}}}
+	f.batches <- res
+}
+
+func (f *fakeHomeserver) sentEvents() []sentEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]sentEvent{}, f.sent...)
+}
+
+func (f *fakeHomeserver) joined() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string{}, f.joins...)
+}
+
+var eventCount int64
+
+func makeEvent(typ, sender string, stateKey *string, content interface{}) *Event {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Event{
+		Type:      typ,
+		Sender:    sender,
+		StateKey:  stateKey,
+		Content:   raw,
+		EventID:   fmt.Sprintf("$event%d", atomic.AddInt64(&eventCount, 1)),
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+}
+
+func stateEvent(typ, sender, stateKey string, content interface{}) *Event {
+	return makeEvent(typ, sender, &stateKey, content)
+}
+
+func member(sender, target, membership, name string) *Event {
+	return stateEvent(eventMember, sender, target, MemberContent{Membership: membership, DisplayName: name})
+}
+
+func message(sender string, content MessageContent) *Event {
+	return makeEvent(eventMessage, sender, nil, content)
+}
+
+func initialSync() syncResponse {
+	res := syncResponse{NextBatch: "initial"}
+	res.Rooms.Join = map[string]joinedRoom{
+		testRoom: {
+			State: roomEvents{Events: []*Event{
+				member("@gggb:test", "@gggb:test", membershipJoin, "gggb"),
+				member("@admin:test", "@admin:test", membershipJoin, "Admin"),
+				member("@user:test", "@user:test", membershipJoin, "Some User"),
+				stateEvent(eventPowerLevels, "@admin:test", "", PowerLevelsContent{Users: map[string]int{"@admin:test": 100}}),
+				stateEvent(eventTopic, "@admin:test", "", TopicContent{Topic: "old topic"}),
+			}},
+			// Old messages should never make it to hooks
+			Timeline: roomEvents{Events: []*Event{message("@admin:test", MessageContent{MsgType: msgText, Body: "old"})}},
+		},
+	}
+
+	return res
+}
+
+func testConf(t *testing.T, url string) tomlconf.ConfigHolder {
+	tree, err := toml.Load(`
+		homeserver = "` + url + `/"
+		access_token = "test-token"
+		command_prefix = "!"
+		sync_timeout = 1
+
+		[[admins]]
+		power_level = 50
+		level = 3
+
+		[[admins]]
+		user = "@user:test"
+		level = 1
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tomlconf.ConfigHolder{Type: "matrix", RealConf: tree}
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+type hooked struct{ source, channel, target, message string }
+
+func expectHook(t *testing.T, what string, c <-chan hooked, want hooked) {
+	t.Helper()
+
+	select {
+	case got := <-c:
+		if got != want {
+			t.Errorf("%s got %#v, want %#v", what, got, want)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestMatrix(t *testing.T) { //nolint:funlen // its an integration test
+	fake := newFakeHomeserver(t)
+	defer fake.server.Close()
+
+	m, err := New(testConf(t, fake.server.URL), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.JoinChannel("#bridge:test")
+
+	msgs := make(chan hooked, 10)
+	m.HookMessage(func(source, channel, message string, isAction bool) {
+		msgs <- hooked{source, channel, fmt.Sprint(isAction), message}
+	})
+
+	privMsgs := make(chan hooked, 10)
+	m.HookPrivateMessage(func(source, channel, message string) { privMsgs <- hooked{source, channel, "", message} })
+
+	members := make(chan hooked, 10)
+	m.HookJoin(func(source, channel string) { members <- hooked{source, channel, "join", ""} })
+	m.HookPart(func(source, channel, message string) { members <- hooked{source, channel, "part", message} })
+	m.HookKick(func(source, channel, target, message string) { members <- hooked{source, channel, target, message} })
+	m.HookNick(func(source, newNick string) { members <- hooked{source, "", "nick", newNick} })
+
+	topics := make(chan hooked, 10)
+	m.HookTopic(func(source, channel, topic string) { topics <- hooked{source, channel, "", topic} })
+
+	runErr := make(chan error, 1)
+
+	go func() { runErr <- m.Run() }()
+
+	waitFor(t, "connection", m.Connected.Get)
+	waitFor(t, "initial sync", func() bool { return m.state.topic(testRoom) == "old topic" })
+
+	if got, want := fake.joined(), []string{"#bridge:test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("joined %q, want %q", got, want)
+	}
+
+	fake.mu.Lock()
+	if len(fake.filters) != 1 || fake.filters[0] != initialFilter {
+		t.Errorf("initial sync used filters %q, want %q", fake.filters, initialFilter)
+	}
+	fake.mu.Unlock()
+
+	for source, want := range map[string]int{"@admin:test": 3, "@user:test": 1, "@other:test": 0} {
+		if got := m.AdminLevel(source); got != want {
+			t.Errorf("AdminLevel(%q) = %d, want %d", source, got, want)
+		}
+	}
+
+	if got := m.HumanReadableSource("@user:test"); got != "Some User" {
+		t.Errorf("HumanReadableSource() = %q, want %q", got, "Some User")
+	}
+
+	fake.push(
+		testRoom,
+		message("@gggb:test", MessageContent{MsgType: msgText, Body: "our own message"}),
+		message("@admin:test", MessageContent{
+			MsgType: msgText, Body: "hello $", Format: formatHTML, FormattedBody: "<b>hello</b> $",
+		}),
+		message("@user:test", MessageContent{MsgType: msgEmote, Body: "waves"}),
+	)
+
+	expectHook(t, "message hook", msgs, hooked{"@admin:test", "#bridge:test", "false", "$bhello$b $$"})
+	expectHook(t, "emote hook", msgs, hooked{"@user:test", "#bridge:test", "true", "waves"})
+
+	fake.push(
+		testRoom,
+		member("@new:test", "@new:test", membershipJoin, "New"),
+		member("@new:test", "@new:test", membershipLeave, ""),
+		stateEvent(eventMember, "@admin:test", "@user:test", MemberContent{Membership: membershipLeave, Reason: "bye"}),
+		member("@admin:test", "@admin:test", membershipJoin, "Boss"),
+	)
+
+	expectHook(t, "join hook", members, hooked{"@new:test", "#bridge:test", "join", ""})
+	expectHook(t, "part hook", members, hooked{"@new:test", "#bridge:test", "part", ""})
+	expectHook(t, "kick hook", members, hooked{"@admin:test", "#bridge:test", "Some User", "bye"})
+	expectHook(t, "nick hook", members, hooked{"@admin:test", "", "nick", "Boss"})
+
+	fake.push(testRoom, stateEvent(eventTopic, "@admin:test", "", TopicContent{Topic: "new $topic"}))
+	expectHook(t, "topic hook", topics, hooked{"@admin:test", "#bridge:test", "", "new $$topic"})
+
+	// The topic is already set to this
+	waitFor(t, "topic", func() bool { return m.state.topic(testRoom) == "new $topic" })
+	m.SetTopic("#bridge:test", "new $$topic")
+	m.SetTopic("#bridge:test", "$bnewer$b topic")
+
+	fake.invite(testDM, stateEvent(eventMember, "@user:test", "@gggb:test", MemberContent{
+		Membership: membershipInvite, IsDirect: true,
+	}))
+	waitFor(t, "DM join", func() bool { return len(fake.joined()) == 2 })
+	fake.push(testDM, message("@user:test", MessageContent{MsgType: msgText, Body: "status"}))
+	expectHook(t, "private message hook", privMsgs, hooked{"@user:test", testDM, "", "status"})
+
+	m.SendMessage("#bridge:test", "$bbold$b\nsecond line")
+	m.SendNotice("@other:test", "private")
+
+	want := []sentEvent{
+		{room: testRoom, typ: eventTopic, content: map[string]interface{}{"topic": "newer topic"}},
+		{room: testRoom, typ: eventMessage, content: map[string]interface{}{
+			"msgtype": msgText, "body": "bold\nsecond line",
+			"format": formatHTML, "formatted_body": "<b>bold</b><br>second line",
+		}},
+		{room: "!dm-@other:test", typ: eventMessage, content: map[string]interface{}{
+			"msgtype": msgNotice, "body": "private", "format": formatHTML, "formatted_body": "private",
+		}},
+	}
+
+	if got := fake.sentEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent events %#v, want %#v", got, want)
+	}
+
+	for line, want := range map[string]string{"!status": "status", "gggb: status": "status", "@gggb:test: a": "a"} {
+		if out, ok := m.IsCommandPrefix(line); !ok || out != want {
+			t.Errorf("IsCommandPrefix(%q) = %q, %t", line, out, ok)
+		}
+	}
+
+	m.Disconnect("bye")
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run() returned %s after a requested disconnect", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run did not return after Disconnect")
+	}
+}
@@ -0,0 +1,210 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clientAPI  = "/_matrix/client/v3"
+	maxRetries = 3
+)
+
+// initialFilter stops the first sync from returning old messages, while still returning the state of our rooms
+const initialFilter = `{"room":{"timeline":{"limit":0}}}`
+
+// apiError is the body of an error response from the client-server API
+type apiError struct {
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMS int64  `json:"retry_after_ms"`
+}
+
+// request makes a request against the client-server API, unmarshalling any response into out if it is non-nil.
+// Requests that are rate limited are retried after the time the homeserver asks for
+func (m *Matrix) request(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var encoded []byte
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not marshal request body: %w", err)
+		}
+
+		encoded = b
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.syncTimeout()+requestTimeout)
+	defer cancel()
+
+	target := m.Homeserver + clientAPI + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(encoded))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+m.AccessToken)
+
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		res, err := m.http.Do(req)
+		if err != nil {
+			return err
+		}
+
+		resBody, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case res.StatusCode == http.StatusTooManyRequests && attempt < maxRetries:
+			limit := apiError{}
+			_ = json.Unmarshal(resBody, &limit)
+			m.log.Debugf("rate limited on %s %s, retrying in %dms", method, path, limit.RetryAfterMS)
+
+			select {
+			case <-time.After(time.Duration(limit.RetryAfterMS) * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			continue
+
+		case res.StatusCode < 200 || res.StatusCode > 299:
+			apiErr := apiError{}
+			if json.Unmarshal(resBody, &apiErr) == nil && apiErr.ErrCode != "" {
+				return fmt.Errorf("%s %s returned %s: %s: %s", method, path, res.Status, apiErr.ErrCode, apiErr.Error)
+			}
+
+			return fmt.Errorf("%s %s returned %s: %s", method, path, res.Status, resBody)
+		}
+
+		if out == nil || len(resBody) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(resBody, out)
+	}
+}
+
+// timedRequest works like request, and records how long the request took as our lag
+func (m *Matrix) timedRequest(method, path string, body, out interface{}) error {
+	start := time.Now()
+	err := m.request(m.context(), method, path, nil, body, out)
+
+	if err == nil {
+		m.lag.Set(time.Since(start))
+	}
+
+	return err
+}
+
+func (m *Matrix) whoami(ctx context.Context) (string, error) {
+	out := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	if err := m.request(ctx, http.MethodGet, "/account/whoami", nil, nil, &out); err != nil {
+		return "", err
+	}
+
+	return out.UserID, nil
+}
+
+// joinRoom joins the given room ID or alias, and returns the ID of the joined room
+func (m *Matrix) joinRoom(ctx context.Context, room string) (string, error) {
+	out := struct {
+		RoomID string `json:"room_id"`
+	}{}
+
+	if err := m.request(ctx, http.MethodPost, "/join/"+url.PathEscape(room), nil, struct{}{}, &out); err != nil {
+		return "", err
+	}
+
+	return out.RoomID, nil
+}
+
+func (m *Matrix) sync(ctx context.Context, since string, timeout time.Duration, filter string) (*syncResponse, error) {
+	query := url.Values{"timeout": {strconv.FormatInt(timeout.Milliseconds(), 10)}}
+
+	if since != "" {
+		query.Set("since", since)
+	}
+
+	if filter != "" {
+		query.Set("filter", filter)
+	}
+
+	out := new(syncResponse)
+	if err := m.request(ctx, http.MethodGet, "/sync", query, nil, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (m *Matrix) nextTxnID() string {
+	return fmt.Sprintf("gggb%d.%d", m.started.UnixNano(), atomic.AddInt64(&m.txnID, 1))
+}
+
+func (m *Matrix) sendEvent(roomID, eventType string, content interface{}) error {
+	return m.timedRequest(
+		http.MethodPut,
+		fmt.Sprintf("/rooms/%s/send/%s/%s", url.PathEscape(roomID), url.PathEscape(eventType), m.nextTxnID()),
+		content,
+		nil,
+	)
+}
+
+func (m *Matrix) setState(roomID, eventType string, content interface{}) error {
+	return m.timedRequest(
+		http.MethodPut, fmt.Sprintf("/rooms/%s/state/%s", url.PathEscape(roomID), url.PathEscape(eventType)), content, nil,
+	)
+}
+
+// resolveRoom turns a target into a room ID. Targets are either channel names, room IDs, or user IDs, in which case
+// a DM room is created (and cached) for them
+func (m *Matrix) resolveRoom(target string) (string, error) {
+	if id, ok := m.state.roomID(target); ok {
+		return id, nil
+	}
+
+	if !isUserID(target) {
+		return target, nil
+	}
+
+	if id, ok := m.state.dmRoom(target); ok {
+		return id, nil
+	}
+
+	out := struct {
+		RoomID string `json:"room_id"`
+	}{}
+
+	body := map[string]interface{}{"is_direct": true, "invite": []string{target}, "preset": "trusted_private_chat"}
+	if err := m.timedRequest(http.MethodPost, "/createRoom", body, &out); err != nil {
+		return "", fmt.Errorf("could not create DM room: %w", err)
+	}
+
+	m.state.setDMRoom(target, out.RoomID)
+
+	return out.RoomID, nil
+}
@@ -0,0 +1,238 @@
+package matrix
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+type roomState struct {
+	members     map[string]MemberContent
+	powerLevels PowerLevelsContent
+	topic       string
+}
+
+// state holds everything we know about the rooms we are in. It is fed from sync responses
+type state struct {
+	sync.RWMutex
+	rooms map[string]*roomState
+	names map[string]string // user ID -> most recently seen display name
+	dms   map[string]string // user ID -> DM room ID
+	ids   map[string]string // channel name (room ID or alias) -> room ID
+}
+
+func newState() *state {
+	return &state{
+		rooms: make(map[string]*roomState),
+		names: make(map[string]string),
+		dms:   make(map[string]string),
+		ids:   make(map[string]string),
+	}
+}
+
+// clear forgets everything but the DM rooms and channel room IDs, which are still valid across connections
+func (s *state) clear() {
+	s.Lock()
+	s.rooms = make(map[string]*roomState)
+	s.names = make(map[string]string)
+	s.Unlock()
+}
+
+func (s *state) getRoom(id string) *roomState {
+	r, ok := s.rooms[id]
+	if !ok {
+		r = &roomState{members: make(map[string]MemberContent)}
+		s.rooms[id] = r
+	}
+
+	return r
+}
+
+// apply updates the state of the given room from the given state event. Events that are not state events, or that
+// we do not track, are ignored
+func (s *state) apply(roomID string, ev *Event) {
+	if ev.StateKey == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	r := s.getRoom(roomID)
+
+	switch ev.Type {
+	case eventMember:
+		m := MemberContent{}
+		if err := json.Unmarshal(ev.Content, &m); err != nil {
+			return
+		}
+
+		if m.Membership == membershipJoin {
+			r.members[*ev.StateKey] = m
+
+			if m.DisplayName != "" {
+				s.names[*ev.StateKey] = m.DisplayName
+			}
+
+			return
+		}
+
+		delete(r.members, *ev.StateKey)
+
+	case eventPowerLevels:
+		p := PowerLevelsContent{}
+		if err := json.Unmarshal(ev.Content, &p); err == nil {
+			r.powerLevels = p
+		}
+
+	case eventTopic:
+		t := TopicContent{}
+		if err := json.Unmarshal(ev.Content, &t); err == nil {
+			r.topic = t.Topic
+		}
+	}
+}
+
+func (s *state) removeRoom(roomID string) {
+	s.Lock()
+	delete(s.rooms, roomID)
+
+	for user, room := range s.dms {
+		if room == roomID {
+			delete(s.dms, user)
+		}
+	}
+	s.Unlock()
+}
+
+// member returns the given user's membership of the given room, if they are joined to it
+func (s *state) member(roomID, userID string) (MemberContent, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if r, ok := s.rooms[roomID]; ok {
+		m, ok := r.members[userID]
+		return m, ok
+	}
+
+	return MemberContent{}, false
+}
+
+func (s *state) topic(roomID string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	if r, ok := s.rooms[roomID]; ok {
+		return r.topic
+	}
+
+	return ""
+}
+
+// displayName returns the most recently seen display name for the given user ID
+func (s *state) displayName(userID string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	n, ok := s.names[userID]
+
+	return n, ok
+}
+
+// powerLevel returns the highest power level the given user has in any of the given rooms that they are joined to
+func (s *state) powerLevel(userID string, roomIDs []string) int {
+	s.RLock()
+	defer s.RUnlock()
+
+	level, found := 0, false
+
+	for _, id := range roomIDs {
+		r, ok := s.rooms[id]
+		if !ok {
+			continue
+		}
+
+		if _, joined := r.members[userID]; !joined {
+			continue
+		}
+
+		l, ok := r.powerLevels.Users[userID]
+		if !ok {
+			l = r.powerLevels.UsersDefault
+		}
+
+		if !found || l > level {
+			level, found = l, true
+		}
+	}
+
+	return level
+}
+
+func (s *state) dmRoom(userID string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	r, ok := s.dms[userID]
+
+	return r, ok
+}
+
+func (s *state) setDMRoom(userID, roomID string) {
+	s.Lock()
+	s.dms[userID] = roomID
+	s.Unlock()
+}
+
+// isDM returns whether or not the given room is a DM room
+func (s *state) isDM(roomID string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, r := range s.dms {
+		if r == roomID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *state) setRoomID(channel, roomID string) {
+	s.Lock()
+	s.ids[channel] = roomID
+	s.Unlock()
+}
+
+// roomID returns the room ID for the given channel name
+func (s *state) roomID(channel string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	r, ok := s.ids[channel]
+
+	return r, ok
+}
+
+// channelName returns the channel name we joined the given room with, if it is one of our channels
+func (s *state) channelName(roomID string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for name, id := range s.ids {
+		if id == roomID {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// channelRooms returns the room IDs of all our channels
+func (s *state) channelRooms() []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make([]string, 0, len(s.ids))
+	for _, id := range s.ids {
+		out = append(out, id)
+	}
+
+	return out
+}
@@ -0,0 +1,280 @@
+package matrix
+
+import (
+	"fmt"
+	"html"
+	"image/color" //nolint:misspell // Go devs cant spell colour
+	"strings"
+	"unicode"
+
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/intermediate"
+	"awesome-dragon.science/go/goGoGameBot/pkg/format/transformer/tokeniser"
+)
+
+var htmlMapping = map[int]string{
+	intermediate.Bold:          "b",
+	intermediate.Italic:        "i",
+	intermediate.Underline:     "u",
+	intermediate.Strikethrough: "del",
+	intermediate.Colour:        "font",
+}
+
+// htmlTags maps the HTML tags that Matrix clients use for formatting to intermediate formats
+var htmlTags = map[string]rune{
+	"b":      intermediate.Bold,
+	"strong": intermediate.Bold,
+	"i":      intermediate.Italic,
+	"em":     intermediate.Italic,
+	"u":      intermediate.Underline,
+	"del":    intermediate.Strikethrough,
+	"s":      intermediate.Strikethrough,
+	"strike": intermediate.Strikethrough,
+	"font":   intermediate.Colour,
+	"span":   intermediate.Colour,
+}
+
+var matrixTransformer = Transformer{} // Copy of matrixTransformer for use in internal stuff
+
+// Transformer is a dummy struct that holds methods for Matrix's implementation of format/transformer's transformer
+// interface. Matrix messages are formatted with a subset of HTML
+type Transformer struct{}
+
+// span is an open HTML element
+type span struct {
+	typ    int
+	colour color.Color
+}
+
+func (s span) open() string {
+	if s.typ == intermediate.Colour {
+		r, g, b, _ := s.colour.RGBA()
+		hex := fmt.Sprintf("#%02x%02x%02x", uint8(r), uint8(g), uint8(b))
+
+		return fmt.Sprintf(`<font color="%s" data-mx-color="%s">`, hex, hex)
+	}
+
+	return "<" + htmlMapping[s.typ] + ">"
+}
+
+func (s span) close() string { return "</" + htmlMapping[s.typ] + ">" }
+
+// Transform implements Transformer.Transform. Intermediate formatting is toggle based, so open elements are closed
+// (and reopened where needed) to keep them correctly nested. Newlines are converted to line breaks
+func (Transformer) Transform(in string) string {
+	out := strings.Builder{}
+
+	var open []span
+
+	// closeFrom closes every element from the given index up, and returns the ones that were closed above it
+	closeFrom := func(idx int) []span {
+		for i := len(open) - 1; i >= idx; i-- {
+			out.WriteString(open[i].close())
+		}
+
+		closed := append([]span{}, open[idx+1:]...)
+		open = open[:idx]
+
+		return closed
+	}
+
+	for _, tok := range tokeniser.Tokenise(in) {
+		switch tok.TokenType {
+		case tokeniser.StringToken:
+			out.WriteString(strings.ReplaceAll(html.EscapeString(tok.OriginalString), "\n", "<br>"))
+
+		case intermediate.Bold, intermediate.Italic, intermediate.Underline, intermediate.Strikethrough,
+			intermediate.Colour:
+			idx := -1
+
+			for i, s := range open {
+				if s.typ == tok.TokenType {
+					idx = i
+					break
+				}
+			}
+
+			var reopen []span
+			if idx != -1 {
+				reopen = closeFrom(idx)
+			}
+
+			if idx == -1 || tok.TokenType == intermediate.Colour {
+				// Colours change rather than toggle, so a new colour replaces the old one
+				reopen = append(reopen, span{typ: tok.TokenType, colour: tok.Colour})
+			}
+
+			for _, s := range reopen {
+				open = append(open, s)
+				out.WriteString(s.open())
+			}
+
+		case intermediate.Reset:
+			if len(open) > 0 {
+				closeFrom(0)
+			}
+		}
+	}
+
+	if len(open) > 0 {
+		closeFrom(0)
+	}
+
+	return out.String()
+}
+
+// plainText converts a string in the intermediate format to the plain text fallback that is sent with HTML messages
+func plainText(in string) string { return tokeniser.Strip(in) }
+
+// escapeText converts plain text to the intermediate format
+func escapeText(in string) string {
+	return strings.ReplaceAll(in, intermediate.SentinelString, intermediate.SSentinelString)
+}
+
+// tag is a parsed HTML tag
+type tag struct {
+	name    string
+	closing bool
+	attrs   map[string]string
+}
+
+// parseTag parses the HTML tag at the start of the given string, and returns it and its length. If the string does not
+// start with a tag, the returned length is 0
+func parseTag(in string) (tag, int) {
+	end := strings.IndexByte(in, '>')
+	if !strings.HasPrefix(in, "<") || end == -1 {
+		return tag{}, 0
+	}
+
+	inner := strings.TrimSuffix(in[1:end], "/")
+	t := tag{attrs: make(map[string]string)}
+
+	if strings.HasPrefix(inner, "/") {
+		t.closing = true
+		inner = inner[1:]
+	}
+
+	// Tag names must follow the < directly, and start with a letter
+	if inner == "" || !unicode.IsLetter(rune(inner[0])) {
+		return tag{}, 0
+	}
+
+	fields := strings.Fields(inner)
+	t.name = strings.ToLower(fields[0])
+
+	for _, attr := range fields[1:] {
+		split := strings.SplitN(attr, "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+
+		t.attrs[strings.ToLower(split[0])] = html.UnescapeString(strings.Trim(split[1], `"'`))
+	}
+
+	return t, end + 1
+}
+
+// tagColour returns the colour set by the given tag, if any
+func tagColour(t tag) (string, bool) {
+	for _, attr := range []string{"data-mx-color", "color"} {
+		if c := strings.TrimPrefix(t.attrs[attr], "#"); len(c) == 6 {
+			if _, err := tokeniser.ParseColour(c); err == nil {
+				return strings.ToUpper(c), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// MakeIntermediate implements Transformer.MakeIntermediate. Reply fallbacks are removed, and links are replaced with
+// their text
+func (Transformer) MakeIntermediate(in string) string { //nolint:gocognit,funlen // its a parser
+	out := strings.Builder{}
+
+	// open holds the formats set by the elements that are currently open. Spans with no colour hold an empty string
+	var open []string
+
+	reply := 0
+
+	for len(in) > 0 {
+		t, length := parseTag(in)
+		if length == 0 {
+			next := strings.IndexByte(in[1:], '<') + 1
+			if next == 0 {
+				next = len(in)
+			}
+
+			if reply == 0 {
+				out.WriteString(escapeText(html.UnescapeString(in[:next])))
+			}
+
+			in = in[next:]
+
+			continue
+		}
+
+		in = in[length:]
+
+		switch {
+		case t.name == "mx-reply":
+			if t.closing {
+				reply--
+			} else {
+				reply++
+			}
+
+			continue
+		case reply > 0:
+			continue
+		case t.name == "br":
+			out.WriteString("\n")
+			continue
+		case t.name == "p" && t.closing && len(in) > 0:
+			out.WriteString("\n")
+			continue
+		}
+
+		typ, ok := htmlTags[t.name]
+		if !ok {
+			continue
+		}
+
+		if !t.closing {
+			code := ""
+
+			switch c, hasColour := tagColour(t); {
+			case typ != intermediate.Colour:
+				code = intermediate.SentinelString + string(typ)
+			case hasColour:
+				code = intermediate.SColourString + c
+			}
+
+			open = append(open, code)
+			out.WriteString(code)
+
+			continue
+		}
+
+		if len(open) == 0 {
+			continue
+		}
+
+		closed := open[len(open)-1]
+		open = open[:len(open)-1]
+
+		switch {
+		case closed == "":
+		case strings.HasPrefix(closed, intermediate.SColourString):
+			// Colours cannot be turned off, so reset everything and reapply the formats that are still open
+			out.WriteString(intermediate.SResetString)
+
+			for _, o := range open {
+				out.WriteString(o)
+			}
+		default:
+			out.WriteString(closed)
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,157 @@
+package matrix
+
+import "testing"
+
+func TestTransformer_Transform(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain",
+			in:   "this is a test",
+			want: "this is a test",
+		},
+		{
+			name: "bold",
+			in:   "this $bis$b a test",
+			want: "this <b>is</b> a test",
+		},
+		{
+			name: "unclosed",
+			in:   "this $iis a test",
+			want: "this <i>is a test</i>",
+		},
+		{
+			name: "overlapping",
+			in:   "$bbold $iboth$b italic$i",
+			want: "<b>bold <i>both</i></b><i> italic</i>",
+		},
+		{
+			name: "reset",
+			in:   "$b$u$sall$r none",
+			want: "<b><u><del>all</del></u></b> none",
+		},
+		{
+			name: "colours",
+			in:   "$cFF0000red $cFFFFFFwhite$r none",
+			want: `<font color="#ff0000" data-mx-color="#ff0000">red </font>` +
+				`<font color="#ffffff" data-mx-color="#ffffff">white</font> none`,
+		},
+		{
+			name: "escapes html",
+			in:   "<b>not bold</b> & a\nnew line",
+			want: "&lt;b&gt;not bold&lt;/b&gt; &amp; a<br>new line",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Transformer{}).Transform(tt.in); got != tt.want {
+				t.Errorf("Transform() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformer_MakeIntermediate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain",
+			in:   "this is a test",
+			want: "this is a test",
+		},
+		{
+			name: "all formats",
+			in:   "<strong>bold</strong> <em>italic</em> <u>underline</u> <del>strike</del> <s>strike</s>",
+			want: "$bbold$b $iitalic$i $uunderline$u $sstrike$s $sstrike$s",
+		},
+		{
+			name: "sentinels and entities",
+			in:   "this co$ts &lt;$5&gt; &amp; more",
+			want: "this co$$ts <$$5> & more",
+		},
+		{
+			name: "colours",
+			in:   `<b><font color="#ff0000">red</font> bold</b> <span data-mx-color="#00FF00">green</span>`,
+			want: "$b$cFF0000red$r$b bold$b $c00FF00green$r",
+		},
+		{
+			name: "line breaks",
+			in:   "<p>one</p><p>two<br/>three</p>",
+			want: "one\ntwo\nthree",
+		},
+		{
+			name: "reply fallback",
+			in:   "<mx-reply><blockquote><b>quoted</b></blockquote></mx-reply>the reply",
+			want: "the reply",
+		},
+		{
+			name: "links",
+			in:   `hi <a href="https://matrix.to/#/@someone:example.org">someone</a>`,
+			want: "hi someone",
+		},
+		{
+			name: "not a tag",
+			in:   "1 < 2 > 0",
+			want: "1 < 2 > 0",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Transformer{}).MakeIntermediate(tt.in); got != tt.want {
+				t.Errorf("MakeIntermediate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageToIntermediate(t *testing.T) {
+	reply := &relatesTo{InReplyTo: &struct {
+		EventID string `json:"event_id"`
+	}{EventID: "$someevent"}}
+
+	tests := []struct {
+		name    string
+		content MessageContent
+		want    string
+	}{
+		{
+			name:    "plain",
+			content: MessageContent{MsgType: msgText, Body: "costs $5"},
+			want:    "costs $$5",
+		},
+		{
+			name:    "html",
+			content: MessageContent{MsgType: msgText, Body: "bold", Format: formatHTML, FormattedBody: "<b>bold</b>"},
+			want:    "$bbold$b",
+		},
+		{
+			name:    "reply fallback",
+			content: MessageContent{MsgType: msgText, Body: "> <@a:b> quoted\n> more\n\nthe reply", RelatesTo: reply},
+			want:    "the reply",
+		},
+		{
+			name:    "quote without reply",
+			content: MessageContent{MsgType: msgText, Body: "> quoted\n\nnot a reply"},
+			want:    "> quoted\n\nnot a reply",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageToIntermediate(&tt.content); got != tt.want {
+				t.Errorf("messageToIntermediate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -62,6 +62,15 @@ func (n *NullConn) HookKick(_ func(source, channel, target, message string)) {}
 // HookNick hoops on a user changing their nickname
 func (n *NullConn) HookNick(_ func(source, newNick string)) {}
 
+// HookTopic hooks on a channel's topic being changed
+func (n *NullConn) HookTopic(_ func(source, channel, topic string)) {}
+
+// HookMode hooks on a channel's modes being changed
+func (n *NullConn) HookMode(_ func(source, channel string, changes []interfaces.ModeChange)) {}
+
+// HookNotice hooks on notices to a channel
+func (n *NullConn) HookNotice(_ func(source, channel, message string)) {}
+
 // AdminLevel returns the permission level that a given source has. It should return
 // zero for sources with no permissions
 func (n *NullConn) AdminLevel(source string) int { return 0 }
@@ -69,6 +78,9 @@ func (n *NullConn) AdminLevel(source string) int { return 0 }
 // JoinChannel joins the given channel
 func (n *NullConn) JoinChannel(name string) { n.log.Infof("join channel requested: %s", name) }
 
+// SetTopic sets the topic of the given channel
+func (n *NullConn) SetTopic(channel, topic string) { n.log.Infof("topic for %s: %s", channel, topic) }
+
 // Reload reloads the Bot using the given (string) config
 func (n *NullConn) Reload(conf interfaces.Unmarshaler) error {
 	n.log.Infof("reload requested with conf %#v", conf)
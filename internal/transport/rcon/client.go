@@ -0,0 +1,189 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types. Auth responses share their type with commands
+const (
+	typeResponse     int32 = 0
+	typeAuthResponse int32 = 2
+	typeCommand      int32 = 2
+	typeAuth         int32 = 3
+)
+
+const (
+	minPacketSize = 10 // ID, type, and the two null bytes that end the body
+	maxPacketSize = 1 << 16
+)
+
+// ErrAuthFailed is returned when the server rejects the RCON password
+var ErrAuthFailed = errors.New("RCON authentication failed")
+
+// packet is a single RCON packet. On the wire it is prefixed with its size, and its body ends with two null bytes
+type packet struct {
+	id   int32
+	typ  int32
+	body string
+}
+
+func writePacket(w io.Writer, p packet) error {
+	buf := new(bytes.Buffer)
+	for _, n := range []int32{int32(len(p.body) + minPacketSize), p.id, p.typ} {
+		_ = binary.Write(buf, binary.LittleEndian, n)
+	}
+
+	buf.WriteString(p.body)
+	buf.Write([]byte{0, 0})
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func readPacket(r io.Reader) (packet, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return packet{}, err
+	}
+
+	if size < minPacketSize || size > maxPacketSize {
+		return packet{}, fmt.Errorf("invalid packet size %d", size)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return packet{}, err
+	}
+
+	return packet{
+		id:   int32(binary.LittleEndian.Uint32(buf[0:4])),
+		typ:  int32(binary.LittleEndian.Uint32(buf[4:8])),
+		body: string(bytes.TrimRight(buf[8:], "\x00")),
+	}, nil
+}
+
+// client is an authenticated RCON connection. Requests are sent one at a time, as Minecraft cannot handle a packet
+// arriving before it has replied to the last one
+type client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	timeout time.Duration
+	lastID  int32
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// dial connects to the RCON server at address, and authenticates with password
+func dial(address, password string, timeout time.Duration) (*client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{conn: conn, timeout: timeout, closed: make(chan struct{})}
+	if err := c.auth(password); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *client) auth(password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.nextID()
+	if err := c.send(packet{id: id, typ: typeAuth, body: password}); err != nil {
+		return err
+	}
+
+	for {
+		p, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		// Source servers send an empty response before the auth response
+		if p.typ != typeAuthResponse {
+			continue
+		}
+
+		if p.id == -1 {
+			return ErrAuthFailed
+		}
+
+		if p.id == id {
+			return nil
+		}
+	}
+}
+
+func (c *client) nextID() int32 {
+	c.lastID++
+	return c.lastID
+}
+
+func (c *client) send(p packet) error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+
+	return writePacket(c.conn, p)
+}
+
+func (c *client) read() (packet, error) {
+	return readPacket(c.conn)
+}
+
+// request sends the given packet and returns the body of the reply to it. Packets with other IDs are replies to
+// earlier requests that were not read, and are skipped
+func (c *client) request(typ int32, body string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.nextID()
+	if err := c.send(packet{id: id, typ: typ, body: body}); err != nil {
+		return "", err
+	}
+
+	for {
+		p, err := c.read()
+		if err != nil {
+			return "", err
+		}
+
+		if p.id == id {
+			return p.body, nil
+		}
+	}
+}
+
+// exec runs the given command on the server and returns its response. Only the first packet of responses that are
+// split over more than one is returned
+func (c *client) exec(command string) (string, error) {
+	return c.request(typeCommand, command)
+}
+
+// ping checks that the server is still responding. Source servers echo empty response packets, and Minecraft replies
+// to them with an error, so they are safe to send at any time
+func (c *client) ping() error {
+	_, err := c.request(typeResponse, "")
+	return err
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.conn.Close()
+	})
+}
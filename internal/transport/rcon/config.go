@@ -0,0 +1,57 @@
+// Package rcon holds a Transport implementation for game servers that are run by something else, and are controlled
+// over the Source RCON protocol, as used by Source engine games and Minecraft
+package rcon
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultStopCommand  = "stop"
+	defaultPollInterval = time.Second * 10
+	defaultTimeout      = time.Second * 10
+)
+
+// Config is a config for an RCONTransport
+type Config struct {
+	Address      string `toml:"address" comment:"host:port of the server's RCON listener"`
+	Password     string `toml:"password" comment:"RCON password"`
+	LogFile      string `toml:"log_file" comment:"Log file of the server, which is followed for its output"`
+	StopCommand  string `toml:"stop_command" comment:"Command that stops the server (default \"stop\")"`
+	KillCommand  string `toml:"kill_command" comment:"Command sent if the server has not stopped after the stop timeout"`
+	PollInterval int    `toml:"poll_interval" comment:"Seconds between checks that the server is up (default 10)"`
+	Timeout      int    `toml:"timeout" comment:"Seconds to wait when connecting and for replies (default 10)"`
+}
+
+func (c *Config) validate() error {
+	if c.Address == "" {
+		return errors.New("address cannot be empty")
+	}
+
+	return nil
+}
+
+func (c *Config) stopCommand() string {
+	if c.StopCommand == "" {
+		return defaultStopCommand
+	}
+
+	return c.StopCommand
+}
+
+func (c *Config) pollInterval() time.Duration {
+	if c.PollInterval <= 0 {
+		return defaultPollInterval
+	}
+
+	return time.Duration(c.PollInterval) * time.Second
+}
+
+func (c *Config) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return time.Duration(c.Timeout) * time.Second
+}
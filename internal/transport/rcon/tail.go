@@ -0,0 +1,109 @@
+package rcon
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// tailer follows a file as it is written to, like tail -F. It follows the path rather than the file, so that it
+// continues from the start of the new file when the old one is rotated away or truncated
+type tailer struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// open opens the file at the tailer's path, starting at its end if atEnd is set
+func (t *tailer) open(atEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	t.close()
+	t.file, t.info, t.offset, t.partial = f, info, 0, nil
+
+	if atEnd {
+		if t.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		t.file = nil
+	}
+}
+
+// read returns all complete lines written since the last read. A file that did not exist when the tailer was
+// started is read from its start once it is created
+func (t *tailer) read() ([]string, error) {
+	if t.file == nil {
+		if err := t.open(false); os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	lines, err := t.readLines()
+	if err != nil {
+		return lines, err
+	}
+
+	info, err := os.Stat(t.path)
+
+	switch {
+	case os.IsNotExist(err):
+		// Rotated away, and not yet replaced. Keep the old file until it is
+		return lines, nil
+	case err != nil:
+		return lines, err
+	case os.SameFile(info, t.info) && info.Size() >= t.offset:
+		return lines, nil
+	}
+
+	if err := t.open(false); err != nil {
+		return lines, err
+	}
+
+	more, err := t.readLines()
+
+	return append(lines, more...), err
+}
+
+func (t *tailer) readLines() ([]string, error) {
+	b, err := ioutil.ReadAll(t.file)
+	t.offset += int64(len(b))
+	data := append(t.partial, b...)
+
+	end := bytes.LastIndexByte(data, '\n')
+	if end == -1 {
+		t.partial = data
+		return nil, err
+	}
+
+	t.partial = append([]byte(nil), data[end+1:]...)
+	lines := strings.Split(string(data[:end]), "\n")
+
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+
+	return lines, err
+}
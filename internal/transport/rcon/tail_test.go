@@ -0,0 +1,68 @@
+package rcon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTailer_read(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gggb-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "latest.log")
+
+	tail := &tailer{path: path}
+	defer tail.close()
+
+	write := func(data string) {
+		t.Helper()
+
+		if err := ioutil.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name string
+		do   func()
+		want []string
+	}{
+		{name: "missing file", do: func() {}},
+		{name: "created", do: func() { write("one\ntwo\nthr") }, want: []string{"one", "two"}},
+		{name: "appended", do: func() { appendTo(t, path, "ee\r\n") }, want: []string{"three"}},
+		{name: "nothing new", do: func() {}},
+		{name: "truncated", do: func() { write("four\n") }, want: []string{"four"}},
+		{
+			name: "rotated",
+			do: func() {
+				appendTo(t, path, "five\n")
+
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"five"},
+		},
+		{name: "replaced", do: func() { write("six\nseven\n") }, want: []string{"six", "seven"}},
+	}
+
+	for _, s := range steps {
+		s.do()
+
+		got, err := tail.read()
+		if err != nil {
+			t.Fatalf("%s: read() error = %v", s.name, err)
+		}
+
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: read() = %q, want %q", s.name, got, s.want)
+		}
+	}
+}
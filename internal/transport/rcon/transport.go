@@ -0,0 +1,483 @@
+package rcon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/transport/util"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+// These are variables rather than constants so that tests can shorten them
+var (
+	tailInterval         = time.Millisecond * 250
+	stoppingPollInterval = time.Second
+)
+
+const outputBufferSize = 100
+
+type state int
+
+const (
+	disconnected state = iota
+	connecting
+	connected
+	stopping
+)
+
+// New creates a new RCONTransport
+func New(transportConfig tomlconf.ConfigHolder, logger *log.Logger) (*RCONTransport, error) {
+	r := &RCONTransport{log: logger.Clone().SetPrefix(logger.Prefix() + "|" + "RCON")}
+	if err := r.Update(transportConfig); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// RCONTransport is a transport implementation for game servers that are started and stopped by something other than
+// the bot. The game is considered to be running while it is reachable over RCON or being connected to, lines written to
+// it are sent as RCON commands, and its output is read from its log file, along with the responses to any commands sent
+type RCONTransport struct {
+	log *log.Logger
+
+	confMu sync.Mutex
+	conf   *Config
+
+	mu       sync.Mutex
+	state    state
+	client   *client
+	stopping chan struct{} // Closed once a stop has been requested, so that the connection is checked more often
+	exited   chan struct{} // Closed when Run returns
+
+	outMu     sync.RWMutex
+	stdout    chan []byte
+	stderr    chan []byte
+	outClosed bool
+}
+
+func (r *RCONTransport) getConf() *Config {
+	r.confMu.Lock()
+	defer r.confMu.Unlock()
+
+	return r.conf
+}
+
+func (r *RCONTransport) getState() state {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state
+}
+
+func (r *RCONTransport) setState(s state) {
+	r.mu.Lock()
+	r.state = s
+	r.mu.Unlock()
+}
+
+func (r *RCONTransport) getClient() *client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.client
+}
+
+// GetStatus returns the current state of the connection to the game
+func (r *RCONTransport) GetStatus() util.TransportStatus {
+	switch r.getState() {
+	case connecting, connected, stopping:
+		return util.Running
+	case disconnected:
+		return util.Stopped
+	default:
+		return util.Unknown
+	}
+}
+
+// GetHumanStatus returns the status of the transport in a human readable form
+func (r *RCONTransport) GetHumanStatus() string {
+	addr := r.getConf().Address
+
+	switch r.getState() {
+	case connecting:
+		return fmt.Sprintf("connecting to %s", addr)
+	case connected:
+		return fmt.Sprintf("connected to %s", addr)
+	case stopping:
+		if r.getClient() == nil {
+			return fmt.Sprintf("stopping (not connected to %s)", addr)
+		}
+
+		return fmt.Sprintf("stopping (connected to %s)", addr)
+	default:
+		return "not connected"
+	}
+}
+
+// IsRunning returns whether or not the game is reachable over RCON, or is being connected to
+func (r *RCONTransport) IsRunning() bool {
+	return r.GetStatus() == util.Running
+}
+
+// Stdout returns a channel that will have lines from the game's log file, and responses to commands, sent over it
+func (r *RCONTransport) Stdout() <-chan []byte {
+	r.outMu.RLock()
+	defer r.outMu.RUnlock()
+
+	return r.stdout
+}
+
+// Stderr returns a channel that is closed when Run returns. Nothing is ever sent on it, as RCON has no stderr
+func (r *RCONTransport) Stderr() <-chan []byte {
+	r.outMu.RLock()
+	defer r.outMu.RUnlock()
+
+	return r.stderr
+}
+
+// Update updates the Transport with a TransportConfig. Changes take effect the next time the game is connected to
+func (r *RCONTransport) Update(rawConf tomlconf.ConfigHolder) error {
+	conf := new(Config)
+
+	if err := rawConf.RealConf.Unmarshal(conf); err != nil {
+		return fmt.Errorf("could not unmarshal config: %w", err)
+	}
+
+	if err := conf.validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	r.confMu.Lock()
+	r.conf = conf
+	r.confMu.Unlock()
+
+	return nil
+}
+
+func (r *RCONTransport) openOutput() {
+	r.outMu.Lock()
+	r.stdout = make(chan []byte, outputBufferSize)
+	r.stderr = make(chan []byte)
+	r.outClosed = false
+	r.outMu.Unlock()
+}
+
+func (r *RCONTransport) closeOutput() {
+	r.outMu.Lock()
+	close(r.stdout)
+	close(r.stderr)
+	r.outClosed = true
+	r.outMu.Unlock()
+}
+
+// sendLine sends the given line to stdout, waiting until it can be sent or stop is closed. A nil stop waits forever
+func (r *RCONTransport) sendLine(line string, stop <-chan struct{}) {
+	r.outMu.RLock()
+	defer r.outMu.RUnlock()
+
+	if r.outClosed {
+		return
+	}
+
+	select {
+	case r.stdout <- []byte(line):
+		return
+	default:
+	}
+
+	select {
+	case r.stdout <- []byte(line):
+	case <-stop:
+	}
+}
+
+// sendResponse sends the lines of a command response to stdout. Lines are dropped rather than waited on if stdout is
+// full, as commands can be sent from whatever is reading it
+func (r *RCONTransport) sendResponse(resp string) {
+	r.outMu.RLock()
+	defer r.outMu.RUnlock()
+
+	if r.outClosed {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(resp, "\r\n"), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line == "" {
+			continue
+		}
+
+		select {
+		case r.stdout <- []byte(line):
+		default:
+			r.log.Warnf("output is full, dropping response line %q", line)
+		}
+	}
+}
+
+// Run connects to the game over RCON, retrying until it can connect or is stopped. It blocks until the connection is
+// lost, or the game is stopped. As the exit code of the game is unknown, 0 is returned if it was stopped by StopOrKill,
+// and 1 otherwise
+func (r *RCONTransport) Run(start chan struct{}) (exitCode int, exitString string, exitError error) {
+	r.mu.Lock()
+	if r.state != disconnected {
+		r.mu.Unlock()
+		close(start)
+
+		return -1, "", fmt.Errorf("could not start game: %w", util.ErrorAlreadyRunning)
+	}
+
+	stopRequested, exited := make(chan struct{}), make(chan struct{})
+	r.state, r.stopping, r.exited = connecting, stopRequested, exited
+	r.mu.Unlock()
+
+	conf := r.getConf()
+
+	// The log file is opened before start is closed, so that nothing written once the game is running is missed
+	var t *tailer
+	if conf.LogFile != "" {
+		t = &tailer{path: conf.LogFile}
+		if err := t.open(true); err != nil {
+			r.log.Warnf("could not open log file: %s", err)
+		}
+	}
+
+	r.openOutput()
+	close(start)
+
+	stopTail, tailDone := make(chan struct{}), make(chan struct{})
+	go r.tail(t, stopTail, tailDone)
+
+	c, err := r.connect(conf, stopRequested)
+	if err == nil {
+		err = r.watch(c, conf.pollInterval(), stopRequested)
+		c.close()
+	}
+
+	close(stopTail)
+	<-tailDone
+	r.closeOutput()
+
+	r.mu.Lock()
+	wasStopping := r.state == stopping
+	r.state, r.client = disconnected, nil
+	close(exited)
+	r.mu.Unlock()
+
+	switch {
+	case wasStopping:
+		return 0, "stopped", nil
+	case c == nil:
+		return -1, "", fmt.Errorf("could not connect to RCON server at %s: %w", conf.Address, err)
+	}
+
+	r.log.Warnf("lost connection to %s: %s", conf.Address, err)
+
+	return 1, fmt.Sprintf("lost connection to RCON server: %s", err), nil
+}
+
+// connect dials the server every poll interval until it connects, a stop is requested, or the password is rejected.
+// The client is only returned if the transport was marked as connected
+func (r *RCONTransport) connect(conf *Config, stopRequested <-chan struct{}) (*client, error) {
+	lastErr := ""
+
+	for {
+		c, err := dial(conf.Address, conf.Password, conf.timeout())
+		if err == nil {
+			r.mu.Lock()
+			stopped := r.state == stopping
+
+			if !stopped {
+				r.state, r.client = connected, c
+			}
+			r.mu.Unlock()
+
+			if stopped {
+				c.close()
+				return nil, errors.New("stopped while connecting")
+			}
+
+			r.log.Infof("connected to %s", conf.Address)
+
+			return c, nil
+		}
+
+		if errors.Is(err, ErrAuthFailed) {
+			return nil, err
+		}
+
+		// Only log errors once, rather than every attempt
+		if err.Error() != lastErr {
+			lastErr = err.Error()
+			r.log.Warnf("could not connect to %s, retrying every %s: %s", conf.Address, conf.pollInterval(), err)
+		}
+
+		select {
+		case <-stopRequested:
+			return nil, errors.New("stopped while connecting")
+		case <-time.After(conf.pollInterval()):
+		}
+	}
+}
+
+// watch pings the server every interval, or more often once stopRequested is closed, until it stops responding or the
+// connection is closed. It returns the error that ended the connection
+func (r *RCONTransport) watch(c *client, interval time.Duration, stopRequested <-chan struct{}) error {
+	for {
+		select {
+		case <-c.closed:
+			return errors.New("connection closed")
+		case <-stopRequested:
+			interval, stopRequested = stoppingPollInterval, nil
+		case <-time.After(interval):
+		}
+
+		if err := c.ping(); err != nil {
+			return err
+		}
+	}
+}
+
+// tail sends lines read by t to stdout until stop is closed. A nil t sends nothing
+func (r *RCONTransport) tail(t *tailer, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	if t == nil {
+		return
+	}
+
+	defer t.close()
+
+	lastErr := ""
+
+	for {
+		stopped := false
+		select {
+		case <-stop:
+			stopped = true
+		case <-time.After(tailInterval):
+		}
+
+		lines, err := t.read()
+		for _, l := range lines {
+			r.sendLine(l, stop)
+		}
+
+		// Only log errors once, rather than every tailInterval
+		if err == nil {
+			lastErr = ""
+		} else if err.Error() != lastErr {
+			lastErr = err.Error()
+			r.log.Warnf("could not read log file: %s", err)
+		}
+
+		if stopped {
+			return
+		}
+	}
+}
+
+// StopOrKill sends the stop command, and after 30 seconds, the kill command
+func (r *RCONTransport) StopOrKill() error {
+	return r.StopOrKillTimeout(time.Second * 30)
+}
+
+// StopOrKillTimeout is like StopOrKill, but allows you to specify the timeout. If the game is still reachable once
+// the kill command has had time to work, or there is no kill command, the connection is closed and an error returned
+func (r *RCONTransport) StopOrKillTimeout(duration time.Duration) error {
+	r.mu.Lock()
+	if r.state == disconnected {
+		r.mu.Unlock()
+		return util.ErrorNotRunning
+	}
+
+	if r.state != stopping {
+		r.state = stopping
+		close(r.stopping)
+	}
+
+	c, exited := r.client, r.exited
+	r.mu.Unlock()
+
+	if c == nil {
+		// Stopped while connecting, Run gives up once any attempt in progress finishes
+		<-exited
+		return nil
+	}
+
+	conf := r.getConf()
+
+	// The server may well close the connection before it responds
+	if _, err := c.exec(conf.stopCommand()); err != nil {
+		r.log.Infof("error while sending stop command: %s", err)
+	}
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(duration):
+	}
+
+	if conf.KillCommand != "" {
+		r.log.Warnf("game did not stop within %s, sending kill command", duration)
+
+		if _, err := c.exec(conf.KillCommand); err != nil {
+			r.log.Infof("error while sending kill command: %s", err)
+		}
+
+		select {
+		case <-exited:
+			return nil
+		case <-time.After(conf.timeout()):
+		}
+	}
+
+	c.close()
+	<-exited
+
+	return fmt.Errorf("game did not stop within %s, and is no longer being watched", duration)
+}
+
+// StopOrKillWaitgroup calls StopOrKill, and marks a waitgroup as Done once it has completed.
+// The waitgroup is incremented automatically before the StopOrKill call
+func (r *RCONTransport) StopOrKillWaitgroup(group *sync.WaitGroup) {
+	group.Add(1)
+
+	if err := r.StopOrKill(); err != nil {
+		r.log.Warnf("error while stopping game: %s", err)
+	}
+
+	group.Done()
+}
+
+// Write sends each line in b to the game as an RCON command. Responses are sent to stdout
+func (r *RCONTransport) Write(b []byte) (n int, err error) {
+	c := r.getClient()
+	if c == nil {
+		return 0, util.ErrorNotRunning
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\r\n"), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line == "" {
+			continue
+		}
+
+		resp, err := c.exec(line)
+		if err != nil {
+			return 0, fmt.Errorf("could not send command: %w", err)
+		}
+
+		r.sendResponse(resp)
+	}
+
+	return len(b), nil
+}
+
+// WriteString is the same as Write but accepts a string instead of a byte slice
+func (r *RCONTransport) WriteString(s string) (n int, err error) {
+	return r.Write([]byte(s))
+}
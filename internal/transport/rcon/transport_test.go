@@ -0,0 +1,531 @@
+package rcon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/transport/util"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+const testPassword = "hunter2"
+
+// fakeServer is an RCON server that behaves like both Source and Minecraft servers do. It shuts down, closing all of
+// its connections, when it is sent one of its shutdown commands
+type fakeServer struct {
+	listener  net.Listener
+	responses map[string]string
+	shutdown  map[string]bool
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	commands []string
+	closed   bool
+}
+
+func newFakeServer(t *testing.T, shutdownCommands ...string) *fakeServer {
+	t.Helper()
+
+	return listenFakeServer(t, "127.0.0.1:0", shutdownCommands...)
+}
+
+// listenFakeServer is like newFakeServer, but listens on the given address
+func listenFakeServer(t *testing.T, addr string, shutdownCommands ...string) *fakeServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeServer{
+		listener:  l,
+		responses: map[string]string{"list": "There are 0 of a max of 20 players online:\n"},
+		shutdown:  make(map[string]bool),
+	}
+
+	for _, c := range shutdownCommands {
+		s.shutdown[c] = true
+	}
+
+	go s.serve()
+
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.listener.Addr().String() }
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var out []packet
+
+		switch p.typ {
+		case typeAuth:
+			id := p.id
+			if p.body != testPassword {
+				id = -1
+			}
+
+			out = []packet{{id: p.id, typ: typeResponse}, {id: id, typ: typeAuthResponse}}
+		case typeCommand:
+			s.mu.Lock()
+			s.commands = append(s.commands, p.body)
+			s.mu.Unlock()
+
+			resp, ok := s.responses[p.body]
+			if !ok {
+				resp = fmt.Sprintf("Unknown command %q", p.body)
+			}
+
+			out = []packet{{id: p.id, typ: typeResponse, body: resp}}
+		default:
+			// Echo the empty response, followed by the junk packet that Source servers send after one
+			out = []packet{{id: p.id, typ: typeResponse}, {id: p.id, typ: typeResponse, body: "\x00\x01"}}
+		}
+
+		for _, o := range out {
+			if err := writePacket(conn, o); err != nil {
+				return
+			}
+		}
+
+		if p.typ == typeCommand && s.shutdown[p.body] {
+			s.close()
+			return
+		}
+	}
+}
+
+func (s *fakeServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+	_ = s.listener.Close()
+
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+}
+
+func (s *fakeServer) getCommands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+func TestDial(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.close()
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{name: "correct password", password: testPassword},
+		{name: "wrong password", password: "hunter3", wantErr: ErrAuthFailed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := dial(s.addr(), tt.password, time.Second*5)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("dial() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if c != nil {
+				c.close()
+			}
+		})
+	}
+}
+
+func TestClient_exec(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.close()
+
+	c, err := dial(s.addr(), testPassword, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.close()
+
+	// The junk packet sent after the ping's reply must not be taken as the reply to the command
+	if err := c.ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range []string{"list", "list"} {
+		got, err := c.exec(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := s.responses[cmd]; got != want {
+			t.Errorf("exec(%q) = %q, want %q", cmd, got, want)
+		}
+	}
+}
+
+// runTransport starts a transport connected to s in the background, returning it, the file it tails, and a channel
+// that Run's results are sent on
+func runTransport(t *testing.T, s *fakeServer, dir, killCommand string) (*RCONTransport, string, chan string) {
+	t.Helper()
+
+	r, logFile, res := startTransport(t, s.addr(), testPassword, dir, killCommand)
+	waitForState(t, r, connected, res)
+
+	return r, logFile, res
+}
+
+// startTransport starts a transport for the server at addr in the background, without waiting for it to connect
+func startTransport(t *testing.T, addr, password, dir, killCommand string) (*RCONTransport, string, chan string) {
+	t.Helper()
+
+	logFile := filepath.Join(dir, "latest.log")
+	if err := ioutil.WriteFile(logFile, []byte("from before the bot connected\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &RCONTransport{
+		log: log.New(0, ioutil.Discard, "TEST", log.INFO),
+		conf: &Config{
+			Address:      addr,
+			Password:     password,
+			LogFile:      logFile,
+			KillCommand:  killCommand,
+			Timeout:      1,
+			PollInterval: 1,
+		},
+	}
+
+	start := make(chan struct{})
+	res := make(chan string, 1)
+
+	go func() {
+		code, status, err := r.Run(start)
+		res <- fmt.Sprintf("%d %q %v", code, status, err)
+	}()
+
+	<-start
+
+	return r, logFile, res
+}
+
+func waitForState(t *testing.T, r *RCONTransport, want state, res chan string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+
+	for r.getState() != want {
+		select {
+		case got := <-res:
+			t.Fatalf("Run returned %s while waiting for state %d", got, want)
+		case <-time.After(time.Millisecond * 10):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for state %d, status %q", want, r.GetHumanStatus())
+		}
+	}
+}
+
+// freeAddr returns an address that nothing is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func appendTo(t *testing.T, path, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLine(t *testing.T, c <-chan []byte) string {
+	t.Helper()
+
+	select {
+	case b, ok := <-c:
+		if !ok {
+			t.Fatal("stdout was closed")
+		}
+
+		return string(b)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for a line on stdout")
+	}
+
+	return ""
+}
+
+func TestRCONTransport_Run(t *testing.T) {
+	tailInterval = time.Millisecond * 10
+	stoppingPollInterval = time.Millisecond * 10
+
+	dir, err := ioutil.TempDir("", "gggb-rcon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s := newFakeServer(t, "stop")
+	defer s.close()
+
+	r, logFile, res := runTransport(t, s, dir, "")
+
+	if _, _, err := r.Run(make(chan struct{})); !errors.Is(err, util.ErrorAlreadyRunning) {
+		t.Errorf("second Run() error = %v, want %v", err, util.ErrorAlreadyRunning)
+	}
+
+	stdout := r.Stdout()
+
+	appendTo(t, logFile, "Done (1.2s)!\r\nhalf a ")
+	appendTo(t, logFile, "line\n")
+
+	for _, want := range []string{"Done (1.2s)!", "half a line"} {
+		if got := readLine(t, stdout); got != want {
+			t.Errorf("got line %q from the log file, want %q", got, want)
+		}
+	}
+
+	if _, err := r.WriteString("list\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := readLine(t, stdout), "There are 0 of a max of 20 players online:"; got != want {
+		t.Errorf("got response %q, want %q", got, want)
+	}
+
+	if err := r.StopOrKill(); err != nil {
+		t.Errorf("StopOrKill() = %v", err)
+	}
+
+	if got, want := <-res, `0 "stopped" <nil>`; got != want {
+		t.Errorf("Run() returned %s, want %s", got, want)
+	}
+
+	for range stdout {
+		// Wait for it to be closed
+	}
+
+	if _, ok := <-r.Stderr(); ok {
+		t.Error("stderr was not closed")
+	}
+
+	if r.IsRunning() || r.GetStatus() != util.Stopped {
+		t.Errorf("transport is still running after stopping, status %q", r.GetHumanStatus())
+	}
+
+	if _, err := r.WriteString("list"); !errors.Is(err, util.ErrorNotRunning) {
+		t.Errorf("Write() after stopping error = %v, want %v", err, util.ErrorNotRunning)
+	}
+
+	if got, want := fmt.Sprint(s.getCommands()), "[list stop]"; got != want {
+		t.Errorf("server got commands %s, want %s", got, want)
+	}
+}
+
+func TestRCONTransport_StopOrKillTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		shutdown     []string
+		kill         string
+		wantErr      bool
+		wantCommands string
+	}{
+		{name: "stop", shutdown: []string{"stop"}, kill: "kill", wantCommands: "[stop]"},
+		{name: "kill", shutdown: []string{"kill"}, kill: "kill", wantCommands: "[stop kill]"},
+		{name: "no kill command", wantErr: true, wantCommands: "[stop]"},
+		{name: "kill fails", kill: "kill", wantErr: true, wantCommands: "[stop kill]"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gggb-rcon")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer os.RemoveAll(dir)
+
+			s := newFakeServer(t, tt.shutdown...)
+			defer s.close()
+
+			r, _, res := runTransport(t, s, dir, tt.kill)
+
+			if err := r.StopOrKillTimeout(time.Millisecond * 100); (err != nil) != tt.wantErr {
+				t.Errorf("StopOrKillTimeout() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if got := <-res; got != `0 "stopped" <nil>` {
+				t.Errorf("Run() returned %s", got)
+			}
+
+			if got := fmt.Sprint(s.getCommands()); got != tt.wantCommands {
+				t.Errorf("server got commands %s, want %s", got, tt.wantCommands)
+			}
+		})
+	}
+}
+
+func TestRCONTransport_lostConnection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gggb-rcon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s := newFakeServer(t)
+	r, _, res := runTransport(t, s, dir, "")
+	s.close()
+
+	select {
+	case got := <-res:
+		if want := `1 "lost connection to RCON server: `; !strings.HasPrefix(got, want) {
+			t.Errorf("Run() returned %s, want %s...", got, want)
+		}
+	case <-time.After(time.Second * 15):
+		t.Fatal("Run did not return after the server went away")
+	}
+
+	// With nothing to connect to, it keeps trying until it is stopped
+	start := make(chan struct{})
+	res = make(chan string, 1)
+
+	go func() {
+		code, status, err := r.Run(start)
+		res <- fmt.Sprintf("%d %q %v", code, status, err)
+	}()
+
+	<-start
+
+	if !r.IsRunning() || !strings.HasPrefix(r.GetHumanStatus(), "connecting to") {
+		t.Errorf("transport is not connecting, status %q", r.GetHumanStatus())
+	}
+
+	if err := r.StopOrKill(); err != nil {
+		t.Errorf("StopOrKill() while connecting = %v", err)
+	}
+
+	if got, want := <-res, `0 "stopped" <nil>`; got != want {
+		t.Errorf("Run() returned %s, want %s", got, want)
+	}
+
+	if err := r.StopOrKill(); !errors.Is(err, util.ErrorNotRunning) {
+		t.Errorf("StopOrKill() error = %v, want %v", err, util.ErrorNotRunning)
+	}
+}
+
+func TestRCONTransport_lateServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gggb-rcon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	addr := freeAddr(t)
+	r, _, res := startTransport(t, addr, testPassword, dir, "")
+
+	// Give it time to fail at least once before there is anything to connect to
+	time.Sleep(time.Millisecond * 100)
+
+	if got := r.getState(); got != connecting {
+		t.Fatalf("state before the server is up = %d, want %d (connecting)", got, connecting)
+	}
+
+	s := listenFakeServer(t, addr, "stop")
+	defer s.close()
+
+	waitForState(t, r, connected, res)
+
+	if err := r.StopOrKill(); err != nil {
+		t.Errorf("StopOrKill() = %v", err)
+	}
+
+	if got, want := <-res, `0 "stopped" <nil>`; got != want {
+		t.Errorf("Run() returned %s, want %s", got, want)
+	}
+}
+
+func TestRCONTransport_wrongPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gggb-rcon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s := newFakeServer(t)
+	defer s.close()
+
+	r, _, res := startTransport(t, s.addr(), "hunter3", dir, "")
+
+	// A rejected password will not start working, so it is not retried
+	if got := <-res; !strings.Contains(got, ErrAuthFailed.Error()) {
+		t.Errorf("Run() returned %s, want an %q error", got, ErrAuthFailed)
+	}
+
+	if r.IsRunning() {
+		t.Error("transport is still running after failing to authenticate")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"awesome-dragon.science/go/goGoGameBot/internal/interfaces"
 	"awesome-dragon.science/go/goGoGameBot/internal/transport/network"
 	"awesome-dragon.science/go/goGoGameBot/internal/transport/process"
+	"awesome-dragon.science/go/goGoGameBot/internal/transport/rcon"
 	"awesome-dragon.science/go/goGoGameBot/internal/transport/util"
 	"awesome-dragon.science/go/goGoGameBot/internal/version"
 	"awesome-dragon.science/go/goGoGameBot/pkg/log"
@@ -67,6 +68,8 @@ func GetTransport(name string, transportConfig tomlconf.ConfigHolder, logger *lo
 		}
 
 		return network.New(transportConfig, logger)
+	case "rcon":
+		return rcon.New(transportConfig, logger)
 	default:
 		return nil, fmt.Errorf("cannot create transport %q: %w", name, ErrNoTransport)
 	}
@@ -0,0 +1,2 @@
+// Package webhook sends game events to HTTP endpoints, retrying deliveries that fail
+package webhook
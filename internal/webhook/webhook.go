@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/internal/version"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+	"awesome-dragon.science/go/goGoGameBot/pkg/util"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-GoGoGameBot-Event"
+	SignatureHeader = "X-GoGoGameBot-Signature"
+)
+
+const queueSize = 100 // Deliveries that can be waiting on a single webhook before new ones are dropped
+
+var (
+	retryDelay    = time.Second      // The delay before the first retry of a delivery, doubled on each retry after
+	maxRetryDelay = time.Minute * 5  // The longest delay between retries
+	reloadGrace   = time.Second * 30 // How long webhooks removed or changed on reload have to finish their deliveries
+)
+
+// Event is a single game event. It is sent as is to json webhooks
+type Event struct {
+	Type     string            `json:"type"`
+	Game     string            `json:"game"`
+	Message  string            `json:"message"`
+	Time     time.Time         `json:"time"`
+	ExitCode *int              `json:"exit_code,omitempty"` // Set on stop and crash events
+	Regexp   string            `json:"regexp,omitempty"`    // Set on notify events
+	Groups   map[string]string `json:"groups,omitempty"`    // Set on notify events
+}
+
+// payload returns the body to send for the given event to a webhook of the given type
+func payload(typ string, e Event) ([]byte, error) {
+	text := fmt.Sprintf("[%s] %s", e.Game, e.Message)
+
+	switch typ {
+	case tomlconf.WebhookSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case tomlconf.WebhookDiscord:
+		// Game output could contain mentions, dont let it ping anyone
+		return json.Marshal(map[string]interface{}{
+			"content":          text,
+			"allowed_mentions": map[string][]string{"parse": {}},
+		})
+	default:
+		return json.Marshal(e)
+	}
+}
+
+// Sign returns the signature for the given body with the given secret, as sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier sends events to a set of webhooks. Each webhook has its own queue, and deliveries to it are made in order
+type Notifier struct {
+	mu        sync.RWMutex
+	endpoints map[string]*endpoint
+	closed    bool
+	log       *log.Logger
+}
+
+// New creates a Notifier with no webhooks. Use Update to add them
+func New(logger *log.Logger) *Notifier {
+	return &Notifier{endpoints: make(map[string]*endpoint), log: logger}
+}
+
+// Update sets the webhooks events are sent to. Webhooks whose config has not changed keep their queues, webhooks that
+// were removed or changed are given a short time to finish their queued deliveries before they are dropped
+func (n *Notifier) Update(confs []tomlconf.Webhook) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return
+	}
+
+	old := n.endpoints
+	n.endpoints = make(map[string]*endpoint, len(confs))
+
+	for _, conf := range confs {
+		if e, ok := old[conf.Name]; ok && reflect.DeepEqual(e.conf, conf) {
+			n.endpoints[conf.Name] = e
+			delete(old, conf.Name)
+
+			continue
+		}
+
+		n.endpoints[conf.Name] = newEndpoint(conf, n.log)
+	}
+
+	for _, e := range old {
+		go e.close(reloadGrace)
+	}
+}
+
+// Notify queues the given event on every webhook that wants it. It does not block
+func (n *Notifier) Notify(e Event) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		return
+	}
+
+	for name, ep := range n.endpoints {
+		if !ep.wants(e) {
+			continue
+		}
+
+		select {
+		case ep.queue <- e:
+		default:
+			n.log.Warnf("webhook %q has too many queued deliveries, dropping %s event for %s", name, e.Type, e.Game)
+		}
+	}
+}
+
+// Close stops the Notifier, waiting up to the given timeout for queued deliveries to be made. Any deliveries still
+// queued after that are dropped
+func (n *Notifier) Close(timeout time.Duration) {
+	n.mu.Lock()
+	n.closed = true
+	endpoints := n.endpoints
+	n.endpoints = nil
+	n.mu.Unlock()
+
+	wg := sync.WaitGroup{}
+
+	for _, e := range endpoints {
+		wg.Add(1)
+
+		go func(e *endpoint) {
+			defer wg.Done()
+			e.close(timeout)
+		}(e)
+	}
+
+	wg.Wait()
+}
+
+// endpoint is a single webhook and its queue of deliveries
+type endpoint struct {
+	conf   tomlconf.Webhook
+	client *http.Client
+	log    *log.Logger
+	queue  chan Event
+	ctx    context.Context
+	cancel context.CancelFunc // Cancels ctx, aborting the current delivery and dropping any queued
+	done   chan struct{}
+}
+
+func newEndpoint(conf tomlconf.Webhook, logger *log.Logger) *endpoint {
+	e := &endpoint{
+		conf:   conf,
+		client: &http.Client{Timeout: time.Duration(conf.Timeout) * time.Second},
+		log:    logger,
+		queue:  make(chan Event, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	go e.run()
+
+	return e
+}
+
+// wants returns whether or not the given event should be sent to this webhook
+func (e *endpoint) wants(ev Event) bool {
+	return (len(e.conf.Events) == 0 || util.ContainsFold(e.conf.Events, ev.Type)) &&
+		(len(e.conf.Games) == 0 || util.ContainsFold(e.conf.Games, ev.Game))
+}
+
+func (e *endpoint) run() {
+	defer close(e.done)
+
+	for ev := range e.queue {
+		e.deliver(ev)
+	}
+}
+
+// close stops accepting new deliveries, and waits up to grace for the queued ones to be made before dropping the rest
+func (e *endpoint) close(grace time.Duration) {
+	close(e.queue)
+
+	select {
+	case <-e.done:
+	case <-time.After(grace):
+	}
+
+	e.cancel()
+	<-e.done
+}
+
+// deliver sends the given event, retrying with increasing delays if the webhook could not be reached or returned a
+// server error
+func (e *endpoint) deliver(ev Event) {
+	body, err := payload(e.conf.Type, ev)
+	if err != nil {
+		e.log.Warnf("could not create payload for webhook %q: %s", e.conf.Name, err)
+		return
+	}
+
+	delay := retryDelay
+
+	for attempt := 1; ; attempt++ {
+		retry, err := e.post(ev.Type, body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt > e.conf.MaxRetries {
+			e.log.Warnf("dropping %s event for %s to webhook %q after %d attempts: %s",
+				ev.Type, ev.Game, e.conf.Name, attempt, err)
+
+			return
+		}
+
+		e.log.Debugf("delivery to webhook %q failed, retrying in %s: %s", e.conf.Name, delay, err)
+
+		select {
+		case <-e.ctx.Done():
+			e.log.Warnf("dropping %s event for %s to webhook %q: %s", ev.Type, ev.Game, e.conf.Name, e.ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// post sends the given body to the webhook, returning whether or not a failed request is worth retrying
+func (e *endpoint) post(eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range e.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goGoGameBot/"+version.Version)
+	req.Header.Set(EventHeader, eventType)
+
+	if e.conf.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(e.conf.Secret, body))
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return e.ctx.Err() == nil, err
+	}
+
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected response status %q", res.Status)
+	default:
+		return false, fmt.Errorf("webhook rejected the delivery with status %q", res.Status)
+	}
+}
@@ -0,0 +1,306 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"awesome-dragon.science/go/goGoGameBot/internal/config/tomlconf"
+	"awesome-dragon.science/go/goGoGameBot/pkg/log"
+)
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// testServer records the requests made to it, responding with the given statuses in order, and 200 after that
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []request
+}
+
+func newTestServer(statuses ...int) *testServer {
+	s := &testServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, request{header: r.Header, body: body})
+
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+
+	return s
+}
+
+func (s *testServer) getRequests() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]request(nil), s.requests...)
+}
+
+func testConf(name, url string) tomlconf.Webhook {
+	return tomlconf.Webhook{Name: name, URL: url, Type: tomlconf.WebhookJSON, Timeout: 5, MaxRetries: 5}
+}
+
+// notifyAndClose sends the given events to a Notifier with the given webhooks, and waits for them to be delivered
+func notifyAndClose(confs []tomlconf.Webhook, events ...Event) {
+	n := New(log.New(0, ioutil.Discard, "TEST", log.INFO))
+	n.Update(confs)
+
+	for _, e := range events {
+		n.Notify(e)
+	}
+
+	n.Close(time.Second * 5)
+}
+
+func TestNotifier_payloads(t *testing.T) {
+	code := 1
+	event := Event{
+		Type:     tomlconf.WebhookCrash,
+		Game:     "test",
+		Message:  "exited with code 1",
+		Time:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		ExitCode: &code,
+	}
+
+	tests := []struct {
+		name string
+		typ  string
+		want string
+	}{
+		{
+			name: "json",
+			typ:  tomlconf.WebhookJSON,
+			want: `{"type":"crash","game":"test","message":"exited with code 1","time":"2020-01-02T03:04:05Z","exit_code":1}`,
+		},
+		{
+			name: "slack",
+			typ:  tomlconf.WebhookSlack,
+			want: `{"text":"[test] exited with code 1"}`,
+		},
+		{
+			name: "discord",
+			typ:  tomlconf.WebhookDiscord,
+			want: `{"allowed_mentions":{"parse":[]},"content":"[test] exited with code 1"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			defer s.Close()
+
+			conf := testConf("test", s.URL)
+			conf.Type = tt.typ
+			conf.Secret = "hunter2"
+			conf.Headers = map[string]string{"X-Extra": "extra"}
+
+			notifyAndClose([]tomlconf.Webhook{conf}, event)
+
+			reqs := s.getRequests()
+			if len(reqs) != 1 {
+				t.Fatalf("got %d requests, want 1", len(reqs))
+			}
+
+			req := reqs[0]
+			if string(req.body) != tt.want {
+				t.Errorf("body = %s, want %s", req.body, tt.want)
+			}
+
+			if got, want := req.header.Get(SignatureHeader), Sign("hunter2", req.body); got != want {
+				t.Errorf("signature = %q, want %q", got, want)
+			}
+
+			if got := req.header.Get(EventHeader); got != tomlconf.WebhookCrash {
+				t.Errorf("event header = %q, want %q", got, tomlconf.WebhookCrash)
+			}
+
+			if got := req.header.Get("X-Extra"); got != "extra" {
+				t.Errorf("extra header = %q, want %q", got, "extra")
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Known value from the HMAC-SHA256 test vectors in RFC 4231
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := Sign("Jefe", []byte("what do ya want for nothing?")); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+func TestNotifier_retries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		want       int
+	}{
+		{
+			name: "success",
+			want: 1,
+		},
+		{
+			name:       "server errors",
+			statuses:   []int{http.StatusInternalServerError, http.StatusBadGateway},
+			maxRetries: 5,
+			want:       3,
+		},
+		{
+			name:       "rate limited",
+			statuses:   []int{http.StatusTooManyRequests},
+			maxRetries: 5,
+			want:       2,
+		},
+		{
+			name:       "out of retries",
+			statuses:   []int{500, 500, 500, 500},
+			maxRetries: 2,
+			want:       3,
+		},
+		{
+			name:       "rejected",
+			statuses:   []int{http.StatusBadRequest},
+			maxRetries: 5,
+			want:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(tt.statuses...)
+			defer s.Close()
+
+			conf := testConf("test", s.URL)
+			conf.MaxRetries = tt.maxRetries
+
+			notifyAndClose([]tomlconf.Webhook{conf}, Event{Type: tomlconf.WebhookStart, Game: "test"})
+
+			if got := len(s.getRequests()); got != tt.want {
+				t.Errorf("got %d requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifier_filters(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	all := testConf("all", s.URL)
+	crashes := testConf("crashes", s.URL)
+	crashes.Events = []string{tomlconf.WebhookCrash}
+	survival := testConf("survival", s.URL)
+	survival.Games = []string{"survival"}
+
+	notifyAndClose(
+		[]tomlconf.Webhook{all, crashes, survival},
+		Event{Type: tomlconf.WebhookStart, Game: "creative"},
+		Event{Type: tomlconf.WebhookCrash, Game: "creative"},
+		Event{Type: tomlconf.WebhookNotify, Game: "survival"},
+	)
+
+	// all gets all 3, crashes gets 1, and survival gets 1
+	reqs := s.getRequests()
+	if len(reqs) != 5 {
+		t.Fatalf("got %d requests, want 5", len(reqs))
+	}
+
+	counts := make(map[string]int)
+
+	for _, r := range reqs {
+		e := Event{}
+		if err := json.Unmarshal(r.body, &e); err != nil {
+			t.Fatal(err)
+		}
+
+		counts[e.Type+"/"+e.Game]++
+	}
+
+	want := map[string]int{"start/creative": 1, "crash/creative": 2, "notify/survival": 2}
+	for k, v := range want {
+		if counts[k] != v {
+			t.Errorf("got %d %s events, want %d", counts[k], k, v)
+		}
+	}
+}
+
+func TestNotifier_Update(t *testing.T) {
+	n := New(log.New(0, ioutil.Discard, "TEST", log.INFO))
+	defer n.Close(time.Second)
+
+	one := testConf("one", "http://127.0.0.1:1")
+	two := testConf("two", "http://127.0.0.1:1")
+
+	n.Update([]tomlconf.Webhook{one, two})
+	first := n.endpoints["one"]
+
+	two.Timeout = 20
+	n.Update([]tomlconf.Webhook{one, two})
+
+	if n.endpoints["one"] != first {
+		t.Error("unchanged webhook was recreated")
+	}
+
+	if n.endpoints["two"].conf.Timeout != 20 {
+		t.Error("changed webhook was not updated")
+	}
+
+	n.Update(nil)
+
+	if len(n.endpoints) != 0 {
+		t.Errorf("removed webhooks still exist: %v", n.endpoints)
+	}
+}
+
+func TestNotifier_Close(t *testing.T) {
+	s := newTestServer(500, 500, 500)
+	defer s.Close()
+
+	old := retryDelay
+	retryDelay = time.Hour
+
+	defer func() { retryDelay = old }()
+
+	n := New(log.New(0, ioutil.Discard, "TEST", log.INFO))
+	n.Update([]tomlconf.Webhook{testConf("test", s.URL)})
+	n.Notify(Event{Type: tomlconf.WebhookStop, Game: "test"})
+	n.Notify(Event{Type: tomlconf.WebhookStop, Game: "test"})
+
+	start := time.Now()
+	n.Close(time.Millisecond * 100)
+
+	if time.Since(start) > time.Second*5 {
+		t.Errorf("Close did not give up on deliveries that were retrying")
+	}
+
+	// Events sent after Close are dropped
+	n.Notify(Event{Type: tomlconf.WebhookStop, Game: "test"})
+
+	if got := len(s.getRequests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
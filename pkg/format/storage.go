@@ -1,11 +1,41 @@
 package format
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
-// Storage holds data for cross-execution storage
+// SaveDelay is how long a Storage with a Persister waits after a change before saving, so that many changes in a short
+// time only cause a single write
+var SaveDelay = time.Second * 5
+
+var timeNow = time.Now // For tests
+
+// Storage holds data for cross-execution storage. Values can be ints, bools, strings, lists of strings, or maps of
+// strings to strings, and any value can be given an expiry time. If a Persister is set, the Storage is saved to it
+// shortly after any change
 type Storage struct {
 	sync.RWMutex // Lets not have lists explode
 	data         map[string]interface{}
+	expires      map[string]time.Time
+
+	persister Persister
+	onError   func(error)
+	onChange  func()
+	changing  bool // Whether onChange is running
+	rechange  bool // Whether there were changes while onChange was running
+	dirty     bool
+	saveTimer *time.Timer
+	saveMu    sync.Mutex
+}
+
+// OnChange sets a function to be called after any change to the Storage. It is run in its own goroutine, so it may use
+// the Storage, but should not change it. Calls never overlap, changes made while it is running cause a single call once
+// it returns. A nil function disables the callback
+func (s *Storage) OnChange(f func()) {
+	s.Lock()
+	s.onChange = f
+	s.Unlock()
 }
 
 func (s *Storage) checkMap() {
@@ -13,13 +43,25 @@ func (s *Storage) checkMap() {
 	if s.data == nil {
 		s.data = make(map[string]interface{})
 	}
+
+	if s.expires == nil {
+		s.expires = make(map[string]time.Time)
+	}
 	s.Unlock()
 }
 
+// expired returns whether or not the given key has expired. The caller must hold at least a read lock
+func (s *Storage) expired(name string) bool {
+	expiry, ok := s.expires[name]
+	return ok && !timeNow().Before(expiry)
+}
+
 func (s *Storage) set(name string, data interface{}) {
 	s.checkMap()
 	s.Lock()
 	s.data[name] = data
+	delete(s.expires, name)
+	s.changed()
 	s.Unlock()
 }
 
@@ -27,11 +69,37 @@ func (s *Storage) get(name string) (interface{}, bool) {
 	s.checkMap()
 	s.RLock()
 	defer s.RUnlock()
+
+	if s.expired(name) {
+		return nil, false
+	}
+
 	data, ok := s.data[name]
 
 	return data, ok // Cant just return data[testName] apparently
 }
 
+// update calls f with the current value stored at name, and replaces it with the result if f reports a change. Unlike
+// set, update does not clear any expiry on the value
+func (s *Storage) update(name string, f func(old interface{}) (interface{}, bool)) {
+	s.checkMap()
+	s.Lock()
+	defer s.Unlock()
+
+	if s.expired(name) {
+		delete(s.data, name)
+		delete(s.expires, name)
+	}
+
+	updated, changed := f(s.data[name])
+	if !changed {
+		return
+	}
+
+	s.data[name] = updated
+	s.changed()
+}
+
 // SetInt sets the int at `testName` to `data`
 func (s *Storage) SetInt(name string, i int) int {
 	s.set(name, i)
@@ -41,7 +109,9 @@ func (s *Storage) SetInt(name string, i int) int {
 // GetInt returns either the int stored at `testName` or a default
 func (s *Storage) GetInt(name string, def int) int {
 	if data, ok := s.get(name); ok {
-		return data.(int)
+		if i, ok := data.(int); ok {
+			return i
+		}
 	}
 
 	return def
@@ -56,7 +126,9 @@ func (s *Storage) SetBool(name string, data bool) bool {
 // GetBool returns either the bool stored at `testName` or a default
 func (s *Storage) GetBool(name string, def bool) bool {
 	if res, ok := s.get(name); ok {
-		return res.(bool)
+		if b, ok := res.(bool); ok {
+			return b
+		}
 	}
 
 	return def
@@ -71,16 +143,187 @@ func (s *Storage) SetString(name, data string) string {
 // GetString returns either the string stored at `testName` or a default
 func (s *Storage) GetString(name, def string) string {
 	if res, ok := s.get(name); ok {
-		return res.(string)
+		if str, ok := res.(string); ok {
+			return str
+		}
 	}
 
 	return def
 }
 
+// AppendList appends the given values to the list at `name`, creating it if needed, and returns the new list
+func (s *Storage) AppendList(name string, values ...string) []string {
+	var out []string
+
+	s.update(name, func(old interface{}) (interface{}, bool) {
+		list, _ := old.([]string)
+		list = append(list, values...)
+		out = append([]string(nil), list...)
+
+		return list, len(values) > 0
+	})
+
+	return out
+}
+
+// TrimList removes items from the start of the list at `name` until it is at most max items long, and returns the new
+// list
+func (s *Storage) TrimList(name string, max int) []string {
+	var out []string
+
+	s.update(name, func(old interface{}) (interface{}, bool) {
+		list, _ := old.([]string)
+		trimmed := max >= 0 && len(list) > max
+
+		if trimmed {
+			list = list[len(list)-max:]
+		}
+
+		out = append([]string(nil), list...)
+
+		return list, trimmed
+	})
+
+	return out
+}
+
+// GetList returns a copy of the list stored at `name`, or an empty list
+func (s *Storage) GetList(name string) []string {
+	if res, ok := s.get(name); ok {
+		if list, ok := res.([]string); ok {
+			return append([]string(nil), list...)
+		}
+	}
+
+	return nil
+}
+
+// ListLen returns the length of the list stored at `name`
+func (s *Storage) ListLen(name string) int {
+	return len(s.GetList(name))
+}
+
+// SetMapKey sets `key` to `value` on the map stored at `name`, creating it if needed
+func (s *Storage) SetMapKey(name, key, value string) string {
+	s.update(name, func(old interface{}) (interface{}, bool) {
+		m, ok := old.(map[string]string)
+		if !ok {
+			m = make(map[string]string)
+		}
+
+		if current, exists := m[key]; ok && exists && current == value {
+			return m, false
+		}
+
+		m[key] = value
+
+		return m, true
+	})
+
+	return value
+}
+
+// GetMapKey returns either the value at `key` on the map stored at `name`, or a default
+func (s *Storage) GetMapKey(name, key, def string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.expired(name) {
+		return def
+	}
+
+	if m, ok := s.data[name].(map[string]string); ok {
+		if res, ok := m[key]; ok {
+			return res
+		}
+	}
+
+	return def
+}
+
+// GetMap returns a copy of the map stored at `name`, or an empty map
+func (s *Storage) GetMap(name string) map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make(map[string]string)
+
+	if s.expired(name) {
+		return out
+	}
+
+	if m, ok := s.data[name].(map[string]string); ok {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// DeleteMapKey deletes `key` from the map stored at `name`. It will not error if either does not exist
+func (s *Storage) DeleteMapKey(name, key string) string {
+	s.update(name, func(old interface{}) (interface{}, bool) {
+		m, ok := old.(map[string]string)
+		if _, exists := m[key]; !ok || !exists {
+			return old, false
+		}
+
+		delete(m, key)
+
+		return m, true
+	})
+
+	return key
+}
+
+// Has returns whether or not an entry exists at `name`
+func (s *Storage) Has(name string) bool {
+	_, ok := s.get(name)
+	return ok
+}
+
+// Expire sets the entry at `name` to expire after the given number of seconds. Any value of 0 or less removes the
+// expiry. Setting a value with any of the Set methods also removes its expiry
+func (s *Storage) Expire(name string, seconds int) string {
+	s.checkMap()
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.data[name]; !exists || s.expired(name) {
+		return name
+	}
+
+	if seconds <= 0 {
+		delete(s.expires, name)
+	} else {
+		s.expires[name] = timeNow().Add(time.Second * time.Duration(seconds))
+	}
+
+	s.changed()
+
+	return name
+}
+
+// TTL returns the number of seconds until the entry at `name` expires, or -1 if it does not exist or has no expiry
+func (s *Storage) TTL(name string) int {
+	s.RLock()
+	defer s.RUnlock()
+
+	expiry, ok := s.expires[name]
+	if !ok || s.expired(name) {
+		return -1
+	}
+
+	return int(expiry.Sub(timeNow()).Seconds())
+}
+
 // Delete deletes an entry from the Storage, It will not error if the entry does not exist
 func (s *Storage) Delete(name string) string {
 	s.Lock()
 	delete(s.data, name)
+	delete(s.expires, name)
+	s.changed()
 	s.Unlock()
 
 	return name
@@ -0,0 +1,330 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Persister saves and loads the serialised form of a Storage
+type Persister interface {
+	// Load returns the last saved data, or nil if nothing has been saved yet
+	Load() ([]byte, error)
+	// Save saves the given data, replacing anything saved previously
+	Save(data []byte) error
+}
+
+// FilePersister is a Persister that saves to a single file. Writes are atomic, the data is written to a temporary file
+// which is then renamed over the original
+type FilePersister struct {
+	Path string
+}
+
+// Load implements Persister.Load
+func (f *FilePersister) Load() ([]byte, error) {
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// Save implements Persister.Save
+func (f *FilePersister) Save(data []byte) error {
+	dir := filepath.Dir(f.Path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(f.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // Will fail harmlessly if the rename worked
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// Types as stored in the serialised form of a Storage
+const (
+	storedInt    = "int"
+	storedBool   = "bool"
+	storedString = "string"
+	storedList   = "list"
+	storedMap    = "map"
+)
+
+type storedEntry struct {
+	Type    string          `json:"type"`
+	Value   json.RawMessage `json:"value"`
+	Expires *time.Time      `json:"expires,omitempty"`
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case int:
+		return storedInt
+	case bool:
+		return storedBool
+	case string:
+		return storedString
+	case []string:
+		return storedList
+	case map[string]string:
+		return storedMap
+	default:
+		return ""
+	}
+}
+
+func newForType(t string) (interface{}, error) {
+	switch t {
+	case storedInt:
+		return new(int), nil
+	case storedBool:
+		return new(bool), nil
+	case storedString:
+		return new(string), nil
+	case storedList:
+		return new([]string), nil
+	case storedMap:
+		return new(map[string]string), nil
+	default:
+		return nil, fmt.Errorf("unknown stored type %q", t)
+	}
+}
+
+// MarshalJSON implements json.Marshaler. Expired entries are not included
+func (s *Storage) MarshalJSON() ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.marshal()
+}
+
+// marshal does the actual work for MarshalJSON. The caller must hold at least a read lock
+func (s *Storage) marshal() ([]byte, error) {
+	out := make(map[string]storedEntry, len(s.data))
+
+	for name, v := range s.data {
+		if s.expired(name) {
+			continue
+		}
+
+		t := typeName(v)
+		if t == "" {
+			return nil, fmt.Errorf("cannot store %q, unsupported type %T", name, v)
+		}
+
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := storedEntry{Type: t, Value: raw}
+
+		if expiry, ok := s.expires[name]; ok {
+			expiry := expiry
+			entry.Expires = &expiry
+		}
+
+		out[name] = entry
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Any data currently on the Storage is replaced
+func (s *Storage) UnmarshalJSON(data []byte) error {
+	var in map[string]storedEntry
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	newData := make(map[string]interface{}, len(in))
+	newExpires := make(map[string]time.Time)
+
+	for name, entry := range in {
+		if entry.Expires != nil && !timeNow().Before(*entry.Expires) {
+			continue
+		}
+
+		target, err := newForType(entry.Type)
+		if err != nil {
+			return fmt.Errorf("cannot load %q: %w", name, err)
+		}
+
+		if err := json.Unmarshal(entry.Value, target); err != nil {
+			return fmt.Errorf("cannot load %q: %w", name, err)
+		}
+
+		switch v := target.(type) {
+		case *int:
+			newData[name] = *v
+		case *bool:
+			newData[name] = *v
+		case *string:
+			newData[name] = *v
+		case *[]string:
+			newData[name] = *v
+		case *map[string]string:
+			newData[name] = *v
+		}
+
+		if entry.Expires != nil {
+			newExpires[name] = *entry.Expires
+		}
+	}
+
+	s.Lock()
+	s.data = newData
+	s.expires = newExpires
+	s.Unlock()
+
+	return nil
+}
+
+// SetPersister sets the Persister to save the Storage to, and loads any data already saved by it. If nothing has been
+// saved yet, the current data is kept and saved. onError is called with any errors that occur while saving in the
+// background, and may be nil. A nil Persister disables saving
+func (s *Storage) SetPersister(p Persister, onError func(error)) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.Lock()
+	s.persister = p
+	s.onError = onError
+	s.Unlock()
+
+	if p == nil {
+		return nil
+	}
+
+	data, err := p.Load()
+	if err != nil {
+		return fmt.Errorf("could not load storage: %w", err)
+	}
+
+	if data == nil {
+		s.Lock()
+		s.changed()
+		s.Unlock()
+
+		return nil
+	}
+
+	if err := s.UnmarshalJSON(data); err != nil {
+		return fmt.Errorf("could not load storage: %w", err)
+	}
+
+	return nil
+}
+
+// changed marks the Storage as needing a save, and schedules one if needed. The caller must hold the write lock
+func (s *Storage) changed() {
+	s.dirty = true
+
+	if s.onChange != nil {
+		if s.changing {
+			s.rechange = true
+		} else {
+			s.changing = true
+			go s.runOnChange()
+		}
+	}
+
+	if s.persister == nil || s.saveTimer != nil {
+		return
+	}
+
+	s.saveTimer = time.AfterFunc(SaveDelay, func() {
+		s.Lock()
+		s.saveTimer = nil
+		onError := s.onError
+		s.Unlock()
+
+		if err := s.Flush(); err != nil && onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// runOnChange calls onChange until there are no changes that it has not seen, so that the last call always sees the
+// latest data
+func (s *Storage) runOnChange() {
+	for {
+		s.Lock()
+		f := s.onChange
+		s.rechange = false
+
+		if f == nil {
+			s.changing = false
+			s.Unlock()
+
+			return
+		}
+
+		s.Unlock()
+
+		f()
+
+		s.Lock()
+		again := s.rechange
+		s.changing = again
+		s.Unlock()
+
+		if !again {
+			return
+		}
+	}
+}
+
+// Flush saves the Storage to its Persister immediately if there are unsaved changes
+func (s *Storage) Flush() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.Lock()
+	if s.persister == nil || !s.dirty {
+		s.Unlock()
+		return nil
+	}
+
+	p := s.persister
+	data, err := s.marshal()
+	s.dirty = false
+	s.Unlock()
+
+	if err == nil {
+		err = p.Save(data)
+	}
+
+	if err != nil {
+		s.Lock()
+		s.dirty = true
+		s.Unlock()
+
+		return fmt.Errorf("could not save storage: %w", err)
+	}
+
+	return nil
+}
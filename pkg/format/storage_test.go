@@ -1,7 +1,14 @@
 package format
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // duplicate the map so individual tests dont mess with things
@@ -267,3 +274,298 @@ func TestStorage_SetString(t *testing.T) {
 		})
 	}
 }
+
+func TestStorage_Lists(t *testing.T) {
+	s := new(Storage)
+
+	s.AppendList("list", "a", "b")
+	s.AppendList("list", "c")
+
+	if got := s.GetList("list"); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("GetList() = %v, want [a b c]", got)
+	}
+
+	if got := s.TrimList("list", 2); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("TrimList() = %v, want [b c]", got)
+	}
+
+	if got := s.ListLen("list"); got != 2 {
+		t.Errorf("ListLen() = %d, want 2", got)
+	}
+
+	if got := s.GetList("doesn't exist"); got != nil {
+		t.Errorf("GetList() on a nonexistent list = %v, want nil", got)
+	}
+}
+
+func TestStorage_Maps(t *testing.T) {
+	s := new(Storage)
+
+	s.SetMapKey("seen", "someone", "yesterday")
+	s.SetMapKey("seen", "someoneElse", "today")
+	s.DeleteMapKey("seen", "someoneElse")
+
+	if got := s.GetMapKey("seen", "someone", "never"); got != "yesterday" {
+		t.Errorf("GetMapKey() = %q, want %q", got, "yesterday")
+	}
+
+	if got := s.GetMapKey("seen", "someoneElse", "never"); got != "never" {
+		t.Errorf("GetMapKey() on a deleted key = %q, want %q", got, "never")
+	}
+
+	if got := s.GetMap("seen"); !reflect.DeepEqual(got, map[string]string{"someone": "yesterday"}) {
+		t.Errorf("GetMap() = %v", got)
+	}
+}
+
+func TestStorage_noopUpdates(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func(s *Storage)
+	}{
+		{name: "delete key from missing map", do: func(s *Storage) { s.DeleteMapKey("missing", "key") }},
+		{name: "delete missing key", do: func(s *Storage) { s.DeleteMapKey("map", "missing") }},
+		{name: "set key to its current value", do: func(s *Storage) { s.SetMapKey("map", "key", "value") }},
+		{name: "append nothing to missing list", do: func(s *Storage) { s.AppendList("missing") }},
+		{name: "trim missing list", do: func(s *Storage) { s.TrimList("missing", 2) }},
+		{name: "trim short list", do: func(s *Storage) { s.TrimList("list", 2) }},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := new(Storage)
+			s.SetMapKey("map", "key", "value")
+			s.AppendList("list", "a")
+			s.dirty = false
+
+			tt.do(s)
+
+			if s.dirty {
+				t.Error("Storage was marked as changed")
+			}
+
+			if s.Has("missing") {
+				t.Error("an entry was created for a missing name")
+			}
+
+			if !s.Has("map") || !s.Has("list") {
+				t.Error("existing entries were lost")
+			}
+		})
+	}
+}
+
+func TestStorage_Expire(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	defer func() { timeNow = time.Now }()
+
+	s := new(Storage)
+	s.SetInt("counter", 1)
+	s.Expire("counter", 10)
+
+	if got := s.TTL("counter"); got != 10 {
+		t.Errorf("TTL() = %d, want 10", got)
+	}
+
+	s.AppendList("list", "a")
+	s.Expire("list", 5)
+	s.AppendList("list", "b")
+
+	if got := s.TTL("list"); got != 5 {
+		t.Errorf("TTL() after a list append = %d, want 5", got)
+	}
+
+	now = now.Add(time.Second * 10)
+
+	if s.Has("counter") {
+		t.Error("Has() returned true for an expired key")
+	}
+
+	if got := s.GetInt("counter", 1337); got != 1337 {
+		t.Errorf("GetInt() on an expired key = %d, want 1337", got)
+	}
+
+	if got := s.AppendList("list", "c"); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("AppendList() on an expired list = %v, want [c]", got)
+	}
+
+	s.SetString("string", "test")
+	s.Expire("string", 5)
+	s.SetString("string", "test")
+
+	if got := s.TTL("string"); got != -1 {
+		t.Errorf("TTL() after a Set = %d, want -1", got)
+	}
+}
+
+func TestStorage_Persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gggbStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	p := &FilePersister{Path: filepath.Join(dir, "nested", "storage.json")}
+
+	s := new(Storage)
+	s.SetInt("int", 1)
+
+	if err := s.SetPersister(p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.SetPersister(nil, nil) //nolint:errcheck // Cant error with a nil Persister
+
+	s.SetString("string", "test")
+	s.SetBool("bool", true)
+	s.AppendList("list", "a", "b")
+	s.SetMapKey("map", "key", "value")
+	s.SetInt("expiring", 2)
+	s.Expire("expiring", 1000)
+	s.SetInt("expired", 3)
+	s.Expire("expired", 1)
+
+	now := time.Now().Add(time.Second * 2)
+	timeNow = func() time.Time { return now }
+
+	defer func() { timeNow = time.Now }()
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := new(Storage)
+	if err := loaded.SetPersister(p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"int":      1,
+		"string":   "test",
+		"bool":     true,
+		"list":     []string{"a", "b"},
+		"map":      map[string]string{"key": "value"},
+		"expiring": 2,
+	}
+
+	if !reflect.DeepEqual(loaded.data, want) {
+		t.Errorf("loaded storage = %#v, want %#v", loaded.data, want)
+	}
+
+	if got := loaded.TTL("expiring"); got < 990 || got > 1000 {
+		t.Errorf("TTL() on a loaded key = %d, want ~998", got)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(p.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("expected only the storage file to exist, got %d files", len(files))
+	}
+}
+
+func TestStorage_SaveDelay(t *testing.T) {
+	oldDelay := SaveDelay
+	SaveDelay = time.Millisecond
+
+	defer func() { SaveDelay = oldDelay }()
+
+	p := &memoryPersister{saved: make(chan []byte, 10)}
+	s := new(Storage)
+
+	if err := s.SetPersister(p, func(err error) { t.Error(err) }); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetInt("test", 1)
+
+	timeout := time.After(time.Second * 5)
+
+	for {
+		select {
+		case data := <-p.saved:
+			if strings.Contains(string(data), `"test"`) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("storage was not saved after a change")
+		}
+	}
+}
+
+func TestStorage_OnChange(t *testing.T) {
+	s := new(Storage)
+	changes := make(chan int, 10)
+
+	s.OnChange(func() { changes <- s.GetInt("test", 0) })
+	s.GetInt("test", 0)
+	s.SetInt("test", 1)
+
+	select {
+	case got := <-changes:
+		if got != 1 {
+			t.Errorf("OnChange saw %d, want 1", got)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("OnChange was not called after a change")
+	}
+
+	select {
+	case <-changes:
+		t.Error("OnChange was called more than once")
+	case <-time.After(time.Millisecond * 20):
+	}
+}
+
+func TestStorage_OnChange_serialised(t *testing.T) {
+	s := new(Storage)
+	seen := make(chan int, 100)
+	running := int32(0)
+
+	s.OnChange(func() {
+		if atomic.AddInt32(&running, 1) != 1 {
+			t.Error("OnChange calls overlapped")
+		}
+
+		time.Sleep(time.Millisecond * 5)
+		seen <- s.GetInt("test", 0)
+		atomic.AddInt32(&running, -1)
+	})
+
+	for i := 1; i <= 20; i++ {
+		s.SetInt("test", i)
+	}
+
+	// Every change is followed by a call that sees it, so the last call must see the last value
+	for {
+		select {
+		case got := <-seen:
+			if got == 20 {
+				return
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("OnChange never saw the last change")
+		}
+	}
+}
+
+type memoryPersister struct {
+	saved chan []byte
+}
+
+func (m *memoryPersister) Load() ([]byte, error) { return nil, nil }
+
+func (m *memoryPersister) Save(data []byte) error {
+	select {
+	case m.saved <- data:
+	default:
+	}
+
+	return nil
+}
@@ -0,0 +1,2 @@
+// Package metrics contains a minimal metrics registry that can be exposed in the Prometheus text format
+package metrics
@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types
+const (
+	CounterType = "counter"
+	GaugeType   = "gauge"
+)
+
+// Sample is a single value of a metric, with the values for its labels
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type metric interface {
+	describe() (name, help, metricType string, labels []string)
+	samples() []Sample
+}
+
+// Registry holds a set of metrics, and writes them out in the Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry creates a new, empty, Registry
+func NewRegistry() *Registry { return &Registry{} }
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// vec holds values for a metric, keyed on its label values
+type vec struct {
+	name       string
+	help       string
+	metricType string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+func newVec(name, help, metricType string, labels []string) *vec {
+	return &vec{name: name, help: help, metricType: metricType, labels: labels, values: make(map[string]*Sample)}
+}
+
+func (v *vec) describe() (name, help, metricType string, labels []string) {
+	return v.name, v.help, v.metricType, v.labels
+}
+
+func (v *vec) get(labelValues []string) *Sample {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\x00")
+
+	s, ok := v.values[key]
+	if !ok {
+		s = &Sample{LabelValues: append([]string(nil), labelValues...)}
+		v.values[key] = s
+	}
+
+	return s
+}
+
+func (v *vec) samples() []Sample {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	out := make([]Sample, 0, len(v.values))
+	for _, s := range v.values {
+		out = append(out, *s)
+	}
+
+	return out
+}
+
+// Counter is a value that only ever increases, split by labels
+type Counter struct{ *vec }
+
+// NewCounter creates a Counter on the registry with the given labels
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(name, help, CounterType, labels)}
+	r.add(c)
+
+	return c
+}
+
+// Inc increments the counter with the given label values by one
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds the given value, which must not be negative, to the counter with the given label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(labelValues).Value += value
+}
+
+// Gauge is a value that can go up and down, split by labels
+type Gauge struct{ *vec }
+
+// NewGauge creates a Gauge on the registry with the given labels
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(name, help, GaugeType, labels)}
+	r.add(g)
+
+	return g
+}
+
+// Set sets the gauge with the given label values to the given value
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(labelValues).Value = value
+}
+
+// funcMetric is a metric whose samples are collected by a function when the registry is written out
+type funcMetric struct {
+	name       string
+	help       string
+	metricType string
+	labels     []string
+	f          func() []Sample
+}
+
+func (f *funcMetric) describe() (name, help, metricType string, labels []string) {
+	return f.name, f.help, f.metricType, f.labels
+}
+
+func (f *funcMetric) samples() []Sample { return f.f() }
+
+// NewFunc adds a metric of the given type whose samples are collected by calling f each time the registry is
+// written out. The samples returned must have a value for each label
+func (r *Registry) NewFunc(name, help, metricType string, labels []string, f func() []Sample) {
+	r.add(&funcMetric{name: name, help: help, metricType: metricType, labels: labels, f: f})
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	out := strings.Builder{}
+	out.WriteByte('{')
+
+	for i, name := range names {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+
+		out.WriteString(name)
+		out.WriteString(`="`)
+		out.WriteString(labelEscaper.Replace(values[i]))
+		out.WriteByte('"')
+	}
+
+	out.WriteByte('}')
+
+	return out.String()
+}
+
+// WriteText writes all metrics on the registry to w in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		a, _, _, _ := metrics[i].describe()
+		b, _, _, _ := metrics[j].describe()
+
+		return a < b
+	})
+
+	out := strings.Builder{}
+
+	for _, m := range metrics {
+		name, help, metricType, labels := m.describe()
+		samples := m.samples()
+
+		sort.Slice(samples, func(i, j int) bool {
+			return strings.Join(samples[i].LabelValues, "\x00") < strings.Join(samples[j].LabelValues, "\x00")
+		})
+
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, metricType)
+
+		for _, s := range samples {
+			if len(s.LabelValues) != len(labels) {
+				return fmt.Errorf("metrics: sample for %s has %d label values, want %d", name, len(s.LabelValues), len(labels))
+			}
+
+			fmt.Fprintf(&out, "%s%s %s\n", name, formatLabels(labels, s.LabelValues), formatValue(s.Value))
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+
+	return err
+}
+
+// Handler returns an http.Handler that serves the registry's metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
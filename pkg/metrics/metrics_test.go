@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounter("test_total", "A test counter", "game")
+	c.Inc("b")
+	c.Inc("a")
+	c.Add(2.5, "a")
+
+	g := r.NewGauge("test_gauge", "A test\ngauge")
+	g.Set(-1)
+
+	r.NewFunc("test_func", "A test func", GaugeType, []string{"name"}, func() []Sample {
+		return []Sample{{LabelValues: []string{`quote " and \ slash`}, Value: 1}}
+	})
+
+	out := strings.Builder{}
+	if err := r.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_func A test func
+# TYPE test_func gauge
+test_func{name="quote \" and \\ slash"} 1
+# HELP test_gauge A test\ngauge
+# TYPE test_gauge gauge
+test_gauge -1
+# HELP test_total A test counter
+# TYPE test_total counter
+test_total{game="a"} 3.5
+test_total{game="b"} 1
+`
+
+	if out.String() != want {
+		t.Errorf("WriteText() = \n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRegistry_WriteTextBadFunc(t *testing.T) {
+	r := NewRegistry()
+	r.NewFunc("bad", "bad labels", GaugeType, []string{"a", "b"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"a"}}}
+	})
+
+	if err := r.WriteText(&strings.Builder{}); err == nil {
+		t.Error("WriteText() did not error with a sample with missing labels")
+	}
+}
+
+func TestCounter_panics(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(c *Counter)
+	}{
+		{name: "negative", f: func(c *Counter) { c.Add(-1, "a") }},
+		{name: "wrong labels", f: func(c *Counter) { c.Inc("a", "b") }},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+
+			tt.f(NewRegistry().NewCounter("test", "test", "label"))
+		})
+	}
+}
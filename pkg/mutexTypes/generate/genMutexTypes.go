@@ -10,6 +10,7 @@ import (
 var toGen = [][]string{
 	{"Bool", "bool"},
 	{"Int", "int"},
+	{"String", "string"},
 	{"StringSlice", "[]string"},
 	{"Duration", "time.Duration"},
 	{"Time", "time.Time"},
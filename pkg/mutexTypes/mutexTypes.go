@@ -48,6 +48,26 @@ func (x *Int) Set(thing int) {
 	x.m.Unlock()
 }
 
+// String is a string wrapped with a sync.RWMutex.
+type String struct {
+	x string
+	m sync.RWMutex
+}
+
+// Get fetches the stored value in a concurrent safe manner
+func (x *String) Get() string {
+	x.m.RLock()
+	defer x.m.RUnlock()
+	return x.x
+}
+
+// Set sets the stored value in a concurrent safe manner
+func (x *String) Set(thing string) {
+	x.m.Lock()
+	x.x = thing
+	x.m.Unlock()
+}
+
 // StringSlice is a []string wrapped with a sync.RWMutex.
 type StringSlice struct {
 	x []string
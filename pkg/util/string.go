@@ -61,6 +61,17 @@ func IdxOrEmpty(slice []string, idx int) string {
 	return ""
 }
 
+// ContainsFold returns whether or not the given slice contains s, ignoring case
+func ContainsFold(slice []string, s string) bool {
+	for _, entry := range slice {
+		if strings.EqualFold(entry, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // JoinToMaxLength takes a string slice and joins it on sep until the joined string cannot be made larger without
 // crossing maxLength length. If any entry in the slice to be joined is larger than maxLength, it will be added on its
 // own to an entry in the resulting slice
@@ -239,6 +239,29 @@ func TestIdxOrEmpty(t *testing.T) {
 	}
 }
 
+func TestContainsFold(t *testing.T) {
+	tests := []struct {
+		name  string
+		slice []string
+		s     string
+		want  bool
+	}{
+		{"exact", []string{"one", "two"}, "two", true},
+		{"case", []string{"one", "two"}, "TWO", true},
+		{"missing", []string{"one", "two"}, "three", false},
+		{"empty", nil, "one", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainsFold(tt.slice, tt.s); got != tt.want {
+				t.Errorf("ContainsFold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func ExampleIdxOrEmpty() {
 	s := []string{"test", "string", "is", "testy"}
 
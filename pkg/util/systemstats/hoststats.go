@@ -3,6 +3,7 @@ package systemstats
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"strconv"
 	"strings"
@@ -61,6 +62,44 @@ func getGoStats() string {
 	return out.String()
 }
 
+// Stats holds numeric statistics about the bot and the system it is running on. Values that could not be read are NaN
+type Stats struct {
+	CPUPercent     float64
+	MemoryUsed     float64
+	MemoryTotal    float64
+	BotMemory      float64
+	Goroutines     float64
+	BotVersion     string
+	RuntimeVersion string
+}
+
+// Collect returns the current statistics for the bot and the system. CPU usage is measured since the last call
+func Collect() Stats {
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+
+	out := Stats{
+		CPUPercent:     math.NaN(),
+		MemoryUsed:     math.NaN(),
+		MemoryTotal:    math.NaN(),
+		BotMemory:      float64(memstats.Sys),
+		Goroutines:     float64(runtime.NumGoroutine()),
+		BotVersion:     version.Version,
+		RuntimeVersion: runtime.Version(),
+	}
+
+	if h, err := cpu.Percent(0, false); err == nil && len(h) > 0 {
+		out.CPUPercent = h[0]
+	}
+
+	if m, err := mem.VirtualMemory(); err == nil {
+		out.MemoryUsed = float64(m.Used)
+		out.MemoryTotal = float64(m.Total)
+	}
+
+	return out
+}
+
 // GetStats returns a string containing statistics of the currently running bot, and the system as a whole
 func GetStats() string {
 	return fmt.Sprintf("Bot: %s System: %s Go: %s", getBotUsageStats(), getSystemUsageStats(), getGoStats())